@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gotest.tools/gotestsum/internal/log"
+)
+
+// changedSinceState is the result of selecting packages with --changed-since.
+type changedSinceState struct {
+	ref string
+	// selected is the list of packages which were changed, or depend on a
+	// package which was changed.
+	selected []string
+	// total is the number of packages matched by the package patterns.
+	total int
+}
+
+// selectChangedPackages replaces opts.packages with the list of packages that
+// have changed since the git ref, and the packages that depend on them.
+func selectChangedPackages(opts *options) (*changedSinceState, error) {
+	if opts.changedSince == "" {
+		return nil, nil
+	}
+	root, files, err := gitChangedFilesFn(opts.changedSince)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list files changed since %v: %w", opts.changedSince, err)
+	}
+
+	pkgs := cmdArgPackageList(opts, rerunOpts{}, "./...")
+	raw, err := goListFn(pkgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+	listed, err := decodeGoListPackages(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	changed := changedPackages(listed, root, files, opts.changedSinceExtraMap.Value())
+	selected, deps := selectedPackageDeps(listed)
+	state := &changedSinceState{ref: opts.changedSince, total: len(selected)}
+	for _, pkg := range selected {
+		for _, dep := range deps[pkg.ImportPath] {
+			if changed[dep] {
+				state.selected = append(state.selected, pkg.ImportPath)
+				break
+			}
+		}
+	}
+	log.Debugf("changed-since: %d changed packages, %d of %d packages selected",
+		len(changed), len(state.selected), state.total)
+	opts.packages = state.selected
+	return state, nil
+}
+
+// changedPackages returns the import paths of the packages which contain any
+// of the files. Files are mapped to the package in the nearest parent
+// directory, so that files in a testdata directory are mapped to the package
+// that uses them. Files that are not in a package directory are ignored,
+// unless they match a glob in extraMap.
+func changedPackages(listed []goListPackage, root string, files []string, extraMap []fileMapping) map[string]bool {
+	root = realPath(root)
+	dirs := make(map[string]string)
+	for _, pkg := range listed {
+		if pkg.Standard || pkg.Dir == "" || isTestPackage(pkg) {
+			continue
+		}
+		dirs[realPath(pkg.Dir)] = pkg.ImportPath
+	}
+
+	changed := make(map[string]bool)
+	for _, file := range files {
+		dir := path.Dir(file)
+		if mapped, ok := matchFileMapping(file, extraMap); ok {
+			if mapped == "" {
+				log.Debugf("changed-since: ignoring %v", file)
+				continue
+			}
+			dir = mapped
+		}
+
+		name, ok := packageForDir(dirs, root, filepath.Join(root, filepath.FromSlash(dir)))
+		if !ok {
+			log.Debugf("changed-since: ignoring %v, not in a package", file)
+			continue
+		}
+		changed[name] = true
+	}
+	return changed
+}
+
+// matchFileMapping returns the directory that file is mapped to by the first
+// glob in mappings that matches either the path of the file, or its base
+// name.
+func matchFileMapping(file string, mappings []fileMapping) (string, bool) {
+	for _, m := range mappings {
+		if ok, _ := path.Match(m.glob, file); ok {
+			return m.dir, true
+		}
+		if ok, _ := path.Match(m.glob, path.Base(file)); ok {
+			return m.dir, true
+		}
+	}
+	return "", false
+}
+
+// packageForDir returns the import path of the package in dir, or in the
+// nearest parent of dir that is not above root.
+func packageForDir(dirs map[string]string, root string, dir string) (string, bool) {
+	for {
+		if name, ok := dirs[dir]; ok {
+			return name, true
+		}
+		parent := filepath.Dir(dir)
+		if dir == root || parent == dir || !strings.HasPrefix(parent, root) {
+			return "", false
+		}
+		dir = parent
+	}
+}
+
+// realPath returns path with any symlinks resolved, so that the paths from git
+// and go list can be compared.
+func realPath(path string) string {
+	if resolved, err := filepath.EvalSymlinks(path); err == nil {
+		return resolved
+	}
+	return filepath.Clean(path)
+}
+
+// gitChangedFilesFn is a shim for testing
+var gitChangedFilesFn = gitChangedFiles
+
+// gitChangedFiles returns the root of the git repository, and the paths of the
+// files that are different from ref, relative to the root.
+func gitChangedFiles(ref string) (string, []string, error) {
+	root, err := gitOutput("rev-parse", "--show-toplevel")
+	if err != nil {
+		return "", nil, err
+	}
+	out, err := gitOutput("diff", "--name-only", ref, "--")
+	if err != nil {
+		return "", nil, err
+	}
+	var files []string
+	for _, line := range strings.Split(out, "\n") {
+		if line != "" {
+			files = append(files, line)
+		}
+	}
+	return root, files, nil
+}
+
+func gitOutput(args ...string) (string, error) {
+	log.Debugf("exec: git %s", args)
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func writeChangedSinceSummary(out io.Writer, state *changedSinceState) {
+	if state == nil {
+		return
+	}
+	fmt.Fprintf(out, "\n=== Changed since %v: %d of %d packages selected\n",
+		state.ref, len(state.selected), state.total)
+}
@@ -0,0 +1,117 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+	"gotest.tools/v3/fs"
+)
+
+func TestRun_ChangedSince(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithDir("one", fs.WithDir("testdata")),
+		fs.WithDir("two"),
+		fs.WithDir("three"),
+		fs.WithDir("helper"))
+
+	listed := []goListPackage{
+		{ImportPath: "fmt", Standard: true, DepOnly: true},
+		{ImportPath: "example.com/helper", Dir: dir.Join("helper"), DepOnly: true},
+		{ImportPath: "example.com/one", Dir: dir.Join("one"), Deps: []string{"fmt"}},
+		{ImportPath: "example.com/two", Dir: dir.Join("two"), Deps: []string{"example.com/one"}},
+		{ImportPath: "example.com/three", Dir: dir.Join("three")},
+		{
+			ImportPath: "example.com/three.test",
+			Deps:       []string{"example.com/helper", "example.com/three [example.com/three.test]"},
+		},
+	}
+	origGoList := goListFn
+	goListFn = func(pkgs []string) ([]byte, error) {
+		assert.DeepEqual(t, pkgs, []string{"./..."})
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		for _, pkg := range listed {
+			assert.NilError(t, enc.Encode(pkg))
+		}
+		return buf.Bytes(), nil
+	}
+	t.Cleanup(func() { goListFn = origGoList })
+
+	var changed []string
+	origGitChangedFiles := gitChangedFilesFn
+	gitChangedFilesFn = func(ref string) (string, []string, error) {
+		assert.Equal(t, ref, "origin/main")
+		return dir.Path(), changed, nil
+	}
+	t.Cleanup(func() { gitChangedFilesFn = origGitChangedFiles })
+
+	var calls [][]string
+	fn := func(args []string) *proc {
+		calls = append(calls, args)
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(""),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	runOnce := func(extraMap ...string) string {
+		out := new(bytes.Buffer)
+		opts := &options{
+			format:               "none",
+			changedSince:         "origin/main",
+			changedSinceExtraMap: &fileMapValue{},
+			stdout:               out,
+			stderr:               os.Stderr,
+			hideSummary:          &hideSummaryValue{value: testjson.SummarizeNone},
+		}
+		for _, m := range extraMap {
+			assert.NilError(t, opts.changedSinceExtraMap.Set(m))
+		}
+		assert.NilError(t, run(opts))
+		return out.String()
+	}
+
+	t.Run("testdata and reverse dependencies", func(t *testing.T) {
+		calls = nil
+		changed = []string{"one/testdata/fixture.json", "README.md"}
+		out := runOnce()
+		assert.Equal(t, len(calls), 1)
+		assert.DeepEqual(t, calls[0],
+			[]string{"go", "test", "-json", "example.com/one", "example.com/two"})
+		assert.Assert(t, cmp.Contains(out, "=== Changed since origin/main: 2 of 3 packages selected"))
+	})
+
+	t.Run("test dependencies", func(t *testing.T) {
+		calls = nil
+		changed = []string{"helper/helper.go"}
+		runOnce()
+		assert.Equal(t, len(calls), 1)
+		assert.DeepEqual(t, calls[0], []string{"go", "test", "-json", "example.com/three"})
+	})
+
+	t.Run("extra map", func(t *testing.T) {
+		calls = nil
+		changed = []string{"config/settings.yaml", "two/README.md"}
+		runOnce("config/*.yaml=three", "*.md=")
+		assert.Equal(t, len(calls), 1)
+		assert.DeepEqual(t, calls[0], []string{"go", "test", "-json", "example.com/three"})
+	})
+
+	t.Run("no packages changed", func(t *testing.T) {
+		calls = nil
+		changed = []string{"README.md"}
+		out := runOnce()
+		assert.Equal(t, len(calls), 0)
+		assert.Assert(t, cmp.Contains(out, "No packages changed since origin/main"))
+		assert.Assert(t, cmp.Contains(out, "=== Changed since origin/main: 0 of 3 packages selected"))
+	})
+}
@@ -0,0 +1,25 @@
+package cmd
+
+import (
+	"io"
+	"os"
+
+	"github.com/fatih/color"
+	"golang.org/x/term"
+)
+
+// consoleFile returns the file that out writes to, or false if out does not
+// write to a file. color.Output wraps os.Stdout, and is not an *os.File on
+// windows.
+func consoleFile(out io.Writer) (*os.File, bool) {
+	if out == color.Output {
+		return os.Stdout, true
+	}
+	f, ok := out.(*os.File)
+	return f, ok
+}
+
+// stdinIsTerminal returns true if the stdin of gotestsum is a terminal.
+func stdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import "os"
+
+// enableVirtualTerminal does nothing, terminals on other platforms always
+// process escape sequences.
+func enableVirtualTerminal(_ *os.File) bool {
+	return true
+}
@@ -0,0 +1,23 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/fatih/color"
+	"gotest.tools/v3/assert"
+)
+
+func TestConsoleFile(t *testing.T) {
+	f, ok := consoleFile(color.Output)
+	assert.Assert(t, ok)
+	assert.Equal(t, f, os.Stdout)
+
+	f, ok = consoleFile(os.Stderr)
+	assert.Assert(t, ok)
+	assert.Equal(t, f, os.Stderr)
+
+	_, ok = consoleFile(new(bytes.Buffer))
+	assert.Assert(t, !ok)
+}
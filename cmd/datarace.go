@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"gotest.tools/gotestsum/testjson"
+)
+
+// applyRaceExitCode returns an error with the --race-exit-code in place of the
+// exit error from 'go test' when every unexpected failure reported a data race.
+func applyRaceExitCode(opts *options, exec *testjson.Execution, exitErr error) error {
+	if opts.raceExitCode == 0 || exitErr == nil || !IsExitCoder(exitErr) || isInterrupted(exitErr) {
+		return exitErr
+	}
+	if ExitCodeWithDefault(exitErr) != 1 || !onlyDataRacesFailed(opts, exec) {
+		return exitErr
+	}
+	return exitError{num: opts.raceExitCode}
+}
+
+// onlyDataRacesFailed returns true when at least one test reported a data
+// race, and every other failure was expected by --expected-fails-file, or
+// passed when it was rerun. A parent test which failed because of a failed
+// subtest is not counted. A package failure without a failed test, or an
+// error, is a failure that did not race.
+func onlyDataRacesFailed(opts *options, exec *testjson.Execution) bool {
+	if len(exec.Errors()) > 0 {
+		return false
+	}
+	isExpected := opts.expectedFails.isExpectedFailure(exec)
+	var raced bool
+	for _, tc := range testjson.FilterFailedUnique(exec.Failed()) {
+		switch {
+		case tc.Test == "":
+			return false
+		case isExpected != nil && isExpected(tc):
+		case passedOnRerun(exec, tc):
+		case isRaced(exec, tc):
+			raced = true
+		default:
+			return false
+		}
+	}
+	return raced
+}
+
+func isRaced(exec *testjson.Execution, tc testjson.TestCase) bool {
+	for _, r := range exec.Package(tc.Package).Raced() {
+		if r.ID == tc.ID {
+			return true
+		}
+	}
+	return false
+}
+
+// passedOnRerun returns true if the test in tc passed in a later run.
+func passedOnRerun(exec *testjson.Execution, tc testjson.TestCase) bool {
+	for _, passed := range exec.Package(tc.Package).Passed {
+		if passed.Test == tc.Test && passed.RunID > tc.RunID {
+			return true
+		}
+	}
+	return false
+}
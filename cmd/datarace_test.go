@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestRun_RaceExitCode(t *testing.T) {
+	type testCase struct {
+		name     string
+		output   string
+		expected int
+	}
+	run := func(t *testing.T, tc testCase) {
+		fn := func(args []string) *proc {
+			return &proc{
+				cmd:    fakeWaiter{result: newExitCode("failed", 1)},
+				stdout: strings.NewReader(tc.output),
+				stderr: bytes.NewReader(nil),
+			}
+		}
+		reset := patchStartGoTestFn(fn)
+		defer reset()
+
+		out := new(bytes.Buffer)
+		opts := &options{
+			format:           "testname",
+			raceExitCode:     3,
+			summaryDataRaces: true,
+			stdout:           out,
+			stderr:           os.Stderr,
+			hideSummary:      newHideSummaryValue(),
+		}
+		err := run(opts)
+		assert.Equal(t, ExitCodeWithDefault(err), tc.expected)
+	}
+
+	testCases := []testCase{
+		{
+			name: "data race",
+			output: `{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "output", "Output": "WARNING: DATA RACE\n"}
+{"Package": "pkg", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`,
+			expected: 3,
+		},
+		{
+			name: "data race in a subtest",
+			output: `{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA/sub", "Action": "run"}
+{"Package": "pkg", "Test": "TestA/sub", "Action": "output", "Output": "WARNING: DATA RACE\n"}
+{"Package": "pkg", "Test": "TestA/sub", "Action": "fail"}
+{"Package": "pkg", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`,
+			expected: 3,
+		},
+		{
+			name: "data race and a failure without a data race",
+			output: `{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "output", "Output": "WARNING: DATA RACE\n"}
+{"Package": "pkg", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg", "Test": "TestB", "Action": "run"}
+{"Package": "pkg", "Test": "TestB", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`,
+			expected: 1,
+		},
+		{
+			name: "failure without a data race",
+			output: `{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`,
+			expected: 1,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestRun_SummaryDataRaces(t *testing.T) {
+	fn := func(args []string) *proc {
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "output", "Output": "WARNING: DATA RACE\n"}
+{"Package": "pkg", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		format:           "testname",
+		summaryDataRaces: true,
+		stdout:           out,
+		stderr:           os.Stderr,
+		hideSummary:      newHideSummaryValue(),
+	}
+	err := run(opts)
+	assert.Equal(t, ExitCodeWithDefault(err), 1)
+	assert.Assert(t, cmp.Contains(out.String(), "=== DATA RACE: pkg TestA"))
+	assert.Assert(t, cmp.Contains(out.String(), "DONE 1 tests, 1 data race in"))
+}
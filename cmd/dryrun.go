@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+)
+
+// writeDryRun prints the go test command that would be run, and the steps
+// which can not be predicted before the tests run.
+func writeDryRun(opts *options) error {
+	args := goTestCmdArgs(opts, rerunOpts{})
+	if opts.shuffleIterations > 0 {
+		fmt.Fprintf(opts.stdout, "Dry run, the tests would be run %d times with -shuffle=on using:\n",
+			opts.shuffleIterations)
+	} else {
+		fmt.Fprintln(opts.stdout, "Dry run, the tests would be run using:")
+	}
+	fmt.Fprintln(opts.stdout, formatCommand(args))
+
+	if opts.rerunFailsMaxAttempts > 0 {
+		fmt.Fprintf(opts.stdout, "\nFailed tests would be rerun up to %d times. The reruns depend on "+
+			"which tests fail, so they can not be listed by --dry-run.\n",
+			opts.rerunFailsMaxAttempts)
+	}
+	return nil
+}
+
+// formatCommand returns args as a single string which can be copied to a
+// shell. Any argument with characters that are special to a shell is quoted.
+func formatCommand(args []string) string {
+	quoted := make([]string, 0, len(args))
+	for _, arg := range args {
+		if arg == "" || strings.ContainsAny(arg, " \t\n\"'\\$`|&;<>()*?[]{}^~#!") {
+			arg = "'" + strings.Replace(arg, "'", `'\''`, -1) + "'"
+		}
+		quoted = append(quoted, arg)
+	}
+	return strings.Join(quoted, " ")
+}
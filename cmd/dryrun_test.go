@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRun_DryRun(t *testing.T) {
+	reset := patchStartGoTestFn(func(args []string) *proc {
+		t.Fatalf("go test should not be run, got %v", args)
+		return nil
+	})
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		dryRun:                       true,
+		args:                         []string{"-run", "TestOne|TestTwo", "-tags", "integration"},
+		packages:                     []string{"./cmd/...", "./testjson"},
+		rerunFailsMaxAttempts:        2,
+		rerunFailsMaxInitialFailures: 10,
+		hideSummary:                  newHideSummaryValue(),
+		stdout:                       out,
+	}
+	assert.NilError(t, run(opts))
+
+	expected := `Dry run, the tests would be run using:
+go test -json -run 'TestOne|TestTwo' -tags integration ./cmd/... ./testjson
+
+Failed tests would be rerun up to 2 times. The reruns depend on which tests fail, so they can not be listed by --dry-run.
+`
+	assert.Equal(t, out.String(), expected)
+}
+
+func TestFormatCommand(t *testing.T) {
+	args := []string{"go", "test", "-run=^TestOne$", "", "it's", "./..."}
+	assert.Equal(t, formatCommand(args), `go test '-run=^TestOne$' '' 'it'\''s' ./...`)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gotest.tools/gotestsum/testjson"
+)
+
+// writeErrorsFile writes one line for each test failure to opts.errorsFile,
+// in the form "path/to/file_test.go:42: TestName: message". The path is
+// relative to the working directory, so that editors can open the file. The
+// file is rewritten on every run, and is empty when no tests failed.
+//
+// Failures with no file:line reference in their output are omitted. This
+// includes most root tests which failed because of a failed subtest, because
+// the subtest is written instead.
+func writeErrorsFile(opts *options, exec *testjson.Execution) error {
+	if opts.errorsFile == "" || exec == nil {
+		return nil
+	}
+	source := &testjson.FailureSource{PackageDir: newPackageDirs().lookup}
+	isExpected := opts.expectedFails.isExpectedFailure(exec)
+	cwd, _ := os.Getwd()
+
+	buf := new(bytes.Buffer)
+	for _, tc := range exec.Failed() {
+		if isExpected != nil && isExpected(tc) {
+			continue
+		}
+		loc, ok := source.Location(exec, tc)
+		if !ok {
+			continue
+		}
+		buf.WriteString(formatErrorLine(cwd, tc, loc))
+	}
+
+	_ = os.MkdirAll(filepath.Dir(opts.errorsFile), 0o755)
+	return ioutil.WriteFile(opts.errorsFile, buf.Bytes(), 0o644)
+}
+
+func formatErrorLine(cwd string, tc testjson.TestCase, loc testjson.FailureLocation) string {
+	path := loc.File
+	if filepath.IsAbs(path) && cwd != "" {
+		if rel, err := filepath.Rel(cwd, path); err == nil {
+			path = rel
+		}
+	}
+	parts := []string{fmt.Sprintf("%s:%d", path, loc.Line)}
+	if name := tc.Test.Name(); name != "" {
+		parts = append(parts, name)
+	}
+	if loc.Message != "" {
+		parts = append(parts, loc.Message)
+	}
+	return strings.Join(parts, ": ") + "\n"
+}
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestWriteErrorsFile(t *testing.T) {
+	cwd, err := os.Getwd()
+	assert.NilError(t, err)
+	defer func(orig func(string) (string, error)) {
+		goListPackageDirFn = orig
+	}(goListPackageDirFn)
+	goListPackageDirFn = func(pkg string) (string, error) {
+		return filepath.Join(cwd, "testdata", pkg), nil
+	}
+
+	out := `{"Package": "one", "Test": "TestTable", "Action": "run"}
+{"Package": "one", "Test": "TestTable/case_1", "Action": "run"}
+{"Package": "one", "Test": "TestTable/case_1", "Action": "output", "Output": "    table_test.go:21: got 1, want 2\n"}
+{"Package": "one", "Test": "TestTable/case_1", "Action": "fail"}
+{"Package": "one", "Test": "TestTable", "Action": "fail"}
+{"Package": "one", "Test": "TestOther", "Action": "run"}
+{"Package": "one", "Test": "TestOther", "Action": "output", "Output": "    other_test.go:8: \n"}
+{"Package": "one", "Test": "TestOther", "Action": "fail"}
+{"Package": "one", "Action": "fail"}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+
+	dir := fs.NewDir(t, t.Name(), fs.WithFile("quickfix.txt", "stale.go:1: TestStale\n"))
+	opts := &options{errorsFile: dir.Join("quickfix.txt")}
+	assert.NilError(t, writeErrorsFile(opts, exec))
+
+	raw, err := ioutil.ReadFile(opts.errorsFile)
+	assert.NilError(t, err)
+	expected := filepath.Join("testdata", "one", "table_test.go") + ":21: TestTable/case_1: got 1, want 2\n" +
+		filepath.Join("testdata", "one", "other_test.go") + ":8: TestOther\n"
+	assert.Equal(t, string(raw), expected)
+
+	t.Run("empty when no tests failed", func(t *testing.T) {
+		exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+			Stdout: strings.NewReader(`{"Package": "one", "Action": "pass"}` + "\n"),
+			Stderr: strings.NewReader(""),
+		})
+		assert.NilError(t, err)
+		assert.NilError(t, writeErrorsFile(opts, exec))
+
+		raw, err := ioutil.ReadFile(opts.errorsFile)
+		assert.NilError(t, err)
+		assert.Equal(t, string(raw), "")
+	})
+}
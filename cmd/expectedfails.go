@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strings"
+
+	"github.com/fatih/color"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// expectedFails is the set of tests listed in the --expected-fails-file. A
+// listed test is also expected to fail when its root test is listed.
+type expectedFails struct {
+	// tests maps a package to the names of the tests in the package.
+	tests map[string]map[string]bool
+}
+
+// expectedFailsLine matches a line of the --expected-fails-file. The test
+// name starts at the first '.' that is followed by the name of a test,
+// because the package path may also contain dots.
+var expectedFailsLine = regexp.MustCompile(`^(.+?)\.((?:Test|Example|Fuzz)[^/]*(?:/.*)?)$`)
+
+// readExpectedFailsFile reads the tests listed in path, one per line, in the
+// form package.TestName. Blank lines, and lines starting with # are ignored.
+func readExpectedFailsFile(path string) (*expectedFails, error) {
+	return readTestListFile(path, "expected fails file")
+}
+
+// readTestListFile reads a file in the format of the --expected-fails-file.
+// name is used to identify the file in errors.
+func readTestListFile(path string, name string) (*expectedFails, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %v: %w", name, err)
+	}
+	e := &expectedFails{tests: make(map[string]map[string]bool)}
+	for i, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		match := expectedFailsLine.FindStringSubmatch(line)
+		if match == nil {
+			return nil, fmt.Errorf("%v:%d: invalid test %q, expected package.TestName", path, i+1, line)
+		}
+		if e.tests[match[1]] == nil {
+			e.tests[match[1]] = make(map[string]bool)
+		}
+		e.tests[match[1]][match[2]] = true
+	}
+	return e, nil
+}
+
+// listed returns true if the test, or any of its parents, is listed.
+func (e *expectedFails) listed(pkg string, test testjson.TestName) bool {
+	if e == nil {
+		return false
+	}
+	tests := e.tests[pkg]
+	for name := test.Name(); name != ""; name = testjson.TestName(name).Parent() {
+		if tests[name] {
+			return true
+		}
+	}
+	return false
+}
+
+// isExpectedFailure returns a function which returns true if the failed test
+// was expected to fail. A failed test which is not listed is also expected
+// when all of its failed subtests were expected to fail, because a test fails
+// when any of its subtests fail.
+func (e *expectedFails) isExpectedFailure(exec *testjson.Execution) func(testjson.TestCase) bool {
+	if e == nil {
+		return nil
+	}
+	expected := make(map[string]map[string]bool)
+	for _, name := range exec.Packages() {
+		failed := exec.Package(name).Failed
+		expected[name] = make(map[string]bool)
+		for _, tc := range failed {
+			if e.listed(name, tc.Test) || allSubtestsExpected(e, name, tc, failed) {
+				expected[name][tc.Test.Name()] = true
+			}
+		}
+	}
+	return func(tc testjson.TestCase) bool {
+		return expected[tc.Package][tc.Test.Name()]
+	}
+}
+
+func allSubtestsExpected(e *expectedFails, pkg string, tc testjson.TestCase, failed []testjson.TestCase) bool {
+	prefix := tc.Test.Name() + "/"
+	var count int
+	for _, sub := range failed {
+		if !strings.HasPrefix(sub.Test.Name(), prefix) {
+			continue
+		}
+		if !e.listed(pkg, sub.Test) {
+			return false
+		}
+		count++
+	}
+	return count > 0
+}
+
+// allFailuresExpected returns true if every failure in exec was expected.
+// A package that failed without any failed tests, for example because
+// TestMain failed, is never expected.
+func (e *expectedFails) allFailuresExpected(exec *testjson.Execution) bool {
+	isExpected := e.isExpectedFailure(exec)
+	if isExpected == nil || len(exec.Errors()) > 0 {
+		return false
+	}
+	for _, name := range exec.Packages() {
+		pkg := exec.Package(name)
+		if pkg.Result() == testjson.ActionFail && len(pkg.Failed) == 0 {
+			return false
+		}
+		for _, tc := range pkg.Failed {
+			if !isExpected(tc) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// unexpectedPasses returns the listed tests which passed, and never failed.
+func (e *expectedFails) unexpectedPasses(exec *testjson.Execution) []testjson.TestCase {
+	if e == nil {
+		return nil
+	}
+	var result []testjson.TestCase
+	for _, name := range exec.Packages() {
+		pkg := exec.Package(name)
+		failed := make(map[string]bool)
+		for _, tc := range pkg.Failed {
+			failed[tc.Test.Name()] = true
+		}
+		for _, tc := range pkg.Passed {
+			if e.tests[name][tc.Test.Name()] && !failed[tc.Test.Name()] {
+				result = append(result, tc)
+			}
+		}
+	}
+	return result
+}
+
+// withoutExpectedFails removes the tests listed in the --expected-fails-file
+// from the tests selected by filter, so that they are not rerun.
+func withoutExpectedFails(filter testCaseFilter, e *expectedFails) testCaseFilter {
+	return func(tcs []testjson.TestCase) []testjson.TestCase {
+		var result []testjson.TestCase
+		for _, tc := range filter(tcs) {
+			if !e.listed(tc.Package, tc.Test) {
+				result = append(result, tc)
+			}
+		}
+		return result
+	}
+}
+
+// applyExpectedFails returns nil in place of the exit error from 'go test'
+// when all the failures were expected.
+func applyExpectedFails(opts *options, exec *testjson.Execution, exitErr error) error {
+	if exitErr == nil || !IsExitCoder(exitErr) || isInterrupted(exitErr) {
+		return exitErr
+	}
+	if ExitCodeWithDefault(exitErr) != 1 || !opts.expectedFails.allFailuresExpected(exec) {
+		return exitErr
+	}
+	return nil
+}
+
+func writeUnexpectedPassSummary(out io.Writer, passed []testjson.TestCase) {
+	if len(passed) == 0 {
+		return
+	}
+	fmt.Fprintln(out, color.YellowString("\n=== Unexpectedly passed"))
+	for _, tc := range passed {
+		fmt.Fprintf(out, "=== %s: %s %s\n",
+			color.YellowString("UNEXPECTED PASS"),
+			testjson.RelativePackagePath(tc.Package),
+			tc.Test)
+	}
+}
+
+// failOnUnexpectedPass returns an error if any of the tests expected to fail
+// passed, and --fail-on-unexpected-pass is set.
+func failOnUnexpectedPass(opts *options, passed []testjson.TestCase) error {
+	if !opts.failOnUnexpectedPass || len(passed) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d tests listed in %v passed, remove them from the file",
+		len(passed), opts.expectedFailsFile)
+}
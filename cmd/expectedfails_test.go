@@ -0,0 +1,158 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+	"gotest.tools/v3/fs"
+)
+
+func TestReadExpectedFailsFile(t *testing.T) {
+	file := fs.NewFile(t, t.Name(), fs.WithContent(`
+# waiting for a fix
+example.com/pkg.TestOne
+gopkg.in/yaml.v3.TestDecode/case_1.yaml
+
+example.com/pkg/v2.ExampleFoo
+`))
+	e, err := readExpectedFailsFile(file.Path())
+	assert.NilError(t, err)
+	expected := map[string]map[string]bool{
+		"example.com/pkg":    {"TestOne": true},
+		"gopkg.in/yaml.v3":   {"TestDecode/case_1.yaml": true},
+		"example.com/pkg/v2": {"ExampleFoo": true},
+	}
+	assert.DeepEqual(t, e.tests, expected)
+
+	assert.Assert(t, e.listed("example.com/pkg", "TestOne/sub"))
+	assert.Assert(t, !e.listed("example.com/pkg", "TestOneMore"))
+	assert.Assert(t, !e.listed("gopkg.in/yaml.v3", "TestDecode"))
+
+	t.Run("invalid line", func(t *testing.T) {
+		file := fs.NewFile(t, t.Name(), fs.WithContent("example.com/pkg.TestOne\nexample.com/pkg\n"))
+		_, err := readExpectedFailsFile(file.Path())
+		assert.ErrorContains(t, err, `:2: invalid test "example.com/pkg"`)
+	})
+
+	t.Run("not set", func(t *testing.T) {
+		e, err := readExpectedFailsFile("")
+		assert.NilError(t, err)
+		assert.Assert(t, e == nil)
+	})
+}
+
+func newExecutionWithExpectedFailures(t *testing.T) *testjson.Execution {
+	t.Helper()
+	out := `{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestBroken", "Action": "run"}
+{"Package": "pkg", "Test": "TestBroken", "Action": "fail"}
+{"Package": "pkg", "Test": "TestTable", "Action": "run"}
+{"Package": "pkg", "Test": "TestTable/case_1", "Action": "run"}
+{"Package": "pkg", "Test": "TestTable/case_1", "Action": "fail"}
+{"Package": "pkg", "Test": "TestTable/case_2", "Action": "run"}
+{"Package": "pkg", "Test": "TestTable/case_2", "Action": "pass"}
+{"Package": "pkg", "Test": "TestTable", "Action": "fail"}
+{"Package": "pkg", "Test": "TestFixed", "Action": "run"}
+{"Package": "pkg", "Test": "TestFixed", "Action": "pass"}
+{"Package": "pkg", "Action": "fail"}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+	return exec
+}
+
+func newExpectedFails(tests ...string) *expectedFails {
+	e := &expectedFails{tests: map[string]map[string]bool{"pkg": {}}}
+	for _, name := range tests {
+		e.tests["pkg"][name] = true
+	}
+	return e
+}
+
+func TestFinishRun_ExpectedFailures(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := &options{
+		stdout:        out,
+		hideSummary:   newHideSummaryValue(),
+		expectedFails: newExpectedFails("TestBroken", "TestTable/case_1"),
+	}
+	err := finishRun(opts, newExecutionWithExpectedFailures(t), newExitCode("failed", 1))
+	assert.NilError(t, err)
+
+	expected := `
+=== Expected failures
+=== EXPECTED FAIL: pkg TestBroken (0.00s)
+=== EXPECTED FAIL: pkg TestTable/case_1 (0.00s)
+=== EXPECTED FAIL: pkg TestTable (0.00s)
+`
+	assert.Assert(t, cmp.Contains(out.String(), expected))
+	assert.Assert(t, cmp.Contains(out.String(), "DONE 5 tests, 3 expected failures"))
+	assert.Assert(t, !strings.Contains(out.String(), "=== Failed"))
+}
+
+func TestFinishRun_UnexpectedFailure(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := &options{
+		stdout:        out,
+		hideSummary:   newHideSummaryValue(),
+		expectedFails: newExpectedFails("TestBroken"),
+	}
+	exitErr := newExitCode("failed", 1)
+	err := finishRun(opts, newExecutionWithExpectedFailures(t), exitErr)
+	assert.Equal(t, err, exitErr)
+
+	expected := `
+=== Failed
+=== FAIL: pkg TestTable/case_1 (0.00s)
+
+=== FAIL: pkg TestTable (0.00s)
+
+=== Expected failures
+=== EXPECTED FAIL: pkg TestBroken (0.00s)
+`
+	assert.Assert(t, cmp.Contains(out.String(), expected))
+	assert.Assert(t, cmp.Contains(out.String(), "2 failures, 1 expected failure"))
+}
+
+func TestFinishRun_UnexpectedPass(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := &options{
+		stdout:            out,
+		hideSummary:       newHideSummaryValue(),
+		expectedFailsFile: "expected-fails.txt",
+		expectedFails:     newExpectedFails("TestBroken", "TestTable", "TestFixed"),
+	}
+	err := finishRun(opts, newExecutionWithExpectedFailures(t), newExitCode("failed", 1))
+	assert.NilError(t, err)
+	expected := `
+=== Unexpectedly passed
+=== UNEXPECTED PASS: pkg TestFixed
+`
+	assert.Assert(t, cmp.Contains(out.String(), expected))
+
+	t.Run("with fail-on-unexpected-pass", func(t *testing.T) {
+		opts.failOnUnexpectedPass = true
+		err := finishRun(opts, newExecutionWithExpectedFailures(t), newExitCode("failed", 1))
+		assert.Error(t, err, "1 tests listed in expected-fails.txt passed, remove them from the file")
+	})
+}
+
+func TestRerunFailsFilter_WithoutExpectedFails(t *testing.T) {
+	opts := &options{expectedFails: newExpectedFails("TestBroken", "TestTable/case_1")}
+	exec := newExecutionWithExpectedFailures(t)
+	assert.Equal(t, len(rerunFailsFilter(opts, exec)(exec.Failed())), 0)
+
+	opts.expectedFails = newExpectedFails("TestBroken")
+	var names []string
+	for _, tc := range rerunFailsFilter(opts, exec)(exec.Failed()) {
+		names = append(names, tc.Test.Name())
+	}
+	assert.DeepEqual(t, names, []string{"TestTable/case_1"})
+}
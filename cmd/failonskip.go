@@ -0,0 +1,28 @@
+package cmd
+
+import (
+	"fmt"
+	"strings"
+
+	"gotest.tools/gotestsum/testjson"
+)
+
+// failOnSkip returns an error with the names of the skipped tests if
+// --fail-on-skip is set, and any test not listed in the
+// --fail-on-skip-allow-file was skipped.
+func failOnSkip(opts *options, exec *testjson.Execution) error {
+	if !opts.failOnSkip {
+		return nil
+	}
+	var names []string
+	for _, tc := range exec.Skipped() {
+		if opts.failOnSkipAllowed.listed(tc.Package, tc.Test) {
+			continue
+		}
+		names = append(names, testjson.RelativePackagePath(tc.Package)+"."+tc.Test.Name())
+	}
+	if len(names) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d tests were skipped: %s", len(names), strings.Join(names, ", "))
+}
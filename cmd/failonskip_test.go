@@ -0,0 +1,47 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestFailOnSkip(t *testing.T) {
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "example.com/pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestOne", "Action": "skip"}
+{"Package": "example.com/pkg", "Test": "TestTwo", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestTwo/sub", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestTwo/sub", "Action": "skip"}
+{"Package": "example.com/pkg", "Test": "TestTwo", "Action": "pass"}
+{"Package": "example.com/pkg", "Test": "TestThree", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestThree", "Action": "pass"}
+{"Package": "example.com/pkg", "Action": "pass"}
+`),
+		Stderr: bytes.NewReader(nil),
+	})
+	assert.NilError(t, err)
+
+	t.Run("not set", func(t *testing.T) {
+		assert.NilError(t, failOnSkip(&options{}, exec))
+	})
+
+	t.Run("skipped tests", func(t *testing.T) {
+		err := failOnSkip(&options{failOnSkip: true}, exec)
+		assert.Error(t, err,
+			"2 tests were skipped: example.com/pkg.TestOne, example.com/pkg.TestTwo/sub")
+	})
+
+	t.Run("allowed skips", func(t *testing.T) {
+		file := fs.NewFile(t, t.Name(), fs.WithContent("example.com/pkg.TestTwo\n"))
+		allowed, err := readTestListFile(file.Path(), "fail on skip allow file")
+		assert.NilError(t, err)
+
+		opts := &options{failOnSkip: true, failOnSkipAllowed: allowed}
+		assert.Error(t, failOnSkip(opts, exec), "1 tests were skipped: example.com/pkg.TestOne")
+	})
+}
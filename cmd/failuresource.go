@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os/exec"
+	"strings"
+	"sync"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// defaultFailureSourceContext is the number of lines printed before and after
+// the failing line when --show-failure-source is used without a value.
+const defaultFailureSourceContext = 3
+
+// newFailureSource returns the FailureSource used to print the source of each
+// failure in the summary, or nil if --show-failure-source is not set.
+func newFailureSource(opts *options) *testjson.FailureSource {
+	if opts.showFailureSource <= 0 {
+		return nil
+	}
+	return &testjson.FailureSource{
+		Context:    opts.showFailureSource,
+		PackageDir: newPackageDirs().lookup,
+	}
+}
+
+// packageDirs looks up the directory of a package using go list. The result
+// is cached so that go list is only run once for each package.
+type packageDirs struct {
+	mu   sync.Mutex
+	dirs map[string]string
+}
+
+func newPackageDirs() *packageDirs {
+	return &packageDirs{dirs: make(map[string]string)}
+}
+
+func (p *packageDirs) lookup(pkg string) string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if dir, ok := p.dirs[pkg]; ok {
+		return dir
+	}
+	dir, err := goListPackageDirFn(pkg)
+	if err != nil {
+		log.Debugf("failed to lookup directory of package %v: %v", pkg, err)
+	}
+	p.dirs[pkg] = dir
+	return dir
+}
+
+// goListPackageDirFn is a shim for testing
+var goListPackageDirFn = goListPackageDir
+
+func goListPackageDir(pkg string) (string, error) {
+	log.Debugf("exec: go list -f {{.Dir}} %v", pkg)
+	out, err := exec.Command("go", "list", "-f", "{{.Dir}}", pkg).Output()
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(out)), nil
+}
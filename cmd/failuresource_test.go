@@ -0,0 +1,27 @@
+package cmd
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestNewFailureSource(t *testing.T) {
+	assert.Assert(t, newFailureSource(&options{}) == nil)
+
+	var calls []string
+	defer func(orig func(string) (string, error)) {
+		goListPackageDirFn = orig
+	}(goListPackageDirFn)
+	goListPackageDirFn = func(pkg string) (string, error) {
+		calls = append(calls, pkg)
+		return "/src/" + pkg, nil
+	}
+
+	source := newFailureSource(&options{showFailureSource: 2})
+	assert.Equal(t, source.Context, 2)
+	assert.Equal(t, source.PackageDir("example.com/one"), "/src/example.com/one")
+	assert.Equal(t, source.PackageDir("example.com/one"), "/src/example.com/one")
+	assert.Equal(t, source.PackageDir("example.com/two"), "/src/example.com/two")
+	assert.DeepEqual(t, calls, []string{"example.com/one", "example.com/two"})
+}
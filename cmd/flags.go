@@ -4,11 +4,15 @@ import (
 	"encoding/csv"
 	"fmt"
 	"path"
+	"sort"
+	"strconv"
 	"strings"
+	"text/template"
 
 	"github.com/dnephin/pflag"
 	"github.com/google/shlex"
 	"gotest.tools/gotestsum/internal/junitxml"
+	"gotest.tools/gotestsum/internal/log"
 	"gotest.tools/gotestsum/testjson"
 )
 
@@ -38,7 +42,7 @@ func (s *hideSummaryValue) Set(val string) error {
 			return fmt.Errorf("value must be one or more of: %s",
 				testjson.SummarizeAll.String())
 		}
-		s.value -= summary
+		s.value &^= summary
 	}
 	return nil
 }
@@ -87,6 +91,39 @@ func (f *junitFieldFormatValue) Value() junitxml.FormatFunc {
 	return f.value
 }
 
+var junitTestCaseTimeValues = "first, last, sum"
+
+type junitTestCaseTimeValue struct {
+	value junitxml.TestCaseTime
+}
+
+func (f *junitTestCaseTimeValue) Set(val string) error {
+	switch junitxml.TestCaseTime(val) {
+	case junitxml.TestCaseTimeFirst, junitxml.TestCaseTimeLast, junitxml.TestCaseTimeSum:
+		f.value = junitxml.TestCaseTime(val)
+		return nil
+	}
+	return fmt.Errorf("invalid value: %v, must be one of: "+junitTestCaseTimeValues, val)
+}
+
+func (f *junitTestCaseTimeValue) Type() string {
+	return "time-mode"
+}
+
+func (f *junitTestCaseTimeValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return string(f.value)
+}
+
+func (f *junitTestCaseTimeValue) Value() junitxml.TestCaseTime {
+	if f == nil {
+		return junitxml.TestCaseTimeEachRun
+	}
+	return f.value
+}
+
 type commandValue struct {
 	original string
 	command  []string
@@ -133,6 +170,278 @@ func (s *stringSlice) Type() string {
 	return "list"
 }
 
+var _ pflag.Value = (*metadataValue)(nil)
+
+// metadataValue is a flag.Value which accumulates key=value pairs in the order
+// they were set. Duplicate keys are rejected.
+type metadataValue struct {
+	values []junitxml.JUnitProperty
+}
+
+func (m *metadataValue) String() string {
+	pairs := make([]string, 0, len(m.values))
+	for _, p := range m.values {
+		pairs = append(pairs, p.Name+"="+p.Value)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (m *metadataValue) Set(raw string) error {
+	idx := strings.Index(raw, "=")
+	if idx <= 0 {
+		return fmt.Errorf("invalid value %q, must be in the form key=value", raw)
+	}
+	key, value := raw[:idx], raw[idx+1:]
+	for _, p := range m.values {
+		if p.Name == key {
+			return fmt.Errorf("duplicate key %q", key)
+		}
+	}
+	m.values = append(m.values, junitxml.JUnitProperty{Name: key, Value: value})
+	return nil
+}
+
+func (m *metadataValue) Type() string {
+	return "key=value"
+}
+
+func (m *metadataValue) Value() []junitxml.JUnitProperty {
+	if m == nil {
+		return nil
+	}
+	return m.values
+}
+
+// keyValueMap is a flag.Value which accumulates key=value pairs into a map.
+// A key which is set again replaces the previous value.
+type keyValueMap map[string]string
+
+func (m keyValueMap) String() string {
+	pairs := make([]string, 0, len(m))
+	for key, value := range m {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m keyValueMap) Set(raw string) error {
+	idx := strings.Index(raw, "=")
+	if idx <= 0 {
+		return fmt.Errorf("invalid value %q, must be in the form key=value", raw)
+	}
+	m[raw[:idx]] = raw[idx+1:]
+	return nil
+}
+
+func (m keyValueMap) Type() string {
+	return "key=value"
+}
+
+// fileMapValue is a flag.Value which maps files that match a glob to the
+// directory of a package.
+type fileMapValue struct {
+	values []fileMapping
+}
+
+type fileMapping struct {
+	glob string
+	// dir is the directory of the package, relative to the root of the
+	// repository. An empty dir ignores the files that match glob.
+	dir string
+}
+
+func (f *fileMapValue) String() string {
+	pairs := make([]string, 0, len(f.values))
+	for _, m := range f.values {
+		pairs = append(pairs, m.glob+"="+m.dir)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (f *fileMapValue) Set(raw string) error {
+	idx := strings.Index(raw, "=")
+	if idx <= 0 {
+		return fmt.Errorf("invalid value %q, must be in the form glob=dir", raw)
+	}
+	glob := raw[:idx]
+	if _, err := path.Match(glob, ""); err != nil {
+		return fmt.Errorf("invalid glob %q: %w", glob, err)
+	}
+	f.values = append(f.values, fileMapping{glob: glob, dir: raw[idx+1:]})
+	return nil
+}
+
+func (f *fileMapValue) Type() string {
+	return "glob=dir"
+}
+
+func (f *fileMapValue) Value() []fileMapping {
+	if f == nil {
+		return nil
+	}
+	return f.values
+}
+
+// packageScaleValue is a flag.Value which maps a package to a multiplier.
+type packageScaleValue struct {
+	values []packageScale
+}
+
+type packageScale struct {
+	pkg   string
+	scale float64
+}
+
+func (p *packageScaleValue) String() string {
+	pairs := make([]string, 0, len(p.values))
+	for _, v := range p.values {
+		pairs = append(pairs, v.pkg+"="+strconv.FormatFloat(v.scale, 'f', -1, 64))
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (p *packageScaleValue) Set(raw string) error {
+	idx := strings.LastIndex(raw, "=")
+	if idx <= 0 {
+		return fmt.Errorf("invalid value %q, must be in the form pkg=multiplier", raw)
+	}
+	scale, err := strconv.ParseFloat(raw[idx+1:], 64)
+	if err != nil || scale <= 0 {
+		return fmt.Errorf("invalid multiplier %q, must be a number greater than 0", raw[idx+1:])
+	}
+	p.values = append(p.values, packageScale{pkg: raw[:idx], scale: scale})
+	return nil
+}
+
+func (p *packageScaleValue) Type() string {
+	return "pkg=multiplier"
+}
+
+// Value returns the multiplier for pkg. If pkg is set more than once, the
+// last value is used.
+func (p *packageScaleValue) Value(pkg string) (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	for i := len(p.values) - 1; i >= 0; i-- {
+		if p.values[i].pkg == pkg {
+			return p.values[i].scale, true
+		}
+	}
+	return 0, false
+}
+
+type logLevelValue struct {
+	value log.Level
+}
+
+func (l *logLevelValue) Set(raw string) error {
+	var err error
+	l.value, err = log.ParseLevel(raw)
+	return err
+}
+
+func (l *logLevelValue) Type() string {
+	return "level"
+}
+
+func (l *logLevelValue) String() string {
+	return l.value.String()
+}
+
+var logFormatValues = "text, json"
+
+type logFormatValue struct {
+	value log.Format
+}
+
+func (f *logFormatValue) Set(raw string) error {
+	switch log.Format(raw) {
+	case log.TextFormat, log.JSONFormat:
+		f.value = log.Format(raw)
+		return nil
+	}
+	return fmt.Errorf("invalid value: %v, must be one of: "+logFormatValues, raw)
+}
+
+func (f *logFormatValue) Type() string {
+	return "format"
+}
+
+func (f *logFormatValue) String() string {
+	return string(f.value)
+}
+
+// templateValue is a flag.Value which parses the raw flag value as a
+// text/template.
+type templateValue struct {
+	original string
+	template *template.Template
+}
+
+func (t *templateValue) String() string {
+	return t.original
+}
+
+func (t *templateValue) Set(raw string) error {
+	tmpl, err := template.New("").Parse(raw)
+	if err != nil {
+		return err
+	}
+	t.original, t.template = raw, tmpl
+	return nil
+}
+
+func (t *templateValue) Type() string {
+	return "template"
+}
+
+func (t *templateValue) Value() *template.Template {
+	if t == nil {
+		return nil
+	}
+	return t.template
+}
+
+// percentValue is a flag.Value which parses a percentage, with an optional %
+// suffix (ex: 10%), as a fraction between 0 and 1.
+type percentValue struct {
+	value float64
+	set   bool
+}
+
+func (p *percentValue) String() string {
+	if p == nil || !p.set {
+		return ""
+	}
+	return strconv.FormatFloat(p.value*100, 'f', -1, 64) + "%"
+}
+
+func (p *percentValue) Set(raw string) error {
+	n, err := strconv.ParseFloat(strings.TrimSuffix(raw, "%"), 64)
+	if err != nil {
+		return fmt.Errorf("invalid percentage: %v", raw)
+	}
+	if n < 0 || n > 100 {
+		return fmt.Errorf("percentage must be between 0%% and 100%%, not %v", raw)
+	}
+	p.value, p.set = n/100, true
+	return nil
+}
+
+func (p *percentValue) Type() string {
+	return "percent"
+}
+
+// Value returns the fraction, and false if the flag was not set.
+func (p *percentValue) Value() (float64, bool) {
+	if p == nil {
+		return 0, false
+	}
+	return p.value, p.set
+}
+
 func truthyFlag(s string) bool {
 	switch strings.ToLower(s) {
 	case "true", "yes", "1":
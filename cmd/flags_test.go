@@ -3,6 +3,7 @@ package cmd
 import (
 	"testing"
 
+	"gotest.tools/gotestsum/testjson"
 	"gotest.tools/v3/assert"
 )
 
@@ -26,6 +27,12 @@ func TestNoSummaryValue_SetAndString(t *testing.T) {
 	})
 }
 
+func TestNoSummaryValue_SetOptInSection(t *testing.T) {
+	value := newHideSummaryValue()
+	assert.NilError(t, value.Set("warnings"))
+	assert.Equal(t, value.value, testjson.SummarizeAll)
+}
+
 func TestStringSlice(t *testing.T) {
 	value := "one \ntwo  three\n\tfour\t five   \n"
 	var v []string
@@ -33,3 +40,97 @@ func TestStringSlice(t *testing.T) {
 	assert.NilError(t, ss.Set(value))
 	assert.DeepEqual(t, v, []string{"one", "two", "three", "four", "five"})
 }
+
+func TestMetadataValue(t *testing.T) {
+	t.Run("valid", func(t *testing.T) {
+		value := &metadataValue{}
+		assert.NilError(t, value.Set("git.sha=abc123"))
+		assert.NilError(t, value.Set("note=a=b"))
+		assert.Equal(t, value.String(), "git.sha=abc123,note=a=b")
+	})
+	t.Run("missing equals", func(t *testing.T) {
+		value := &metadataValue{}
+		assert.ErrorContains(t, value.Set("git.sha"), "must be in the form key=value")
+	})
+	t.Run("empty key", func(t *testing.T) {
+		value := &metadataValue{}
+		assert.ErrorContains(t, value.Set("=abc"), "must be in the form key=value")
+	})
+	t.Run("duplicate key", func(t *testing.T) {
+		value := &metadataValue{}
+		assert.NilError(t, value.Set("branch=main"))
+		assert.ErrorContains(t, value.Set("branch=other"), `duplicate key "branch"`)
+	})
+}
+
+func TestKeyValueMap(t *testing.T) {
+	m := map[string]string{}
+	value := keyValueMap(m)
+	assert.NilError(t, value.Set("name_width=40"))
+	assert.NilError(t, value.Set("hide_empty_pkg=true"))
+	assert.NilError(t, value.Set("name_width=-1"))
+	assert.DeepEqual(t, m, map[string]string{"name_width": "-1", "hide_empty_pkg": "true"})
+	assert.Equal(t, value.String(), "hide_empty_pkg=true,name_width=-1")
+
+	assert.ErrorContains(t, value.Set("name_width"), "must be in the form key=value")
+}
+
+func TestTemplateValue(t *testing.T) {
+	value := &templateValue{}
+	assert.Assert(t, value.Value() == nil)
+	assert.NilError(t, value.Set("{{.Package}}.{{.Test}}"))
+	assert.Equal(t, value.String(), "{{.Package}}.{{.Test}}")
+	assert.Assert(t, value.Value() != nil)
+
+	assert.ErrorContains(t, value.Set("{{.Package"), "unclosed action")
+}
+
+func TestFileMapValue(t *testing.T) {
+	value := &fileMapValue{}
+	assert.NilError(t, value.Set("docs/*.yaml=internal/docs"))
+	assert.NilError(t, value.Set("*.md="))
+	assert.Equal(t, value.String(), "docs/*.yaml=internal/docs,*.md=")
+	assert.Equal(t, len(value.Value()), 2)
+	assert.Equal(t, value.Value()[0], fileMapping{glob: "docs/*.yaml", dir: "internal/docs"})
+	assert.Equal(t, value.Value()[1], fileMapping{glob: "*.md"})
+
+	assert.ErrorContains(t, value.Set("docs"), "must be in the form glob=dir")
+	assert.ErrorContains(t, value.Set("[=dir"), "invalid glob")
+}
+
+func TestPercentValue(t *testing.T) {
+	value := &percentValue{}
+	_, ok := value.Value()
+	assert.Assert(t, !ok)
+	assert.Equal(t, value.String(), "")
+
+	assert.NilError(t, value.Set("10%"))
+	fraction, ok := value.Value()
+	assert.Assert(t, ok)
+	assert.Equal(t, fraction, 0.1)
+	assert.Equal(t, value.String(), "10%")
+
+	assert.NilError(t, value.Set("2.5"))
+	assert.Equal(t, value.String(), "2.5%")
+
+	assert.ErrorContains(t, value.Set("ten"), "invalid percentage: ten")
+	assert.ErrorContains(t, value.Set("150%"), "must be between 0% and 100%")
+}
+
+func TestPackageScaleValue(t *testing.T) {
+	value := &packageScaleValue{}
+	assert.NilError(t, value.Set("example.com/slow=3"))
+	assert.NilError(t, value.Set("example.com/other=1.5"))
+	assert.NilError(t, value.Set("example.com/slow=2.5"))
+	assert.Equal(t, value.String(), "example.com/slow=3,example.com/other=1.5,example.com/slow=2.5")
+
+	scale, ok := value.Value("example.com/slow")
+	assert.Assert(t, ok)
+	assert.Equal(t, scale, 2.5)
+	_, ok = value.Value("example.com/fast")
+	assert.Assert(t, !ok)
+
+	assert.ErrorContains(t, value.Set("example.com/slow"), "must be in the form pkg=multiplier")
+	assert.ErrorContains(t, value.Set("example.com/slow=fast"), "invalid multiplier")
+	assert.ErrorContains(t, value.Set("example.com/slow=0"), "must be a number greater than 0")
+}
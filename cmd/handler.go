@@ -14,11 +14,19 @@ import (
 )
 
 type eventHandler struct {
-	formatter            testjson.EventFormatter
+	formatter testjson.EventFormatter
+	// rerunFormatter is the formatter used for rerun attempts when
+	// --rerun-fails-output-format is set.
+	rerunFormatter       testjson.EventFormatter
 	err                  *bufio.Writer
 	jsonFile             writeSyncer
+	jsonFileFilter       *failedEventsFilter
+	jsonFileFlatten      *flattenRerunsFilter
 	jsonFileTimingEvents writeSyncer
 	maxFails             int
+	tracer               *otelTracer
+	onTestFail           *testFailCommand
+	tagOutput            *rerunTagOutput
 }
 
 type writeSyncer interface {
@@ -36,7 +44,7 @@ func (h *eventHandler) Err(text string) error {
 }
 
 func (h *eventHandler) Event(event testjson.TestEvent, execution *testjson.Execution) error {
-	if err := writeWithNewline(h.jsonFile, event.Bytes()); err != nil {
+	if err := h.writeJSONFile(event); err != nil {
 		return fmt.Errorf("failed to write JSON file: %w", err)
 	}
 	if event.Action.IsTerminal() {
@@ -45,6 +53,10 @@ func (h *eventHandler) Event(event testjson.TestEvent, execution *testjson.Execu
 		}
 	}
 
+	h.tracer.event(event)
+	h.onTestFail.event(event, execution)
+
+	h.tagOutput.setRunID(event.RunID)
 	err := h.formatter.Format(event, execution)
 	if err != nil {
 		return fmt.Errorf("failed to format event: %w", err)
@@ -56,6 +68,16 @@ func (h *eventHandler) Event(event testjson.TestEvent, execution *testjson.Execu
 	return nil
 }
 
+func (h *eventHandler) writeJSONFile(event testjson.TestEvent) error {
+	if h.jsonFileFilter != nil {
+		return h.jsonFileFilter.write(event)
+	}
+	if h.jsonFileFlatten != nil {
+		return h.jsonFileFlatten.write(event)
+	}
+	return writeWithNewline(h.jsonFile, event.Bytes())
+}
+
 func writeWithNewline(out io.Writer, b []byte) error {
 	// ignore artificial events that have len(b) == 0
 	if out == nil || len(b) == 0 {
@@ -69,6 +91,14 @@ func writeWithNewline(out io.Writer, b []byte) error {
 }
 
 func (h *eventHandler) Flush() {
+	flushFormatter(h.formatter)
+	flushFormatter(h.rerunFormatter)
+	h.tagOutput.Flush()
+	if h.jsonFileFilter != nil {
+		if err := h.jsonFileFilter.flush(); err != nil {
+			log.Errorf("Failed to write JSON file: %v", err)
+		}
+	}
 	if h.jsonFile != nil {
 		if err := h.jsonFile.Sync(); err != nil {
 			log.Errorf("Failed to sync JSON file: %v", err)
@@ -82,6 +112,14 @@ func (h *eventHandler) Flush() {
 }
 
 func (h *eventHandler) Close() error {
+	closeFormatter(h.formatter)
+	closeFormatter(h.rerunFormatter)
+	h.tagOutput.Flush()
+	if h.jsonFileFlatten != nil {
+		if err := h.jsonFileFlatten.flush(); err != nil {
+			log.Errorf("Failed to write JSON file: %v", err)
+		}
+	}
 	if h.jsonFile != nil {
 		if err := h.jsonFile.Close(); err != nil {
 			log.Errorf("Failed to close JSON file: %v", err)
@@ -95,17 +133,61 @@ func (h *eventHandler) Close() error {
 	return nil
 }
 
+// closeFormatter closes formatters which write the end of a document when the
+// run is done, like the tap format.
+func closeFormatter(formatter testjson.EventFormatter) {
+	closer, ok := formatter.(io.Closer)
+	if !ok {
+		return
+	}
+	if err := closer.Close(); err != nil {
+		log.Errorf("Failed to write output: %v", err)
+	}
+}
+
+// flushFormatter flushes formatters which buffer output until a package ends,
+// like the plain-verbose-package format, so that the output of packages which
+// did not end is printed.
+func flushFormatter(formatter testjson.EventFormatter) {
+	flusher, ok := formatter.(interface{ Flush() error })
+	if !ok {
+		return
+	}
+	if err := flusher.Flush(); err != nil {
+		log.Errorf("Failed to write output: %v", err)
+	}
+}
+
 var _ testjson.EventHandler = &eventHandler{}
 
 func newEventHandler(opts *options) (*eventHandler, error) {
-	formatter := testjson.NewEventFormatter(opts.stdout, opts.format, opts.formatOptions)
+	var tagOutput *rerunTagOutput
+	out := opts.stdout
+	if opts.rerunFailsTagOutput {
+		tagOutput = newRerunTagOutput(opts.stdout)
+		out = tagOutput
+	}
+	formatter := newFormatter(opts, out, opts.format)
 	if formatter == nil {
 		return nil, fmt.Errorf("unknown format %s", opts.format)
 	}
 	handler := &eventHandler{
-		formatter: formatter,
-		err:       bufio.NewWriter(opts.stderr),
-		maxFails:  opts.maxFails,
+		formatter:  formatter,
+		err:        bufio.NewWriter(opts.stderr),
+		maxFails:   opts.maxFails,
+		onTestFail: newTestFailCommand(opts.onTestFailCmd.Value()),
+		tagOutput:  tagOutput,
+	}
+	if endpoint := otelTracesEndpoint(opts); endpoint != "" {
+		opts.otelTracer = newOTelTracer(endpoint)
+		handler.tracer = opts.otelTracer
+	}
+	if opts.rerunFailsOutputFormat != "" {
+		handler.rerunFormatter = newFormatter(opts, out, opts.rerunFailsOutputFormat)
+		if handler.rerunFormatter == nil {
+			return nil, fmt.Errorf("unknown format %s for --rerun-fails-output-format",
+				opts.rerunFailsOutputFormat)
+		}
 	}
 
 	switch opts.format {
@@ -122,6 +204,12 @@ func newEventHandler(opts *options) (*eventHandler, error) {
 		if err != nil {
 			return handler, fmt.Errorf("failed to create file: %w", err)
 		}
+		if opts.jsonFileFilter == jsonFileFilterFailed {
+			handler.jsonFileFilter = newFailedEventsFilter(handler.jsonFile)
+		}
+		if opts.jsonFileFlattenReruns {
+			handler.jsonFileFlatten = newFlattenRerunsFilter(handler.jsonFile)
+		}
 	}
 	if opts.jsonFileTimingEvents != "" {
 		_ = os.MkdirAll(filepath.Dir(opts.jsonFileTimingEvents), 0o755)
@@ -133,12 +221,80 @@ func newEventHandler(opts *options) (*eventHandler, error) {
 	return handler, nil
 }
 
+// newFormatter returns the formatter for format, or nil if the format is not
+// known.
+func newFormatter(opts *options, out io.Writer, format string) testjson.EventFormatter {
+	if opts.forceColor {
+		format = colorFormat(format)
+	}
+	if f, ok := consoleFile(opts.stdout); ok && format == "dots-v2" && !enableVirtualTerminal(f) {
+		log.Debugf("console does not support escape sequences, using dots-v1")
+		format = "dots-v1"
+	}
+	return testjson.NewEventFormatter(out, format, opts.formatOptions)
+}
+
+// useRerunFormatter replaces the formatter of handler with the formatter for
+// --rerun-fails-output-format, and returns a function which restores the
+// formatter used by the first run.
+func useRerunFormatter(handler testjson.EventHandler) func() {
+	h, ok := handler.(*eventHandler)
+	if !ok || h.rerunFormatter == nil {
+		return func() {}
+	}
+	formatter := h.formatter
+	h.formatter = h.rerunFormatter
+	return func() {
+		h.formatter = formatter
+	}
+}
+
+// colorFormat returns the variant of format which always prints in color. The
+// other formats use color when color.NoColor is false, which is set by
+// --force-color.
+func colorFormat(format string) string {
+	if format == "standard-verbose" {
+		return "standard-verbose-color"
+	}
+	return format
+}
+
 func writeJUnitFile(opts *options, execution *testjson.Execution) error {
-	if opts.junitFile == "" {
+	bazelFile := os.Getenv("XML_OUTPUT_FILE")
+	if opts.junitFile == "" && bazelFile == "" {
 		return nil
 	}
-	_ = os.MkdirAll(filepath.Dir(opts.junitFile), 0o755)
-	junitFile, err := os.Create(opts.junitFile)
+
+	cfg := junitxml.Config{
+		ProjectName:             opts.junitProjectName,
+		FormatTestSuiteName:     opts.junitTestSuiteNameFormat.Value(),
+		FormatTestCaseClassname: opts.junitTestCaseClassnameFormat.Value(),
+		HideEmptyPackages:       opts.junitHideEmptyPackages,
+		TestCaseTime:            opts.junitTestCaseTime.Value(),
+		Properties:              opts.metadata.Value(),
+		MaxOutputBytes:          opts.junitMaxOutputBytes,
+		MaxFailuresOutput:       opts.maxFailsOutput,
+	}
+	if opts.skipUnchanged != nil {
+		cfg.CachedPackages = opts.skipUnchanged.cached
+	}
+	if opts.junitFile != "" {
+		if err := writeJUnitXML(opts.junitFile, execution, cfg); err != nil {
+			return err
+		}
+	}
+	// Bazel sets XML_OUTPUT_FILE to the path where it expects the test
+	// results of 'bazel test'.
+	if bazelFile != "" {
+		cfg.Bazel = true
+		return writeJUnitXML(bazelFile, execution, cfg)
+	}
+	return nil
+}
+
+func writeJUnitXML(path string, execution *testjson.Execution, cfg junitxml.Config) error {
+	_ = os.MkdirAll(filepath.Dir(path), 0o755)
+	junitFile, err := os.Create(path)
 	if err != nil {
 		return fmt.Errorf("failed to open JUnit file: %v", err)
 	}
@@ -147,13 +303,7 @@ func writeJUnitFile(opts *options, execution *testjson.Execution) error {
 			log.Errorf("Failed to close JUnit file: %v", err)
 		}
 	}()
-
-	return junitxml.Write(junitFile, execution, junitxml.Config{
-		ProjectName:             opts.junitProjectName,
-		FormatTestSuiteName:     opts.junitTestSuiteNameFormat.Value(),
-		FormatTestCaseClassname: opts.junitTestCaseClassnameFormat.Value(),
-		HideEmptyPackages:       opts.junitHideEmptyPackages,
-	})
+	return junitxml.Write(junitFile, execution, cfg)
 }
 
 func postRunHook(opts *options, execution *testjson.Execution) error {
@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"io"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -122,6 +123,75 @@ func TestNewEventHandler_CreatesDirectory(t *testing.T) {
 	assert.NilError(t, err)
 }
 
+func TestNewEventHandler_ForceColor(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := &options{
+		stdout:     out,
+		stderr:     io.Discard,
+		format:     "standard-verbose",
+		forceColor: true,
+	}
+	handler, err := newEventHandler(opts)
+	assert.NilError(t, err)
+
+	source := golden.Get(t, "../../testjson/testdata/input/go-test-json.out")
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout:  bytes.NewReader(source),
+		Handler: handler,
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Contains(out.String(), "\x1b[32m--- PASS: TestPassed (0.00s)\x1b[0m\n"))
+}
+
+func TestEventHandler_Close_WritesTAPPlan(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := &options{
+		stdout: out,
+		stderr: io.Discard,
+		format: "tap",
+	}
+	handler, err := newEventHandler(opts)
+	assert.NilError(t, err)
+
+	source := golden.Get(t, "../../testjson/testdata/input/go-test-json.out")
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout:  bytes.NewReader(source),
+		Handler: handler,
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, handler.Close())
+
+	assert.Equal(t, strings.Count(out.String(), "TAP version 13\n"), 1)
+	assert.Assert(t, strings.HasSuffix(out.String(), "\n1..5\n"), out.String())
+}
+
+func TestEventHandler_Flush_WritesPackagesThatDidNotEnd(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := &options{
+		stdout: out,
+		stderr: io.Discard,
+		format: "plain-verbose-package",
+	}
+	handler, err := newEventHandler(opts)
+	assert.NilError(t, err)
+
+	// the package never ends, for example because the run was interrupted
+	source := `{"Package": "pkg", "Test": "TestHangs", "Action": "run"}
+{"Package": "pkg", "Test": "TestHangs", "Action": "output", "Output": "=== RUN   TestHangs\n"}
+`
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout:  strings.NewReader(source),
+		Handler: handler,
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, out.String(), "")
+
+	handler.Flush()
+	assert.Equal(t, out.String(), "=== RUN   TestHangs\n")
+	assert.NilError(t, handler.Close())
+	assert.Equal(t, out.String(), "=== RUN   TestHangs\n")
+}
+
 func TestWriteJunitFile_CreatesDirectory(t *testing.T) {
 	dir := fs.NewDir(t, t.Name())
 	junitFile := filepath.Join(dir.Path(), "new-path", "junit.xml")
@@ -139,6 +209,30 @@ func TestWriteJunitFile_CreatesDirectory(t *testing.T) {
 	assert.NilError(t, err)
 }
 
+func TestWriteJunitFile_BazelXMLOutputFile(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	bazelFile := dir.Join("bazel", "test.xml")
+	env.Patch(t, "XML_OUTPUT_FILE", bazelFile)
+	env.Patch(t, "TEST_TARGET", "//pkg:go_test")
+	env.Patch(t, "GOVERSION", "go7.7.7")
+
+	opts := &options{
+		junitFile:                    dir.Join("junit.xml"),
+		junitTestCaseClassnameFormat: &junitFieldFormatValue{},
+		junitTestSuiteNameFormat:     &junitFieldFormatValue{},
+	}
+	exec := &testjson.Execution{}
+	assert.NilError(t, writeJUnitFile(opts, exec))
+
+	raw, err := ioutil.ReadFile(bazelFile)
+	assert.NilError(t, err)
+	assert.Assert(t, cmp.Contains(string(raw), `<testsuites name="//pkg:go_test"`))
+
+	raw, err = ioutil.ReadFile(opts.junitFile)
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(string(raw), "//pkg:go_test"))
+}
+
 func TestScanTestOutput_TestTimeoutPanicRace(t *testing.T) {
 	run := func(t *testing.T, name string) {
 		format := testjson.NewEventFormatter(io.Discard, "testname", testjson.FormatOptions{})
@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"io"
+	"sort"
+	"strings"
+
+	"gotest.tools/gotestsum/testjson"
+)
+
+// Values of --jsonfile-filter.
+const (
+	jsonFileFilterAll    = "all"
+	jsonFileFilterFailed = "failed"
+)
+
+// failedEventsFilter writes only the TestEvents of failed tests and packages
+// to the --jsonfile, for --jsonfile-filter=failed. The events of each root
+// test, including the events of its subtests, are buffered until the root
+// test ends. A subtest can only fail when its root test fails, so the buffer
+// is written when the root test fails, and discarded otherwise.
+//
+// The package events without output, like start and the final pass or fail,
+// are always written so that the file records the result of every package.
+// The package output is only written when the package fails.
+type failedEventsFilter struct {
+	out     io.Writer
+	tests   map[filterKey][][]byte
+	pkgs    map[filterKey][][]byte
+	pending []filterKey
+}
+
+// filterKey identifies the events of a root test, or of a package when
+// test is empty, from one run.
+type filterKey struct {
+	pkg   string
+	test  string
+	runID int
+}
+
+func newFailedEventsFilter(out io.Writer) *failedEventsFilter {
+	return &failedEventsFilter{
+		out:   out,
+		tests: make(map[filterKey][][]byte),
+		pkgs:  make(map[filterKey][][]byte),
+	}
+}
+
+func (f *failedEventsFilter) write(event testjson.TestEvent) error {
+	raw := event.Bytes()
+	// ignore artificial events, the same as writeWithNewline
+	if len(raw) == 0 {
+		return nil
+	}
+	if event.PackageEvent() {
+		return f.writePackageEvent(event, raw)
+	}
+
+	key := filterKey{
+		pkg:   event.Package,
+		test:  strings.SplitN(event.Test, "/", 2)[0],
+		runID: event.RunID,
+	}
+	if _, ok := f.tests[key]; !ok {
+		f.pending = append(f.pending, key)
+	}
+	f.tests[key] = append(f.tests[key], raw)
+	if !event.Action.IsTerminal() || key.test != event.Test {
+		return nil
+	}
+	events := f.tests[key]
+	f.remove(key)
+	if event.Action != testjson.ActionFail {
+		return nil
+	}
+	return f.writeAll(events)
+}
+
+func (f *failedEventsFilter) writePackageEvent(event testjson.TestEvent, raw []byte) error {
+	key := filterKey{pkg: event.Package, runID: event.RunID}
+	switch {
+	case event.Action == testjson.ActionOutput:
+		f.pkgs[key] = append(f.pkgs[key], raw)
+		return nil
+	case !event.Action.IsTerminal():
+		return writeWithNewline(f.out, raw)
+	}
+
+	output := f.pkgs[key]
+	delete(f.pkgs, key)
+	if event.Action == testjson.ActionFail {
+		// Tests which never finished, because of a panic or a timeout, are
+		// part of the failure.
+		if err := f.writeUnfinished(key); err != nil {
+			return err
+		}
+		if err := f.writeAll(output); err != nil {
+			return err
+		}
+	}
+	return writeWithNewline(f.out, raw)
+}
+
+// writeUnfinished writes the buffered events of the tests in the package and
+// run identified by pkgKey, which never ended.
+func (f *failedEventsFilter) writeUnfinished(pkgKey filterKey) error {
+	for _, key := range append([]filterKey{}, f.pending...) {
+		if key.pkg != pkgKey.pkg || key.runID != pkgKey.runID {
+			continue
+		}
+		events := f.tests[key]
+		f.remove(key)
+		if err := f.writeAll(events); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// flush writes the buffered events of every test and package which never
+// ended, for example because the run was interrupted.
+func (f *failedEventsFilter) flush() error {
+	for _, key := range f.pending {
+		if err := f.writeAll(f.tests[key]); err != nil {
+			return err
+		}
+	}
+	f.pending = nil
+	f.tests = make(map[filterKey][][]byte)
+
+	keys := make([]filterKey, 0, len(f.pkgs))
+	for key := range f.pkgs {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].runID != keys[j].runID {
+			return keys[i].runID < keys[j].runID
+		}
+		return keys[i].pkg < keys[j].pkg
+	})
+	for _, key := range keys {
+		if err := f.writeAll(f.pkgs[key]); err != nil {
+			return err
+		}
+	}
+	f.pkgs = make(map[filterKey][][]byte)
+	return nil
+}
+
+func (f *failedEventsFilter) remove(key filterKey) {
+	delete(f.tests, key)
+	for i, k := range f.pending {
+		if k == key {
+			f.pending = append(f.pending[:i], f.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (f *failedEventsFilter) writeAll(events [][]byte) error {
+	for _, raw := range events {
+		if err := writeWithNewline(f.out, raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
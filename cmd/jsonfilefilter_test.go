@@ -0,0 +1,62 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestFailedEventsFilter(t *testing.T) {
+	lines := []string{
+		`{"Action":"start","Package":"one"}`,
+		`{"Action":"run","Package":"one","Test":"TestPass"}`,
+		`{"Action":"output","Package":"one","Test":"TestPass","Output":"=== RUN   TestPass\n"}`,
+		`{"Action":"pass","Package":"one","Test":"TestPass"}`,
+		`{"Action":"run","Package":"one","Test":"TestFail"}`,
+		`{"Action":"run","Package":"one","Test":"TestFail/passes"}`,
+		`{"Action":"pass","Package":"one","Test":"TestFail/passes"}`,
+		`{"Action":"run","Package":"one","Test":"TestFail/fails"}`,
+		`{"Action":"output","Package":"one","Test":"TestFail/fails","Output":"oops\n"}`,
+		`{"Action":"fail","Package":"one","Test":"TestFail/fails"}`,
+		`{"Action":"fail","Package":"one","Test":"TestFail"}`,
+		`{"Action":"output","Package":"one","Output":"FAIL\n"}`,
+		`{"Action":"fail","Package":"one"}`,
+		`{"Action":"start","Package":"two"}`,
+		`{"Action":"run","Package":"two","Test":"TestPass"}`,
+		`{"Action":"pass","Package":"two","Test":"TestPass"}`,
+		`{"Action":"output","Package":"two","Output":"ok  \ttwo\t0.1s\n"}`,
+		`{"Action":"pass","Package":"two"}`,
+		`{"Action":"start","Package":"three"}`,
+		`{"Action":"run","Package":"three","Test":"TestPanic"}`,
+		`{"Action":"output","Package":"three","Test":"TestPanic","Output":"panic: boom\n"}`,
+		`{"Action":"output","Package":"three","Output":"FAIL\tthree\t0.1s\n"}`,
+		`{"Action":"fail","Package":"three"}`,
+		`{"Action":"start","Package":"four"}`,
+		`{"Action":"run","Package":"four","Test":"TestInterrupted"}`,
+	}
+	buf := new(bufferCloser)
+	handler := &eventHandler{
+		jsonFile:       buf,
+		jsonFileFilter: newFailedEventsFilter(buf),
+		formatter:      testjson.NewEventFormatter(new(strings.Builder), "testname", testjson.FormatOptions{}),
+	}
+	_, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout:  strings.NewReader(strings.Join(lines, "\n") + "\n"),
+		Handler: handler,
+	})
+	assert.NilError(t, err)
+	handler.Flush()
+
+	expected := []string{
+		lines[0], lines[4], lines[5], lines[6], lines[7], lines[8], lines[9], lines[10],
+		lines[11], lines[12],
+		lines[13], lines[17],
+		// the test which never ended is written before the package output
+		lines[18], lines[19], lines[20], lines[21], lines[22],
+		// the events of a test which never ended are written by Flush
+		lines[23], lines[24],
+	}
+	assert.Equal(t, buf.String(), strings.Join(expected, "\n")+"\n")
+}
@@ -0,0 +1,111 @@
+package cmd
+
+import (
+	"io"
+
+	"gotest.tools/gotestsum/testjson"
+)
+
+// flattenRerunsFilter writes the TestEvents to the --jsonfile with only the
+// final run of each test, for --jsonfile-flatten-reruns. Every event is
+// buffered until the handler is closed, because the final run of a test is
+// not known until all the reruns have ended.
+//
+// The events of each test, and the package events of each package, are kept
+// from the run with the highest RunID that included them. A test which was
+// rerun is written once, with the events of its last attempt, in the place
+// where it first appeared.
+type flattenRerunsFilter struct {
+	out     io.Writer
+	pkgs    []string
+	tests   map[string][]string
+	entries map[flattenKey]*flattenEntry
+}
+
+// flattenKey identifies a test, or a package when test is empty.
+type flattenKey struct {
+	pkg  string
+	test string
+}
+
+type flattenEntry struct {
+	runID  int
+	events []testjson.TestEvent
+}
+
+func newFlattenRerunsFilter(out io.Writer) *flattenRerunsFilter {
+	return &flattenRerunsFilter{
+		out:     out,
+		tests:   make(map[string][]string),
+		entries: make(map[flattenKey]*flattenEntry),
+	}
+}
+
+func (f *flattenRerunsFilter) write(event testjson.TestEvent) error {
+	// ignore artificial events, the same as writeWithNewline
+	if len(event.Bytes()) == 0 {
+		return nil
+	}
+	pkgKey := flattenKey{pkg: event.Package}
+	if _, ok := f.entries[pkgKey]; !ok {
+		f.pkgs = append(f.pkgs, event.Package)
+		f.entries[pkgKey] = &flattenEntry{runID: event.RunID}
+	}
+
+	key := flattenKey{pkg: event.Package, test: event.Test}
+	entry, ok := f.entries[key]
+	switch {
+	case !ok:
+		entry = &flattenEntry{runID: event.RunID}
+		f.entries[key] = entry
+		f.tests[event.Package] = append(f.tests[event.Package], event.Test)
+	case event.RunID > entry.runID:
+		entry.runID = event.RunID
+		entry.events = nil
+	case event.RunID < entry.runID:
+		return nil
+	}
+	entry.events = append(entry.events, event)
+	return nil
+}
+
+// flush writes the events of every package, and the events of their tests,
+// in the order they were first received.
+func (f *flattenRerunsFilter) flush() error {
+	for _, pkg := range f.pkgs {
+		pkgEvents := f.entries[flattenKey{pkg: pkg}].events
+		// The start event is written before the tests, and the output and
+		// result of the package after them.
+		var tail []testjson.TestEvent
+		for _, event := range pkgEvents {
+			if event.Action != testjson.ActionOutput && !event.Action.IsTerminal() {
+				if err := writeWithNewline(f.out, event.Bytes()); err != nil {
+					return err
+				}
+				continue
+			}
+			tail = append(tail, event)
+		}
+		for _, test := range f.tests[pkg] {
+			if err := f.writeEvents(f.entries[flattenKey{pkg: pkg, test: test}].events); err != nil {
+				return err
+			}
+		}
+		if err := f.writeEvents(tail); err != nil {
+			return err
+		}
+	}
+	f.pkgs = nil
+	f.tests = make(map[string][]string)
+	f.entries = make(map[flattenKey]*flattenEntry)
+	return nil
+}
+
+func (f *flattenRerunsFilter) writeEvents(events []testjson.TestEvent) error {
+	for _, event := range events {
+		if err := writeWithNewline(f.out, event.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
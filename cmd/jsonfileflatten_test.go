@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestFlattenRerunsFilter(t *testing.T) {
+	first := []string{
+		`{"Action":"start","Package":"one"}`,
+		`{"Action":"run","Package":"one","Test":"TestPass"}`,
+		`{"Action":"pass","Package":"one","Test":"TestPass"}`,
+		`{"Action":"run","Package":"one","Test":"TestFlaky"}`,
+		`{"Action":"output","Package":"one","Test":"TestFlaky","Output":"oops\n"}`,
+		`{"Action":"fail","Package":"one","Test":"TestFlaky"}`,
+		`{"Action":"run","Package":"one","Test":"TestLast"}`,
+		`{"Action":"pass","Package":"one","Test":"TestLast"}`,
+		`{"Action":"output","Package":"one","Output":"FAIL\n"}`,
+		`{"Action":"fail","Package":"one"}`,
+		`{"Action":"start","Package":"two"}`,
+		`{"Action":"run","Package":"two","Test":"TestPass"}`,
+		`{"Action":"pass","Package":"two","Test":"TestPass"}`,
+		`{"Action":"pass","Package":"two"}`,
+	}
+	rerun := []string{
+		`{"Action":"start","Package":"one"}`,
+		`{"Action":"run","Package":"one","Test":"TestFlaky"}`,
+		`{"Action":"pass","Package":"one","Test":"TestFlaky"}`,
+		`{"Action":"output","Package":"one","Output":"ok  \tone\t0.1s\n"}`,
+		`{"Action":"pass","Package":"one"}`,
+	}
+	buf := new(bufferCloser)
+	handler := &eventHandler{
+		jsonFile:        buf,
+		jsonFileFlatten: newFlattenRerunsFilter(buf),
+		formatter:       testjson.NewEventFormatter(new(strings.Builder), "testname", testjson.FormatOptions{}),
+	}
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout:  strings.NewReader(strings.Join(first, "\n") + "\n"),
+		Handler: handler,
+	})
+	assert.NilError(t, err)
+	handler.Flush()
+	assert.Equal(t, buf.String(), "", "events are written when the handler is closed")
+
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout:    strings.NewReader(strings.Join(rerun, "\n") + "\n"),
+		Handler:   handler,
+		Execution: exec,
+		RunID:     1,
+	})
+	assert.NilError(t, err)
+	assert.NilError(t, handler.Close())
+
+	expected := []string{
+		rerun[0], first[1], first[2], rerun[1], rerun[2], first[6], first[7],
+		rerun[3], rerun[4],
+		first[10], first[11], first[12], first[13],
+	}
+	assert.Equal(t, buf.String(), strings.Join(expected, "\n")+"\n")
+}
@@ -5,12 +5,15 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"os/signal"
+	"strconv"
 	"strings"
 	"sync/atomic"
 	"syscall"
+	"time"
 
 	"github.com/dnephin/pflag"
 	"github.com/fatih/color"
@@ -31,6 +34,23 @@ func Run(name string, args []string) error {
 	}
 	opts.args = flags.Args()
 	setupLogging(opts)
+	if flags.Changed("rerun-fails") && opts.rerunFailsMaxAttempts == 0 {
+		log.Warnf("--rerun-fails=0 disables re-running failed tests, "+
+			"use --rerun-fails to re-run them up to %d times", defaultRerunFailsMaxAttempts)
+	}
+	if err := readPackagesFile(opts); err != nil {
+		return err
+	}
+	var err error
+	if opts.expectedFails, err = readExpectedFailsFile(opts.expectedFailsFile); err != nil {
+		return err
+	}
+	if opts.rerunFailsMatrix, err = readRerunFailsMatrixJSON(opts.rerunFailsMatrixFile); err != nil {
+		return err
+	}
+	if opts.failOnSkipAllowed, err = readTestListFile(opts.failOnSkipAllowFile, "fail on skip allow file"); err != nil {
+		return err
+	}
 
 	switch {
 	case opts.version:
@@ -42,14 +62,31 @@ func Run(name string, args []string) error {
 	return run(opts)
 }
 
+// defaultRerunFailsMaxAttempts is the number of reruns used when --rerun-fails
+// is set without a value.
+const defaultRerunFailsMaxAttempts = 2
+
+// defaultCollapseRepeats is the value of --format-collapse-repeats when the
+// flag is set without a value.
+const defaultCollapseRepeats = 3
+
 func setupFlags(name string) (*pflag.FlagSet, *options) {
 	opts := &options{
-		hideSummary:                  newHideSummaryValue(),
-		junitTestCaseClassnameFormat: &junitFieldFormatValue{},
-		junitTestSuiteNameFormat:     &junitFieldFormatValue{},
-		postRunHookCmd:               &commandValue{},
-		stdout:                       color.Output,
-		stderr:                       color.Error,
+		hideSummary:                   newHideSummaryValue(),
+		junitTestCaseClassnameFormat:  &junitFieldFormatValue{},
+		junitTestSuiteNameFormat:      &junitFieldFormatValue{},
+		junitTestCaseTime:             &junitTestCaseTimeValue{},
+		metadata:                      &metadataValue{},
+		changedSinceExtraMap:          &fileMapValue{},
+		failOnTestCountDrop:           &percentValue{},
+		rerunFailsPackageTimeoutScale: &packageScaleValue{},
+		rerunFailsOutputTemplate:      &templateValue{},
+		logLevel:                      &logLevelValue{value: log.WarnLevel},
+		logFormat:                     &logFormatValue{value: log.TextFormat},
+		postRunHookCmd:                &commandValue{},
+		onTestFailCmd:                 &commandValue{},
+		stdout:                        color.Output,
+		stderr:                        color.Error,
 	}
 	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
 	flags.SetInterspersed(false)
@@ -68,32 +105,94 @@ func setupFlags(name string) (*pflag.FlagSet, *options) {
 	flags.StringVar(&opts.formatOptions.Icons, "format-icons",
 		lookEnvWithDefault("GOTESTSUM_FORMAT_ICONS", ""),
 		"use different icons, see help for options")
+	flags.IntVar(&opts.formatOptions.WideNameWidth, "format-wide-name-width",
+		testjson.DefaultWideNameWidth,
+		"in the wide format truncate test names longer than this width, -1 to disable")
+	flags.BoolVar(&opts.formatOptions.QuietPassing, "quiet-passing", false,
+		"in the standard-verbose format only print the output of tests that fail or are skipped")
+	opts.formatOptions.Options = make(map[string]string)
+	flags.Var(keyValueMap(opts.formatOptions.Options), "format-option",
+		"set an option of the format, may be repeated, see help for the options of each format")
+	flags.BoolVar(&opts.dryRun, "dry-run", false,
+		"print the go test command that would be run, without running it")
 	flags.BoolVar(&opts.rawCommand, "raw-command", false,
 		"don't prepend 'go test -json' to the 'go test' command")
+	flags.BoolVar(&opts.multiStream, "multi-stream", false,
+		"with --raw-command, read the paths of test2json streams from the output of the command, and scan the streams concurrently")
 	flags.BoolVar(&opts.ignoreNonJSONOutputLines, "ignore-non-json-output-lines", false,
 		"write non-JSON 'go test' output lines to stderr instead of failing")
 	flags.Lookup("ignore-non-json-output-lines").Hidden = true
 	flags.StringVar(&opts.jsonFile, "jsonfile",
 		lookEnvWithDefault("GOTESTSUM_JSONFILE", ""),
 		"write all TestEvents to file")
+	flags.StringVar(&opts.jsonFileFilter, "jsonfile-filter", jsonFileFilterAll,
+		"TestEvents written to --jsonfile, one of: all, failed")
+	flags.BoolVar(&opts.jsonFileFlattenReruns, "jsonfile-flatten-reruns", false,
+		"write only the events of the final run of each test to --jsonfile")
 	flags.StringVar(&opts.jsonFileTimingEvents, "jsonfile-timing-events",
 		lookEnvWithDefault("GOTESTSUM_JSONFILE_TIMING_EVENTS", ""),
 		"write only the pass, skip, and fail TestEvents to the file")
 	flags.BoolVar(&opts.noColor, "no-color", defaultNoColor(), "disable color output")
+	flags.BoolVar(&opts.forceColor, "force-color", false,
+		"enable color output even when stdout is not a terminal, overrides --no-color")
 
 	flags.Var(opts.hideSummary, "no-summary",
 		"do not print summary of: "+testjson.SummarizeAll.String())
 	flags.Lookup("no-summary").Hidden = true
 	flags.Var(opts.hideSummary, "hide-summary",
 		"hide sections of the summary: "+testjson.SummarizeAll.String())
+	flags.IntVar(&opts.showFailureSource, "show-failure-source", 0,
+		"print this number of lines of source around the location of each failure in the summary")
+	flags.Lookup("show-failure-source").NoOptDefVal = strconv.Itoa(defaultFailureSourceContext)
+	flags.BoolVar(&opts.reportIncomplete, "report-incomplete", false,
+		"print the tests that started but never finished in the summary")
+	flags.IntVar(&opts.formatCollapseRepeats, "format-collapse-repeats", 0,
+		"in the summary collapse this number or more identical consecutive output lines of a failed test into one line")
+	flags.Lookup("format-collapse-repeats").NoOptDefVal = strconv.Itoa(defaultCollapseRepeats)
+	flags.BoolVar(&opts.summaryDurationHistogram, "summary-duration-histogram", false,
+		"print the number of tests in each duration bucket (<10ms, <100ms, <1s, <10s, >=10s) in the summary")
+	flags.BoolVar(&opts.summaryPassRate, "summary-pass-rate", false,
+		"print the percentage of test runs that passed in the summary, skipped tests are not counted")
+	flags.BoolVar(&opts.summaryPassRateIncludeSkipped, "summary-pass-rate-include-skipped", false,
+		"count skipped tests as not passed in the --summary-pass-rate")
+	flags.BoolVar(&opts.summaryRunCount, "summary-run-count", false,
+		"print the number of times each failed test was run in the summary, when it ran more than once")
+	flags.BoolVar(&opts.summaryWarnings, "summary-warnings", false,
+		"print the warnings from go test, like 'no tests to run' and go vet problems, in the summary")
+	flags.BoolVar(&opts.summarySkippedReasons, "summary-skipped-reasons", false,
+		"print the skipped tests grouped by the message passed to t.Skip in the summary")
+	flags.BoolVar(&opts.summaryDataRaces, "summary-data-races", false,
+		"list failed tests which reported a data race in a separate section of the summary")
+	flags.IntVar(&opts.raceExitCode, "race-exit-code", 0,
+		"exit with this code, instead of 1, when every failed test reported a data race")
 	flags.Var(opts.postRunHookCmd, "post-run-command",
 		"command to run after the tests have completed")
+	flags.Var(opts.onTestFailCmd, "on-test-fail-command",
+		"command to run when a test fails, with the package and test name as arguments")
 	flags.BoolVar(&opts.watch, "watch", false,
 		"watch go files, and run tests when a file is modified")
 	flags.BoolVar(&opts.watchChdir, "watch-chdir", false,
 		"in watch mode change the working directory to the directory with the modified file before running tests")
+	flags.DurationVar(&opts.watchDebounce, "watch-debounce", 200*time.Millisecond,
+		"in watch mode wait this long after the last file change before running tests")
+	flags.DurationVar(&opts.timeout, "timeout", 0,
+		"stop 'go test', and any reruns, when the whole run takes longer than this duration")
 	flags.IntVar(&opts.maxFails, "max-fails", 0,
 		"end the test run after this number of failures")
+	flags.IntVar(&opts.maxFailsOutput, "max-fails-output", 0,
+		"include the output of at most this number of failures in the summary and junit.xml file")
+	flags.BoolVar(&opts.failOnNoTests, "fail-on-no-tests", false,
+		"exit non-zero if any package has no tests, or the -run pattern matched no tests")
+	flags.BoolVar(&opts.failOnVet, "fail-on-vet", false,
+		"exit non-zero if go vet reported any problems")
+	flags.StringVar(&opts.expectedFailsFile, "expected-fails-file", "",
+		"file with a list of package.TestName, one per line, of tests that are expected to fail")
+	flags.BoolVar(&opts.failOnUnexpectedPass, "fail-on-unexpected-pass", false,
+		"exit non-zero if any test listed in --expected-fails-file passed")
+	flags.BoolVar(&opts.failOnSkip, "fail-on-skip", false,
+		"exit non-zero if any test was skipped")
+	flags.StringVar(&opts.failOnSkipAllowFile, "fail-on-skip-allow-file", "",
+		"file with a list of package.TestName, one per line, of tests that are allowed to skip with --fail-on-skip")
 
 	flags.StringVar(&opts.junitFile, "junitfile",
 		lookEnvWithDefault("GOTESTSUM_JUNITFILE", ""),
@@ -102,26 +201,140 @@ func setupFlags(name string) (*pflag.FlagSet, *options) {
 		"format the testsuite name field as: "+junitFieldFormatValues)
 	flags.Var(opts.junitTestCaseClassnameFormat, "junitfile-testcase-classname",
 		"format the testcase classname field as: "+junitFieldFormatValues)
+	flags.Var(opts.junitTestCaseTime, "junitfile-time",
+		"for tests that were run more than once, set the testcase time from the run: "+junitTestCaseTimeValues+
+			" (default: each run uses its own time)")
 	flags.StringVar(&opts.junitProjectName, "junitfile-project-name",
 		lookEnvWithDefault("GOTESTSUM_JUNITFILE_PROJECT_NAME", ""),
 		"name of the project used in the junit.xml file")
 	flags.BoolVar(&opts.junitHideEmptyPackages, "junitfile-hide-empty-pkg",
 		truthyFlag(lookEnvWithDefault("GOTESTSUM_JUNIT_HIDE_EMPTY_PKG", "")),
 		"omit packages with no tests from the junit.xml file")
+	flags.IntVar(&opts.junitMaxOutputBytes, "junitfile-max-output-bytes", 0,
+		"truncate the output of each testcase in the junit.xml file to this number of bytes, keeping the start and end")
+	flags.Var(opts.metadata, "metadata",
+		"add a key=value property to the testsuites element of the junit.xml file, may be repeated")
 
 	flags.IntVar(&opts.rerunFailsMaxAttempts, "rerun-fails", 0,
 		"rerun failed tests until they all pass, or attempts exceeds maximum. Defaults to max 2 reruns when enabled")
-	flags.Lookup("rerun-fails").NoOptDefVal = "2"
+	flags.Lookup("rerun-fails").NoOptDefVal = strconv.Itoa(defaultRerunFailsMaxAttempts)
 	flags.IntVar(&opts.rerunFailsMaxInitialFailures, "rerun-fails-max-failures", 10,
 		"do not rerun any tests if the initial run has more than this number of failures")
+	flags.IntVar(&opts.rerunFailsMaxTotalFailures, "rerun-fails-max-total-failures", 0,
+		"stop rerunning tests when the number of failures from all reruns exceeds this number")
+	flags.Var(opts.rerunFailsPackageTimeoutScale, "rerun-fails-package-timeout-scale",
+		"multiply the -timeout of reruns of the package by this value, may be repeated")
+	flags.BoolVar(&opts.rerunFailsSortByDuration, "rerun-fails-sort-by-duration", false,
+		"rerun the fastest failed tests first")
+	flags.BoolVar(&opts.rerunFailsTagOutput, "rerun-fails-tag-output", false,
+		"prefix each line of output from a rerun with [rerun-N], where N is the attempt")
+	flags.BoolVar(&opts.rerunFailsNoCoverprofile, "rerun-fails-no-coverprofile", false,
+		"do not write a coverprofile for reruns, the coverprofile from the first run is not changed")
+	flags.Float64Var(&opts.rerunFailsFlakinessThreshold, "rerun-fails-flakiness-threshold", 0,
+		"tests that were rerun with a pass rate below this value (0.0-1.0) are reported as broken, and fail the run")
 	flags.Var((*stringSlice)(&opts.packages), "packages",
 		"space separated list of package to test")
+	flags.StringVar(&opts.packagesFile, "packages-file", "",
+		"read a list of packages to test from the file, one per line, in addition to --packages")
 	flags.StringVar(&opts.rerunFailsReportFile, "rerun-fails-report", "",
 		"write a report to the file, of the tests that were rerun")
+	flags.StringVar(&opts.rerunFailsReportFormat, "rerun-fails-report-format", rerunReportFormatCounts,
+		"format of the --rerun-fails-report, one of: counts, pass-rate")
+	flags.StringVar(&opts.rerunFailsWriteIDsFile, "rerun-fails-write-ids-file", "",
+		"write the names of the tests that were rerun to the file, one per line")
+	flags.Var(opts.rerunFailsOutputTemplate, "rerun-fails-output-template",
+		"go template printed before the output of each rerun test, with the fields "+
+			".Package, .Test, .Attempt, and .Index")
+	flags.BoolVar(&opts.rerunFailsGroupByPackage, "rerun-fails-group-by-package", false,
+		"print the results of the reruns grouped by package after all reruns, instead of a summary before each attempt")
+	flags.StringVar(&opts.rerunFailsGraphFile, "rerun-fails-generate-graph", "",
+		"write a GraphViz DOT file of the packages that were rerun, with edges between packages that failed in the same rerun attempts")
+	flags.StringVar(&opts.rerunFailsMatrixFile, "rerun-fails-matrix", "",
+		"JSON file with a list of go test flag sets, each failed test is also run once with every set")
+	flags.StringVar(&opts.rerunFailsOutputFormat, "rerun-fails-output-format", "",
+		"print format used for the output of reruns, instead of --format")
+	flags.StringVar(&opts.rerunFailsUploadURL, "rerun-fails-upload", "",
+		"POST a JSON report of the tests that were rerun to this URL")
+	flags.DurationVar(&opts.rerunFailsUploadTimeout, "rerun-fails-upload-timeout", 10*time.Second,
+		"maximum time to wait for the --rerun-fails-upload request")
 	flags.BoolVar(&opts.rerunFailsRunRootCases, "rerun-fails-run-root-test", false,
 		"rerun the entire root testcase when any of its subtests fail, instead of only the failed subtest")
+	flags.IntVar(&opts.rerunFailsMaxPackageBinarySizeKB, "rerun-fails-max-package-binary-size-kb", 0,
+		"do not rerun failed tests in packages with a test binary larger than this size in KB")
+	flags.StringVar(&opts.rerunFailsRecordTo, "rerun-fails-record-to", "",
+		"append a JSON line for every run of the tests that have failed to this file")
+	flags.StringVar(&opts.rerunFailsJSONSummary, "rerun-fails-json-summary", "",
+		"append a JSON line with the results of each rerun attempt to this file")
+	flags.BoolVar(&opts.rerunFailsIgnoreBuildErrors, "rerun-fails-ignore-build-errors", false,
+		"rerun failed tests in other packages when a package fails to build, instead of aborting all reruns")
+	flags.IntSliceVar(&opts.rerunFailsOnExitCode, "rerun-fails-on-exit-code", nil,
+		"only rerun failed tests when the exit code of go test is one of these values")
+	flags.BoolVar(&opts.rerunFailsVerboseLastAttempt, "rerun-fails-verbose-last-attempt", false,
+		"add -test.v to the args of the last rerun attempt, requires --raw-command")
+	flags.BoolVar(&opts.rerunFailsCleanEnv, "rerun-fails-clean-env", false,
+		"run each rerun with a clean environment and a new empty temp directory")
+	flags.BoolVar(&opts.rerunFailsRaceEscalate, "rerun-fails-race-escalate", false,
+		"remove -race from the go test args of the first rerun attempt, later attempts use -race when it was set")
+	flags.StringVar(&opts.rerunFailsTestBinaryCache, "rerun-fails-test-binary-cache", "",
+		"compile the test binary of each package with failed tests into this directory, and rerun the tests with the binary")
+	flags.StringVar(&opts.rerunFailsBeforeHook, "rerun-fails-before-hook", "",
+		"shell command to run before each rerun attempt, the attempt is skipped when the command fails")
+	flags.StringVar(&opts.rerunFailsAfterHook, "rerun-fails-after-hook", "",
+		"shell command to run after each rerun attempt")
+	flags.BoolVar(&opts.strictRerun, "strict-rerun", false,
+		"fail the run when the rerun of a failed test does not run that test, instead of printing a warning")
+	flags.BoolVar(&opts.rerunFailsContinueOnPanic, "rerun-fails-continue-on-panic", false,
+		"rerun failed tests even when the previous run had a suspected panic")
+	flags.BoolVar(&opts.rerunFailsStreaming, "rerun-fails-experimental-streaming", false,
+		"(experimental) start rerunning the failures in a package as soon as the package completes")
+	flags.BoolVar(&opts.rerunFailsSerialPackages, "rerun-fails-serial-packages", false,
+		"with --rerun-fails-experimental-streaming rerun the failures of only one package at a time")
+	flags.IntVar(&opts.shuffleIterations, "shuffle-iterations", 0,
+		"run the tests this number of times with -shuffle=on, and report the seeds of any failures")
+	flags.StringVar(&opts.shufflePackages, "shuffle-packages", "",
+		"pass the packages to go test in a random order, using the seed if one is specified")
+	flags.Lookup("shuffle-packages").NoOptDefVal = "on"
+
+	flags.StringVar(&opts.skipUnchangedFile, "skip-unchanged", "",
+		"do not test packages which are unchanged since they last passed, using the state stored in this file")
+	flags.Var((*stringSlice)(&opts.skipUnchangedIgnore), "skip-unchanged-ignore",
+		"space separated list of file globs to ignore when checking if a package changed")
+
+	flags.StringVar(&opts.changedSince, "changed-since", "",
+		"only test packages with files changed since this git ref, and the packages that depend on them")
+	flags.Var(opts.changedSinceExtraMap, "changed-since-extra-map",
+		"map changed files that match the glob to the package in dir, or ignore them if dir is empty, may be repeated")
+
+	flags.StringVar(&opts.skipReportFile, "skip-report-file", "",
+		"write the skipped tests, grouped by the reason they were skipped, to this file as JSON")
+	flags.StringVar(&opts.errorsFile, "errors-file", "",
+		"write the file:line of each test failure to this file, in a format used by the quickfix list of editors")
+
+	flags.StringVar(&opts.metricsFile, "metrics-file", "",
+		"write metrics of the test run to this file in the Prometheus text format")
+	flags.StringVar(&opts.metricsPushURL, "metrics-push-url", "",
+		"push metrics of the test run to the Prometheus Pushgateway at this URL")
+	flags.StringVar(&opts.metricsPushJob, "metrics-push-job", "gotestsum",
+		"job label used by --metrics-push-url")
+	flags.StringVar(&opts.metricsPushInstance, "metrics-push-instance", "",
+		"instance label used by --metrics-push-url")
+	flags.StringVar(&opts.otelEndpoint, "otel-endpoint", "",
+		"export an OpenTelemetry trace of the test run to the OTLP/HTTP collector at this URL")
+	flags.BoolVar(&opts.otelExport, "otel-export", false,
+		"export an OpenTelemetry trace of the test run to the endpoint from the OTEL_EXPORTER_OTLP_* environment variables")
+
+	flags.StringVar(&opts.testCountFile, "test-count-file", "",
+		"compare the number of tests run by each package to the counts stored in this file, and update the file after a successful run")
+	flags.Var(opts.failOnTestCountDrop, "fail-on-test-count-drop",
+		"exit non-zero when the test count of a package drops by more than this percentage, requires --test-count-file")
+	flags.BoolVar(&opts.updateTestCounts, "update-test-counts", false,
+		"replace the counts in --test-count-file with the counts from this run, instead of reporting any drops")
 
 	flags.BoolVar(&opts.debug, "debug", false, "enabled debug logging")
+	flags.Var(opts.logLevel, "log-level",
+		"minimum level of the messages logged to stderr: debug, info, warn, error")
+	flags.Var(opts.logFormat, "log-format",
+		"format of the messages logged to stderr: "+logFormatValues)
 	flags.BoolVar(&opts.version, "version", false, "show version and exit")
 	return flags, opts
 }
@@ -148,6 +361,16 @@ Formats:
     github-actions           testname format with github actions log grouping
     standard-quiet           standard go test format
     standard-verbose         standard go test -v format
+    standard-verbose-color   standard go test -v format, always in color
+    tap                      TAP version 13 stream for each package
+    plain-verbose-package    standard go test -v format, grouped by package
+    wide                     print a row for each test with aligned columns
+
+Format options, set with --format-option key=value:
+    pkgname-and-test-fails
+        max_failures=int     print the output of at most this many failed tests, 0 for no limit
+    plain-verbose-package
+        show_passed=bool     print the output of passing tests
 
 Format icons:
     default                  the original unicode (✓, ∅, ✖)
@@ -171,31 +394,133 @@ func lookEnvWithDefault(key, defValue string) string {
 }
 
 type options struct {
-	args                         []string
-	format                       string
-	formatOptions                testjson.FormatOptions
-	debug                        bool
-	rawCommand                   bool
-	ignoreNonJSONOutputLines     bool
-	jsonFile                     string
-	jsonFileTimingEvents         string
-	junitFile                    string
-	postRunHookCmd               *commandValue
-	noColor                      bool
-	hideSummary                  *hideSummaryValue
-	junitTestSuiteNameFormat     *junitFieldFormatValue
-	junitTestCaseClassnameFormat *junitFieldFormatValue
-	junitProjectName             string
-	junitHideEmptyPackages       bool
-	rerunFailsMaxAttempts        int
-	rerunFailsMaxInitialFailures int
-	rerunFailsReportFile         string
-	rerunFailsRunRootCases       bool
-	packages                     []string
-	watch                        bool
-	watchChdir                   bool
-	maxFails                     int
-	version                      bool
+	args                             []string
+	format                           string
+	formatOptions                    testjson.FormatOptions
+	debug                            bool
+	rawCommand                       bool
+	dryRun                           bool
+	multiStream                      bool
+	ignoreNonJSONOutputLines         bool
+	jsonFile                         string
+	jsonFileFilter                   string
+	jsonFileFlattenReruns            bool
+	jsonFileTimingEvents             string
+	junitFile                        string
+	postRunHookCmd                   *commandValue
+	onTestFailCmd                    *commandValue
+	noColor                          bool
+	forceColor                       bool
+	hideSummary                      *hideSummaryValue
+	showFailureSource                int
+	reportIncomplete                 bool
+	summaryDurationHistogram         bool
+	summaryPassRate                  bool
+	summaryPassRateIncludeSkipped    bool
+	summaryWarnings                  bool
+	summarySkippedReasons            bool
+	summaryRunCount                  bool
+	summaryDataRaces                 bool
+	raceExitCode                     int
+	formatCollapseRepeats            int
+	junitTestSuiteNameFormat         *junitFieldFormatValue
+	junitTestCaseClassnameFormat     *junitFieldFormatValue
+	junitTestCaseTime                *junitTestCaseTimeValue
+	junitProjectName                 string
+	junitHideEmptyPackages           bool
+	junitMaxOutputBytes              int
+	metadata                         *metadataValue
+	logLevel                         *logLevelValue
+	logFormat                        *logFormatValue
+	rerunFailsMaxAttempts            int
+	rerunFailsMaxInitialFailures     int
+	rerunFailsMaxTotalFailures       int
+	rerunFailsReportFile             string
+	rerunFailsWriteIDsFile           string
+	rerunFailsTagOutput              bool
+	rerunFailsFlakinessThreshold     float64
+	rerunFailsReportFormat           string
+	rerunFailsNoCoverprofile         bool
+	rerunFailsSortByDuration         bool
+	rerunFailsPackageTimeoutScale    *packageScaleValue
+	rerunFailsOutputTemplate         *templateValue
+	rerunFailsOutputFormat           string
+	rerunFailsMatrixFile             string
+	rerunFailsGroupByPackage         bool
+	rerunFailsGraphFile              string
+	rerunFailsUploadURL              string
+	rerunFailsUploadTimeout          time.Duration
+	rerunFailsRunRootCases           bool
+	rerunFailsMaxPackageBinarySizeKB int
+	rerunFailsTestBinaryCache        string
+	rerunFailsVerboseLastAttempt     bool
+	rerunFailsRaceEscalate           bool
+	rerunFailsCleanEnv               bool
+	rerunFailsIgnoreBuildErrors      bool
+	rerunFailsRecordTo               string
+	rerunFailsJSONSummary            string
+	rerunFailsBeforeHook             string
+	rerunFailsAfterHook              string
+	rerunFailsContinueOnPanic        bool
+	rerunFailsOnExitCode             []int
+	strictRerun                      bool
+	rerunFailsStreaming              bool
+	rerunFailsSerialPackages         bool
+	shuffleIterations                int
+	shufflePackages                  string
+	skipUnchangedFile                string
+	skipUnchangedIgnore              []string
+	changedSince                     string
+	changedSinceExtraMap             *fileMapValue
+	testCountFile                    string
+	otelEndpoint                     string
+	otelExport                       bool
+	skipReportFile                   string
+	errorsFile                       string
+	metricsFile                      string
+	metricsPushURL                   string
+	metricsPushJob                   string
+	metricsPushInstance              string
+	failOnTestCountDrop              *percentValue
+	updateTestCounts                 bool
+	packages                         []string
+	packagesFile                     string
+	watch                            bool
+	watchChdir                       bool
+	watchDebounce                    time.Duration
+	timeout                          time.Duration
+	maxFails                         int
+	maxFailsOutput                   int
+	failOnNoTests                    bool
+	failOnVet                        bool
+	expectedFailsFile                string
+	failOnUnexpectedPass             bool
+	failOnSkip                       bool
+	failOnSkipAllowFile              string
+	version                          bool
+
+	// skipUnchanged is the state loaded from skipUnchangedFile.
+	skipUnchanged *unchangedState
+	// changedSinceState is the result of selecting packages by changedSince.
+	changedSinceState *changedSinceState
+	// otelTracer records the spans of the run when otelEndpoint or otelExport
+	// is set.
+	otelTracer *otelTracer
+	// flakiness records the tests that were rerun by --rerun-fails, and the
+	// attempt when each test first passed.
+	flakiness *flakinessTracker
+	// expectedFails are the tests read from expectedFailsFile.
+	expectedFails *expectedFails
+	// rerunFailsMatrix are the flag sets read from rerunFailsMatrixFile.
+	rerunFailsMatrix []matrixFlagSet
+	// failOnSkipAllowed are the tests read from failOnSkipAllowFile.
+	failOnSkipAllowed *expectedFails
+	// rerunBinarySizes is set by rerunFailsFilter when
+	// --rerun-fails-max-package-binary-size-kb is used.
+	rerunBinarySizes *binarySizes
+	// rerunTestBinaries is set by rerunFailedFrom when
+	// --rerun-fails-test-binary-cache is used.
+	rerunTestBinaries *testBinaryCache
 
 	// shims for testing
 	stdout io.Writer
@@ -212,6 +537,199 @@ func (o options) Validate() error {
 		return fmt.Errorf("-failfast can not be used with --rerun-fails " +
 			"because not all test cases will run")
 	}
+	if o.failOnUnexpectedPass && o.expectedFailsFile == "" {
+		return fmt.Errorf("--fail-on-unexpected-pass requires --expected-fails-file")
+	}
+	if o.failOnSkipAllowFile != "" && !o.failOnSkip {
+		return fmt.Errorf("--fail-on-skip-allow-file requires --fail-on-skip")
+	}
+	if o.multiStream && !o.rawCommand {
+		return fmt.Errorf("--multi-stream requires --raw-command")
+	}
+	if o.multiStream && o.rerunFailsMaxAttempts > 0 {
+		return fmt.Errorf("--multi-stream can not be used with --rerun-fails")
+	}
+	if o.skipUnchangedFile != "" && o.rawCommand {
+		return fmt.Errorf("--skip-unchanged can not be used with --raw-command")
+	}
+	if o.skipUnchangedFile != "" && len(o.args) > 0 && len(o.packages) == 0 {
+		return fmt.Errorf(
+			"when go test args are used with --skip-unchanged " +
+				"the list of packages to test must be specified by the --packages flag")
+	}
+	if o.changedSince != "" && o.rawCommand {
+		return fmt.Errorf("--changed-since can not be used with --raw-command")
+	}
+	if o.changedSince != "" && len(o.args) > 0 && len(o.packages) == 0 {
+		return fmt.Errorf(
+			"when go test args are used with --changed-since " +
+				"the list of packages to test must be specified by the --packages flag")
+	}
+	if o.shufflePackages != "" {
+		if _, err := parseShufflePackagesSeed(o.shufflePackages); err != nil {
+			return err
+		}
+	}
+	if o.shufflePackages != "" && !o.rawCommand && len(o.args) > 0 && len(o.packages) == 0 {
+		return fmt.Errorf(
+			"when go test args are used with --shuffle-packages " +
+				"the list of packages to test must be specified by the --packages flag")
+	}
+	if _, ok := o.failOnTestCountDrop.Value(); ok && o.testCountFile == "" {
+		return fmt.Errorf("--fail-on-test-count-drop requires --test-count-file")
+	}
+	if o.updateTestCounts && o.testCountFile == "" {
+		return fmt.Errorf("--update-test-counts requires --test-count-file")
+	}
+	if o.rerunFailsMaxAttempts < 0 {
+		return fmt.Errorf("--rerun-fails must not be negative")
+	}
+	if o.rerunFailsStreaming && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-experimental-streaming requires --rerun-fails")
+	}
+	if o.rerunFailsSerialPackages && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-serial-packages requires --rerun-fails")
+	}
+	if o.rerunFailsSerialPackages && !o.rerunFailsStreaming {
+		return fmt.Errorf("--rerun-fails-serial-packages requires --rerun-fails-experimental-streaming")
+	}
+	if o.rerunFailsGraphFile != "" && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-generate-graph requires --rerun-fails")
+	}
+	if o.rerunFailsGroupByPackage && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-group-by-package requires --rerun-fails")
+	}
+	if o.rerunFailsMatrixFile != "" && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-matrix requires --rerun-fails")
+	}
+	if o.rerunFailsMatrixFile != "" && o.rawCommand {
+		return fmt.Errorf("--rerun-fails-matrix can not be used with --raw-command")
+	}
+	if o.rerunFailsOutputFormat != "" && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-output-format requires --rerun-fails")
+	}
+	if o.rerunFailsTagOutput && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-tag-output requires --rerun-fails")
+	}
+	if (o.rerunFailsBeforeHook != "" || o.rerunFailsAfterHook != "") && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-before-hook and --rerun-fails-after-hook require --rerun-fails")
+	}
+	if (o.rerunFailsBeforeHook != "" || o.rerunFailsAfterHook != "") && o.rerunFailsStreaming {
+		return fmt.Errorf("--rerun-fails-before-hook and --rerun-fails-after-hook " +
+			"can not be used with --rerun-fails-experimental-streaming")
+	}
+	if err := testjson.ValidateFormatOptions(o.format, o.formatOptions.Options); err != nil {
+		return fmt.Errorf("invalid --format-option: %w", err)
+	}
+	switch o.jsonFileFilter {
+	case "", jsonFileFilterAll, jsonFileFilterFailed:
+	default:
+		return fmt.Errorf("invalid --jsonfile-filter %q, must be one of: all, failed", o.jsonFileFilter)
+	}
+	if o.jsonFileFlattenReruns && o.jsonFileFilter == jsonFileFilterFailed {
+		return fmt.Errorf("--jsonfile-flatten-reruns can not be used with --jsonfile-filter=failed")
+	}
+	if o.dryRun && o.watch {
+		return fmt.Errorf("--dry-run can not be used with --watch")
+	}
+	if o.strictRerun && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--strict-rerun requires --rerun-fails")
+	}
+	if o.rerunFailsMaxPackageBinarySizeKB < 0 {
+		return fmt.Errorf("--rerun-fails-max-package-binary-size-kb must not be negative")
+	}
+	if o.rerunFailsMaxPackageBinarySizeKB > 0 && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-max-package-binary-size-kb requires --rerun-fails")
+	}
+	if o.rerunFailsRecordTo != "" && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-record-to requires --rerun-fails")
+	}
+	if o.rerunFailsJSONSummary != "" && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-json-summary requires --rerun-fails")
+	}
+	if o.rerunFailsIgnoreBuildErrors && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-ignore-build-errors requires --rerun-fails")
+	}
+	if len(o.rerunFailsOnExitCode) > 0 {
+		if o.rerunFailsMaxAttempts == 0 {
+			return fmt.Errorf("--rerun-fails-on-exit-code requires --rerun-fails")
+		}
+		if o.rerunFailsStreaming {
+			return fmt.Errorf("--rerun-fails-on-exit-code can not be used with --rerun-fails-experimental-streaming")
+		}
+		for _, code := range o.rerunFailsOnExitCode {
+			if code < 1 || code > 255 {
+				return fmt.Errorf("--rerun-fails-on-exit-code must be between 1 and 255, got %d", code)
+			}
+		}
+	}
+	if o.rerunFailsVerboseLastAttempt && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-verbose-last-attempt requires --rerun-fails")
+	}
+	if o.rerunFailsVerboseLastAttempt && !o.rawCommand {
+		return fmt.Errorf("--rerun-fails-verbose-last-attempt requires --raw-command, " +
+			"go test -json is always verbose")
+	}
+	if o.rerunFailsCleanEnv && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-clean-env requires --rerun-fails")
+	}
+	if o.rerunFailsRaceEscalate && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-race-escalate requires --rerun-fails")
+	}
+	if o.rerunFailsRaceEscalate && o.rawCommand {
+		return fmt.Errorf("--rerun-fails-race-escalate can not be used with --raw-command")
+	}
+	if o.rerunFailsRaceEscalate && o.rerunFailsTestBinaryCache != "" {
+		return fmt.Errorf("--rerun-fails-race-escalate can not be used with --rerun-fails-test-binary-cache")
+	}
+	if o.rerunFailsTestBinaryCache != "" && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-test-binary-cache requires --rerun-fails")
+	}
+	if o.rerunFailsTestBinaryCache != "" && o.rawCommand {
+		return fmt.Errorf("--rerun-fails-test-binary-cache can not be used with --raw-command")
+	}
+	if o.rerunFailsTestBinaryCache != "" && o.rerunFailsStreaming {
+		return fmt.Errorf("--rerun-fails-test-binary-cache can not be used with --rerun-fails-experimental-streaming")
+	}
+	if o.rerunFailsWriteIDsFile != "" && o.rerunFailsMaxAttempts == 0 {
+		return fmt.Errorf("--rerun-fails-write-ids-file requires --rerun-fails")
+	}
+	if o.shuffleIterations > 0 && o.rerunFailsMaxAttempts > 0 {
+		return fmt.Errorf("--shuffle-iterations can not be used with --rerun-fails")
+	}
+	if o.rerunFailsMaxTotalFailures < 0 {
+		return fmt.Errorf("--rerun-fails-max-total-failures must not be negative")
+	}
+	if o.rerunFailsFlakinessThreshold < 0 || o.rerunFailsFlakinessThreshold > 1 {
+		return fmt.Errorf("--rerun-fails-flakiness-threshold must be between 0.0 and 1.0")
+	}
+	switch o.rerunFailsReportFormat {
+	case "", rerunReportFormatCounts, rerunReportFormatPassRate:
+	default:
+		return fmt.Errorf("invalid --rerun-fails-report-format %q, must be one of: counts, pass-rate",
+			o.rerunFailsReportFormat)
+	}
+	if o.summaryPassRateIncludeSkipped && !o.summaryPassRate {
+		return fmt.Errorf("--summary-pass-rate-include-skipped requires --summary-pass-rate")
+	}
+	if o.raceExitCode < 0 || o.raceExitCode > 255 {
+		return fmt.Errorf("--race-exit-code must be between 0 and 255")
+	}
+	if o.timeout < 0 {
+		return fmt.Errorf("--timeout must not be negative")
+	}
+	if o.timeout > 0 && o.watch {
+		return fmt.Errorf("--timeout can not be used with --watch")
+	}
+	if o.formatCollapseRepeats < 0 {
+		return fmt.Errorf("--format-collapse-repeats must not be negative")
+	}
+	if o.maxFailsOutput < 0 {
+		return fmt.Errorf("--max-fails-output must not be negative")
+	}
+	if o.junitMaxOutputBytes < 0 {
+		return fmt.Errorf("--junitfile-max-output-bytes must not be negative")
+	}
 	return nil
 }
 
@@ -250,27 +768,63 @@ func defaultNoColor() bool {
 }
 
 func setupLogging(opts *options) {
+	log.SetLevel(opts.logLevel.value)
 	if opts.debug {
 		log.SetLevel(log.DebugLevel)
 	}
-	color.NoColor = opts.noColor
+	log.SetFormat(opts.logFormat.value)
+	color.NoColor = opts.noColor && !opts.forceColor
 }
 
 func run(opts *options) error {
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := withRunTimeout(context.Background(), opts)
 	defer cancel()
 
 	if err := opts.Validate(); err != nil {
 		return err
 	}
+	var err error
+	if opts.changedSinceState, err = selectChangedPackages(opts); err != nil {
+		return err
+	}
+	if opts.changedSinceState != nil && len(opts.packages) == 0 {
+		fmt.Fprintf(opts.stdout, "No packages changed since %v\n", opts.changedSince)
+		if opts.dryRun {
+			return nil
+		}
+		exec, err := testjson.ScanTestOutput(testjson.ScanConfig{Stdout: strings.NewReader("")})
+		return finishRun(opts, exec, err)
+	}
+	if opts.skipUnchanged, err = skipUnchangedPackages(opts); err != nil {
+		return err
+	}
+	if opts.skipUnchanged != nil && len(opts.packages) == 0 {
+		fmt.Fprintln(opts.stdout, "No packages changed since they last passed")
+		if opts.dryRun {
+			return nil
+		}
+		exec, err := testjson.ScanTestOutput(testjson.ScanConfig{Stdout: strings.NewReader("")})
+		return finishRun(opts, exec, err)
+	}
+	if err := shufflePackages(opts); err != nil {
+		return err
+	}
+	if opts.dryRun {
+		return writeDryRun(opts)
+	}
+	if opts.shuffleIterations > 0 {
+		return runShuffleIterations(ctx, opts)
+	}
 
-	goTestProc, err := startGoTestFn(ctx, "", goTestCmdArgs(opts, rerunOpts{}))
+	goTestProc, err := startGoTestFn(ctx, "", nil, goTestCmdArgs(opts, rerunOpts{}))
 	if err != nil {
 		return err
 	}
+	outputRead := closeOutputOnTimeout(ctx, opts, goTestProc)
 
 	handler, err := newEventHandler(opts)
 	if err != nil {
+		outputRead()
 		return err
 	}
 	defer handler.Close() // nolint: errcheck
@@ -281,24 +835,48 @@ func run(opts *options) error {
 		Stop:                     cancel,
 		IgnoreNonJSONOutputLines: opts.ignoreNonJSONOutputLines,
 	}
-	exec, err := testjson.ScanTestOutput(cfg)
+	var streaming *streamingReruns
+	if opts.rerunFailsStreaming {
+		streaming = newStreamingReruns(ctx, opts, handler)
+		defer streaming.stop()
+		cfg.Handler = streaming
+	}
+	var exec *testjson.Execution
+	if opts.multiStream {
+		exec, err = scanMultiStream(cfg)
+	} else {
+		exec, err = testjson.ScanTestOutput(cfg)
+	}
+	outputRead()
 	handler.Flush()
 	if err != nil {
-		return finishRun(opts, exec, err)
+		return finishRun(opts, exec, runTimeoutErr(ctx, opts, err))
 	}
 
 	exitErr := goTestProc.cmd.Wait()
+	if err := runTimeoutErr(ctx, opts, nil); err != nil {
+		return finishRun(opts, exec, err)
+	}
 	if signum := atomic.LoadInt32(&goTestProc.signal); signum != 0 {
-		return finishRun(opts, exec, exitError{num: signalExitCode + int(signum)})
+		return finishRun(opts, exec, interruptedError(signum))
 	}
 	if exitErr == nil || opts.rerunFailsMaxAttempts == 0 {
 		return finishRun(opts, exec, exitErr)
 	}
-	if err := hasErrors(exitErr, exec); err != nil {
+	if len(opts.rerunFailsOnExitCode) > 0 && !isRerunExitCode(opts, ExitCodeWithDefault(exitErr)) {
+		return finishRun(opts, exec, exitErr)
+	}
+	if err := hasErrors(exitErr, exec, opts, ""); err != nil {
 		return finishRun(opts, exec, err)
 	}
 
-	failed := len(rerunFailsFilter(opts)(exec.Failed()))
+	initialFailures := rerunFailsFilter(opts, exec)(exec.Failed())
+	failed := len(initialFailures)
+	if failed == 0 && (opts.expectedFails != nil || rerunSkippedFailures(opts, exec)) {
+		// all the failures were expected by --expected-fails-file, or are in
+		// packages which are too large to rerun, or failed to build
+		return finishRun(opts, exec, exitErr)
+	}
 	if failed > opts.rerunFailsMaxInitialFailures {
 		err := fmt.Errorf(
 			"number of test failures (%d) exceeds maximum (%d) set by --rerun-fails-max-failures",
@@ -306,29 +884,156 @@ func run(opts *options) error {
 		return finishRun(opts, exec, err)
 	}
 
+	initialErr := exitErr
 	cfg = testjson.ScanConfig{Execution: exec, Handler: handler}
-	exitErr = rerunFailed(ctx, opts, cfg)
+	if streaming != nil {
+		exitErr = streaming.finish(ctx, cfg)
+	} else {
+		exitErr = rerunFailed(ctx, opts, cfg, initialErr)
+	}
+	exitErr = runTimeoutErr(ctx, opts, exitErr)
+	if exitErr == nil && rerunSkippedFailures(opts, exec) {
+		// the failures which were not rerun are still failures
+		exitErr = initialErr
+	}
+	if exitErr == nil {
+		exitErr = failOnBrokenTests(opts, exec)
+	}
 	handler.Flush()
 	if err := writeRerunFailsReport(opts, exec); err != nil {
 		return err
 	}
+	uploadRerunFailsReport(opts, exec)
+	writeRerunPackageSummary(opts, exec)
+	writeRerunGraph(opts, exec)
+	runRerunFailsMatrix(ctx, opts, initialFailures)
 	return finishRun(opts, exec, exitErr)
 }
 
+// summarySections returns the sections of the summary which are not hidden
+// by --hide-summary, and the sections enabled by other flags.
+func summarySections(opts *options) testjson.Summary {
+	summary := opts.hideSummary.value
+	if opts.summaryWarnings {
+		summary |= testjson.SummarizeWarnings
+	}
+	if opts.summarySkippedReasons {
+		summary |= testjson.SummarizeSkippedReasons
+	}
+	return summary
+}
+
 func finishRun(opts *options, exec *testjson.Execution, exitErr error) error {
-	testjson.PrintSummary(opts.stdout, exec, opts.hideSummary.value)
+	if isInterrupted(exitErr) {
+		fmt.Fprintln(opts.stdout, "\n=== Run interrupted, the results are incomplete")
+	}
+	if isRunTimeout(exitErr) {
+		fmt.Fprintf(opts.stdout, "\n=== Run stopped by gotestsum --timeout=%v, the results are incomplete\n",
+			opts.timeout)
+	}
+	// The metrics are written first, so that they are written even when one
+	// of the steps below returns an error.
+	if err := writeMetricsFile(opts, exec); err != nil {
+		return fmt.Errorf("failed to write metrics file: %w", err)
+	}
+	pushMetrics(opts, exec)
+	if !isInterrupted(exitErr) {
+		writeRerunRecords(opts, exec)
+	}
+	writeChangedSinceSummary(opts.stdout, opts.changedSinceState)
+	writeCachedPassSummary(opts.stdout, opts.skipUnchanged)
+	testCounts, err := compareTestCounts(opts, exec)
+	if err != nil {
+		return err
+	}
+	writeTestCountSummary(opts.stdout, testCounts)
+	unexpectedPasses := opts.expectedFails.unexpectedPasses(exec)
+	writeUnexpectedPassSummary(opts.stdout, unexpectedPasses)
+	testjson.PrintSummaryWithConfig(opts.stdout, exec, testjson.SummaryConfig{
+		Summary:                summarySections(opts),
+		FailureSource:          newFailureSource(opts),
+		MaxFailuresOutput:      opts.maxFailsOutput,
+		Incomplete:             opts.reportIncomplete,
+		DurationHistogram:      opts.summaryDurationHistogram,
+		CollapseRepeats:        opts.formatCollapseRepeats,
+		PassRate:               opts.summaryPassRate,
+		PassRateIncludeSkipped: opts.summaryPassRateIncludeSkipped,
+		DataRaces:              opts.summaryDataRaces,
+		RunCount:               opts.summaryRunCount,
+		ExpectedFailure:        opts.expectedFails.isExpectedFailure(exec),
+	})
+	exitErr = applyExpectedFails(opts, exec, exitErr)
+	exitErr = applyRaceExitCode(opts, exec, exitErr)
 
 	if err := writeJUnitFile(opts, exec); err != nil {
 		return fmt.Errorf("failed to write junit file: %w", err)
 	}
+	if err := writeUnchangedState(opts, exec); err != nil {
+		return fmt.Errorf("failed to write skip-unchanged file: %w", err)
+	}
+	if err := writeTestCounts(opts, exec, testCounts, exitErr); err != nil {
+		return fmt.Errorf("failed to write test count file: %w", err)
+	}
+	if err := writeRerunIDsFile(opts); err != nil {
+		return fmt.Errorf("failed to write rerun IDs file: %w", err)
+	}
+	if err := writeSkipReportFile(opts, exec); err != nil {
+		return fmt.Errorf("failed to write skip report file: %w", err)
+	}
+	if err := writeErrorsFile(opts, exec); err != nil {
+		return fmt.Errorf("failed to write errors file: %w", err)
+	}
+	exportTrace(opts)
 	if err := postRunHook(opts, exec); err != nil {
 		return fmt.Errorf("post run command failed: %w", err)
 	}
+	if exitErr == nil {
+		if err := failOnTestCountDrop(opts, testCounts); err != nil {
+			return err
+		}
+		if err := failOnUnexpectedPass(opts, unexpectedPasses); err != nil {
+			return err
+		}
+		if err := failOnSkip(opts, exec); err != nil {
+			return err
+		}
+		return failOnWarnings(opts, exec)
+	}
 	return exitErr
 }
 
+// failOnWarnings returns an error if exec has any of the warnings selected by
+// --fail-on-no-tests or --fail-on-vet.
+func failOnWarnings(opts *options, exec *testjson.Execution) error {
+	if opts.failOnNoTests {
+		var pkgs []string
+		for _, kind := range []testjson.WarningKind{testjson.WarningNoTestFiles, testjson.WarningNoTestsToRun} {
+			for _, w := range exec.WarningsOfKind(kind) {
+				pkgs = append(pkgs, testjson.RelativePackagePath(w.Package))
+			}
+		}
+		if len(pkgs) > 0 {
+			msg := fmt.Sprintf("no tests were run in %d packages: %s",
+				len(pkgs), strings.Join(pkgs, ", "))
+			if pattern := argValue("run", opts.args); pattern != "" {
+				msg += fmt.Sprintf(" (-run %v)", pattern)
+			}
+			return errors.New(msg)
+		}
+	}
+	if opts.failOnVet {
+		if count := len(exec.WarningsOfKind(testjson.WarningVet)); count > 0 {
+			return fmt.Errorf("go vet reported %d problems", count)
+		}
+	}
+	return nil
+}
+
 func goTestCmdArgs(opts *options, rerunOpts rerunOpts) []string {
 	if opts.rawCommand {
+		if boolArgIndex("v", opts.args) >= 0 || boolArgIndex("test.v", opts.args) >= 0 {
+			rerunOpts.verbose = false
+		}
 		var result []string
 		result = append(result, opts.args...)
 		result = append(result, rerunOpts.Args()...)
@@ -343,9 +1048,21 @@ func goTestCmdArgs(opts *options, rerunOpts rerunOpts) []string {
 		if rerunOpts.runFlag != "" {
 			result = append(result, rerunOpts.runFlag)
 		}
+		if rerunOpts.shuffle != "" {
+			result = append(result, rerunOpts.shuffleFlag())
+		}
+		if rerunOpts.timeout != "" {
+			result = append(result, rerunOpts.timeoutFlag())
+		}
+		if rerunOpts.runFlag != "" {
+			result = append(result, rerunCountFlag)
+		}
 		return append(result, cmdArgPackageList(opts, rerunOpts, "./...")...)
 	}
 
+	if rerunOpts.pkg != "" {
+		args = stripConflictingFlags(args)
+	}
 	if boolArgIndex("json", args) < 0 {
 		result = append(result, "-json")
 	}
@@ -360,6 +1077,52 @@ func goTestCmdArgs(opts *options, rerunOpts rerunOpts) []string {
 		result = append(result, rerunOpts.runFlag)
 	}
 
+	if rerunOpts.shuffle != "" {
+		// Remove any existing shuffle arg, the seed from the previous run
+		// replaces it.
+		for _, flag := range []string{"shuffle", "test.shuffle"} {
+			start, end := argIndex(flag, args)
+			if start >= 0 && end < len(args) {
+				args = append(args[:start], args[end+1:]...)
+			}
+		}
+		result = append(result, rerunOpts.shuffleFlag())
+	}
+
+	if rerunOpts.coverprofile != "" || rerunOpts.noCoverprofile {
+		// Remove the existing coverprofile arg, so that the profile from the
+		// first run is not replaced by the profile of the rerun.
+		start, end := argIndex("coverprofile", args)
+		if start >= 0 && end < len(args) {
+			args = append(args[:start], args[end+1:]...)
+		}
+	}
+	if rerunOpts.coverprofile != "" {
+		result = append(result, rerunOpts.coverprofileFlag())
+	}
+
+	if rerunOpts.timeout != "" {
+		// Remove any existing timeout arg, it is replaced by the scaled
+		// timeout.
+		for _, flag := range []string{"timeout", "test.timeout"} {
+			start, end := argIndex(flag, args)
+			if start >= 0 && end < len(args) {
+				args = append(args[:start], args[end+1:]...)
+			}
+		}
+		result = append(result, rerunOpts.timeoutFlag())
+	}
+
+	if rerunOpts.noRace {
+		args = removeBoolArg("race", args)
+	}
+
+	// A rerun must not use a cached result. -count is only added when it is
+	// not already in args, because 'go test' does not accept duplicate flags.
+	if rerunOpts.runFlag != "" && !hasCountArg(args) {
+		result = append(result, rerunCountFlag)
+	}
+
 	pkgArgIndex := findPkgArgPosition(args)
 	result = append(result, args[:pkgArgIndex]...)
 	result = append(result, cmdArgPackageList(opts, rerunOpts)...)
@@ -367,6 +1130,21 @@ func goTestCmdArgs(opts *options, rerunOpts rerunOpts) []string {
 	return result
 }
 
+// rerunCountFlag is added to the args of a rerun so that 'go test' runs the
+// tests again instead of using a cached result.
+const rerunCountFlag = "-count=1"
+
+// hasCountArg returns true if args contains the -count flag, in either the
+// -count=N or the -count N form.
+func hasCountArg(args []string) bool {
+	for _, flag := range []string{"count", "test.count"} {
+		if start, _ := argIndex(flag, args); start >= 0 {
+			return true
+		}
+	}
+	return false
+}
+
 func cmdArgPackageList(opts *options, rerunOpts rerunOpts, defPkgList ...string) []string {
 	switch {
 	case rerunOpts.pkg != "":
@@ -380,6 +1158,26 @@ func cmdArgPackageList(opts *options, rerunOpts rerunOpts, defPkgList ...string)
 	}
 }
 
+// readPackagesFile adds the packages listed in opts.packagesFile to
+// opts.packages. Blank lines, and lines starting with # are ignored.
+func readPackagesFile(opts *options) error {
+	if opts.packagesFile == "" {
+		return nil
+	}
+	raw, err := ioutil.ReadFile(opts.packagesFile)
+	if err != nil {
+		return fmt.Errorf("failed to read packages file: %w", err)
+	}
+	for _, line := range strings.Split(string(raw), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		opts.packages = append(opts.packages, line)
+	}
+	return nil
+}
+
 func boolArgIndex(flag string, args []string) int {
 	for i, arg := range args {
 		if arg == "-"+flag || arg == "--"+flag {
@@ -389,6 +1187,39 @@ func boolArgIndex(flag string, args []string) int {
 	return -1
 }
 
+// removeBoolArg returns args without the boolean flag, in either the -flag or
+// the -flag=value form. Only the go test flags before -args are removed.
+func removeBoolArg(flag string, args []string) []string {
+	pkgArgIndex := findPkgArgPosition(args)
+	result := make([]string, 0, len(args))
+	for i, arg := range args {
+		if i < pkgArgIndex && (arg == "-"+flag || arg == "--"+flag ||
+			strings.HasPrefix(arg, "-"+flag+"=") || strings.HasPrefix(arg, "--"+flag+"=")) {
+			continue
+		}
+		result = append(result, arg)
+	}
+	return result
+}
+
+// conflictingFlags are the go test flags removed from the args of a rerun by
+// stripConflictingFlags. A rerun always uses -json, because gotestsum scans
+// the output, so a -json=false in the args would break the rerun. The -v and
+// -test.v flags are not needed, because go test prints verbose output when
+// -json is used.
+var conflictingFlags = []string{"json", "v", "test.v"}
+
+// stripConflictingFlags returns args without the conflictingFlags, in either
+// the -flag or the -flag=value form. These flags are all boolean flags, so
+// 'go test' does not accept a value in the next arg (-flag value), that arg
+// is a package or another flag, and it is kept.
+func stripConflictingFlags(args []string) []string {
+	for _, flag := range conflictingFlags {
+		args = removeBoolArg(flag, args)
+	}
+	return args
+}
+
 func argIndex(flag string, args []string) (start, end int) {
 	for i, arg := range args {
 		if arg == "-"+flag || arg == "--"+flag {
@@ -401,6 +1232,22 @@ func argIndex(flag string, args []string) (start, end int) {
 	return -1, -1
 }
 
+// argValue returns the value of flag from args, or an empty string if the flag
+// is not set.
+func argValue(flag string, args []string) string {
+	start, end := argIndex(flag, args)
+	switch {
+	case start < 0:
+		return ""
+	case start == end:
+		return strings.SplitN(args[start], "=", 2)[1]
+	case end < len(args):
+		return args[end]
+	default:
+		return ""
+	}
+}
+
 // The package list is before the -args flag, or at the end of the args list
 // if the -args flag is not in args.
 // The -args flag is a 'go test' flag that indicates that all subsequent
@@ -421,20 +1268,30 @@ type proc struct {
 	// signal is atomically set to the signal value when a signal is received
 	// by newSignalHandler.
 	signal int32
+	// interrupts is atomically incremented for every signal received by
+	// newSignalHandler.
+	interrupts int32
 }
 
 type waiter interface {
 	Wait() error
 }
 
-func startGoTest(ctx context.Context, dir string, args []string) (*proc, error) {
+// startGoTest starts the command in args in dir. env is the environment of the
+// command, or nil to use the environment of gotestsum.
+func startGoTest(ctx context.Context, dir string, env []string, args []string) (*proc, error) {
 	if len(args) == 0 {
 		return nil, errors.New("missing command to run")
 	}
 
-	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	cmd := exec.Command(args[0], args[1:]...)
 	cmd.Stdin = os.Stdin
 	cmd.Dir = dir
+	cmd.Env = env
+	setProcessGroup(cmd)
 
 	p := proc{cmd: cmd}
 	log.Debugf("exec: %s", cmd.Args)
@@ -452,8 +1309,10 @@ func startGoTest(ctx context.Context, dir string, args []string) (*proc, error)
 	}
 	log.Debugf("go test pid: %d", cmd.Process.Pid)
 
-	ctx, cancel := context.WithCancel(ctx)
-	newSignalHandler(ctx, cmd.Process.Pid, &p)
+	exited, cancel := context.WithCancel(context.Background())
+	newSignalHandler(exited, cmd.Process.Pid, &p, interruptGracePeriod)
+	forwardSignals(exited, cmd.Process.Pid, interruptGracePeriod)
+	go terminateOnCancel(ctx, exited, cmd.Process.Pid, interruptGracePeriod)
 	p.cmd = &cancelWaiter{cancel: cancel, wrapped: p.cmd}
 	return &p, nil
 }
@@ -483,6 +1342,18 @@ func IsExitCoder(err error) bool {
 
 type exitError struct {
 	num int
+	// interrupted is true when the run was stopped by a signal.
+	interrupted bool
+}
+
+// interruptedError returns the error for a run that was stopped by signum.
+func interruptedError(signum int32) error {
+	return exitError{num: signalExitCode + int(signum), interrupted: true}
+}
+
+func isInterrupted(err error) bool {
+	var exitErr exitError
+	return errors.As(err, &exitErr) && exitErr.interrupted
 }
 
 func (e exitError) Error() string {
@@ -497,32 +1368,78 @@ func (e exitError) ExitCode() int {
 // exit code value. This matches the behaviour of bash.
 const signalExitCode = 128
 
-func newSignalHandler(ctx context.Context, pid int, p *proc) {
+// interruptGracePeriod is the time to wait for 'go test' to exit after it was
+// interrupted, before it is killed. It must only be read before starting a
+// goroutine, and passed to the goroutine by value.
+var interruptGracePeriod = 5 * time.Second
+
+// newSignalHandler forwards the first of the interruptSignals to the 'go test'
+// process group, and kills the process group if it has not exited after the
+// grace period. A second interrupt kills the process group immediately.
+func newSignalHandler(ctx context.Context, pid int, p *proc, grace time.Duration) {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, interruptSignals...)
 
 	go func() {
 		defer signal.Stop(c)
 
-		select {
-		case <-ctx.Done():
-			return
-		case s := <-c:
-			atomic.StoreInt32(&p.signal, int32(s.(syscall.Signal)))
-
-			proc, err := os.FindProcess(pid)
-			if err != nil {
-				log.Errorf("failed to find pid of 'go test': %v", err)
+		var graceC <-chan time.Time
+		for {
+			select {
+			case <-ctx.Done():
 				return
-			}
-			if err := proc.Signal(s); err != nil {
-				log.Errorf("failed to interrupt 'go test': %v", err)
+			case <-graceC:
+				log.Warnf("'go test' did not exit %v after it was interrupted, killing it",
+					grace)
+				if err := killProcessGroup(pid); err != nil {
+					log.Errorf("failed to kill 'go test': %v", err)
+				}
 				return
+			case s := <-c:
+				if atomic.AddInt32(&p.interrupts, 1) > 1 {
+					if err := killProcessGroup(pid); err != nil {
+						log.Errorf("failed to kill 'go test': %v", err)
+					}
+					return
+				}
+				atomic.StoreInt32(&p.signal, int32(s.(syscall.Signal)))
+				if err := signalProcessGroup(pid, s); err != nil {
+					log.Errorf("failed to interrupt 'go test': %v", err)
+				}
+				timer := time.NewTimer(grace)
+				defer timer.Stop()
+				graceC = timer.C
 			}
 		}
 	}()
 }
 
+// terminateOnCancel terminates the 'go test' process group when ctx is
+// cancelled before the process exits, and kills the process group if it has
+// not exited after the grace period. Unlike exec.CommandContext, which only
+// kills 'go test', this stops the test binaries started by 'go test'.
+func terminateOnCancel(ctx context.Context, exited context.Context, pid int, grace time.Duration) {
+	select {
+	case <-exited.Done():
+		return
+	case <-ctx.Done():
+	}
+	log.Debugf("terminating 'go test' process group %d", pid)
+	if err := terminateProcessGroup(pid); err != nil {
+		log.Debugf("failed to terminate 'go test': %v", err)
+	}
+
+	timer := time.NewTimer(grace)
+	defer timer.Stop()
+	select {
+	case <-exited.Done():
+	case <-timer.C:
+		if err := killProcessGroup(pid); err != nil {
+			log.Errorf("failed to kill 'go test': %v", err)
+		}
+	}
+}
+
 // cancelWaiter wraps a waiter to cancel the context after the wrapped
 // Wait exits.
 type cancelWaiter struct {
@@ -3,6 +3,7 @@ package cmd
 import (
 	"bytes"
 	"encoding/json"
+	"errors"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -15,6 +16,7 @@ import (
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/assert/cmp"
 	"gotest.tools/v3/env"
+	"gotest.tools/v3/fs"
 	"gotest.tools/v3/golden"
 	"gotest.tools/v3/skip"
 )
@@ -83,11 +85,277 @@ func TestOptions_Validate_FromFlags(t *testing.T) {
 			name: "rerun flag, no go-test args, with packages flag",
 			args: []string{"--rerun-fails", "--packages", "./..."},
 		},
+		{
+			name:     "fail-on-unexpected-pass without expected-fails-file",
+			args:     []string{"--fail-on-unexpected-pass"},
+			expected: "--fail-on-unexpected-pass requires --expected-fails-file",
+		},
+		{
+			name:     "multi-stream without raw-command",
+			args:     []string{"--multi-stream", "--", "./list-streams"},
+			expected: "--multi-stream requires --raw-command",
+		},
+		{
+			name:     "multi-stream with rerun-fails",
+			args:     []string{"--multi-stream", "--raw-command", "--rerun-fails", "--", "./list-streams"},
+			expected: "--multi-stream can not be used with --rerun-fails",
+		},
+		{
+			name:     "format-option not supported by the format",
+			args:     []string{"--format", "tap", "--format-option", "quiet_passing=true"},
+			expected: "invalid --format-option: format tap does not support any format options, got quiet_passing",
+		},
+		{
+			name:     "dry-run with watch",
+			args:     []string{"--dry-run", "--watch"},
+			expected: "--dry-run can not be used with --watch",
+		},
+		{
+			name:     "invalid jsonfile-filter",
+			args:     []string{"--jsonfile-filter=passed"},
+			expected: `invalid --jsonfile-filter "passed", must be one of: all, failed`,
+		},
+		{
+			name:     "invalid rerun-fails-report-format",
+			args:     []string{"--rerun-fails-report-format=json"},
+			expected: `invalid --rerun-fails-report-format "json", must be one of: counts, pass-rate`,
+		},
+		{
+			name:     "rerun-fails-on-exit-code without rerun-fails",
+			args:     []string{"--rerun-fails-on-exit-code=1"},
+			expected: "--rerun-fails-on-exit-code requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-on-exit-code out of range",
+			args:     []string{"--rerun-fails", "--rerun-fails-on-exit-code=1,256"},
+			expected: "--rerun-fails-on-exit-code must be between 1 and 255, got 256",
+		},
+		{
+			name:     "jsonfile-flatten-reruns with jsonfile-filter=failed",
+			args:     []string{"--jsonfile-flatten-reruns", "--jsonfile-filter=failed"},
+			expected: "--jsonfile-flatten-reruns can not be used with --jsonfile-filter=failed",
+		},
+		{
+			name:     "rerun-fails-generate-graph without rerun-fails",
+			args:     []string{"--rerun-fails-generate-graph=reruns.dot"},
+			expected: "--rerun-fails-generate-graph requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-group-by-package without rerun-fails",
+			args:     []string{"--rerun-fails-group-by-package"},
+			expected: "--rerun-fails-group-by-package requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-matrix without rerun-fails",
+			args:     []string{"--rerun-fails-matrix=matrix.yaml"},
+			expected: "--rerun-fails-matrix requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-matrix with raw-command",
+			args:     []string{"--rerun-fails-matrix=matrix.yaml", "--rerun-fails", "--raw-command"},
+			expected: "--rerun-fails-matrix can not be used with --raw-command",
+		},
+		{
+			name:     "fail-on-skip-allow-file without fail-on-skip",
+			args:     []string{"--fail-on-skip-allow-file=skips.txt"},
+			expected: "--fail-on-skip-allow-file requires --fail-on-skip",
+		},
+		{
+			name:     "rerun-fails-output-format without rerun-fails",
+			args:     []string{"--rerun-fails-output-format=standard-verbose"},
+			expected: "--rerun-fails-output-format requires --rerun-fails",
+		},
+		{
+			name:     "negative race-exit-code",
+			args:     []string{"--race-exit-code=-1"},
+			expected: "--race-exit-code must be between 0 and 255",
+		},
+		{
+			name:     "rerun-fails-json-summary without rerun-fails",
+			args:     []string{"--rerun-fails-json-summary=summary.json"},
+			expected: "--rerun-fails-json-summary requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-serial-packages without rerun-fails",
+			args:     []string{"--rerun-fails-serial-packages"},
+			expected: "--rerun-fails-serial-packages requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-serial-packages without rerun-fails-experimental-streaming",
+			args:     []string{"--rerun-fails", "--rerun-fails-serial-packages"},
+			expected: "--rerun-fails-serial-packages requires --rerun-fails-experimental-streaming",
+		},
+		{
+			name:     "summary-pass-rate-include-skipped without summary-pass-rate",
+			args:     []string{"--summary-pass-rate-include-skipped"},
+			expected: "--summary-pass-rate-include-skipped requires --summary-pass-rate",
+		},
+		{
+			name:     "rerun-fails-clean-env without rerun-fails",
+			args:     []string{"--rerun-fails-clean-env"},
+			expected: "--rerun-fails-clean-env requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-race-escalate with raw-command",
+			args:     []string{"--rerun-fails", "--rerun-fails-race-escalate", "--raw-command", "--", "./test.test"},
+			expected: "--rerun-fails-race-escalate can not be used with --raw-command",
+		},
+		{
+			name:     "negative rerun-fails",
+			args:     []string{"--rerun-fails=-1"},
+			expected: "--rerun-fails must not be negative",
+		},
+		{
+			name:     "timeout with watch",
+			args:     []string{"--timeout=10m", "--watch"},
+			expected: "--timeout can not be used with --watch",
+		},
+		{
+			name:     "negative format-collapse-repeats",
+			args:     []string{"--format-collapse-repeats=-1"},
+			expected: "--format-collapse-repeats must not be negative",
+		},
+		{
+			name:     "rerun-fails-record-to without rerun-fails",
+			args:     []string{"--rerun-fails-record-to=flakiness.jsonl"},
+			expected: "--rerun-fails-record-to requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-ignore-build-errors without rerun-fails",
+			args:     []string{"--rerun-fails-ignore-build-errors"},
+			expected: "--rerun-fails-ignore-build-errors requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-verbose-last-attempt without rerun-fails",
+			args:     []string{"--rerun-fails-verbose-last-attempt"},
+			expected: "--rerun-fails-verbose-last-attempt requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-verbose-last-attempt without raw-command",
+			args:     []string{"--rerun-fails", "--rerun-fails-verbose-last-attempt"},
+			expected: "--rerun-fails-verbose-last-attempt requires --raw-command, go test -json is always verbose",
+		},
+		{
+			name:     "rerun-fails-test-binary-cache without rerun-fails",
+			args:     []string{"--rerun-fails-test-binary-cache=bin"},
+			expected: "--rerun-fails-test-binary-cache requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-test-binary-cache with raw-command",
+			args:     []string{"--rerun-fails", "--rerun-fails-test-binary-cache=bin", "--raw-command"},
+			expected: "--rerun-fails-test-binary-cache can not be used with --raw-command",
+		},
+		{
+			name: "rerun-fails-test-binary-cache with streaming",
+			args: []string{
+				"--rerun-fails", "--rerun-fails-test-binary-cache=bin", "--rerun-fails-experimental-streaming",
+			},
+			expected: "--rerun-fails-test-binary-cache can not be used with --rerun-fails-experimental-streaming",
+		},
+		{
+			name:     "strict-rerun without rerun-fails",
+			args:     []string{"--strict-rerun"},
+			expected: "--strict-rerun requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-max-package-binary-size-kb without rerun-fails",
+			args:     []string{"--rerun-fails-max-package-binary-size-kb=1024"},
+			expected: "--rerun-fails-max-package-binary-size-kb requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-max-package-binary-size-kb is negative",
+			args:     []string{"--rerun-fails", "--rerun-fails-max-package-binary-size-kb=-1"},
+			expected: "--rerun-fails-max-package-binary-size-kb must not be negative",
+		},
+		{
+			name:     "rerun-fails-before-hook without rerun-fails",
+			args:     []string{"--rerun-fails-before-hook", "./reset-db"},
+			expected: "--rerun-fails-before-hook and --rerun-fails-after-hook require --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-after-hook with rerun-fails-experimental-streaming",
+			args:     []string{"--rerun-fails", "--rerun-fails-experimental-streaming", "--rerun-fails-after-hook", "./reset-db"},
+			expected: "--rerun-fails-before-hook and --rerun-fails-after-hook can not be used with --rerun-fails-experimental-streaming",
+		},
+		{
+			name:     "shuffle-iterations with rerun-fails",
+			args:     []string{"--rerun-fails", "--shuffle-iterations=3"},
+			expected: "--shuffle-iterations can not be used with --rerun-fails",
+		},
+		{
+			name:     "rerun-fails streaming without rerun-fails",
+			args:     []string{"--rerun-fails-experimental-streaming"},
+			expected: "--rerun-fails-experimental-streaming requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-tag-output without rerun-fails",
+			args:     []string{"--rerun-fails-tag-output"},
+			expected: "--rerun-fails-tag-output requires --rerun-fails",
+		},
+		{
+			name:     "rerun-fails-write-ids-file without rerun-fails",
+			args:     []string{"--rerun-fails-write-ids-file=ids.txt"},
+			expected: "--rerun-fails-write-ids-file requires --rerun-fails",
+		},
 		{
 			name:     "rerun-fails with failfast",
 			args:     []string{"--rerun-fails", "--packages=./...", "--", "-failfast"},
 			expected: "-failfast can not be used with --rerun-fails",
 		},
+		{
+			name:     "changed-since with go test args, no packages flag",
+			args:     []string{"--changed-since=main", "--", "-tags=integration"},
+			expected: "the list of packages to test must be specified by the --packages flag",
+		},
+		{
+			name:     "changed-since with raw-command",
+			args:     []string{"--changed-since=main", "--raw-command", "--", "./test.test"},
+			expected: "--changed-since can not be used with --raw-command",
+		},
+		{
+			name:     "negative rerun-fails-max-total-failures",
+			args:     []string{"--rerun-fails", "--rerun-fails-max-total-failures=-1"},
+			expected: "--rerun-fails-max-total-failures must not be negative",
+		},
+		{
+			name:     "rerun-fails-flakiness-threshold above 1",
+			args:     []string{"--rerun-fails", "--rerun-fails-flakiness-threshold=1.5"},
+			expected: "--rerun-fails-flakiness-threshold must be between 0.0 and 1.0",
+		},
+		{
+			name:     "shuffle-packages with invalid seed",
+			args:     []string{"--shuffle-packages=random"},
+			expected: `--shuffle-packages must be "on" or an integer seed, not "random"`,
+		},
+		{
+			name:     "shuffle-packages with go test args and no packages",
+			args:     []string{"--shuffle-packages", "--", "./..."},
+			expected: "the list of packages to test must be specified by the --packages flag",
+		},
+		{
+			name: "shuffle-packages with seed",
+			args: []string{"--shuffle-packages=1234", "--packages=./...", "--", "-count=1"},
+		},
+		{
+			name:     "fail-on-test-count-drop without test-count-file",
+			args:     []string{"--fail-on-test-count-drop=10%"},
+			expected: "--fail-on-test-count-drop requires --test-count-file",
+		},
+		{
+			name:     "update-test-counts without test-count-file",
+			args:     []string{"--update-test-counts"},
+			expected: "--update-test-counts requires --test-count-file",
+		},
+		{
+			name:     "negative max-fails-output",
+			args:     []string{"--max-fails-output=-1"},
+			expected: "--max-fails-output must not be negative",
+		},
+		{
+			name:     "negative junitfile-max-output-bytes",
+			args:     []string{"--junitfile-max-output-bytes=-1"},
+			expected: "--junitfile-max-output-bytes must not be negative",
+		},
 	}
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
@@ -96,6 +364,27 @@ func TestOptions_Validate_FromFlags(t *testing.T) {
 	}
 }
 
+func TestReadPackagesFile(t *testing.T) {
+	file := fs.NewFile(t, "packages", fs.WithContent(`
+# packages selected by the matrix
+./cmd/...
+  ./internal/junitxml
+
+./testjson
+`))
+	opts := &options{packages: []string{"./pkg"}, packagesFile: file.Path()}
+	assert.NilError(t, readPackagesFile(opts))
+	expected := []string{"./pkg", "./cmd/...", "./internal/junitxml", "./testjson"}
+	assert.DeepEqual(t, opts.packages, expected)
+
+	t.Run("missing file", func(t *testing.T) {
+		opts := &options{packagesFile: file.Path() + "-missing"}
+		err := readPackagesFile(opts)
+		assert.ErrorContains(t, err, "failed to read packages file")
+		assert.Assert(t, os.IsNotExist(errors.Unwrap(err)))
+	})
+}
+
 func TestGoTestCmdArgs(t *testing.T) {
 	type testCase struct {
 		opts      *options
@@ -171,7 +460,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "./fails"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "./fails"},
 	})
 	run(t, "TEST_DIRECTORY env var, no args, with rerunOpts", testCase{
 		opts: &options{},
@@ -181,7 +470,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 		},
 		env: []string{"TEST_DIRECTORY=testdir"},
 		// TEST_DIRECTORY should be overridden by rerun opts
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "./fails"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "./fails"},
 	})
 	run(t, "TEST_DIRECTORY env var, with args, with rerunOpts", testCase{
 		opts: &options{
@@ -192,7 +481,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			pkg:     "./fails",
 		},
 		env:      []string{"TEST_DIRECTORY=testdir"},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-tags=integration", "./fails"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "-tags=integration", "./fails"},
 	})
 	run(t, "no -json arg, with rerunOpts", testCase{
 		opts: &options{
@@ -203,7 +492,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-timeout=2m", "./fails"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "-timeout=2m", "./fails"},
 	})
 	run(t, "with -json arg, with rerunOpts", testCase{
 		opts: &options{
@@ -214,7 +503,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-run=TestOne|TestTwo", "-json", "-timeout=2m", "./fails"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "-timeout=2m", "./fails"},
 	})
 	run(t, "with args, with reunFailsPackageList args, with rerunOpts", testCase{
 		opts: &options{
@@ -225,7 +514,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-timeout=2m", "./fails"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "-timeout=2m", "./fails"},
 	})
 	run(t, "with args, with reunFailsPackageList", testCase{
 		opts: &options{
@@ -242,7 +531,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "./fails"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "./fails"},
 	})
 	run(t, "reunFailsPackageList args, with rerunOpts, with -args ", testCase{
 		opts: &options{
@@ -253,7 +542,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "before", "./fails", "-args", "after"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "before", "./fails", "-args", "after"},
 	})
 	run(t, "reunFailsPackageList args, with rerunOpts, with -args at end", testCase{
 		opts: &options{
@@ -264,7 +553,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "before", "./fails", "-args"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "before", "./fails", "-args"},
 	})
 	run(t, "reunFailsPackageList args, with -args at start", testCase{
 		opts: &options{
@@ -282,7 +571,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 			runFlag: "-run=TestOne|TestTwo",
 			pkg:     "./fails",
 		},
-		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "./fails", "-args"},
+		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "./fails", "-args"},
 	})
 	run(t, "-run arg in middle, with rerunOpts ", testCase{
 		opts: &options{
@@ -295,6 +584,17 @@ func TestGoTestCmdArgs(t *testing.T) {
 		},
 		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count", "1", "./fails", "-args"},
 	})
+	run(t, "-test.count arg, with rerunOpts", testCase{
+		opts: &options{
+			args:     []string{"-test.count=3"},
+			packages: []string{"./pkg"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag: "-run=TestOne",
+			pkg:     "./fails",
+		},
+		expected: []string{"go", "test", "-json", "-run=TestOne", "-test.count=3", "./fails"},
+	})
 	run(t, "-run arg at end with missing value, with rerunOpts ", testCase{
 		opts: &options{
 			args:     []string{"-count", "1", "-run"},
@@ -306,6 +606,119 @@ func TestGoTestCmdArgs(t *testing.T) {
 		},
 		expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count", "1", "-run", "./fails"},
 	})
+	run(t, "no args, with rerunOpts shuffle", testCase{
+		opts: &options{},
+		rerunOpts: rerunOpts{
+			runFlag: "-run=TestOne",
+			pkg:     "./fails",
+			shuffle: "12345",
+		},
+		expected: []string{"go", "test", "-json", "-run=TestOne", "-test.shuffle=12345", "-count=1", "./fails"},
+	})
+	run(t, "-shuffle arg, with rerunOpts shuffle", testCase{
+		opts: &options{
+			args:     []string{"-shuffle", "on", "-count=1"},
+			packages: []string{"./pkg"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag: "-run=TestOne",
+			pkg:     "./fails",
+			shuffle: "12345",
+		},
+		expected: []string{"go", "test", "-json", "-run=TestOne", "-test.shuffle=12345", "-count=1", "./fails"},
+	})
+	run(t, "-coverprofile arg, with rerunOpts coverprofile", testCase{
+		opts: &options{
+			args:     []string{"-covermode=atomic", "-coverprofile", "c.out"},
+			packages: []string{"./pkg"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag:      "-run=TestOne",
+			pkg:          "./fails",
+			coverprofile: "/tmp/rerun.out",
+		},
+		expected: []string{"go", "test", "-json", "-run=TestOne", "-coverprofile=/tmp/rerun.out", "-count=1", "-covermode=atomic", "./fails"},
+	})
+	run(t, "-coverprofile arg, with rerunOpts noCoverprofile", testCase{
+		opts: &options{
+			args:     []string{"-covermode=atomic", "-coverprofile", "c.out"},
+			packages: []string{"./pkg"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag:        "-run=TestOne",
+			pkg:            "./fails",
+			noCoverprofile: true,
+		},
+		expected: []string{"go", "test", "-json", "-run=TestOne", "-count=1", "-covermode=atomic", "./fails"},
+	})
+	run(t, "-timeout arg, with rerunOpts timeout", testCase{
+		opts: &options{
+			args:     []string{"-timeout", "2m", "-count=1"},
+			packages: []string{"./pkg"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag: "-run=TestOne",
+			pkg:     "./fails",
+			timeout: "6m0s",
+		},
+		expected: []string{"go", "test", "-json", "-run=TestOne", "-timeout=6m0s", "-count=1", "./fails"},
+	})
+	run(t, "conflicting flags, with rerunOpts", testCase{
+		opts: &options{
+			args:     []string{"-json=false", "-v", "-test.v=true", "-tags=integration", "-args", "-v"},
+			packages: []string{"./pkg"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag: "-run=TestOne",
+			pkg:     "./fails",
+		},
+		expected: []string{"go", "test", "-json", "-run=TestOne", "-count=1", "-tags=integration", "./fails", "-args", "-v"},
+	})
+	run(t, "conflicting flags, without rerunOpts", testCase{
+		opts: &options{
+			args:     []string{"-v", "-tags=integration"},
+			packages: []string{"./pkg"},
+		},
+		expected: []string{"go", "test", "-json", "-v", "-tags=integration", "./pkg"},
+	})
+	run(t, "raw command, with rerunOpts verbose", testCase{
+		opts: &options{
+			rawCommand: true,
+			args:       []string{"./script"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag: "-run=TestOne",
+			pkg:     "./fails",
+			verbose: true,
+		},
+		expected: []string{"./script", "-run=TestOne", "-test.v", "./fails"},
+	})
+	for _, flag := range []string{"-v", "-test.v"} {
+		run(t, "raw command, "+flag+" arg, with rerunOpts verbose", testCase{
+			opts: &options{
+				rawCommand: true,
+				args:       []string{"./script", flag},
+			},
+			rerunOpts: rerunOpts{
+				runFlag: "-run=TestOne",
+				pkg:     "./fails",
+				verbose: true,
+			},
+			expected: []string{"./script", flag, "-run=TestOne", "./fails"},
+		})
+	}
+	run(t, "raw command, with rerunOpts shuffle", testCase{
+		opts: &options{
+			rawCommand: true,
+			args:       []string{"./script"},
+		},
+		rerunOpts: rerunOpts{
+			runFlag: "-run=TestOne",
+			pkg:     "./fails",
+			shuffle: "12345",
+		},
+		expected: []string{"./script", "-run=TestOne", "-test.shuffle=12345", "./fails"},
+	})
 	t.Run("rerun with -run flag", func(t *testing.T) {
 		tc := testCase{
 			opts: &options{
@@ -316,7 +729,7 @@ func TestGoTestCmdArgs(t *testing.T) {
 				runFlag: "-run=TestOne|TestTwo",
 				pkg:     "./fails",
 			},
-			expected: []string{"go", "test", "-run=TestOne|TestTwo", "-tags", "some", "-json", "./fails"},
+			expected: []string{"go", "test", "-json", "-run=TestOne|TestTwo", "-count=1", "-tags", "some", "./fails"},
 		}
 		run(t, "first", tc)
 		run(t, "second", tc)
@@ -398,12 +811,53 @@ func TestRun_RerunFails_BuildErrorPreventsRerun(t *testing.T) {
 	}
 	err := run(opts)
 	assert.ErrorContains(t, err, "rerun aborted because previous run had errors", out.String())
+	var rerunErr *RerunError
+	assert.Assert(t, errors.As(err, &rerunErr))
+	assert.Equal(t, rerunErr.Kind, ErrKindBuildError)
 }
 
 // type checking of os/exec.ExitError is done in a test file so that users
 // installing from source can continue to use versions prior to go1.12.
 var _ exitCoder = &exec.ExitError{}
 
+func TestRun_MaxFails_SkipsRerun(t *testing.T) {
+	jsonFailed := `{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "fail"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "run"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "fail"}
+{"Package": "pkg", "Test": "TestThree", "Action": "run"}
+{"Package": "pkg", "Test": "TestThree", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`
+
+	var calls int
+	fn := func(args []string) *proc {
+		calls++
+		return &proc{
+			cmd:    fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(jsonFailed),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		format:                       "testname",
+		maxFails:                     2,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsMaxInitialFailures: 10,
+		stdout:                       out,
+		stderr:                       os.Stderr,
+		hideSummary:                  newHideSummaryValue(),
+	}
+	err := run(opts)
+	assert.Error(t, err, "ending test run because max failures was reached")
+	assert.Equal(t, calls, 1, "reruns should be skipped")
+}
+
 func TestRun_RerunFails_PanicPreventsRerun(t *testing.T) {
 	jsonFailed := `{"Package": "pkg", "Action": "run"}
 {"Package": "pkg", "Test": "TestOne", "Action": "run"}
@@ -434,6 +888,159 @@ func TestRun_RerunFails_PanicPreventsRerun(t *testing.T) {
 	}
 	err := run(opts)
 	assert.ErrorContains(t, err, "rerun aborted because previous run had a suspected panic", out.String())
+	var rerunErr *RerunError
+	assert.Assert(t, errors.As(err, &rerunErr))
+	assert.Equal(t, rerunErr.Kind, ErrKindPanic)
+}
+
+func TestRun_RerunFails_ContinueOnPanic(t *testing.T) {
+	jsonFailed := `{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "output","Output":"panic: something went wrong\n"}
+{"Package": "pkg", "Test": "TestOne", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`
+	jsonPassed := `{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`
+
+	var calls int
+	fn := func(args []string) *proc {
+		calls++
+		if calls > 1 {
+			return &proc{
+				cmd:    fakeWaiter{},
+				stdout: strings.NewReader(jsonPassed),
+				stderr: bytes.NewReader(nil),
+			}
+		}
+		return &proc{
+			cmd:    fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(jsonFailed),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		rawCommand:                   true,
+		args:                         []string{"./test.test"},
+		format:                       "testname",
+		rerunFailsMaxAttempts:        3,
+		rerunFailsMaxInitialFailures: 1,
+		rerunFailsContinueOnPanic:    true,
+		stdout:                       out,
+		stderr:                       os.Stderr,
+		hideSummary:                  newHideSummaryValue(),
+	}
+	err := run(opts)
+	assert.NilError(t, err, out.String())
+	assert.Equal(t, calls, 2)
+	assert.Assert(t, cmp.Contains(out.String(), "panic: something went wrong"))
+}
+
+func TestRun_FailOnWarnings(t *testing.T) {
+	jsonOutput := `{"Package": "example.com/one", "Action": "output", "Output": "testing: warning: no tests to run\n"}
+{"Package": "example.com/one", "Action": "pass"}
+`
+	stderr := "# [example.com/two]\n./two.go:3:1: unreachable code\n"
+
+	fn := func(args []string) *proc {
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(jsonOutput),
+			stderr: strings.NewReader(stderr),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	newOpts := func() *options {
+		return &options{
+			args:        []string{"-run", "TestTypo"},
+			format:      "none",
+			stdout:      new(bytes.Buffer),
+			stderr:      os.Stderr,
+			hideSummary: newHideSummaryValue(),
+		}
+	}
+
+	t.Run("without flags", func(t *testing.T) {
+		assert.NilError(t, run(newOpts()))
+	})
+	t.Run("fail on no tests", func(t *testing.T) {
+		opts := newOpts()
+		opts.failOnNoTests = true
+		err := run(opts)
+		assert.Error(t, err, "no tests were run in 1 packages: example.com/one (-run TestTypo)")
+	})
+	t.Run("fail on vet", func(t *testing.T) {
+		opts := newOpts()
+		opts.failOnVet = true
+		assert.Error(t, run(opts), "go vet reported 1 problems")
+	})
+	t.Run("summary warnings", func(t *testing.T) {
+		opts := newOpts()
+		assert.NilError(t, run(opts))
+		out := opts.stdout.(*bytes.Buffer).String()
+		assert.Assert(t, !strings.Contains(out, "=== Warnings"), out)
+		assert.Assert(t, cmp.Contains(out, "=== Errors\n./two.go:3:1: unreachable code"))
+
+		opts = newOpts()
+		opts.summaryWarnings = true
+		assert.NilError(t, run(opts))
+		out = opts.stdout.(*bytes.Buffer).String()
+		assert.Assert(t, cmp.Contains(out, "=== Warnings\n"))
+		assert.Assert(t, cmp.Contains(out, "example.com/one: testing: warning: no tests to run\n"))
+	})
+}
+
+func TestRun_ShuffleIterations(t *testing.T) {
+	seeds := []string{"111", "222", "333"}
+	var calls [][]string
+
+	fn := func(args []string) *proc {
+		seed := seeds[len(calls)]
+		calls = append(calls, args)
+		out := `{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Action": "output", "Output": "-test.shuffle ` + seed + `\n"}
+{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "pass"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "run"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`
+		if seed == "222" {
+			out = strings.Replace(out, `"TestTwo", "Action": "fail"`, `"TestTwo", "Action": "pass"`, 1)
+		}
+		return &proc{
+			cmd:    fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(out),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		rawCommand:        true,
+		args:              []string{"./test.test"},
+		format:            "none",
+		shuffleIterations: 3,
+		stdout:            out,
+		stderr:            os.Stderr,
+		hideSummary:       &hideSummaryValue{value: testjson.SummarizeNone},
+	}
+	err := run(opts)
+	assert.Error(t, err, "failed")
+	assert.Equal(t, len(calls), 3)
+	assert.DeepEqual(t, calls[0], []string{"./test.test", "-test.shuffle=on"})
+	assert.Assert(t, cmp.Contains(out.String(), "FAIL pkg.TestTwo (seeds: 111, 333)"))
 }
 
 func TestRun_InputFromStdin(t *testing.T) {
@@ -545,3 +1152,13 @@ func TestRun_JsonFileTimingEvents(t *testing.T) {
 	assert.NilError(t, err)
 	golden.Assert(t, string(raw), "expected-jsonfile-timing-events")
 }
+
+func TestFinishRun_Interrupted(t *testing.T) {
+	out := new(bytes.Buffer)
+	opts := &options{stdout: out, hideSummary: newHideSummaryValue()}
+	exec := newExecutionWithTwoFailures(t)
+
+	err := finishRun(opts, exec, interruptedError(int32(2)))
+	assert.Equal(t, ExitCodeWithDefault(err), 130)
+	assert.Assert(t, strings.HasPrefix(out.String(), "\n=== Run interrupted, the results are incomplete\n"))
+}
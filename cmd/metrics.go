@@ -0,0 +1,261 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// Metrics written by --metrics-file and --metrics-push-url, in the Prometheus
+// text exposition format. The names, types, and labels of these metrics are
+// used by dashboards and alerts, so they must not be changed.
+//
+// All the values include every attempt from --rerun-fails.
+const (
+	// metricTestsTotal is the number of tests run, labelled by result.
+	metricTestsTotal = "gotestsum_tests_total"
+	// metricTestsFailed is the number of tests that failed.
+	metricTestsFailed = "gotestsum_tests_failed"
+	// metricRunDuration is the elapsed time of the run.
+	metricRunDuration = "gotestsum_run_duration_seconds"
+	// metricRerunsPerformed is the number of tests run by --rerun-fails.
+	metricRerunsPerformed = "gotestsum_reruns_performed"
+	// metricPackageDuration is the elapsed time of each package, labelled by
+	// package and result.
+	metricPackageDuration = "gotestsum_package_duration_seconds"
+	// metricPackageTests is the number of tests run in each package,
+	// labelled by package and result.
+	metricPackageTests = "gotestsum_package_tests"
+)
+
+// Labels used by the metrics.
+const (
+	labelPackage = "package"
+	labelResult  = "result"
+)
+
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []metricSample
+}
+
+type metricSample struct {
+	// labels is a list of name, value pairs.
+	labels [][2]string
+	value  float64
+}
+
+// testResults is the order of the result label values.
+var testResults = []testjson.Action{testjson.ActionPass, testjson.ActionFail, testjson.ActionSkip}
+
+func newMetrics(exec *testjson.Execution) []metricFamily {
+	testsTotal := metricFamily{
+		name: metricTestsTotal,
+		help: "Number of tests run, by result.",
+		typ:  "counter",
+	}
+	packageDuration := metricFamily{
+		name: metricPackageDuration,
+		help: "Elapsed time of each package in seconds.",
+		typ:  "gauge",
+	}
+	packageTests := metricFamily{
+		name: metricPackageTests,
+		help: "Number of tests run in each package, by result.",
+		typ:  "gauge",
+	}
+
+	var reruns int
+	totals := make(map[testjson.Action]int)
+	for _, name := range exec.Packages() {
+		pkg := exec.Package(name)
+		counts := map[testjson.Action]int{
+			testjson.ActionPass: len(pkg.Passed),
+			testjson.ActionFail: len(pkg.Failed),
+			testjson.ActionSkip: len(pkg.Skipped),
+		}
+		for _, result := range testResults {
+			totals[result] += counts[result]
+			packageTests.samples = append(packageTests.samples, metricSample{
+				labels: [][2]string{{labelPackage, name}, {labelResult, string(result)}},
+				value:  float64(counts[result]),
+			})
+		}
+		for _, tc := range pkg.TestCases() {
+			if tc.RunID > 0 {
+				reruns++
+			}
+		}
+
+		result := pkg.Result()
+		if result == "" {
+			result = testjson.ActionPass
+		}
+		packageDuration.samples = append(packageDuration.samples, metricSample{
+			labels: [][2]string{{labelPackage, name}, {labelResult, string(result)}},
+			value:  pkg.Elapsed().Seconds(),
+		})
+	}
+	for _, result := range testResults {
+		testsTotal.samples = append(testsTotal.samples, metricSample{
+			labels: [][2]string{{labelResult, string(result)}},
+			value:  float64(totals[result]),
+		})
+	}
+
+	return []metricFamily{
+		testsTotal,
+		{
+			name:    metricTestsFailed,
+			help:    "Number of tests that failed.",
+			typ:     "gauge",
+			samples: []metricSample{{value: float64(len(exec.Failed()))}},
+		},
+		{
+			name:    metricRunDuration,
+			help:    "Elapsed time of the test run in seconds.",
+			typ:     "gauge",
+			samples: []metricSample{{value: exec.Elapsed().Seconds()}},
+		},
+		{
+			name:    metricRerunsPerformed,
+			help:    "Number of tests run by --rerun-fails.",
+			typ:     "gauge",
+			samples: []metricSample{{value: float64(reruns)}},
+		},
+		packageDuration,
+		packageTests,
+	}
+}
+
+// writeMetrics writes the metrics in the Prometheus text exposition format.
+func writeMetrics(out io.Writer, metrics []metricFamily) error {
+	buf := new(bytes.Buffer)
+	for _, m := range metrics {
+		fmt.Fprintf(buf, "# HELP %s %s\n", m.name, m.help)
+		fmt.Fprintf(buf, "# TYPE %s %s\n", m.name, m.typ)
+		for _, sample := range m.samples {
+			buf.WriteString(m.name)
+			if len(sample.labels) > 0 {
+				pairs := make([]string, 0, len(sample.labels))
+				for _, label := range sample.labels {
+					pairs = append(pairs, label[0]+`="`+escapeLabelValue(label[1])+`"`)
+				}
+				buf.WriteString("{" + strings.Join(pairs, ",") + "}")
+			}
+			buf.WriteString(" " + strconv.FormatFloat(sample.value, 'g', -1, 64) + "\n")
+		}
+	}
+	_, err := out.Write(buf.Bytes())
+	return err
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueReplacer.Replace(value)
+}
+
+type jsonMetricFamily struct {
+	Name    string             `json:"name"`
+	Help    string             `json:"help"`
+	Type    string             `json:"type"`
+	Samples []jsonMetricSample `json:"samples"`
+}
+
+type jsonMetricSample struct {
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// writeMetricsJSON writes the metrics as a JSON array of metric families, with
+// the same names, labels, and values as the text exposition format.
+func writeMetricsJSON(out io.Writer, metrics []metricFamily) error {
+	families := make([]jsonMetricFamily, 0, len(metrics))
+	for _, m := range metrics {
+		family := jsonMetricFamily{Name: m.name, Help: m.help, Type: m.typ}
+		for _, sample := range m.samples {
+			var labels map[string]string
+			if len(sample.labels) > 0 {
+				labels = make(map[string]string, len(sample.labels))
+				for _, label := range sample.labels {
+					labels[label[0]] = label[1]
+				}
+			}
+			family.Samples = append(family.Samples, jsonMetricSample{Labels: labels, Value: sample.value})
+		}
+		families = append(families, family)
+	}
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(families)
+}
+
+// writeMetricsFile writes the metrics from exec to opts.metricsFile. A file
+// with the .json extension is written as JSON, any other file in the text
+// exposition format.
+func writeMetricsFile(opts *options, exec *testjson.Execution) error {
+	if opts.metricsFile == "" || exec == nil {
+		return nil
+	}
+	write := writeMetrics
+	if filepath.Ext(opts.metricsFile) == ".json" {
+		write = writeMetricsJSON
+	}
+	buf := new(bytes.Buffer)
+	if err := write(buf, newMetrics(exec)); err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(opts.metricsFile), 0o755)
+	return ioutil.WriteFile(opts.metricsFile, buf.Bytes(), 0o644)
+}
+
+// metricsPushTimeout is the maximum time to wait for the Pushgateway.
+const metricsPushTimeout = 10 * time.Second
+
+// pushMetrics sends the metrics from exec to the Pushgateway at
+// opts.metricsPushURL. Any failure to push is logged as a warning, so that
+// the push never changes the result of the test run.
+func pushMetrics(opts *options, exec *testjson.Execution) {
+	if opts.metricsPushURL == "" || exec == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), metricsPushTimeout)
+	defer cancel()
+
+	buf := new(bytes.Buffer)
+	if err := writeMetrics(buf, newMetrics(exec)); err != nil {
+		log.Warnf("failed to push metrics: %v", err)
+		return
+	}
+	target := pushgatewayURL(opts.metricsPushURL, opts.metricsPushJob, opts.metricsPushInstance)
+	log.Debugf("pushing metrics to %v", target)
+	err := post(ctx, target, "text/plain; version=0.0.4", nil, buf.Bytes())
+	if err != nil {
+		log.Warnf("failed to push metrics: %v", err)
+	}
+}
+
+// pushgatewayURL returns the URL of the group identified by the job and
+// instance labels.
+func pushgatewayURL(base, job, instance string) string {
+	target := strings.TrimSuffix(base, "/") + "/metrics/job/" + url.PathEscape(job)
+	if instance != "" {
+		target += "/instance/" + url.PathEscape(instance)
+	}
+	return target
+}
@@ -0,0 +1,199 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+	"gotest.tools/v3/fs"
+	"gotest.tools/v3/golden"
+)
+
+func newExecutionWithRerun(t *testing.T) *testjson.Execution {
+	t.Helper()
+
+	out := `{"Package": "example.com/one", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestOne", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestOne", "Action": "fail", "Elapsed": 0.5}
+{"Package": "example.com/one", "Test": "TestTwo", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestTwo", "Action": "pass"}
+{"Package": "example.com/one", "Test": "TestSkip", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestSkip", "Action": "skip"}
+{"Package": "example.com/one", "Action": "fail", "Elapsed": 1.5}
+{"Package": "example.com/\"two\"", "Test": "TestThree", "Action": "run"}
+{"Package": "example.com/\"two\"", "Test": "TestThree", "Action": "pass"}
+{"Package": "example.com/\"two\"", "Action": "pass", "Elapsed": 0.25}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+
+	rerun := `{"Package": "example.com/one", "Test": "TestOne", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestOne", "Action": "pass"}
+{"Package": "example.com/one", "Action": "pass", "Elapsed": 0.5}
+`
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		RunID:     1,
+		Stdout:    strings.NewReader(rerun),
+		Stderr:    strings.NewReader(""),
+		Execution: exec,
+	})
+	assert.NilError(t, err)
+	return exec
+}
+
+func TestWriteMetrics(t *testing.T) {
+	metrics := newMetrics(newExecutionWithRerun(t))
+	for i := range metrics {
+		if metrics[i].name == metricRunDuration {
+			metrics[i].samples[0].value = 2.5
+		}
+	}
+
+	out := new(bytes.Buffer)
+	assert.NilError(t, writeMetrics(out, metrics))
+	golden.Assert(t, out.String(), "metrics-expected")
+}
+
+func TestWriteMetricsFile(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{metricsFile: dir.Join("out", "metrics.json")}
+	exec := newExecutionWithRerun(t)
+
+	assert.NilError(t, writeMetricsFile(opts, exec))
+	metrics := readMetricsJSON(t, opts.metricsFile)
+	expected := map[string]float64{
+		`gotestsum_tests_total{result="pass"}`: 3,
+		`gotestsum_tests_total{result="fail"}`: 1,
+		`gotestsum_tests_total{result="skip"}`: 1,
+		`gotestsum_tests_failed`:               1,
+		`gotestsum_reruns_performed`:           1,
+
+		`gotestsum_package_duration_seconds{package="example.com/one",result="pass"}`:   0.5,
+		`gotestsum_package_duration_seconds{package="example.com/"two"",result="pass"}`: 0.25,
+		`gotestsum_package_tests{package="example.com/one",result="pass"}`:              2,
+		`gotestsum_package_tests{package="example.com/one",result="fail"}`:              1,
+		`gotestsum_package_tests{package="example.com/one",result="skip"}`:              1,
+		`gotestsum_package_tests{package="example.com/"two"",result="pass"}`:            1,
+		`gotestsum_package_tests{package="example.com/"two"",result="fail"}`:            0,
+		`gotestsum_package_tests{package="example.com/"two"",result="skip"}`:            0,
+	}
+	for name, value := range expected {
+		actual, ok := metrics[name]
+		assert.Check(t, ok, "missing sample %v", name)
+		assert.Check(t, actual == value, "sample %v: got %v, expected %v", name, actual, value)
+	}
+	_, ok := metrics["gotestsum_run_duration_seconds"]
+	assert.Check(t, ok)
+}
+
+func TestWriteMetricsFile_NotSet(t *testing.T) {
+	assert.NilError(t, writeMetricsFile(&options{}, newExecutionWithRerun(t)))
+}
+
+func TestFinishRun_WritesMetricsFileOnFailure(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	out := new(bytes.Buffer)
+	opts := &options{
+		metricsFile: filepath.Join(dir.Path(), "metrics.json"),
+		stdout:      out,
+		hideSummary: newHideSummaryValue(),
+	}
+	exitErr := newExitCode("failed", 1)
+
+	err := finishRun(opts, newExecutionWithTwoFailures(t), exitErr)
+	assert.Equal(t, err, exitErr)
+
+	metrics := readMetricsJSON(t, opts.metricsFile)
+	assert.Equal(t, metrics["gotestsum_tests_failed"], float64(2))
+}
+
+func TestFinishRun_WritesMetricsFileOnEarlyError(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(), fs.WithFile("counts.json", "not json"))
+	opts := &options{
+		metricsFile:   filepath.Join(dir.Path(), "metrics.json"),
+		testCountFile: dir.Join("counts.json"),
+		stdout:        new(bytes.Buffer),
+		hideSummary:   newHideSummaryValue(),
+	}
+
+	err := finishRun(opts, newExecutionWithTwoFailures(t), nil)
+	assert.Assert(t, err != nil)
+
+	metrics := readMetricsJSON(t, opts.metricsFile)
+	assert.Equal(t, metrics["gotestsum_tests_failed"], float64(2))
+}
+
+func TestPushMetrics(t *testing.T) {
+	var path, contentType string
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.EscapedPath()
+		contentType = r.Header.Get("Content-Type")
+		var err error
+		body, err = ioutil.ReadAll(r.Body)
+		assert.Check(t, err)
+	}))
+	defer server.Close()
+
+	opts := &options{
+		metricsPushURL:      server.URL + "/",
+		metricsPushJob:      "unit tests",
+		metricsPushInstance: "ci-1",
+	}
+	pushMetrics(opts, newExecutionWithRerun(t))
+
+	assert.Equal(t, path, "/metrics/job/unit%20tests/instance/ci-1")
+	assert.Equal(t, contentType, "text/plain; version=0.0.4")
+	assert.Assert(t, cmp.Contains(string(body), "\ngotestsum_reruns_performed 1\n"))
+}
+
+func TestPushgatewayURL(t *testing.T) {
+	assert.Equal(t, pushgatewayURL("http://localhost:9091", "gotestsum", ""),
+		"http://localhost:9091/metrics/job/gotestsum")
+	assert.Equal(t, pushgatewayURL("http://localhost:9091/", "a/b", "host"),
+		"http://localhost:9091/metrics/job/a%2Fb/instance/host")
+}
+
+// readMetricsJSON reads a metrics file written in the JSON format, and returns
+// the value of each sample keyed by the name and labels of the sample.
+func readMetricsJSON(t *testing.T, filename string) map[string]float64 {
+	t.Helper()
+	raw, err := ioutil.ReadFile(filename)
+	assert.NilError(t, err)
+
+	var families []jsonMetricFamily
+	assert.NilError(t, json.Unmarshal(raw, &families))
+
+	samples := make(map[string]float64)
+	for _, family := range families {
+		for _, sample := range family.Samples {
+			names := make([]string, 0, len(sample.Labels))
+			for name := range sample.Labels {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+			pairs := make([]string, 0, len(names))
+			for _, name := range names {
+				pairs = append(pairs, name+`="`+sample.Labels[name]+`"`)
+			}
+			key := family.Name
+			if len(pairs) > 0 {
+				key += "{" + strings.Join(pairs, ",") + "}"
+			}
+			samples[key] = sample.Value
+		}
+	}
+	return samples
+}
@@ -0,0 +1,133 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"strings"
+	"sync"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// scanMultiStream reads the paths of test2json streams, one per line, from
+// cfg.Stdout, and scans all the streams concurrently into a single Execution.
+// Each stream is opened, and read into a buffer, as soon as its path is read,
+// because a command may keep its stdout open until it has written all of the
+// streams. The events are scanned once cfg.Stdout is closed. cfg.Stderr is
+// scanned with the first stream.
+func scanMultiStream(cfg testjson.ScanConfig) (*testjson.Execution, error) {
+	streams, err := openStreams(cfg)
+	for _, stream := range streams {
+		defer stream.Close() // nolint: errcheck
+	}
+	if err != nil || len(streams) == 0 {
+		if err == nil {
+			log.Warnf("no test2json streams were listed by the command")
+		}
+		cfg.Stdout = strings.NewReader("")
+		exec, scanErr := testjson.ScanTestOutput(cfg)
+		if err == nil {
+			err = scanErr
+		}
+		return exec, err
+	}
+
+	configs := make([]testjson.ScanConfig, 0, len(streams))
+	for i, stream := range streams {
+		streamCfg := cfg
+		streamCfg.Stdout = stream
+		if i > 0 {
+			streamCfg.Stderr = nil
+		}
+		configs = append(configs, streamCfg)
+	}
+	log.Debugf("scanning %d test2json streams", len(streams))
+	return testjson.ScanMultiple(configs)
+}
+
+// openStreams opens a stream for each path read from cfg.Stdout.
+func openStreams(cfg testjson.ScanConfig) ([]*bufferedStream, error) {
+	var streams []*bufferedStream
+	scanner := bufio.NewScanner(cfg.Stdout)
+	for scanner.Scan() {
+		if path := strings.TrimSpace(scanner.Text()); path != "" {
+			streams = append(streams, openBufferedStream(path))
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		cfg.Stop()
+		return streams, err
+	}
+	return streams, nil
+}
+
+// bufferedStream reads the file at path into a buffer from a goroutine, so
+// that the writer of a named pipe is never blocked waiting for gotestsum to
+// open or read the pipe. Read returns the buffered data.
+type bufferedStream struct {
+	path string
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	fh   *os.File
+	// err is io.EOF after the whole file was read, or the error from opening
+	// or reading the file.
+	err error
+}
+
+func openBufferedStream(path string) *bufferedStream {
+	s := &bufferedStream{path: path}
+	s.cond = sync.NewCond(&s.mu)
+	go s.readAll()
+	return s
+}
+
+func (s *bufferedStream) readAll() {
+	// Opening a named pipe blocks until the pipe is opened for writing.
+	fh, err := os.Open(s.path)
+	s.mu.Lock()
+	s.fh, s.err = fh, err
+	s.mu.Unlock()
+	if err != nil {
+		s.cond.Broadcast()
+		return
+	}
+
+	chunk := make([]byte, 32*1024)
+	for {
+		n, err := fh.Read(chunk)
+		s.mu.Lock()
+		s.buf.Write(chunk[:n])
+		if err != nil {
+			s.err = err
+		}
+		s.mu.Unlock()
+		s.cond.Broadcast()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (s *bufferedStream) Read(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for s.buf.Len() == 0 && s.err == nil {
+		s.cond.Wait()
+	}
+	if s.buf.Len() > 0 {
+		return s.buf.Read(p)
+	}
+	return 0, s.err
+}
+
+func (s *bufferedStream) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.fh == nil {
+		return nil
+	}
+	return s.fh.Close()
+}
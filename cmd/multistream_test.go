@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestScanMultiStream(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("one.json", `{"Package": "example.com/one", "Test": "TestA", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "pass"}
+{"Package": "example.com/one", "Action": "pass"}
+`),
+		fs.WithFile("two.json", `{"Package": "example.com/two", "Test": "TestB", "Action": "run"}
+{"Package": "example.com/two", "Test": "TestB", "Action": "fail"}
+{"Package": "example.com/two", "Action": "fail"}
+`))
+
+	cfg := testjson.ScanConfig{
+		Stdout:  strings.NewReader(dir.Join("one.json") + "\n\n" + dir.Join("two.json") + "\n"),
+		Stderr:  strings.NewReader("build failed\n"),
+		Handler: noopHandler{},
+	}
+	exec, err := scanMultiStream(cfg)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, exec.Packages(), []string{"example.com/one", "example.com/two"})
+	assert.Equal(t, exec.Total(), 2)
+	assert.Equal(t, len(exec.Failed()), 1)
+	assert.DeepEqual(t, exec.Errors(), []string{"build failed"})
+}
+
+func TestScanMultiStream_NoStreams(t *testing.T) {
+	cfg := testjson.ScanConfig{Stdout: strings.NewReader("\n"), Handler: noopHandler{}}
+	exec, err := scanMultiStream(cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, exec.Total(), 0)
+}
+
+func TestScanMultiStream_MissingStream(t *testing.T) {
+	var stopped bool
+	cfg := testjson.ScanConfig{
+		Stdout:  strings.NewReader("./does-not-exist.json\n"),
+		Handler: noopHandler{},
+		Stop:    func() { stopped = true },
+	}
+	_, err := scanMultiStream(cfg)
+	assert.ErrorContains(t, err, "does-not-exist.json")
+	assert.Assert(t, stopped)
+}
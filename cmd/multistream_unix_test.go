@@ -0,0 +1,66 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"io"
+	"io/ioutil"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestScanMultiStream_NamedPipes(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	paths := []string{dir.Join("one.json"), dir.Join("two.json")}
+	for _, path := range paths {
+		assert.NilError(t, syscall.Mkfifo(path, 0o600))
+	}
+	events := []string{
+		`{"Package": "example.com/one", "Test": "TestA", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "pass"}
+{"Package": "example.com/one", "Action": "pass"}
+`,
+		`{"Package": "example.com/two", "Test": "TestB", "Action": "run"}
+{"Package": "example.com/two", "Test": "TestB", "Action": "fail"}
+{"Package": "example.com/two", "Action": "fail"}
+`,
+	}
+
+	// The command writes the streams one at a time, and closes its stdout
+	// after all the streams are written.
+	stdout, writer := io.Pipe()
+	go func() {
+		defer writer.Close()
+		for _, path := range paths {
+			_, _ = io.WriteString(writer, path+"\n")
+		}
+		for i, path := range paths {
+			if err := ioutil.WriteFile(path, []byte(events[i]), 0o600); err != nil {
+				writer.CloseWithError(err)
+				return
+			}
+		}
+	}()
+
+	done := make(chan struct{})
+	var exec *testjson.Execution
+	var err error
+	go func() {
+		defer close(done)
+		exec, err = scanMultiStream(testjson.ScanConfig{Stdout: stdout, Handler: noopHandler{}})
+	}()
+	select {
+	case <-done:
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for the streams to be scanned")
+	}
+	assert.NilError(t, err)
+	assert.DeepEqual(t, exec.Packages(), []string{"example.com/one", "example.com/two"})
+	assert.Equal(t, len(exec.Failed()), 1)
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// maxTestFailCommands is the maximum number of --on-test-fail-command
+// processes that run at the same time.
+const maxTestFailCommands = 4
+
+// testFailCommandTimeout is the maximum time an --on-test-fail-command may
+// run before it is killed, so that a hung command does not block gotestsum.
+var testFailCommandTimeout = time.Minute
+
+// testFailCommand runs the --on-test-fail-command for each test that fails.
+type testFailCommand struct {
+	command []string
+	// sem limits the number of commands that run at the same time.
+	sem chan struct{}
+}
+
+func newTestFailCommand(command []string) *testFailCommand {
+	if len(command) == 0 {
+		return nil
+	}
+	return &testFailCommand{command: command, sem: make(chan struct{}, maxTestFailCommands)}
+}
+
+// event starts the command when the event is a test failure. The command runs
+// in a goroutine registered with the Execution, so that the scan is not
+// blocked by the command, and ScanTestOutput waits for the command to exit.
+func (c *testFailCommand) event(event testjson.TestEvent, execution *testjson.Execution) {
+	if c == nil || event.PackageEvent() || event.Action != testjson.ActionFail {
+		return
+	}
+	wg := execution.WaitGroup()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		c.sem <- struct{}{}
+		defer func() { <-c.sem }()
+		c.run(event)
+	}()
+}
+
+// run the command with the package and name of the failed test as the last
+// two arguments, and in the environment. Errors are logged, so that the
+// command never changes the result of the test run.
+func (c *testFailCommand) run(event testjson.TestEvent) {
+	args := append(c.command[1:len(c.command):len(c.command)], event.Package, event.Test)
+	log.Debugf("exec: %s %s", c.command[0], args)
+
+	ctx, cancel := context.WithTimeout(context.Background(), testFailCommandTimeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, c.command[0], args...)
+	cmd.Env = append(
+		os.Environ(),
+		"GOTESTSUM_PACKAGE="+event.Package,
+		"GOTESTSUM_TEST="+event.Test,
+		"GOTESTSUM_RUN_ID="+strconv.Itoa(event.RunID),
+	)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Warnf("on-test-fail-command for %s in %s did not exit after %v, killed it\n%s",
+			event.Test, event.Package, testFailCommandTimeout, out)
+		return
+	}
+	if err != nil {
+		log.Warnf("on-test-fail-command for %s in %s failed: %v\n%s",
+			event.Test, event.Package, err, out)
+		return
+	}
+	log.Debugf("on-test-fail-command for %s in %s: %s", event.Test, event.Package, out)
+}
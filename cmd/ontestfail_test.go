@@ -0,0 +1,83 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestTestFailCommand(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	out := dir.Join("out")
+	command := &commandValue{}
+	assert.NilError(t, command.Set(
+		`sh -c 'echo "$1 $2 $GOTESTSUM_PACKAGE $GOTESTSUM_TEST $GOTESTSUM_RUN_ID" >> `+out+`' sh`))
+
+	input := `{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "fail"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "run"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "pass"}
+{"Package": "pkg", "Test": "TestThree", "Action": "run"}
+{"Package": "pkg", "Test": "TestThree", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`
+	_, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout:  strings.NewReader(input),
+		Handler: &eventHandler{formatter: noopFormatter{}, onTestFail: newTestFailCommand(command.Value())},
+	})
+	assert.NilError(t, err)
+
+	raw, err := ioutil.ReadFile(out)
+	assert.NilError(t, err)
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	sort.Strings(lines)
+	assert.DeepEqual(t, lines, []string{
+		"pkg TestOne pkg TestOne 0",
+		"pkg TestThree pkg TestThree 0",
+	})
+}
+
+func TestTestFailCommand_Error(t *testing.T) {
+	cmd := newTestFailCommand([]string{"false"})
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "fail"}
+`),
+		Handler: &eventHandler{formatter: noopFormatter{}, onTestFail: cmd},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(exec.Failed()), 1)
+}
+
+func TestTestFailCommand_Timeout(t *testing.T) {
+	orig := testFailCommandTimeout
+	testFailCommandTimeout = 100 * time.Millisecond
+	t.Cleanup(func() { testFailCommandTimeout = orig })
+
+	cmd := newTestFailCommand([]string{"sh", "-c", "exec sleep 30", "sh"})
+	start := time.Now()
+	_, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "fail"}
+`),
+		Handler: &eventHandler{formatter: noopFormatter{}, onTestFail: cmd},
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, time.Since(start) < 10*time.Second)
+}
+
+func TestNewTestFailCommand_NotSet(t *testing.T) {
+	assert.Assert(t, newTestFailCommand(nil) == nil)
+}
+
+type noopFormatter struct{}
+
+func (noopFormatter) Format(testjson.TestEvent, *testjson.Execution) error {
+	return nil
+}
@@ -0,0 +1,424 @@
+package cmd
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// otelTracer creates OpenTelemetry spans from the events of a test run. The
+// spans use the time of the test2json events, so that they match the time the
+// tests actually ran, not the time they were exported.
+//
+// The trace has a root span for the run, a child span for each package, and
+// a span for each test under the span of its package. Subtests are children of
+// their parent test. Each rerun of a test is a separate span with a different
+// attempt attribute.
+type otelTracer struct {
+	// endpoint is the URL used to export the traces.
+	endpoint string
+	mu       sync.Mutex
+	traceID  string
+	root     *otelSpan
+	// packages are the spans of each package, from the first run.
+	packages map[string]*otelSpan
+	// running are the spans of tests which have not finished.
+	running map[otelTestKey]*otelSpan
+	output  map[otelTestKey][]string
+	spans   []*otelSpan
+	last    time.Time
+}
+
+type otelTestKey struct {
+	pkg   string
+	test  string
+	runID int
+}
+
+type otelSpan struct {
+	TraceID      string          `json:"traceId"`
+	SpanID       string          `json:"spanId"`
+	ParentSpanID string          `json:"parentSpanId,omitempty"`
+	Name         string          `json:"name"`
+	Kind         int             `json:"kind"`
+	Start        otelTime        `json:"startTimeUnixNano"`
+	End          otelTime        `json:"endTimeUnixNano"`
+	Attributes   []otelAttribute `json:"attributes,omitempty"`
+	Events       []otelEvent     `json:"events,omitempty"`
+	Status       otelStatus      `json:"status"`
+}
+
+type otelEvent struct {
+	Time       otelTime        `json:"timeUnixNano"`
+	Name       string          `json:"name"`
+	Attributes []otelAttribute `json:"attributes,omitempty"`
+}
+
+type otelStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otelAttribute struct {
+	Key   string        `json:"key"`
+	Value otelAttrValue `json:"value"`
+}
+
+type otelAttrValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+}
+
+// otelTime is a time encoded as a string of nanoseconds since the unix epoch,
+// as required by the JSON encoding of OTLP.
+type otelTime time.Time
+
+func (t otelTime) MarshalJSON() ([]byte, error) {
+	if time.Time(t).IsZero() {
+		return []byte(`"0"`), nil
+	}
+	return []byte(`"` + strconv.FormatInt(time.Time(t).UnixNano(), 10) + `"`), nil
+}
+
+func (t *otelTime) UnmarshalJSON(raw []byte) error {
+	n, err := strconv.ParseInt(strings.Trim(string(raw), `"`), 10, 64)
+	if err != nil {
+		return err
+	}
+	*t = otelTime{}
+	if n != 0 {
+		*t = otelTime(time.Unix(0, n).UTC())
+	}
+	return nil
+}
+
+const (
+	otelSpanKindInternal = 1
+	otelStatusOK         = 1
+	otelStatusError      = 2
+)
+
+func stringAttr(key, value string) otelAttribute {
+	return otelAttribute{Key: key, Value: otelAttrValue{StringValue: &value}}
+}
+
+func intAttr(key string, value int) otelAttribute {
+	v := strconv.Itoa(value)
+	return otelAttribute{Key: key, Value: otelAttrValue{IntValue: &v}}
+}
+
+func newOTelTracer(endpoint string) *otelTracer {
+	return &otelTracer{
+		endpoint: endpoint,
+		traceID:  randomHex(16),
+		packages: make(map[string]*otelSpan),
+		running:  make(map[otelTestKey]*otelSpan),
+		output:   make(map[otelTestKey][]string),
+	}
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+func (t *otelTracer) newSpan(name string, parent *otelSpan, start time.Time) *otelSpan {
+	span := &otelSpan{
+		TraceID: t.traceID,
+		SpanID:  randomHex(8),
+		Name:    name,
+		Kind:    otelSpanKindInternal,
+		Start:   otelTime(start),
+	}
+	if parent != nil {
+		span.ParentSpanID = parent.SpanID
+	}
+	return span
+}
+
+// event updates the spans from a test2json event.
+func (t *otelTracer) event(event testjson.TestEvent) {
+	if t == nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	// Events created by gotestsum, for example when a test is missing a
+	// terminal action, do not have a time.
+	now := event.Time
+	if now.IsZero() {
+		now = t.last
+	}
+	if now.After(t.last) {
+		t.last = now
+	}
+	if t.root == nil {
+		t.root = t.newSpan("gotestsum", nil, now)
+	}
+
+	pkg, ok := t.packages[event.Package]
+	if !ok {
+		pkg = t.newSpan(event.Package, t.root, now)
+		pkg.Attributes = []otelAttribute{stringAttr("test.suite.name", event.Package)}
+		t.packages[event.Package] = pkg
+	}
+
+	if event.PackageEvent() {
+		if event.RunID == 0 && event.Action.IsTerminal() {
+			pkg.End = otelTime(now)
+			pkg.Status = otelStatusFromAction(event.Action)
+			pkg.Attributes = append(pkg.Attributes,
+				stringAttr("test.suite.run.status", string(event.Action)))
+			t.spans = append(t.spans, pkg)
+		}
+		return
+	}
+
+	key := otelTestKey{pkg: event.Package, test: event.Test, runID: event.RunID}
+	switch {
+	case event.Action == testjson.ActionRun:
+		parent := pkg
+		if idx := strings.LastIndex(event.Test, "/"); idx > 0 {
+			parentKey := otelTestKey{pkg: event.Package, test: event.Test[:idx], runID: event.RunID}
+			if span, ok := t.running[parentKey]; ok {
+				parent = span
+			}
+		}
+		span := t.newSpan(event.Test, parent, now)
+		span.Attributes = []otelAttribute{
+			stringAttr("test.suite.name", event.Package),
+			stringAttr("test.case.name", event.Test),
+			intAttr("test.case.attempt", event.RunID+1),
+		}
+		t.running[key] = span
+	case event.Action == testjson.ActionOutput:
+		if _, ok := t.running[key]; ok {
+			t.output[key] = append(t.output[key], event.Output)
+		}
+	case event.Action.IsTerminal():
+		span, ok := t.running[key]
+		if !ok {
+			return
+		}
+		delete(t.running, key)
+		span.End = otelTime(now)
+		span.Status = otelStatusFromAction(event.Action)
+		span.Attributes = append(span.Attributes,
+			stringAttr("test.case.result.status", string(event.Action)))
+		if event.Action == testjson.ActionFail {
+			span.Events = append(span.Events, otelEvent{
+				Time: otelTime(now),
+				Name: "exception",
+				Attributes: []otelAttribute{
+					stringAttr("exception.message", strings.Join(t.output[key], "")),
+				},
+			})
+		}
+		delete(t.output, key)
+		t.spans = append(t.spans, span)
+	}
+}
+
+func otelStatusFromAction(action testjson.Action) otelStatus {
+	if action == testjson.ActionFail {
+		return otelStatus{Code: otelStatusError}
+	}
+	return otelStatus{Code: otelStatusOK}
+}
+
+// finish returns all the spans. Spans which did not end, for example because
+// the run was interrupted, end at the time of the last event.
+func (t *otelTracer) finish() []*otelSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.root == nil {
+		return nil
+	}
+	t.root.End = otelTime(t.last)
+	spans := append([]*otelSpan{t.root}, t.spans...)
+	for _, span := range t.running {
+		span.End = otelTime(t.last)
+		spans = append(spans, span)
+	}
+	for _, span := range t.packages {
+		if time.Time(span.End).IsZero() {
+			span.End = otelTime(t.last)
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// otlpTraces is the JSON body of an OTLP/HTTP trace export request.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otelAttribute `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope   `json:"scope"`
+	Spans []*otelSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+// exportTrace sends the spans from opts.otelTracer to the OTLP endpoint. Any
+// failure to export is logged as a warning, so that the export never changes
+// the result of the test run.
+func exportTrace(opts *options) {
+	tracer := opts.otelTracer
+	if tracer == nil {
+		return
+	}
+	opts.otelTracer = nil
+	spans := tracer.finish()
+	if len(spans) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), otelExportTimeout())
+	defer cancel()
+
+	body := otlpTraces{ResourceSpans: []otlpResourceSpans{{
+		Resource: otlpResource{Attributes: otelResourceAttributes()},
+		ScopeSpans: []otlpScopeSpans{{
+			Scope: otlpScope{Name: "gotest.tools/gotestsum"},
+			Spans: spans,
+		}},
+	}}}
+	log.Debugf("exporting %d spans to %v", len(spans), tracer.endpoint)
+	if err := postJSON(ctx, tracer.endpoint, otelHeaders(), body); err != nil {
+		log.Warnf("failed to export trace: %v", err)
+	}
+}
+
+// otelTracesEndpoint returns the URL used to export traces, or an empty string
+// when traces are not exported. The value of --otel-endpoint is the base URL of
+// the collector. With --otel-export the URL is read from the environment.
+// OTEL_EXPORTER_OTLP_TRACES_ENDPOINT is used as-is, and
+// OTEL_EXPORTER_OTLP_ENDPOINT is a base URL.
+func otelTracesEndpoint(opts *options) string {
+	if opts.otelEndpoint != "" {
+		return withOTelTracesPath(opts.otelEndpoint)
+	}
+	if !opts.otelExport {
+		return ""
+	}
+	protocol := lookEnvWithDefault("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL",
+		os.Getenv("OTEL_EXPORTER_OTLP_PROTOCOL"))
+	switch protocol {
+	case "", "http/protobuf", "http/json":
+	default:
+		log.Warnf("not exporting a trace, OTLP protocol %v is not supported, "+
+			"use http/protobuf or --otel-endpoint", protocol)
+		return ""
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT"); endpoint != "" {
+		return endpoint
+	}
+	if endpoint := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); endpoint != "" {
+		return withOTelTracesPath(endpoint)
+	}
+	log.Warnf("not exporting a trace, --otel-export requires " +
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT or OTEL_EXPORTER_OTLP_ENDPOINT")
+	return ""
+}
+
+// withOTelTracesPath returns the URL of the traces path of the collector at
+// the base URL endpoint.
+func withOTelTracesPath(endpoint string) string {
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return strings.TrimSuffix(endpoint, "/") + "/v1/traces"
+}
+
+// defaultOTelExportTimeout is the default of OTEL_EXPORTER_OTLP_TIMEOUT.
+const defaultOTelExportTimeout = 10 * time.Second
+
+// otelExportTimeout returns the timeout in milliseconds from
+// OTEL_EXPORTER_OTLP_TRACES_TIMEOUT or OTEL_EXPORTER_OTLP_TIMEOUT.
+func otelExportTimeout() time.Duration {
+	for _, key := range []string{"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT"} {
+		raw := os.Getenv(key)
+		if raw == "" {
+			continue
+		}
+		ms, err := strconv.Atoi(raw)
+		if err != nil || ms <= 0 {
+			log.Warnf("invalid value for %v: %v", key, raw)
+			continue
+		}
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultOTelExportTimeout
+}
+
+// otelHeaders returns the headers from OTEL_EXPORTER_OTLP_HEADERS and
+// OTEL_EXPORTER_OTLP_TRACES_HEADERS. The traces headers replace any header
+// with the same name.
+func otelHeaders() map[string]string {
+	headers := make(map[string]string)
+	for _, key := range []string{"OTEL_EXPORTER_OTLP_HEADERS", "OTEL_EXPORTER_OTLP_TRACES_HEADERS"} {
+		for name, value := range parseOTelKeyValues(os.Getenv(key)) {
+			headers[name] = value
+		}
+	}
+	return headers
+}
+
+// otelResourceAttributes returns the attributes of the resource from
+// OTEL_RESOURCE_ATTRIBUTES and OTEL_SERVICE_NAME.
+func otelResourceAttributes() []otelAttribute {
+	values := parseOTelKeyValues(os.Getenv("OTEL_RESOURCE_ATTRIBUTES"))
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		values["service.name"] = name
+	}
+	if values["service.name"] == "" {
+		values["service.name"] = "gotestsum"
+	}
+	attrs := make([]otelAttribute, 0, len(values))
+	for _, key := range sortedStringKeys(values) {
+		attrs = append(attrs, stringAttr(key, values[key]))
+	}
+	return attrs
+}
+
+// parseOTelKeyValues parses a list of key=value pairs separated by commas,
+// with URL encoded values, as used by the OTEL_* environment variables.
+func parseOTelKeyValues(raw string) map[string]string {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(raw, ",") {
+		idx := strings.Index(pair, "=")
+		if idx <= 0 {
+			continue
+		}
+		value, err := url.QueryUnescape(strings.TrimSpace(pair[idx+1:]))
+		if err != nil {
+			continue
+		}
+		result[strings.TrimSpace(pair[:idx])] = value
+	}
+	return result
+}
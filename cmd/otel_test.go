@@ -0,0 +1,205 @@
+package cmd
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/env"
+)
+
+func TestExportTrace(t *testing.T) {
+	env.Patch(t, "OTEL_EXPORTER_OTLP_HEADERS", "x-token=abc%20def")
+	env.Patch(t, "OTEL_SERVICE_NAME", "ci-tests")
+
+	var received otlpTraces
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Check(t, r.URL.Path == "/v1/traces")
+		assert.Check(t, r.Header.Get("x-token") == "abc def")
+		assert.Check(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	start := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	at := func(seconds int) time.Time {
+		return start.Add(time.Duration(seconds) * time.Second)
+	}
+	events := []testjson.TestEvent{
+		{Time: at(0), Action: testjson.Action("start"), Package: "example.com/one"},
+		{Time: at(1), Action: testjson.ActionRun, Package: "example.com/one", Test: "TestOne"},
+		{Time: at(1), Action: testjson.ActionRun, Package: "example.com/one", Test: "TestOne/sub"},
+		{Time: at(2), Action: testjson.ActionOutput, Package: "example.com/one", Test: "TestOne/sub", Output: "failed\n"},
+		{Time: at(2), Action: testjson.ActionFail, Package: "example.com/one", Test: "TestOne/sub"},
+		{Time: at(3), Action: testjson.ActionFail, Package: "example.com/one", Test: "TestOne"},
+		{Time: at(4), Action: testjson.ActionFail, Package: "example.com/one"},
+		// rerun
+		{Time: at(10), Action: testjson.ActionRun, Package: "example.com/one", Test: "TestOne", RunID: 1},
+		{Time: at(11), Action: testjson.ActionPass, Package: "example.com/one", Test: "TestOne", RunID: 1},
+		{Time: at(11), Action: testjson.ActionPass, Package: "example.com/one", RunID: 1},
+	}
+	opts := &options{otelTracer: newOTelTracer(server.URL + "/v1/traces")}
+	for _, event := range events {
+		opts.otelTracer.event(event)
+	}
+	exportTrace(opts)
+	assert.Assert(t, opts.otelTracer == nil)
+
+	assert.Equal(t, len(received.ResourceSpans), 1)
+	resource := received.ResourceSpans[0].Resource
+	assert.Equal(t, resource.Attributes[0].Key, "service.name")
+	assert.Equal(t, *resource.Attributes[0].Value.StringValue, "ci-tests")
+
+	spans := received.ResourceSpans[0].ScopeSpans[0].Spans
+	assert.Equal(t, len(spans), 5)
+	byName := func(name string, attempt int) *otelSpan {
+		for _, span := range spans {
+			if span.Name == name && spanAttempt(span) == attempt {
+				return span
+			}
+		}
+		t.Fatalf("missing span %v attempt %d", name, attempt)
+		return nil
+	}
+
+	root := byName("gotestsum", 0)
+	assert.Equal(t, root.ParentSpanID, "")
+	pkg := byName("example.com/one", 0)
+	assert.Equal(t, pkg.ParentSpanID, root.SpanID)
+	assert.Equal(t, pkg.Status.Code, otelStatusError)
+
+	first := byName("TestOne", 1)
+	assert.Equal(t, first.ParentSpanID, pkg.SpanID)
+	assert.Equal(t, first.Status.Code, otelStatusError)
+	sub := byName("TestOne/sub", 1)
+	assert.Equal(t, sub.ParentSpanID, first.SpanID)
+	assert.Equal(t, len(sub.Events), 1)
+	assert.Equal(t, *sub.Events[0].Attributes[0].Value.StringValue, "failed\n")
+
+	retry := byName("TestOne", 2)
+	assert.Equal(t, retry.ParentSpanID, pkg.SpanID)
+	assert.Equal(t, retry.Status.Code, otelStatusOK)
+
+	for _, span := range spans {
+		assert.Equal(t, span.TraceID, root.TraceID)
+	}
+	// spans use the time of the events
+	assert.Equal(t, time.Time(root.Start), at(0))
+	assert.Equal(t, time.Time(root.End), at(11))
+	assert.Equal(t, time.Time(sub.Start), at(1))
+	assert.Equal(t, time.Time(sub.End), at(2))
+}
+
+func spanAttempt(span *otelSpan) int {
+	for _, attr := range span.Attributes {
+		if attr.Key == "test.case.attempt" {
+			n, _ := strconv.Atoi(*attr.Value.IntValue)
+			return n
+		}
+	}
+	return 0
+}
+
+func TestExportTrace_Timeout(t *testing.T) {
+	env.Patch(t, "OTEL_EXPORTER_OTLP_TIMEOUT", "50")
+
+	unblock := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-unblock
+	}))
+	defer server.Close()
+	defer close(unblock)
+
+	opts := &options{otelTracer: newOTelTracer(server.URL + "/v1/traces")}
+	opts.otelTracer.event(testjson.TestEvent{
+		Time: time.Now(), Action: testjson.Action("start"), Package: "example.com/one",
+	})
+
+	start := time.Now()
+	exportTrace(opts)
+	assert.Assert(t, time.Since(start) < 5*time.Second)
+}
+
+func TestOTelTracesEndpoint(t *testing.T) {
+	type testCase struct {
+		name     string
+		opts     options
+		env      map[string]string
+		expected string
+	}
+	run := func(t *testing.T, tc testCase) {
+		for _, key := range []string{
+			"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_ENDPOINT",
+			"OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", "OTEL_EXPORTER_OTLP_PROTOCOL",
+		} {
+			env.Patch(t, key, tc.env[key])
+		}
+		assert.Equal(t, otelTracesEndpoint(&tc.opts), tc.expected)
+	}
+	testCases := []testCase{
+		{
+			name:     "flag",
+			opts:     options{otelEndpoint: "http://localhost:4318"},
+			expected: "http://localhost:4318/v1/traces",
+		},
+		{
+			name:     "flag with trailing slash",
+			opts:     options{otelEndpoint: "http://localhost:4318/"},
+			expected: "http://localhost:4318/v1/traces",
+		},
+		{
+			name:     "flag with traces path",
+			opts:     options{otelEndpoint: "http://localhost:4318/v1/traces"},
+			expected: "http://localhost:4318/v1/traces",
+		},
+		{
+			name: "env is ignored without --otel-export",
+			env:  map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"},
+		},
+		{
+			name:     "env base endpoint",
+			opts:     options{otelExport: true},
+			env:      map[string]string{"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318"},
+			expected: "http://collector:4318/v1/traces",
+		},
+		{
+			name: "env traces endpoint is used as-is",
+			opts: options{otelExport: true},
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT":        "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "http://traces:4318/custom",
+			},
+			expected: "http://traces:4318/custom",
+		},
+		{
+			name: "env with http protocol",
+			opts: options{otelExport: true},
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4318",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "http/protobuf",
+			},
+			expected: "http://collector:4318/v1/traces",
+		},
+		{
+			name: "env with grpc protocol",
+			opts: options{otelExport: true},
+			env: map[string]string{
+				"OTEL_EXPORTER_OTLP_ENDPOINT": "http://collector:4317",
+				"OTEL_EXPORTER_OTLP_PROTOCOL": "grpc",
+			},
+		},
+		{
+			name: "env without endpoint",
+			opts: options{otelExport: true},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
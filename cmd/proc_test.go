@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/poll"
+	"gotest.tools/v3/skip"
+)
+
+const helperProcessEnv = "GOTESTSUM_TEST_HELPER_PROCESS"
+
+// TestHelperProcessTree is not a real test. It is run as a subprocess by
+// TestStartGoTest_CancelTerminatesProcessTree to act as 'go test' and as a
+// test binary started by 'go test'.
+func TestHelperProcessTree(t *testing.T) {
+	switch os.Getenv(helperProcessEnv) {
+	case "parent":
+		cmd := exec.Command(os.Args[0], "-test.run=^TestHelperProcessTree$")
+		cmd.Env = append(os.Environ(), helperProcessEnv+"=child")
+		if err := cmd.Start(); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		fmt.Println(cmd.Process.Pid)
+		_ = cmd.Wait()
+		os.Exit(0)
+	case "child":
+		time.Sleep(time.Minute)
+		os.Exit(0)
+	}
+}
+
+func TestStartGoTest_CancelTerminatesProcessTree(t *testing.T) {
+	skip.If(t, stdinIsTerminal(), "'go test' is not started in a new process group when stdin is a terminal")
+	t.Setenv(helperProcessEnv, "parent")
+	orig := interruptGracePeriod
+	interruptGracePeriod = time.Second
+	t.Cleanup(func() { interruptGracePeriod = orig })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	p, err := startGoTest(ctx, "", nil, []string{os.Args[0], "-test.run=^TestHelperProcessTree$"})
+	assert.NilError(t, err)
+
+	line, err := bufio.NewReader(p.stdout).ReadString('\n')
+	assert.NilError(t, err)
+	pid, err := strconv.Atoi(strings.TrimSpace(line))
+	assert.NilError(t, err)
+	assert.Assert(t, processExists(pid))
+
+	cancel()
+	assert.Assert(t, p.cmd.Wait() != nil)
+
+	poll.WaitOn(t, func(poll.LogT) poll.Result {
+		if processExists(pid) {
+			return poll.Continue("test binary %d is still running", pid)
+		}
+		return poll.Success()
+	}, poll.WithTimeout(10*time.Second))
+}
@@ -0,0 +1,118 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+)
+
+// interruptSignals are the signals handled by newSignalHandler.
+var interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+// setProcessGroup starts the command in a new process group, so that a signal
+// can be sent to 'go test' and all of the test binaries it starts. When stdin
+// is a terminal the command stays in the foreground process group of
+// gotestsum, so that a test which reads from the terminal is not stopped by
+// SIGTTIN. The terminal sends its signals to every process in that group.
+func setProcessGroup(cmd *exec.Cmd) {
+	if stdinIsTerminal() {
+		return
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+}
+
+// ownsProcessGroup returns true if pid is the leader of the process group
+// started by setProcessGroup.
+func ownsProcessGroup(pid int) bool {
+	pgid, err := syscall.Getpgid(pid)
+	return err == nil && pgid == pid
+}
+
+// killTarget returns the process group of pid when it was started by
+// setProcessGroup, otherwise it returns pid.
+func killTarget(pid int) int {
+	if ownsProcessGroup(pid) {
+		return -pid
+	}
+	return pid
+}
+
+// signalProcessGroup sends the signal to every process in the process group
+// started by setProcessGroup, or only to pid when it has no process group.
+func signalProcessGroup(pid int, s os.Signal) error {
+	return syscall.Kill(killTarget(pid), s.(syscall.Signal))
+}
+
+// terminateProcessGroup sends SIGTERM to every process in the process group
+// started by setProcessGroup, or only to pid when it has no process group.
+func terminateProcessGroup(pid int) error {
+	return syscall.Kill(killTarget(pid), syscall.SIGTERM)
+}
+
+// killProcessGroup kills every process in the process group started by
+// setProcessGroup, or only pid when it has no process group.
+func killProcessGroup(pid int) error {
+	return syscall.Kill(killTarget(pid), syscall.SIGKILL)
+}
+
+// forwardSignals forwards the signals that a terminal sends to its foreground
+// process group to the process group started by setProcessGroup, until ctx is
+// done. Without this, SIGQUIT would not print the goroutine dump of a hung
+// test, and SIGTSTP would stop gotestsum but not the tests. After SIGQUIT is
+// forwarded, and 'go test' exited or the grace period passed, SIGQUIT is
+// raised again on gotestsum so that it prints its own goroutine dump.
+func forwardSignals(ctx context.Context, pid int, grace time.Duration) {
+	if !ownsProcessGroup(pid) {
+		// The terminal already sends the signals to 'go test'.
+		return
+	}
+	forwardSignalsThenRaise(ctx, pid, grace, raiseSignal)
+}
+
+func forwardSignalsThenRaise(ctx context.Context, pid int, grace time.Duration, raise func(syscall.Signal)) {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGQUIT, syscall.SIGTSTP, syscall.SIGCONT)
+
+	go func() {
+		defer signal.Stop(c)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case s := <-c:
+				if err := signalProcessGroup(pid, s); err != nil {
+					log.Debugf("failed to forward %v to 'go test': %v", s, err)
+				}
+				switch s {
+				case syscall.SIGTSTP:
+					// SIGTSTP is handled, so gotestsum must stop itself. The
+					// SIGCONT that resumes it is forwarded to 'go test'.
+					raise(syscall.SIGSTOP)
+				case syscall.SIGQUIT:
+					timer := time.NewTimer(grace)
+					select {
+					case <-ctx.Done():
+					case <-timer.C:
+					}
+					timer.Stop()
+					signal.Stop(c)
+					raise(syscall.SIGQUIT)
+					return
+				}
+			}
+		}
+	}()
+}
+
+// raiseSignal sends s to gotestsum.
+func raiseSignal(s syscall.Signal) {
+	_ = syscall.Kill(os.Getpid(), s)
+}
@@ -0,0 +1,149 @@
+//go:build !windows
+// +build !windows
+
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// ignoreInterrupt is a command which does not exit when it is interrupted.
+var ignoreInterrupt = []string{"sh", "-c", `trap "" INT; echo ready; sleep 30`}
+
+// startIgnoreInterrupt starts the ignoreInterrupt command, and waits for it to
+// ignore interrupts.
+func startIgnoreInterrupt(t *testing.T) *proc {
+	t.Helper()
+	p, err := startGoTest(context.Background(), "", nil, ignoreInterrupt)
+	assert.NilError(t, err)
+	line, err := bufio.NewReader(p.stdout).ReadString('\n')
+	assert.NilError(t, err)
+	assert.Equal(t, line, "ready\n")
+	return p
+}
+
+func TestSignalHandler_KillsAfterGracePeriod(t *testing.T) {
+	orig := interruptGracePeriod
+	interruptGracePeriod = 100 * time.Millisecond
+	t.Cleanup(func() { interruptGracePeriod = orig })
+
+	p := startIgnoreInterrupt(t)
+
+	start := time.Now()
+	assert.NilError(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	assert.Assert(t, p.cmd.Wait() != nil)
+	assert.Assert(t, time.Since(start) < 10*time.Second)
+	assert.Equal(t, atomic.LoadInt32(&p.signal), int32(syscall.SIGINT))
+	assert.Equal(t, atomic.LoadInt32(&p.interrupts), int32(1))
+}
+
+func TestSignalHandler_SecondInterruptKills(t *testing.T) {
+	orig := interruptGracePeriod
+	interruptGracePeriod = time.Minute
+	t.Cleanup(func() { interruptGracePeriod = orig })
+
+	p := startIgnoreInterrupt(t)
+
+	start := time.Now()
+	assert.NilError(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	// wait for the first interrupt to be handled
+	for atomic.LoadInt32(&p.interrupts) == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.NilError(t, syscall.Kill(os.Getpid(), syscall.SIGINT))
+	assert.Assert(t, p.cmd.Wait() != nil)
+	assert.Assert(t, time.Since(start) < 10*time.Second)
+	assert.Equal(t, atomic.LoadInt32(&p.interrupts), int32(2))
+}
+
+func TestForwardSignals_QuitIsRaisedAfterForwarding(t *testing.T) {
+	cmd := exec.Command("sh", "-c", `trap "echo quit; exit 0" QUIT; echo ready; while true; do sleep 0.1; done`)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	stdout, err := cmd.StdoutPipe()
+	assert.NilError(t, err)
+	assert.NilError(t, cmd.Start())
+	out := bufio.NewReader(stdout)
+	line, err := out.ReadString('\n')
+	assert.NilError(t, err)
+	assert.Equal(t, line, "ready\n")
+
+	exited, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	raised := make(chan syscall.Signal, 1)
+	forwardSignalsThenRaise(exited, cmd.Process.Pid, time.Minute, func(s syscall.Signal) {
+		raised <- s
+	})
+
+	assert.NilError(t, syscall.Kill(os.Getpid(), syscall.SIGQUIT))
+	line, err = out.ReadString('\n')
+	assert.NilError(t, err)
+	assert.Equal(t, line, "quit\n")
+	assert.NilError(t, cmd.Wait())
+	cancel()
+	select {
+	case s := <-raised:
+		assert.Equal(t, s, syscall.SIGQUIT)
+	case <-time.After(10 * time.Second):
+		t.Fatal("SIGQUIT was not raised on gotestsum")
+	}
+}
+
+func TestKillTarget(t *testing.T) {
+	cmd := exec.Command("sleep", "30")
+	assert.NilError(t, cmd.Start())
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	assert.Equal(t, killTarget(cmd.Process.Pid), cmd.Process.Pid)
+
+	group := exec.Command("sleep", "30")
+	group.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	assert.NilError(t, group.Start())
+	defer func() {
+		_ = group.Process.Kill()
+		_ = group.Wait()
+	}()
+	assert.Equal(t, killTarget(group.Process.Pid), -group.Process.Pid)
+}
+
+func TestSignalHandler_ForwardsSIGTERM(t *testing.T) {
+	args := []string{"sh", "-c", `trap "echo term; exit 0" TERM; echo ready; while true; do sleep 0.1; done`}
+	p, err := startGoTest(context.Background(), "", nil, args)
+	assert.NilError(t, err)
+	out := bufio.NewReader(p.stdout)
+	line, err := out.ReadString('\n')
+	assert.NilError(t, err)
+	assert.Equal(t, line, "ready\n")
+
+	assert.NilError(t, syscall.Kill(os.Getpid(), syscall.SIGTERM))
+	line, err = out.ReadString('\n')
+	assert.NilError(t, err)
+	assert.Equal(t, line, "term\n")
+	assert.NilError(t, p.cmd.Wait())
+	assert.Equal(t, atomic.LoadInt32(&p.signal), int32(syscall.SIGTERM))
+}
+
+// processExists returns true if the process is running. A zombie process is
+// not running, it has exited but was not yet reaped by its parent.
+func processExists(pid int) bool {
+	if err := syscall.Kill(pid, 0); err != nil {
+		return false
+	}
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	return !strings.Contains(string(stat), ") Z ")
+}
@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"strconv"
+	"time"
+)
+
+// interruptSignals are the signals handled by newSignalHandler.
+var interruptSignals = []os.Signal{os.Interrupt}
+
+// setProcessGroup does nothing on windows. The processes are already attached
+// to the same console, and killProcessGroup uses the process tree.
+func setProcessGroup(_ *exec.Cmd) {}
+
+// signalProcessGroup signals the process. An interrupt is not forwarded,
+// because the console already sends CTRL_C_EVENT to every attached process.
+func signalProcessGroup(pid int, s os.Signal) error {
+	if s == os.Interrupt {
+		return nil
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Signal(s)
+}
+
+// terminateProcessGroup kills the process tree, windows has no equivalent
+// of SIGTERM.
+func terminateProcessGroup(pid int) error {
+	return killProcessGroup(pid)
+}
+
+// killProcessGroup kills the process and all of its descendants, so that no
+// test binaries started by 'go test' keep running.
+func killProcessGroup(pid int) error {
+	cmd := exec.Command("taskkill", "/T", "/F", "/PID", strconv.Itoa(pid))
+	if err := cmd.Run(); err == nil {
+		return nil
+	}
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return err
+	}
+	return proc.Kill()
+}
+
+// forwardSignals does nothing on windows. The processes are attached to the
+// same console, so they receive the console signals directly.
+func forwardSignals(_ context.Context, _ int, _ time.Duration) {}
@@ -0,0 +1,159 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// testBinaryCache is the test binary of each package with failed tests,
+// compiled once into --rerun-fails-test-binary-cache, so that reruns do not
+// need to wait for 'go test' to build and link the binary again.
+type testBinaryCache struct {
+	// binaries maps a package to the path of its compiled test binary.
+	// Packages which failed to build are not in the map, and are rerun with
+	// 'go test'.
+	binaries map[string]string
+	dirs     *packageDirs
+}
+
+// newTestBinaryCache compiles the test binary of each package in tcs. It
+// returns nil when --rerun-fails-test-binary-cache is not set.
+func newTestBinaryCache(opts *options, tcs []testjson.TestCase) *testBinaryCache {
+	if opts.rerunFailsTestBinaryCache == "" {
+		return nil
+	}
+	dir, err := filepath.Abs(opts.rerunFailsTestBinaryCache)
+	if err != nil {
+		log.Warnf("failed to find the test binary cache directory, tests will be rerun with go test: %v", err)
+		return nil
+	}
+	c := &testBinaryCache{binaries: make(map[string]string), dirs: newPackageDirs()}
+	buildArgs := opts.args[:findPkgArgPosition(opts.args)]
+	for _, tc := range tcs {
+		if _, ok := c.binaries[tc.Package]; ok || tc.Package == "" {
+			continue
+		}
+		path := testBinaryPath(dir, tc.Package)
+		if err := buildTestBinaryFn(tc.Package, path, buildArgs); err != nil {
+			log.Warnf("failed to compile the test binary for %v, the package will be rerun with go test: %v",
+				tc.Package, err)
+			continue
+		}
+		c.binaries[tc.Package] = path
+	}
+	return c
+}
+
+// testBinaryPath returns the path of the test binary for pkg in dir.
+func testBinaryPath(dir string, pkg string) string {
+	path := filepath.Join(dir, filepath.FromSlash(pkg)+".test")
+	if runtime.GOOS == "windows" {
+		path += ".exe"
+	}
+	return path
+}
+
+// buildTestBinaryFn is a shim for testing
+var buildTestBinaryFn = buildTestBinary
+
+// buildTestBinary compiles the test binary of pkg to path with 'go test -c'.
+// args are the go test args, the flags which only apply to running the tests
+// are ignored by 'go test -c'.
+func buildTestBinary(pkg string, path string, args []string) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	cmdArgs := []string{"test", "-c", "-o", path}
+	cmdArgs = append(cmdArgs, args...)
+	cmdArgs = append(cmdArgs, pkg)
+	log.Debugf("exec: go %s", strings.Join(cmdArgs, " "))
+	if out, err := exec.Command("go", cmdArgs...).CombinedOutput(); err != nil {
+		return fmt.Errorf("%w\n%s", err, out)
+	}
+	// A package without any test files does not produce a binary.
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	return nil
+}
+
+// command returns the directory and the command used to rerun the tests in
+// rerun.pkg with the cached test binary. The binary is run by test2json, so
+// that the output is the same as 'go test -json'. ok is false when the
+// package does not have a cached binary.
+func (c *testBinaryCache) command(opts *options, rerun rerunOpts) (dir string, args []string, ok bool) {
+	if c == nil {
+		return "", nil, false
+	}
+	path, ok := c.binaries[rerun.pkg]
+	if !ok {
+		return "", nil, false
+	}
+	// 'go test' runs the test binary in the directory of the package.
+	dir = c.dirs.lookup(rerun.pkg)
+	if dir == "" {
+		return "", nil, false
+	}
+	args = []string{"go", "tool", "test2json", "-t", "-p", rerun.pkg, path, "-test.v=test2json"}
+	return dir, append(args, testBinaryArgs(opts.args, rerun)...), true
+}
+
+// testBinaryBoolFlags and testBinaryValueFlags are the flags of 'go test'
+// which are passed to the test binary, and not replaced by a rerun.
+var (
+	testBinaryBoolFlags  = []string{"short", "failfast"}
+	testBinaryValueFlags = []string{"count", "cpu", "parallel", "skip"}
+)
+
+// testBinaryArgs returns the args for the test binary of a rerun. The test
+// flags from the go test args are converted to the -test. form used by the
+// binary, and the args after -args are passed unchanged.
+func testBinaryArgs(goTestArgs []string, rerun rerunOpts) []string {
+	pkgArgIndex := findPkgArgPosition(goTestArgs)
+	flags := goTestArgs[:pkgArgIndex]
+
+	var result []string
+	for _, flag := range testBinaryBoolFlags {
+		if boolArgIndex(flag, flags) >= 0 || boolArgIndex("test."+flag, flags) >= 0 {
+			result = append(result, "-test."+flag)
+		}
+	}
+	for _, flag := range testBinaryValueFlags {
+		value := argValue(flag, flags)
+		if value == "" {
+			value = argValue("test."+flag, flags)
+		}
+		if value != "" {
+			result = append(result, "-test."+flag+"="+value)
+		}
+	}
+
+	timeout := rerun.timeout
+	if timeout == "" {
+		timeout = argValue("timeout", flags)
+	}
+	if timeout == "" {
+		timeout = defaultGoTestTimeout.String()
+	}
+	if rerun.runFlag != "" {
+		result = append(result, rerun.runFlag)
+	}
+	result = append(result, "-test.timeout="+timeout)
+	if rerun.shuffle != "" {
+		result = append(result, rerun.shuffleFlag())
+	}
+	if rerun.coverprofile != "" {
+		result = append(result, "-test.coverprofile="+rerun.coverprofile)
+	}
+	if pkgArgIndex < len(goTestArgs) {
+		result = append(result, goTestArgs[pkgArgIndex+1:]...)
+	}
+	return result
+}
@@ -0,0 +1,175 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func patchBuildTestBinaryFn(t *testing.T, f func(pkg, path string, args []string) error) {
+	t.Helper()
+	orig := buildTestBinaryFn
+	buildTestBinaryFn = f
+	t.Cleanup(func() { buildTestBinaryFn = orig })
+}
+
+func patchGoListPackageDirFn(t *testing.T, f func(pkg string) (string, error)) {
+	t.Helper()
+	orig := goListPackageDirFn
+	goListPackageDirFn = f
+	t.Cleanup(func() { goListPackageDirFn = orig })
+}
+
+func TestNewTestBinaryCache(t *testing.T) {
+	var built []string
+	patchBuildTestBinaryFn(t, func(pkg, path string, args []string) error {
+		assert.DeepEqual(t, args, []string{"-tags", "integration"})
+		built = append(built, pkg)
+		if pkg == "example.com/broken" {
+			return errors.New("build failed")
+		}
+		return nil
+	})
+	patchGoListPackageDirFn(t, func(pkg string) (string, error) {
+		return "/src/" + pkg, nil
+	})
+
+	dir := t.TempDir()
+	opts := &options{
+		rerunFailsTestBinaryCache: dir,
+		args:                      []string{"-tags", "integration", "-args", "-update"},
+	}
+	cache := newTestBinaryCache(opts, []testjson.TestCase{
+		{Package: "example.com/one", Test: "TestOne"},
+		{Package: "example.com/one", Test: "TestTwo"},
+		{Package: "example.com/broken", Test: "TestThree"},
+	})
+	assert.DeepEqual(t, built, []string{"example.com/one", "example.com/broken"})
+
+	rerun := rerunOpts{runFlag: "-test.run=^TestOne$", pkg: "example.com/one"}
+	cmdDir, args, ok := cache.command(opts, rerun)
+	assert.Assert(t, ok)
+	assert.Equal(t, cmdDir, "/src/example.com/one")
+	binary := filepath.Join(dir, "example.com", "one.test")
+	assert.DeepEqual(t, args, []string{
+		"go", "tool", "test2json", "-t", "-p", "example.com/one", binary, "-test.v=test2json",
+		"-test.run=^TestOne$", "-test.timeout=10m0s", "-update",
+	})
+
+	_, _, ok = cache.command(opts, rerunOpts{runFlag: "-test.run=^TestThree$", pkg: "example.com/broken"})
+	assert.Assert(t, !ok, "a package which failed to build is rerun with go test")
+}
+
+func TestNewTestBinaryCache_NotSet(t *testing.T) {
+	cache := newTestBinaryCache(&options{}, []testjson.TestCase{{Package: "example.com/one"}})
+	assert.Assert(t, cache == nil)
+	_, _, ok := cache.command(&options{}, rerunOpts{pkg: "example.com/one"})
+	assert.Assert(t, !ok)
+}
+
+func TestTestBinaryArgs(t *testing.T) {
+	type testCase struct {
+		name     string
+		args     []string
+		rerun    rerunOpts
+		expected []string
+	}
+	run := func(t *testing.T, tc testCase) {
+		assert.DeepEqual(t, testBinaryArgs(tc.args, tc.rerun), tc.expected)
+	}
+	testCases := []testCase{
+		{
+			name:     "no args",
+			rerun:    rerunOpts{runFlag: "-test.run=^TestOne$"},
+			expected: []string{"-test.run=^TestOne$", "-test.timeout=10m0s"},
+		},
+		{
+			name:  "test flags are converted",
+			args:  []string{"-short", "-count", "2", "--parallel=4", "-test.cpu=1,2", "-tags", "foo"},
+			rerun: rerunOpts{runFlag: "-test.run=^TestOne$"},
+			expected: []string{
+				"-test.short", "-test.count=2", "-test.cpu=1,2", "-test.parallel=4",
+				"-test.run=^TestOne$", "-test.timeout=10m0s",
+			},
+		},
+		{
+			name:     "timeout from args",
+			args:     []string{"-timeout=2m", "-run", "TestFoo"},
+			rerun:    rerunOpts{runFlag: "-test.run=^TestOne$"},
+			expected: []string{"-test.run=^TestOne$", "-test.timeout=2m"},
+		},
+		{
+			name: "rerun options",
+			args: []string{"-timeout=2m", "-shuffle=on", "-args", "-update", "-v"},
+			rerun: rerunOpts{
+				runFlag:      "-test.run=^TestOne$",
+				timeout:      "6m0s",
+				shuffle:      "12345",
+				coverprofile: "/tmp/rerun.out",
+			},
+			expected: []string{
+				"-test.run=^TestOne$", "-test.timeout=6m0s", "-test.shuffle=12345",
+				"-test.coverprofile=/tmp/rerun.out", "-update", "-v",
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestRerunFailed_WithTestBinaryCache(t *testing.T) {
+	patchBuildTestBinaryFn(t, func(pkg, path string, args []string) error {
+		return nil
+	})
+	patchGoListPackageDirFn(t, func(pkg string) (string, error) {
+		return "/src/" + pkg, nil
+	})
+
+	type call struct {
+		dir  string
+		args []string
+	}
+	var calls []call
+	defer func(orig func(context.Context, string, []string, []string) (*proc, error)) {
+		startGoTestFn = orig
+	}(startGoTestFn)
+	startGoTestFn = func(ctx context.Context, dir string, env []string, args []string) (*proc, error) {
+		calls = append(calls, call{dir: dir, args: args})
+		test := strings.TrimSuffix(strings.TrimPrefix(args[8], "-test.run=^"), "$")
+		out := `{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(out),
+			stderr: bytes.NewReader(nil),
+		}, nil
+	}
+
+	dir := t.TempDir()
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsTestBinaryCache:    dir,
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{Execution: newExecutionWithTwoFailures(t), Handler: noopHandler{}}
+	assert.NilError(t, rerunFailed(context.Background(), opts, cfg, nil))
+
+	assert.Equal(t, len(calls), 2)
+	for _, c := range calls {
+		assert.Equal(t, c.dir, "/src/pkg")
+		assert.DeepEqual(t, c.args[:7],
+			[]string{"go", "tool", "test2json", "-t", "-p", "pkg", filepath.Join(dir, "pkg.test")})
+	}
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// binarySizes records the estimated size of the test binary of each package
+// with failed tests, and the packages which are not rerun because their test
+// binary is larger than --rerun-fails-max-package-binary-size-kb.
+type binarySizes struct {
+	maxBytes int64
+	// buildArgs are the go test flags used to build the test binary, so that
+	// flags like -race, -cover, and -ldflags produce the same binary as the
+	// test run.
+	buildArgs []string
+
+	mu      sync.Mutex
+	sizes   map[string]int64
+	skipped map[string]bool
+}
+
+func newBinarySizes(maxKB int, buildArgs []string) *binarySizes {
+	return &binarySizes{
+		maxBytes:  int64(maxKB) * 1024,
+		buildArgs: buildArgs,
+		sizes:     make(map[string]int64),
+		skipped:   make(map[string]bool),
+	}
+}
+
+// tooLarge returns true if the test binary of pkg is larger than the limit.
+// The size of each package is looked up once. When the size can not be found
+// the package is rerun.
+func (b *binarySizes) tooLarge(pkg string) bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	size, ok := b.sizes[pkg]
+	if !ok {
+		var err error
+		size, err = packageBinarySizeFn(pkg, b.buildArgs)
+		if err != nil {
+			log.Warnf("failed to find the size of the test binary for %v, the package will be rerun: %v", pkg, err)
+		}
+		b.sizes[pkg] = size
+		if size > b.maxBytes {
+			log.Warnf("not rerunning failed tests in %v because the test binary is %d KB, "+
+				"larger than --rerun-fails-max-package-binary-size-kb=%d",
+				pkg, size/1024, b.maxBytes/1024)
+			b.skipped[pkg] = true
+		}
+	}
+	return b.skipped[pkg]
+}
+
+// skippedAny returns true if the failures of any package were not rerun
+// because the test binary was too large.
+func (b *binarySizes) skippedAny() bool {
+	if b == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.skipped) > 0
+}
+
+// withoutLargePackages removes the tests in packages with a test binary
+// larger than the limit from the tests selected by filter.
+func withoutLargePackages(filter testCaseFilter, b *binarySizes) testCaseFilter {
+	return func(tcs []testjson.TestCase) []testjson.TestCase {
+		var result []testjson.TestCase
+		for _, tc := range filter(tcs) {
+			if !b.tooLarge(tc.Package) {
+				result = append(result, tc)
+			}
+		}
+		return result
+	}
+}
+
+// packageBinarySizeFn is a shim for testing
+var packageBinarySizeFn = packageBinarySize
+
+// packageBinarySize returns the size of the test binary for pkg. The build
+// cache does not store linked test binaries, so the binary is built with
+// go test -c and buildArgs, using the compiled packages from the build cache,
+// and removed once its size is known.
+func packageBinarySize(pkg string, buildArgs []string) (int64, error) {
+	dir, err := ioutil.TempDir("", "gotestsum-binary-size")
+	if err != nil {
+		return 0, err
+	}
+	defer os.RemoveAll(dir) // nolint: errcheck
+
+	path := filepath.Join(dir, "pkg.test")
+	if err := buildTestBinary(pkg, path, buildArgs); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
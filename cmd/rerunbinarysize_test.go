@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"errors"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestRerunFailsFilter_MaxPackageBinarySize(t *testing.T) {
+	var lookups []string
+	defer func(orig func(string, []string) (int64, error)) {
+		packageBinarySizeFn = orig
+	}(packageBinarySizeFn)
+	packageBinarySizeFn = func(pkg string, buildArgs []string) (int64, error) {
+		assert.DeepEqual(t, buildArgs, []string{"-tags", "integration", "-race", "-ldflags=-s"})
+		lookups = append(lookups, pkg)
+		switch pkg {
+		case "example.com/large":
+			return 2048*1024 + 1, nil
+		case "example.com/unknown":
+			return 0, errors.New("go list failed")
+		}
+		return 1024 * 1024, nil
+	}
+
+	failed := []testjson.TestCase{
+		{Package: "example.com/large", Test: "TestOne"},
+		{Package: "example.com/large", Test: "TestTwo"},
+		{Package: "example.com/small", Test: "TestThree"},
+		{Package: "example.com/unknown", Test: "TestFour"},
+	}
+	opts := &options{
+		rerunFailsMaxPackageBinarySizeKB: 2048,
+		args:                             []string{"-tags", "integration", "-race", "-ldflags=-s"},
+	}
+	var names []string
+	for _, tc := range rerunFailsFilter(opts, nil)(failed) {
+		names = append(names, tc.Package+"."+tc.Test.Name())
+	}
+	assert.DeepEqual(t, names, []string{"example.com/small.TestThree", "example.com/unknown.TestFour"})
+	assert.Assert(t, opts.rerunBinarySizes.skippedAny())
+
+	// the size of each package is only looked up once
+	rerunFailsFilter(opts, nil)(failed)
+	assert.DeepEqual(t, lookups, []string{"example.com/large", "example.com/small", "example.com/unknown"})
+}
+
+func TestRerunFailsFilter_MaxPackageBinarySizeNotSet(t *testing.T) {
+	opts := &options{}
+	tcs := rerunFailsFilter(opts, nil)([]testjson.TestCase{{Package: "example.com/large", Test: "TestOne"}})
+	assert.Equal(t, len(tcs), 1)
+	assert.Assert(t, !opts.rerunBinarySizes.skippedAny())
+}
@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"gotest.tools/gotestsum/internal/log"
+)
+
+// tempDirEnvVars are the environment variables used to find the temp
+// directory. TMPDIR is used on unix, TMP and TEMP are used on Windows.
+var tempDirEnvVars = []string{"TMPDIR", "TMP", "TEMP"}
+
+// cleanEnvVars are the environment variables kept in the clean environment of
+// a rerun. They are the variables needed to find and run the go toolchain,
+// and its build and module caches. The variables that start with CGO_ are
+// also kept.
+var cleanEnvVars = []string{
+	"PATH", "HOME", "USER", "LOGNAME", "SHELL", "LANG", "TZ",
+	"XDG_CACHE_HOME", "XDG_CONFIG_HOME",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY",
+	// go toolchain
+	"GOROOT", "GOPATH", "GOBIN", "GOCACHE", "GOMODCACHE", "GOENV", "GOFLAGS",
+	"GOPROXY", "GOPRIVATE", "GONOPROXY", "GONOSUMDB", "GOSUMDB", "GOINSECURE",
+	"GOOS", "GOARCH", "GOAMD64", "GOARM", "GOARM64", "GO386", "GOEXPERIMENT",
+	"GOTOOLCHAIN", "GOWORK", "GOVCS", "CC", "CXX",
+	// Windows
+	"USERPROFILE", "APPDATA", "LOCALAPPDATA", "SYSTEMROOT", "SYSTEMDRIVE",
+	"WINDIR", "COMSPEC", "PATHEXT",
+}
+
+// startRerunGoTest starts the 'go test' process of a rerun. When
+// --rerun-fails-clean-env is set the process is started with a clean
+// environment, and a new empty temp directory, so that environment variables
+// and files left in the temp directory by an earlier run can not change the
+// result of the rerun. The temp directory is removed when the process exits.
+func startRerunGoTest(ctx context.Context, opts *options, dir string, args []string) (*proc, error) {
+	if !opts.rerunFailsCleanEnv {
+		return startGoTestFn(ctx, dir, nil, args)
+	}
+	tmpDir, err := ioutil.TempDir("", "gotestsum-rerun-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create a temp directory for the rerun: %w", err)
+	}
+	remove := func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			log.Warnf("failed to remove the temp directory of the rerun: %v", err)
+		}
+	}
+	p, err := startGoTestFn(ctx, dir, cleanRerunEnv(os.Environ(), tmpDir), args)
+	if err != nil {
+		remove()
+		return nil, err
+	}
+	p.cmd = &cancelWaiter{cancel: remove, wrapped: p.cmd}
+	return p, nil
+}
+
+// cleanRerunEnv returns the variables from env which are in cleanEnvVars, or
+// start with CGO_, with the temp directory variables
+// set to tmpDir. All other variables are removed.
+func cleanRerunEnv(env []string, tmpDir string) []string {
+	result := make([]string, 0, len(cleanEnvVars)+len(tempDirEnvVars))
+	for _, v := range env {
+		if isCleanEnvVar(v) {
+			result = append(result, v)
+		}
+	}
+	for _, key := range tempDirEnvVars {
+		result = append(result, key+"="+tmpDir)
+	}
+	return result
+}
+
+func isCleanEnvVar(v string) bool {
+	idx := strings.Index(v, "=")
+	if idx <= 0 {
+		return false
+	}
+	// environment variables are case insensitive on Windows
+	key := strings.ToUpper(v[:idx])
+	for _, name := range cleanEnvVars {
+		if key == name {
+			return true
+		}
+	}
+	return strings.HasPrefix(key, "CGO_")
+}
@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestRerunFailed_CleanEnv(t *testing.T) {
+	dirty := t.TempDir()
+	t.Setenv("TMPDIR", dirty)
+	t.Setenv("GOTESTSUM_TEST_VAR", "removed")
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	var tmpDirs []string
+	defer func(orig func(context.Context, string, []string, []string) (*proc, error)) {
+		startGoTestFn = orig
+	}(startGoTestFn)
+	startGoTestFn = func(ctx context.Context, dir string, env []string, args []string) (*proc, error) {
+		tmpDir := envValue(env, "TMPDIR")
+		assert.Assert(t, tmpDir != dirty)
+		assert.Equal(t, envValue(env, "TMP"), tmpDir)
+		assert.Equal(t, envValue(env, "TEMP"), tmpDir)
+		assert.Equal(t, envValue(env, "GOTESTSUM_TEST_VAR"), "")
+		assert.Equal(t, envValue(env, "GOFLAGS"), "-mod=mod")
+		assert.Equal(t, envValue(env, "PATH"), os.Getenv("PATH"))
+		_, err := os.Stat(tmpDir)
+		assert.NilError(t, err, "the temp dir exists while the rerun is running")
+		tmpDirs = append(tmpDirs, tmpDir)
+
+		return newPassingRerun(args), nil
+	}
+
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsCleanEnv:           true,
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{Execution: newExecutionWithTwoFailures(t), Handler: noopHandler{}}
+	assert.NilError(t, rerunFailed(context.Background(), opts, cfg, nil))
+
+	assert.Equal(t, len(tmpDirs), 2)
+	assert.Assert(t, tmpDirs[0] != tmpDirs[1], "each rerun has a new temp dir")
+	for _, dir := range tmpDirs {
+		_, err := os.Stat(dir)
+		assert.Assert(t, os.IsNotExist(err), "the temp dir is removed after the rerun")
+	}
+}
+
+func TestRerunFailed_InheritsEnvByDefault(t *testing.T) {
+	defer func(orig func(context.Context, string, []string, []string) (*proc, error)) {
+		startGoTestFn = orig
+	}(startGoTestFn)
+	startGoTestFn = func(ctx context.Context, dir string, env []string, args []string) (*proc, error) {
+		assert.Assert(t, env == nil)
+		return newPassingRerun(args), nil
+	}
+
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        1,
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{Execution: newExecutionWithTwoFailures(t), Handler: noopHandler{}}
+	assert.NilError(t, rerunFailed(context.Background(), opts, cfg, nil))
+}
+
+func newPassingRerun(args []string) *proc {
+	test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+	return &proc{
+		cmd: fakeWaiter{},
+		stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`),
+		stderr: bytes.NewReader(nil),
+	}
+}
+
+func envValue(env []string, key string) string {
+	for _, v := range env {
+		if strings.HasPrefix(v, key+"=") {
+			return strings.TrimPrefix(v, key+"=")
+		}
+	}
+	return ""
+}
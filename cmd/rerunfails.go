@@ -2,18 +2,42 @@ package cmd
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"regexp"
 	"sort"
 	"strings"
+	"sync/atomic"
+	"time"
 
+	"golang.org/x/tools/cover"
+	"gotest.tools/gotestsum/internal/coverprofile"
+	"gotest.tools/gotestsum/internal/log"
 	"gotest.tools/gotestsum/testjson"
 )
 
 type rerunOpts struct {
 	runFlag string
 	pkg     string
+	// shuffle is the value of the -test.shuffle flag. It is used to run
+	// tests with the same order as a previous run.
+	shuffle string
+	// coverprofile is the path used for the -coverprofile flag of a rerun, so
+	// that the profile is not written over the profile of the first run.
+	coverprofile string
+	// noCoverprofile removes the -coverprofile flag from the args of a rerun.
+	noCoverprofile bool
+	// timeout is the value of the -timeout flag of a rerun, set by
+	// --rerun-fails-package-timeout-scale.
+	timeout string
+	// verbose adds the -test.v flag to the last rerun attempt of a
+	// --raw-command, set by --rerun-fails-verbose-last-attempt.
+	verbose bool
+	// noRace removes the -race flag from the args of the first rerun attempt,
+	// set by --rerun-fails-race-escalate.
+	noRace bool
 }
 
 func (o rerunOpts) Args() []string {
@@ -21,106 +45,660 @@ func (o rerunOpts) Args() []string {
 	if o.runFlag != "" {
 		result = append(result, o.runFlag)
 	}
+	if o.shuffle != "" {
+		result = append(result, o.shuffleFlag())
+	}
+	if o.coverprofile != "" {
+		result = append(result, o.coverprofileFlag())
+	}
+	if o.timeout != "" {
+		result = append(result, "-test.timeout="+o.timeout)
+	}
+	if o.verbose {
+		result = append(result, "-test.v")
+	}
 	if o.pkg != "" {
 		result = append(result, o.pkg)
 	}
 	return result
 }
 
-func newRerunOptsFromTestCase(tc testjson.TestCase) rerunOpts {
-	return rerunOpts{
+func (o rerunOpts) coverprofileFlag() string {
+	return "-coverprofile=" + o.coverprofile
+}
+
+func (o rerunOpts) shuffleFlag() string {
+	return "-test.shuffle=" + o.shuffle
+}
+
+func (o rerunOpts) timeoutFlag() string {
+	return "-timeout=" + o.timeout
+}
+
+func newRerunOptsFromTestCase(
+	opts *options,
+	tc testjson.TestCase,
+	exec *testjson.Execution,
+	attempt int,
+) rerunOpts {
+	rerun := rerunOpts{
 		runFlag: goTestRunFlagForTestCase(tc.Test),
 		pkg:     tc.Package,
+		timeout: rerunTimeout(opts, tc.Package),
+		verbose: opts.rerunFailsVerboseLastAttempt && attempt == opts.rerunFailsMaxAttempts,
+		noRace:  opts.rerunFailsRaceEscalate && attempt == 1,
 	}
+	// Use the same seed as the failed run, so that tests which depend on the
+	// order they are run are more likely to fail the same way.
+	if pkg := exec.Package(tc.Package); pkg != nil {
+		rerun.shuffle = pkg.ShuffleSeed()
+	}
+	return rerun
+}
+
+// defaultGoTestTimeout is the timeout used by go test when the -timeout flag
+// is not set.
+const defaultGoTestTimeout = 10 * time.Minute
+
+// rerunTimeout returns the timeout for a rerun of pkg, which is the -timeout
+// from the go test args multiplied by the value from
+// --rerun-fails-package-timeout-scale. An empty string is returned when the
+// timeout of pkg is not scaled.
+func rerunTimeout(opts *options, pkg string) string {
+	scale, ok := opts.rerunFailsPackageTimeoutScale.Value(pkg)
+	if !ok {
+		return ""
+	}
+	base := defaultGoTestTimeout
+	for _, flag := range []string{"timeout", "test.timeout"} {
+		raw := argValue(flag, opts.args)
+		if raw == "" {
+			continue
+		}
+		d, err := time.ParseDuration(raw)
+		if err != nil {
+			log.Warnf("failed to parse -%v=%v, the rerun timeout is not scaled", flag, raw)
+			return ""
+		}
+		base = d
+		break
+	}
+	// A timeout of 0 disables the timeout.
+	if base == 0 {
+		return ""
+	}
+	return time.Duration(float64(base) * scale).String()
 }
 
 type testCaseFilter func([]testjson.TestCase) []testjson.TestCase
 
-func rerunFailsFilter(o *options) testCaseFilter {
-	if o.rerunFailsRunRootCases {
+func rerunFailsFilter(o *options, exec *testjson.Execution) testCaseFilter {
+	filter := rerunFailsSelectFilter(o)
+	if o.rerunFailsIgnoreBuildErrors {
+		filter = withoutBuildFailures(filter, exec)
+	}
+	if o.expectedFails != nil {
+		filter = withoutExpectedFails(filter, o.expectedFails)
+	}
+	if o.rerunFailsMaxPackageBinarySizeKB > 0 {
+		if o.rerunBinarySizes == nil {
+			o.rerunBinarySizes = newBinarySizes(o.rerunFailsMaxPackageBinarySizeKB,
+				o.args[:findPkgArgPosition(o.args)])
+		}
+		filter = withoutLargePackages(filter, o.rerunBinarySizes)
+	}
+	if o.rerunFailsSortByDuration {
 		return func(tcs []testjson.TestCase) []testjson.TestCase {
-			var result []testjson.TestCase
-			for _, tc := range tcs {
-				if !tc.Test.IsSubTest() {
-					result = append(result, tc)
-				}
-			}
-			return result
+			return testjson.SortByDuration(filter(tcs))
 		}
 	}
+	return filter
+}
+
+func rerunFailsSelectFilter(o *options) testCaseFilter {
+	if o.rerunFailsRunRootCases {
+		return coalesceSubtests
+	}
 	return testjson.FilterFailedUnique
 }
 
-func rerunFailed(ctx context.Context, opts *options, scanConfig testjson.ScanConfig) error {
-	ctx, cancel := context.WithCancel(ctx)
-	defer cancel()
-	tcFilter := rerunFailsFilter(opts)
-
-	rec := newFailureRecorderFromExecution(scanConfig.Execution)
-	for attempts := 0; rec.count() > 0 && attempts < opts.rerunFailsMaxAttempts; attempts++ {
-		testjson.PrintSummary(opts.stdout, scanConfig.Execution, testjson.SummarizeNone)
-		opts.stdout.Write([]byte("\n")) // nolint: errcheck
-
-		nextRec := newFailureRecorder(scanConfig.Handler)
-		for _, tc := range tcFilter(rec.failures) {
-			goTestProc, err := startGoTestFn(ctx, "", goTestCmdArgs(opts, newRerunOptsFromTestCase(tc)))
-			if err != nil {
-				return err
-			}
+// coalesceSubtests replaces each failed subtest with its root test, so that
+// the root test is rerun with all of its subtests. Failed root tests without
+// any failed subtests are unchanged. A root test is rerun once, no matter how
+// many of its subtests failed.
+func coalesceSubtests(tcs []testjson.TestCase) []testjson.TestCase {
+	type key struct {
+		pkg  string
+		test string
+	}
+	roots := make(map[key]testjson.TestCase)
+	for _, tc := range tcs {
+		if !tc.Test.IsSubTest() {
+			roots[key{pkg: tc.Package, test: tc.Test.Name()}] = tc
+		}
+	}
 
-			cfg := testjson.ScanConfig{
-				RunID:     attempts + 1,
-				Stdout:    goTestProc.stdout,
-				Stderr:    goTestProc.stderr,
-				Handler:   nextRec,
-				Execution: scanConfig.Execution,
-				Stop:      cancel,
-			}
-			if _, err := testjson.ScanTestOutput(cfg); err != nil {
-				return err
-			}
-			exitErr := goTestProc.cmd.Wait()
-			if exitErr != nil {
-				nextRec.lastErr = exitErr
-			}
-			if err := hasErrors(exitErr, scanConfig.Execution); err != nil {
-				return err
-			}
+	var result []testjson.TestCase
+	seen := make(map[key]bool)
+	for _, tc := range testjson.FilterFailedUnique(tcs) {
+		root, _ := tc.Test.Split()
+		k := key{pkg: tc.Package, test: root}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		if rootTC, ok := roots[k]; ok {
+			tc = rootTC
+		} else {
+			// The root test may be missing when the output was incomplete.
+			tc.Test = testjson.TestName(root)
+		}
+		result = append(result, tc)
+	}
+	return result
+}
+
+// rerunFailed reruns the failed tests in scanConfig.Execution. initialErr is
+// the error from the initial run, which is returned when no rerun attempt
+// completes, for example because the --rerun-fails-before-hook failed.
+func rerunFailed(ctx context.Context, opts *options, scanConfig testjson.ScanConfig, initialErr error) error {
+	opts.flakiness = newFlakinessTracker()
+	rec := newFailureRecorderFromExecution(scanConfig.Execution, initialErr)
+	return rerunFailedFrom(ctx, opts, scanConfig, rec, 0, newRerunCoverage(opts))
+}
+
+// rerunFailedFrom reruns the failures in rec, starting from attempt number
+// attempts. It is used to continue reruns after the first attempt has
+// already been completed by streaming reruns.
+func rerunFailedFrom(
+	ctx context.Context,
+	opts *options,
+	scanConfig testjson.ScanConfig,
+	rec *failureRecorder,
+	attempts int,
+	cov *rerunCoverage,
+) error {
+	tcFilter := rerunFailsFilter(opts, scanConfig.Execution)
+	// totalFailures is the number of failures from all the completed rerun
+	// attempts. The failures in rec are from the initial run when attempts
+	// is 0.
+	var totalFailures int
+	if attempts > 0 {
+		totalFailures = rec.count()
+	}
+	opts.rerunTestBinaries = newTestBinaryCache(opts, tcFilter(rec.failures))
+	for ; rec.count() > 0 && attempts < opts.rerunFailsMaxAttempts; attempts++ {
+		if err := checkMaxTotalFailures(opts, totalFailures); err != nil {
+			return err
+		}
+		writeRerunAttemptSummary(opts, scanConfig.Execution)
+
+		if err := runHook(ctx, opts.rerunFailsBeforeHook, attempts+1); err != nil {
+			log.Warnf("skipping rerun attempt %d because --rerun-fails-before-hook failed: %v", attempts+1, err)
+			continue
+		}
+		nextRec := newFailureRecorder(scanConfig.Handler, opts.flakiness)
+		tcs := tcFilter(rec.failures)
+		started := time.Now()
+		restoreFormatter := useRerunFormatter(scanConfig.Handler)
+		err := rerunAttempt(ctx, opts, scanConfig.Execution, tcs, attempts+1, nextRec, cov)
+		restoreFormatter()
+		if hookErr := runHook(ctx, opts.rerunFailsAfterHook, attempts+1); hookErr != nil {
+			log.Warnf("--rerun-fails-after-hook for rerun attempt %d failed: %v", attempts+1, hookErr)
+		}
+		writeRerunAttemptJSONSummary(opts, attempts+1, len(tcs), nextRec, time.Since(started), err)
+		if err != nil {
+			return err
 		}
 		rec = nextRec
+		totalFailures += rec.count()
+	}
+
+	if err := cov.combine(); err != nil {
+		return err
 	}
 	return rec.lastErr
 }
 
+// rerunAttempt reruns each of the tests in tcs once.
+func rerunAttempt(
+	ctx context.Context,
+	opts *options,
+	exec *testjson.Execution,
+	tcs []testjson.TestCase,
+	attempt int,
+	rec *failureRecorder,
+	cov *rerunCoverage,
+) error {
+	log.Debugf("rerun attempt %d of %d: %d tests", attempt, opts.rerunFailsMaxAttempts, len(tcs))
+	for i, tc := range tcs {
+		opts.flakiness.queued(tc)
+		if err := writeRerunHeader(opts, tc, attempt, i+1); err != nil {
+			return err
+		}
+		if err := rerunTestCase(ctx, opts, exec, tc, attempt, rec, cov); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkMaxTotalFailures returns an error if the number of failures from all
+// rerun attempts exceeds --rerun-fails-max-total-failures.
+func checkMaxTotalFailures(opts *options, totalFailures int) error {
+	if opts.rerunFailsMaxTotalFailures == 0 || totalFailures <= opts.rerunFailsMaxTotalFailures {
+		return nil
+	}
+	return &RerunError{
+		Kind: ErrKindMaxTotalFailures,
+		Underlying: fmt.Errorf(
+			"rerun aborted because the number of failures in all reruns (%d) exceeds maximum (%d) "+
+				"set by --rerun-fails-max-total-failures",
+			totalFailures, opts.rerunFailsMaxTotalFailures),
+	}
+}
+
+// writeRerunAttemptSummary prints the summary line before each rerun attempt,
+// unless the results are printed by --rerun-fails-group-by-package.
+func writeRerunAttemptSummary(opts *options, exec *testjson.Execution) {
+	if opts.rerunFailsGroupByPackage {
+		return
+	}
+	testjson.PrintSummary(opts.stdout, exec, testjson.SummarizeNone)
+	opts.stdout.Write([]byte("\n")) // nolint: errcheck
+}
+
+// rerunHeader is the data used to execute the --rerun-fails-output-template.
+type rerunHeader struct {
+	Package string
+	Test    string
+	// Attempt is the number of the rerun attempt, starting at 1.
+	Attempt int
+	// Index of the test in the attempt, starting at 1.
+	Index int
+}
+
+// writeRerunHeader prints the --rerun-fails-output-template before the output
+// of a rerun.
+func writeRerunHeader(opts *options, tc testjson.TestCase, attempt int, index int) error {
+	tmpl := opts.rerunFailsOutputTemplate.Value()
+	if tmpl == nil {
+		return nil
+	}
+	header := rerunHeader{
+		Package: tc.Package,
+		Test:    tc.Test.Name(),
+		Attempt: attempt,
+		Index:   index,
+	}
+	if err := tmpl.Execute(opts.stdout, header); err != nil {
+		return fmt.Errorf("failed to execute rerun-fails-output-template: %w", err)
+	}
+	return nil
+}
+
+// rerunTestCase runs the test in tc again, and scans the output into exec
+// using rec as the handler.
+func rerunTestCase(
+	ctx context.Context,
+	opts *options,
+	exec *testjson.Execution,
+	tc testjson.TestCase,
+	runID int,
+	rec *failureRecorder,
+	cov *rerunCoverage,
+) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	rerun := newRerunOptsFromTestCase(opts, tc, exec, runID)
+	if err := cov.prepare(&rerun); err != nil {
+		return err
+	}
+	dir, args, ok := opts.rerunTestBinaries.command(opts, rerun)
+	if !ok {
+		dir, args = "", goTestCmdArgs(opts, rerun)
+	}
+	goTestProc, err := startRerunGoTest(ctx, opts, dir, args)
+	if err != nil {
+		cov.discard(rerun)
+		return &RerunError{Kind: ErrKindRerunFailed, Underlying: err}
+	}
+
+	cfg := testjson.ScanConfig{
+		RunID:     runID,
+		Stdout:    goTestProc.stdout,
+		Stderr:    goTestProc.stderr,
+		Handler:   rec,
+		Execution: exec,
+		Stop:      cancel,
+	}
+	if _, err := testjson.ScanTestOutput(cfg); err != nil {
+		return &RerunError{Kind: ErrKindRerunFailed, Underlying: err}
+	}
+	exitErr := goTestProc.cmd.Wait()
+	if signum := atomic.LoadInt32(&goTestProc.signal); signum != 0 {
+		return interruptedError(signum)
+	}
+	if exitErr != nil {
+		rec.lastErr = exitErr
+	}
+	cov.collect(rerun)
+	if err := verifyRerun(opts, exec, tc, rerun.runFlag, runID, rec); err != nil {
+		return err
+	}
+	return hasErrors(exitErr, exec, opts, tc.Package)
+}
+
+// verifyRerun checks that the rerun of tc with runID ran the test. The -run
+// flag of the rerun may not match the test, for example when the name of a
+// subtest changes between runs. A test which did not run is kept as a
+// failure in rec, because the rerun did not show that the test passes. With
+// --strict-rerun an error is returned instead.
+func verifyRerun(
+	opts *options,
+	exec *testjson.Execution,
+	tc testjson.TestCase,
+	runFlag string,
+	runID int,
+	rec *failureRecorder,
+) error {
+	// A package failure has no test name to verify.
+	if tc.Test == "" || hasRunTestCase(exec, tc, runID) {
+		return nil
+	}
+	msg := fmt.Sprintf("the rerun of %v in %v did not run the test, %v did not match any test",
+		tc.Test, tc.Package, runFlag)
+	if opts.strictRerun {
+		return &RerunError{Kind: ErrKindTestNotRerun, Underlying: errors.New(msg)}
+	}
+	log.Warnf("%v. The test is still reported as failed.", msg)
+	rec.failures = append(rec.failures, tc)
+	if rec.lastErr == nil {
+		rec.lastErr = exitError{num: 1}
+	}
+	return nil
+}
+
+// rerunCoverage collects the coverage profiles written by reruns, so that they
+// can be combined with the profile written by the first run.
+type rerunCoverage struct {
+	mainProfile string
+	profiles    []*cover.Profile
+	// skip is true when --rerun-fails-no-coverprofile is set. Reruns do not
+	// write a coverprofile, and the profile of the first run is not changed.
+	skip bool
+}
+
+func newRerunCoverage(opts *options) *rerunCoverage {
+	_, mainProfile, _ := coverprofile.ParseCoverProfile(opts.args)
+	if opts.rerunFailsNoCoverprofile {
+		return &rerunCoverage{skip: mainProfile != ""}
+	}
+	return &rerunCoverage{mainProfile: mainProfile}
+}
+
+// prepare sets the path of the coverprofile used by the rerun.
+func (c *rerunCoverage) prepare(rerun *rerunOpts) error {
+	if c.skip {
+		rerun.noCoverprofile = true
+		return nil
+	}
+	if c.mainProfile == "" {
+		return nil
+	}
+	var err error
+	rerun.coverprofile, err = newRerunCoverprofilePath()
+	if err != nil {
+		return &RerunError{Kind: ErrKindCoverprofile, Underlying: err}
+	}
+	return nil
+}
+
+// collect the profiles written by the rerun.
+func (c *rerunCoverage) collect(rerun rerunOpts) {
+	if rerun.coverprofile != "" {
+		c.profiles = append(c.profiles, readRerunCoverprofile(rerun.coverprofile)...)
+	}
+}
+
+// discard removes the coverprofile of a rerun which did not run, so that the
+// temporary file is not leaked.
+func (c *rerunCoverage) discard(rerun rerunOpts) {
+	if rerun.coverprofile != "" {
+		_ = os.Remove(rerun.coverprofile)
+	}
+}
+
+// combine all the collected profiles into the main profile.
+func (c *rerunCoverage) combine() error {
+	if len(c.profiles) == 0 {
+		return nil
+	}
+	if err := combineCoverprofiles(c.mainProfile, c.profiles); err != nil {
+		return &RerunError{Kind: ErrKindCoverprofile, Underlying: err}
+	}
+	return nil
+}
+
+func newRerunCoverprofilePath() (string, error) {
+	fh, err := ioutil.TempFile("", "gotestsum-rerun-coverprofile")
+	if err != nil {
+		return "", fmt.Errorf("failed to create coverprofile for rerun: %w", err)
+	}
+	return fh.Name(), fh.Close()
+}
+
+// readRerunCoverprofile returns the profiles written by a rerun, and removes
+// the file.
+func readRerunCoverprofile(path string) []*cover.Profile {
+	defer os.Remove(path) // nolint: errcheck
+	profiles, err := cover.ParseProfiles(path)
+	if err != nil {
+		log.Warnf("failed to read coverprofile of rerun: %v", err)
+		return nil
+	}
+	return profiles
+}
+
+// combineCoverprofiles merges the profiles from reruns into the main profile.
+// A rerun may use a stricter cover mode than the first run, for example
+// --rerun-fails-race-escalate adds -race which implies atomic, so the profiles
+// are upgraded to the strictest mode.
+func combineCoverprofiles(mainProfile string, profiles []*cover.Profile) error {
+	mode, err := coverprofile.ProfileMode(mainProfile)
+	if err != nil {
+		return fmt.Errorf("failed to detect mode of coverprofile: %w", err)
+	}
+	main, err := cover.ParseProfiles(mainProfile)
+	if err != nil {
+		return fmt.Errorf("failed to read coverprofile: %w", err)
+	}
+	upgraded, err := coverprofile.ModeUpgrade(append(main, profiles...))
+	if err != nil {
+		return fmt.Errorf("failed to combine coverprofiles: %w", err)
+	}
+	if len(upgraded) > 0 {
+		mode = upgraded[0].Mode
+	}
+	if err := coverprofile.WriteProfiles(mainProfile, mode, upgraded); err != nil {
+		return fmt.Errorf("failed to combine coverprofiles: %w", err)
+	}
+	return nil
+}
+
+// hasRunTestCase returns true if the test in tc ran with runID.
+func hasRunTestCase(exec *testjson.Execution, tc testjson.TestCase, runID int) bool {
+	pkg := exec.Package(tc.Package)
+	if pkg == nil {
+		return false
+	}
+	_, ok := pkg.TestCaseForRun(tc.Test, runID)
+	return ok
+}
+
 // startGoTestFn is a shim for testing
 var startGoTestFn = startGoTest
 
-func hasErrors(err error, exec *testjson.Execution) error {
+// RerunErrorKind identifies the reason the reruns of failed tests were
+// stopped.
+type RerunErrorKind int
+
+const (
+	// ErrKindUnknown is the zero value of RerunErrorKind. It is not used by
+	// any error returned by gotestsum.
+	ErrKindUnknown RerunErrorKind = iota
+	// ErrKindPanic is used when a test panicked, and some tests may not have
+	// run.
+	ErrKindPanic
+	// ErrKindUnexpectedExitCode is used when go test exited with a code other
+	// than 0 or 1.
+	ErrKindUnexpectedExitCode
+	// ErrKindBuildError is used when the previous run had errors, like a
+	// package that failed to build.
+	ErrKindBuildError
+	// ErrKindCoverprofile is used when the coverprofile of a rerun could not
+	// be created, or combined with the coverprofile of the first run.
+	ErrKindCoverprofile
+	// ErrKindMaxTotalFailures is used when the number of failures from all
+	// the rerun attempts exceeds --rerun-fails-max-total-failures.
+	ErrKindMaxTotalFailures
+	// ErrKindTestNotRerun is used when a rerun did not run the failed test,
+	// and --strict-rerun is set.
+	ErrKindTestNotRerun
+	// ErrKindRerunFailed is used when go test could not be started for a
+	// rerun, or the output of the rerun could not be read.
+	ErrKindRerunFailed
+)
+
+// RerunError is returned when the reruns of failed tests were stopped before
+// all the tests passed or the maximum number of attempts was reached.
+type RerunError struct {
+	Kind       RerunErrorKind
+	Underlying error
+}
+
+func (e *RerunError) Error() string {
+	return e.Underlying.Error()
+}
+
+// Unwrap returns the underlying error, for use with errors.Is and errors.As.
+func (e *RerunError) Unwrap() error {
+	return e.Underlying
+}
+
+// hasErrors returns an error when the reruns should be aborted. pkg is the
+// package of the rerun, or an empty string after the first run.
+func hasErrors(err error, exec *testjson.Execution, opts *options, pkg string) error {
 	switch {
-	case len(exec.Errors()) > 0:
-		return fmt.Errorf("rerun aborted because previous run had errors")
-	// Exit code 0 and 1 are expected.
-	case ExitCodeWithDefault(err) > 1:
-		return fmt.Errorf("unexpected go test exit code: %v", err)
-	case exec.HasPanic():
-		return fmt.Errorf("rerun aborted because previous run had a suspected panic and some test may not have run")
+	case hasBuildErrors(exec, opts, pkg):
+		return &RerunError{
+			Kind:       ErrKindBuildError,
+			Underlying: errors.New("rerun aborted because previous run had errors"),
+		}
+	// Exit code 0 and 1 are expected, and any exit code from
+	// --rerun-fails-on-exit-code.
+	case ExitCodeWithDefault(err) > 1 && !isRerunExitCode(opts, ExitCodeWithDefault(err)):
+		return &RerunError{
+			Kind:       ErrKindUnexpectedExitCode,
+			Underlying: fmt.Errorf("unexpected go test exit code: %w", err),
+		}
+	case exec.HasPanic() && !opts.rerunFailsContinueOnPanic:
+		return &RerunError{
+			Kind:       ErrKindPanic,
+			Underlying: errors.New("rerun aborted because previous run had a suspected panic and some test may not have run"),
+		}
 	default:
 		return nil
 	}
 }
 
+// isRerunExitCode returns true if code is one of the exit codes from
+// --rerun-fails-on-exit-code.
+func isRerunExitCode(opts *options, code int) bool {
+	for _, c := range opts.rerunFailsOnExitCode {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// hasBuildErrors returns true if the run had errors. With
+// --rerun-fails-ignore-build-errors only a build failure of pkg is an error,
+// so that the failures in other packages are still rerun. The packages which
+// failed to build are not rerun, see withoutBuildFailures.
+func hasBuildErrors(exec *testjson.Execution, opts *options, pkg string) bool {
+	if !opts.rerunFailsIgnoreBuildErrors {
+		return len(exec.Errors()) > 0
+	}
+	return pkg != "" && packageBuildFailed(exec, pkg)
+}
+
+func packageBuildFailed(exec *testjson.Execution, pkg string) bool {
+	p := exec.Package(pkg)
+	return p != nil && p.Metrics().BuildError
+}
+
+// rerunSkippedFailures returns true when some of the failures from the first
+// run were not rerun, because the test binary of the package was too large,
+// or because the package failed to build. Those are still failures when the
+// reruns pass.
+//
+// Before go1.24 'go test' does not send a [build failed] event, so a build
+// failure is only in the errors, and can not be attributed to a package. Any
+// error which is not attributed to a package is treated as a skipped failure.
+func rerunSkippedFailures(opts *options, exec *testjson.Execution) bool {
+	if opts.rerunBinarySizes.skippedAny() {
+		return true
+	}
+	if !opts.rerunFailsIgnoreBuildErrors {
+		return false
+	}
+	for _, pkg := range exec.Packages() {
+		if packageBuildFailed(exec, pkg) {
+			return true
+		}
+	}
+	return len(exec.Errors()) > 0
+}
+
+// withoutBuildFailures removes the failures in packages which failed to
+// build from the tests selected by filter. Rerunning the package would fail
+// to build again.
+func withoutBuildFailures(filter testCaseFilter, exec *testjson.Execution) testCaseFilter {
+	return func(tcs []testjson.TestCase) []testjson.TestCase {
+		var result []testjson.TestCase
+		for _, tc := range filter(tcs) {
+			if !packageBuildFailed(exec, tc.Package) {
+				result = append(result, tc)
+			}
+		}
+		return result
+	}
+}
+
 type failureRecorder struct {
 	testjson.EventHandler
-	failures []testjson.TestCase
-	lastErr  error
+	failures  []testjson.TestCase
+	passed    int
+	lastErr   error
+	flakiness *flakinessTracker
 }
 
-func newFailureRecorder(handler testjson.EventHandler) *failureRecorder {
-	return &failureRecorder{EventHandler: handler}
+func newFailureRecorder(handler testjson.EventHandler, flakiness *flakinessTracker) *failureRecorder {
+	return &failureRecorder{EventHandler: handler, flakiness: flakiness}
 }
 
-func newFailureRecorderFromExecution(exec *testjson.Execution) *failureRecorder {
-	return &failureRecorder{failures: exec.Failed()}
+// newFailureRecorderFromExecution returns a recorder of the failures from the
+// initial run, with lastErr set to the error from that run. When initialErr is
+// nil the failures still fail the run.
+func newFailureRecorderFromExecution(exec *testjson.Execution, initialErr error) *failureRecorder {
+	rec := &failureRecorder{failures: exec.Failed(), lastErr: initialErr}
+	if rec.lastErr == nil && len(rec.failures) > 0 {
+		rec.lastErr = exitError{num: 1}
+	}
+	return rec
 }
 
 func (r *failureRecorder) Event(event testjson.TestEvent, execution *testjson.Execution) error {
@@ -129,6 +707,10 @@ func (r *failureRecorder) Event(event testjson.TestEvent, execution *testjson.Ex
 		tc := pkg.LastFailedByName(event.Test)
 		r.failures = append(r.failures, tc)
 	}
+	if !event.PackageEvent() && event.Action == testjson.ActionPass {
+		r.passed++
+		r.flakiness.pass(event)
+	}
 	return r.EventHandler.Event(event, execution)
 }
 
@@ -154,19 +736,108 @@ func goTestRunFlagForTestCase(test testjson.TestName) string {
 	return "-test.run=^" + regexp.QuoteMeta(test.Name()) + "$"
 }
 
+// failOnBrokenTests returns an error if any test that was rerun has a pass
+// rate below the --rerun-fails-flakiness-threshold.
+func failOnBrokenTests(opts *options, exec *testjson.Execution) error {
+	if opts.rerunFailsFlakinessThreshold == 0 {
+		return nil
+	}
+	var broken []string
+	for _, counts := range rerunFailsCounts(exec, opts.rerunFailsFlakinessThreshold, opts.flakiness) {
+		if counts.Status == rerunStatusBroken {
+			broken = append(broken, fmt.Sprintf("%s (%.0f%% pass rate)", counts.Name, counts.PassRate*100))
+		}
+	}
+	if len(broken) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d tests have a pass rate below the flakiness threshold of %.0f%%: %s",
+		len(broken), opts.rerunFailsFlakinessThreshold*100, strings.Join(broken, ", "))
+}
+
 func writeRerunFailsReport(opts *options, exec *testjson.Execution) error {
 	if opts.rerunFailsMaxAttempts == 0 || opts.rerunFailsReportFile == "" {
 		return nil
 	}
 
-	type testCaseCounts struct {
-		total  int
-		failed int
+	fh, err := os.Create(opts.rerunFailsReportFile)
+	if err != nil {
+		return err
+	}
+
+	for _, counts := range rerunFailsCounts(exec, opts.rerunFailsFlakinessThreshold, opts.flakiness) {
+		fmt.Fprintf(fh, "%s: %d runs, %d failures", counts.Name, counts.Runs, counts.Failures)
+		if opts.rerunFailsReportFormat == rerunReportFormatPassRate {
+			fmt.Fprintf(fh, ", %.0f%% pass rate, %s", counts.PassRate*100, counts.Status)
+		}
+		if counts.FirstPassAttempt != nil {
+			fmt.Fprintf(fh, " (passed on attempt %d)", *counts.FirstPassAttempt)
+		}
+		fmt.Fprintln(fh)
+	}
+	return nil
+}
+
+// Values of --rerun-fails-report-format.
+const (
+	rerunReportFormatCounts   = "counts"
+	rerunReportFormatPassRate = "pass-rate"
+)
+
+const (
+	// rerunStatusFlaky is the status of a test that passed at least once,
+	// with a pass rate at or above the --rerun-fails-flakiness-threshold.
+	rerunStatusFlaky = "FLAKY"
+	// rerunStatusBroken is the status of a test with a pass rate below the
+	// --rerun-fails-flakiness-threshold.
+	rerunStatusBroken = "BROKEN"
+	// rerunStatusFailed is the status of a test that never passed, when the
+	// --rerun-fails-flakiness-threshold is not set.
+	rerunStatusFailed = "FAIL"
+)
+
+// rerunTestCounts is the number of times a test that failed at least once was
+// run, and the number of times it failed.
+type rerunTestCounts struct {
+	Name     string `json:"name"`
+	Runs     int    `json:"runs"`
+	Failures int    `json:"failures"`
+	// PassRate is the fraction of runs that passed, from 0 to 1.
+	PassRate float64 `json:"passRate"`
+	// Status is one of FLAKY, BROKEN, or FAIL.
+	Status string `json:"status"`
+	// FirstPassAttempt is the attempt when the test first passed, where 0 is
+	// the initial run. It is nil if the test never passed.
+	FirstPassAttempt *int `json:"first_pass_attempt,omitempty"`
+}
+
+// rerunFailsCounts returns the counts for every test that failed at least
+// once, sorted by name. Tests with a pass rate below threshold are BROKEN.
+// Each run of a test is counted once, using the RunID of the run.
+func rerunFailsCounts(
+	exec *testjson.Execution,
+	threshold float64,
+	flakiness *flakinessTracker,
+) []rerunTestCounts {
+	failed := exec.Failed()
+	// Tests are only rerun after a failure, so no test ran after the run that
+	// follows the last failure.
+	var lastRunID int
+	// failedIDs are the IDs of the failed test cases, by package.
+	failedIDs := make(map[string]map[int]bool)
+	for _, tc := range failed {
+		if tc.RunID+1 > lastRunID {
+			lastRunID = tc.RunID + 1
+		}
+		if failedIDs[tc.Package] == nil {
+			failedIDs[tc.Package] = make(map[int]bool)
+		}
+		failedIDs[tc.Package][tc.ID] = true
 	}
 
 	names := []string{}
-	results := map[string]testCaseCounts{}
-	for _, failure := range exec.Failed() {
+	results := map[string]rerunTestCounts{}
+	for _, failure := range failed {
 		name := failure.Package + "." + failure.Test.Name()
 		if _, ok := results[name]; ok {
 			continue
@@ -174,32 +845,108 @@ func writeRerunFailsReport(opts *options, exec *testjson.Execution) error {
 		names = append(names, name)
 
 		pkg := exec.Package(failure.Package)
-		counts := testCaseCounts{}
-
-		for _, tc := range pkg.Failed {
-			if tc.Test == failure.Test {
-				counts.total++
-				counts.failed++
+		counts := rerunTestCounts{Name: name}
+		for runID := 0; runID <= lastRunID; runID++ {
+			tc, ok := pkg.TestCaseForRun(failure.Test, runID)
+			if !ok {
+				continue
 			}
-		}
-		for _, tc := range pkg.Passed {
-			if tc.Test == failure.Test {
-				counts.total++
+			counts.Runs++
+			if failedIDs[failure.Package][tc.ID] {
+				counts.Failures++
 			}
 		}
 		// Skipped tests are not counted, but presumably skipped tests can not fail
+		passed := counts.Runs - counts.Failures
+		counts.PassRate = float64(passed) / float64(counts.Runs)
+		switch {
+		case counts.PassRate < threshold:
+			counts.Status = rerunStatusBroken
+		case passed == 0:
+			counts.Status = rerunStatusFailed
+		default:
+			counts.Status = rerunStatusFlaky
+		}
+		if attempt, ok := flakiness.firstPass(name); ok {
+			counts.FirstPassAttempt = &attempt
+		}
 		results[name] = counts
 	}
 
-	fh, err := os.Create(opts.rerunFailsReportFile)
-	if err != nil {
-		return err
+	sort.Strings(names)
+	result := make([]rerunTestCounts, 0, len(names))
+	for _, name := range names {
+		result = append(result, results[name])
+	}
+	return result
+}
+
+// flakinessTracker records the tests that were rerun, and the attempt when
+// each test first passed. Tests are identified by the package and test name,
+// the same as rerunTestCounts.Name.
+type flakinessTracker struct {
+	firstPassAttempt map[string]int
+	// rerun is the set of tests that were queued for a rerun, identified by
+	// package/TestName.
+	rerun map[string]bool
+}
+
+func newFlakinessTracker() *flakinessTracker {
+	return &flakinessTracker{
+		firstPassAttempt: make(map[string]int),
+		rerun:            make(map[string]bool),
+	}
+}
+
+// queued records that the test was queued for a rerun. A package that is
+// rerun because TestMain failed is not a test, and is not recorded.
+func (f *flakinessTracker) queued(tc testjson.TestCase) {
+	if f == nil || tc.Test == "" {
+		return
+	}
+	f.rerun[tc.Package+"/"+tc.Test.Name()] = true
+}
+
+// pass records a pass event. The RunID of the event is the attempt number.
+func (f *flakinessTracker) pass(event testjson.TestEvent) {
+	if f == nil {
+		return
 	}
+	name := event.Package + "." + event.Test
+	if attempt, ok := f.firstPassAttempt[name]; ok && attempt <= event.RunID {
+		return
+	}
+	f.firstPassAttempt[name] = event.RunID
+}
 
+// firstPass returns the attempt when the test first passed, and false if the
+// test never passed during a rerun.
+func (f *flakinessTracker) firstPass(name string) (int, bool) {
+	if f == nil {
+		return 0, false
+	}
+	attempt, ok := f.firstPassAttempt[name]
+	return attempt, ok
+}
+
+// writeRerunIDsFile writes the tests that were rerun to the
+// --rerun-fails-write-ids-file, one per line, sorted by name. The file is
+// empty when no tests were rerun.
+func writeRerunIDsFile(opts *options) error {
+	if opts.rerunFailsWriteIDsFile == "" {
+		return nil
+	}
+	var names []string
+	if opts.flakiness != nil {
+		for name := range opts.flakiness.rerun {
+			names = append(names, name)
+		}
+	}
 	sort.Strings(names)
+
+	var out strings.Builder
 	for _, name := range names {
-		counts := results[name]
-		fmt.Fprintf(fh, "%s: %d runs, %d failures\n", name, counts.total, counts.failed)
+		out.WriteString(name + "\n")
 	}
-	return nil
+	return ioutil.WriteFile(opts.rerunFailsWriteIDsFile, []byte(out.String()), 0o644)
 }
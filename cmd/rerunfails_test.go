@@ -3,10 +3,14 @@ package cmd
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
+	"os"
 	"strings"
 	"testing"
+	"time"
 
 	"gotest.tools/gotestsum/testjson"
 	"gotest.tools/v3/assert"
@@ -23,12 +27,29 @@ func TestWriteRerunFailsReport(t *testing.T) {
 		rerunFailsMaxAttempts: 4,
 	}
 
-	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
-		Stdout: bytes.NewReader(golden.Get(t, "go-test-json-flaky-rerun.out")),
-	})
+	exec := scanRerunOutput(t, golden.Get(t, "go-test-json-flaky-rerun.out"))
+
+	err := writeRerunFailsReport(opts, exec)
 	assert.NilError(t, err)
 
-	err = writeRerunFailsReport(opts, exec)
+	raw, err := ioutil.ReadFile(reportFile.Path())
+	assert.NilError(t, err)
+	golden.Assert(t, string(raw), t.Name()+"-expected")
+}
+
+func TestWriteRerunFailsReport_PassRateFormat(t *testing.T) {
+	reportFile := fs.NewFile(t, t.Name())
+	defer reportFile.Remove()
+
+	opts := &options{
+		rerunFailsReportFile:   reportFile.Path(),
+		rerunFailsReportFormat: rerunReportFormatPassRate,
+		rerunFailsMaxAttempts:  4,
+	}
+
+	exec := scanRerunOutput(t, golden.Get(t, "go-test-json-flaky-rerun.out"))
+
+	err := writeRerunFailsReport(opts, exec)
 	assert.NilError(t, err)
 
 	raw, err := ioutil.ReadFile(reportFile.Path())
@@ -36,6 +57,35 @@ func TestWriteRerunFailsReport(t *testing.T) {
 	golden.Assert(t, string(raw), t.Name()+"-expected")
 }
 
+func TestFailOnBrokenTests(t *testing.T) {
+	exec := scanRerunOutput(t, golden.Get(t, "go-test-json-flaky-rerun.out"))
+
+	t.Run("no threshold", func(t *testing.T) {
+		assert.NilError(t, failOnBrokenTests(&options{}, exec))
+	})
+	t.Run("below threshold", func(t *testing.T) {
+		opts := &options{rerunFailsFlakinessThreshold: 0.3}
+		err := failOnBrokenTests(opts, exec)
+		assert.Error(t, err, "1 tests have a pass rate below the flakiness threshold of 30%: "+
+			"gotest.tools/gotestsum/testdata/e2e/flaky.TestFailsOften (25% pass rate)")
+	})
+	t.Run("report", func(t *testing.T) {
+		counts := rerunFailsCounts(exec, 0.4, nil)
+		assert.Equal(t, len(counts), 3)
+		assert.Equal(t, counts[0].Status, rerunStatusBroken)
+		assert.Equal(t, counts[1].Status, rerunStatusFlaky)
+		assert.Equal(t, counts[1].PassRate, 0.5)
+		assert.Equal(t, counts[2].Status, rerunStatusBroken)
+	})
+	t.Run("never passed without threshold", func(t *testing.T) {
+		exec := newExecutionWithTwoFailures(t)
+		for _, counts := range rerunFailsCounts(exec, 0, nil) {
+			assert.Equal(t, counts.Status, rerunStatusFailed)
+		}
+		assert.NilError(t, failOnBrokenTests(&options{}, exec))
+	})
+}
+
 func TestWriteRerunFailsReport_HandlesMissingActionRunEvents(t *testing.T) {
 	reportFile := fs.NewFile(t, t.Name())
 	defer reportFile.Remove()
@@ -45,12 +95,9 @@ func TestWriteRerunFailsReport_HandlesMissingActionRunEvents(t *testing.T) {
 		rerunFailsMaxAttempts: 4,
 	}
 
-	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
-		Stdout: bytes.NewReader(golden.Get(t, "go-test-missing-run-events.out")),
-	})
-	assert.NilError(t, err)
+	exec := scanRerunOutput(t, golden.Get(t, "go-test-missing-run-events.out"))
 
-	err = writeRerunFailsReport(opts, exec)
+	err := writeRerunFailsReport(opts, exec)
 	assert.NilError(t, err)
 
 	raw, err := ioutil.ReadFile(reportFile.Path())
@@ -58,6 +105,37 @@ func TestWriteRerunFailsReport_HandlesMissingActionRunEvents(t *testing.T) {
 	golden.Assert(t, string(raw), t.Name()+"-expected")
 }
 
+// scanRerunOutput scans the go test output of a run followed by reruns of the
+// failed tests. Each package-level pass or fail event ends a run, and each run
+// is scanned with its own RunID, the same way rerunFailed scans them.
+func scanRerunOutput(t *testing.T, raw []byte) *testjson.Execution {
+	t.Helper()
+	var exec *testjson.Execution
+	var runID int
+	var run bytes.Buffer
+	for _, line := range bytes.SplitAfter(raw, []byte("\n")) {
+		run.Write(line)
+
+		var event testjson.TestEvent
+		if json.Unmarshal(line, &event) != nil || event.Test != "" {
+			continue
+		}
+		if event.Action != testjson.ActionPass && event.Action != testjson.ActionFail {
+			continue
+		}
+		var err error
+		exec, err = testjson.ScanTestOutput(testjson.ScanConfig{
+			Stdout:    &run,
+			Execution: exec,
+			RunID:     runID,
+		})
+		assert.NilError(t, err)
+		run.Reset()
+		runID++
+	}
+	return exec
+}
+
 func TestGoTestRunFlagFromTestCases(t *testing.T) {
 	type testCase struct {
 		input    string
@@ -94,14 +172,46 @@ func TestGoTestRunFlagFromTestCases(t *testing.T) {
 	}
 }
 
+func TestRerunFailsFilter_SortByDuration(t *testing.T) {
+	input := []testjson.TestCase{
+		{ID: 1, Package: "pkg", Test: "TestSlow", Elapsed: 2 * time.Second},
+		{ID: 2, Package: "pkg", Test: "TestParent", Elapsed: time.Second},
+		{ID: 3, Package: "pkg", Test: "TestParent/sub", Elapsed: 3 * time.Second},
+		{ID: 4, Package: "pkg", Test: "TestFast", Elapsed: time.Millisecond},
+	}
+	opts := &options{rerunFailsSortByDuration: true}
+	var names []string
+	for _, tc := range rerunFailsFilter(opts, nil)(input) {
+		names = append(names, string(tc.Test))
+	}
+	assert.DeepEqual(t, names, []string{"TestFast", "TestSlow", "TestParent/sub"})
+}
+
+func TestRerunFailsFilter_RunRootTest(t *testing.T) {
+	input := []testjson.TestCase{
+		{ID: 1, Package: "pkg", Test: "TestProcess"},
+		{ID: 2, Package: "pkg", Test: "TestProcess/case_1"},
+		{ID: 3, Package: "pkg", Test: "TestProcess/case_2/nested"},
+		{ID: 4, Package: "pkg", Test: "TestRoot"},
+		{ID: 5, Package: "other", Test: "TestMissingRoot/case"},
+	}
+	opts := &options{rerunFailsRunRootCases: true}
+	var names []string
+	for _, tc := range rerunFailsFilter(opts, nil)(input) {
+		names = append(names, tc.Package+"."+string(tc.Test))
+	}
+	assert.DeepEqual(t, names, []string{"other.TestMissingRoot", "pkg.TestProcess", "pkg.TestRoot"})
+	assert.Equal(t, goTestRunFlagForTestCase("TestProcess"), "-test.run=^TestProcess$")
+}
+
 func TestRerunFailed_ReturnsAnErrorWhenTheLastTestIsSuccessful(t *testing.T) {
 	type result struct {
 		out string
 		err error
 	}
 	jsonFailed := `{"Package": "pkg", "Action": "run"}
-{"Package": "pkg", "Test": "TestOne", "Action": "run"}
-{"Package": "pkg", "Test": "TestOne", "Action": "fail"}
+{"Package": "pkg", "Test": "TEST", "Action": "run"}
+{"Package": "pkg", "Test": "TEST", "Action": "fail"}
 {"Package": "pkg", "Action": "fail"}
 `
 	events := []result{
@@ -110,8 +220,8 @@ func TestRerunFailed_ReturnsAnErrorWhenTheLastTestIsSuccessful(t *testing.T) {
 		{out: jsonFailed, err: newExitCode("run-failed-3", 1)},
 		{
 			out: `{"Package": "pkg", "Action": "run"}
-{"Package": "pkg", "Test": "TestOne", "Action": "run"}
-{"Package": "pkg", "Test": "TestOne", "Action": "pass"}
+{"Package": "pkg", "Test": "TEST", "Action": "run"}
+{"Package": "pkg", "Test": "TEST", "Action": "pass"}
 {"Package": "pkg", "Action": "pass"}
 `,
 		},
@@ -120,9 +230,10 @@ func TestRerunFailed_ReturnsAnErrorWhenTheLastTestIsSuccessful(t *testing.T) {
 	fn := func(args []string) *proc {
 		next := events[0]
 		events = events[1:]
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
 		return &proc{
 			cmd:    fakeWaiter{result: next.err},
-			stdout: strings.NewReader(next.out),
+			stdout: strings.NewReader(strings.Replace(next.out, "TEST", test, -1)),
 			stderr: bytes.NewReader(nil),
 		}
 	}
@@ -140,13 +251,372 @@ func TestRerunFailed_ReturnsAnErrorWhenTheLastTestIsSuccessful(t *testing.T) {
 		Execution: newExecutionWithTwoFailures(t),
 		Handler:   noopHandler{},
 	}
-	err := rerunFailed(ctx, opts, cfg)
+	err := rerunFailed(ctx, opts, cfg, nil)
 	assert.Error(t, err, "run-failed-3")
 }
 
+func TestRerunFailed_StartFails(t *testing.T) {
+	orig := startGoTestFn
+	defer func() {
+		startGoTestFn = orig
+	}()
+	startGoTestFn = func(context.Context, string, []string, []string) (*proc, error) {
+		return nil, errors.New("exec: go: not found")
+	}
+
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	err := rerunFailed(context.Background(), opts, cfg, nil)
+	assert.Error(t, err, "exec: go: not found")
+	var rerunErr *RerunError
+	assert.Assert(t, errors.As(err, &rerunErr))
+	assert.Equal(t, rerunErr.Kind, ErrKindRerunFailed)
+}
+
+func TestRerunError_ZeroKind(t *testing.T) {
+	assert.Equal(t, RerunError{}.Kind, ErrKindUnknown)
+	assert.Assert(t, ErrKindPanic != ErrKindUnknown)
+}
+
+func TestRerunFailed_MaxTotalFailures(t *testing.T) {
+	var calls int
+	fn := func(args []string) *proc {
+		calls++
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        5,
+		rerunFailsMaxTotalFailures:   3,
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	err := rerunFailed(context.Background(), opts, cfg, nil)
+	assert.Error(t, err, "rerun aborted because the number of failures in all reruns (4) "+
+		"exceeds maximum (3) set by --rerun-fails-max-total-failures")
+	var rerunErr *RerunError
+	assert.Assert(t, errors.As(err, &rerunErr))
+	assert.Equal(t, rerunErr.Kind, ErrKindMaxTotalFailures)
+	// the first 2 attempts ran both failed tests
+	assert.Equal(t, calls, 4)
+}
+
+func newExecutionWithBuildFailure(t *testing.T) *testjson.Execution {
+	t.Helper()
+
+	out := `{"Package": "example.com/broken", "Action": "output", "Output": "FAIL\texample.com/broken [build failed]\n"}
+{"Package": "example.com/broken", "Action": "fail"}
+{"Package": "example.com/pkg", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestOne", "Action": "fail"}
+{"Package": "example.com/pkg", "Action": "fail"}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader("# example.com/broken\nbroken.go:3:1: syntax error\n"),
+	})
+	assert.NilError(t, err)
+	return exec
+}
+
+func TestHasErrors_IgnoreBuildErrors(t *testing.T) {
+	exec := newExecutionWithBuildFailure(t)
+	exitErr := newExitCode("failed", 1)
+
+	err := hasErrors(exitErr, exec, &options{}, "")
+	assert.Error(t, err, "rerun aborted because previous run had errors")
+
+	opts := &options{rerunFailsIgnoreBuildErrors: true}
+	assert.NilError(t, hasErrors(exitErr, exec, opts, ""))
+	assert.NilError(t, hasErrors(exitErr, exec, opts, "example.com/pkg"))
+
+	err = hasErrors(exitErr, exec, opts, "example.com/broken")
+	var rerunErr *RerunError
+	assert.Assert(t, errors.As(err, &rerunErr))
+	assert.Equal(t, rerunErr.Kind, ErrKindBuildError)
+}
+
+func TestRerunFailsFilter_IgnoreBuildErrors(t *testing.T) {
+	exec := newExecutionWithBuildFailure(t)
+
+	opts := &options{}
+	assert.Equal(t, len(rerunFailsFilter(opts, exec)(exec.Failed())), 2)
+	assert.Assert(t, !rerunSkippedFailures(opts, exec))
+
+	opts = &options{rerunFailsIgnoreBuildErrors: true}
+	tcs := rerunFailsFilter(opts, exec)(exec.Failed())
+	assert.Equal(t, len(tcs), 1)
+	assert.Equal(t, tcs[0].Package, "example.com/pkg")
+	assert.Equal(t, tcs[0].Test, testjson.TestName("TestOne"))
+	assert.Assert(t, rerunSkippedFailures(opts, exec))
+}
+
+func TestRerunSkippedFailures_UnattributedBuildError(t *testing.T) {
+	// before go1.24 a build failure is only reported on stderr
+	out := `{"Package": "example.com/pkg", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "example.com/pkg", "Test": "TestOne", "Action": "fail"}
+{"Package": "example.com/pkg", "Action": "fail"}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader("# example.com/broken\nbroken.go:3:1: syntax error\n"),
+	})
+	assert.NilError(t, err)
+
+	opts := &options{rerunFailsIgnoreBuildErrors: true}
+	assert.Equal(t, len(rerunFailsFilter(opts, exec)(exec.Failed())), 1)
+	assert.Assert(t, rerunSkippedFailures(opts, exec))
+}
+
+func TestRerunFailed_VerboseLastAttempt(t *testing.T) {
+	var verbose []bool
+	fn := func(args []string) *proc {
+		verbose = append(verbose, boolArgIndex("test.v", args) >= 0)
+		test := strings.TrimSuffix(strings.TrimPrefix(args[1], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	opts := &options{
+		args:                         []string{"./script"},
+		rawCommand:                   true,
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        3,
+		rerunFailsVerboseLastAttempt: true,
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	err := rerunFailed(context.Background(), opts, cfg, nil)
+	assert.Error(t, err, "failed")
+	// only the 2 reruns in the last attempt are verbose
+	assert.DeepEqual(t, verbose, []bool{false, false, false, false, true, true})
+}
+
+func TestRerunFailed_RaceEscalate(t *testing.T) {
+	var race []bool
+	fn := func(args []string) *proc {
+		race = append(race, boolArgIndex("race", args) >= 0)
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	opts := &options{
+		args:                         []string{"-race"},
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        3,
+		rerunFailsRaceEscalate:       true,
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	err := rerunFailed(context.Background(), opts, cfg, nil)
+	assert.Error(t, err, "failed")
+	// only the 2 reruns in the first attempt are run without -race
+	assert.DeepEqual(t, race, []bool{false, false, true, true, true, true})
+}
+
+func TestRemoveBoolArg(t *testing.T) {
+	args := []string{"-race", "-v", "--race=true", "./...", "-args", "-race"}
+	assert.DeepEqual(t, removeBoolArg("race", args),
+		[]string{"-v", "./...", "-args", "-race"})
+	assert.DeepEqual(t, removeBoolArg("race", []string{"-racey"}), []string{"-racey"})
+}
+
+func TestRerunCoverage_NoCoverprofile(t *testing.T) {
+	opts := &options{
+		args:                     []string{"-coverprofile=c.out"},
+		rerunFailsNoCoverprofile: true,
+	}
+	cov := newRerunCoverage(opts)
+
+	rerun := rerunOpts{runFlag: "-test.run=^TestOne$", pkg: "example.com/pkg"}
+	assert.NilError(t, cov.prepare(&rerun))
+	assert.Equal(t, rerun.coverprofile, "")
+	assert.Assert(t, rerun.noCoverprofile)
+	cov.collect(rerun)
+	assert.NilError(t, cov.combine())
+
+	args := goTestCmdArgs(opts, rerun)
+	assert.DeepEqual(t, args,
+		[]string{"go", "test", "-json", "-test.run=^TestOne$", "-count=1", "example.com/pkg"})
+}
+
+func TestRerunCoverage_Discard(t *testing.T) {
+	cov := newRerunCoverage(&options{args: []string{"-coverprofile=c.out"}})
+
+	rerun := rerunOpts{runFlag: "-test.run=^TestOne$", pkg: "example.com/pkg"}
+	assert.NilError(t, cov.prepare(&rerun))
+	assert.Assert(t, rerun.coverprofile != "")
+	_, err := os.Stat(rerun.coverprofile)
+	assert.NilError(t, err)
+
+	cov.discard(rerun)
+	_, err = os.Stat(rerun.coverprofile)
+	assert.Assert(t, os.IsNotExist(err))
+}
+
+func TestRerunCoverage_CombineUpgradesMode(t *testing.T) {
+	main := fs.NewFile(t, t.Name(), fs.WithContent(`mode: set
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 0
+`))
+	// the rerun used -race, which implies -covermode=atomic
+	rerun := fs.NewFile(t, t.Name(), fs.WithContent(`mode: atomic
+example.com/pkg/a.go:7.10,9.2 2 3
+`))
+	cov := &rerunCoverage{mainProfile: main.Path()}
+	cov.collect(rerunOpts{coverprofile: rerun.Path()})
+	assert.NilError(t, cov.combine())
+
+	raw, err := ioutil.ReadFile(main.Path())
+	assert.NilError(t, err)
+	expected := `mode: atomic
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 3
+`
+	assert.Equal(t, string(raw), expected)
+}
+
+func TestRerunTimeout(t *testing.T) {
+	type testCase struct {
+		name     string
+		args     []string
+		expected string
+	}
+	run := func(t *testing.T, tc testCase) {
+		opts := &options{args: tc.args, rerunFailsPackageTimeoutScale: &packageScaleValue{}}
+		assert.NilError(t, opts.rerunFailsPackageTimeoutScale.Set("example.com/slow=3"))
+		assert.Equal(t, rerunTimeout(opts, "example.com/slow"), tc.expected)
+		assert.Equal(t, rerunTimeout(opts, "example.com/fast"), "")
+	}
+	testCases := []testCase{
+		{name: "default timeout", expected: "30m0s"},
+		{name: "timeout arg", args: []string{"-timeout=90s"}, expected: "4m30s"},
+		{name: "test.timeout arg", args: []string{"-test.timeout", "1m"}, expected: "3m0s"},
+		{name: "timeout disabled", args: []string{"-timeout=0"}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestHasErrors_RerunFailsOnExitCode(t *testing.T) {
+	exec := newExecutionWithTwoFailures(t)
+	exitErr := newExitCode("failed", 2)
+
+	opts := &options{rerunFailsOnExitCode: []int{1, 2}}
+	assert.NilError(t, hasErrors(exitErr, exec, opts, ""))
+
+	opts = &options{rerunFailsOnExitCode: []int{1}}
+	err := hasErrors(exitErr, exec, opts, "")
+	var rerunErr *RerunError
+	assert.Assert(t, errors.As(err, &rerunErr))
+	assert.Equal(t, rerunErr.Kind, ErrKindUnexpectedExitCode)
+	assert.Assert(t, !isRerunExitCode(opts, 2))
+}
+
+func TestHasErrors_UnexpectedExitCode(t *testing.T) {
+	exec := newExecutionWithTwoFailures(t)
+	exitErr := newExitCode("signal: killed", 2)
+
+	err := hasErrors(exitErr, exec, &options{}, "")
+	assert.Error(t, err, "unexpected go test exit code: signal: killed")
+
+	var rerunErr *RerunError
+	assert.Assert(t, errors.As(err, &rerunErr))
+	assert.Equal(t, rerunErr.Kind, ErrKindUnexpectedExitCode)
+	assert.Assert(t, errors.Is(err, exitErr))
+}
+
+func TestRerunFailed_WithOutputTemplate(t *testing.T) {
+	fn := func(args []string) *proc {
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	tmpl := &templateValue{}
+	assert.NilError(t, tmpl.Set("--- rerun {{.Index}} of attempt {{.Attempt}}: {{.Package}}.{{.Test}}\n"))
+
+	stdout := new(bytes.Buffer)
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsOutputTemplate:     tmpl,
+		stdout:                       stdout,
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	assert.NilError(t, rerunFailed(context.Background(), opts, cfg, nil))
+
+	expected := `
+DONE 2 tests, 2 failures in 0.000s
+
+--- rerun 1 of attempt 1: pkg.TestOne
+--- rerun 2 of attempt 1: pkg.TestTwo
+`
+	assert.Equal(t, stdout.String(), expected)
+}
+
 func patchStartGoTestFn(f func(args []string) *proc) func() {
 	orig := startGoTestFn
-	startGoTestFn = func(ctx context.Context, dir string, args []string) (*proc, error) {
+	startGoTestFn = func(ctx context.Context, dir string, env []string, args []string) (*proc, error) {
 		return f(args), nil
 	}
 	return func() {
@@ -202,3 +672,234 @@ func (s noopHandler) Event(testjson.TestEvent, *testjson.Execution) error {
 func (s noopHandler) Err(string) error {
 	return nil
 }
+
+func TestRerunFailed_FirstPassAttempt(t *testing.T) {
+	attempts := map[string]int{}
+	fn := func(args []string) *proc {
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		attempts[test]++
+		result := "pass"
+		var err error
+		if test == "TestOne" && attempts[test] < 3 {
+			result = "fail"
+			err = newExitCode("failed", 1)
+		}
+		return &proc{
+			cmd: fakeWaiter{result: err},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "` + result + `"}
+{"Package": "pkg", "Action": "` + result + `"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	reportFile := fs.NewFile(t, t.Name())
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        5,
+		rerunFailsReportFile:         reportFile.Path(),
+		stdout:                       new(bytes.Buffer),
+	}
+	exec := newExecutionWithTwoFailures(t)
+	cfg := testjson.ScanConfig{Execution: exec, Handler: noopHandler{}}
+	assert.NilError(t, rerunFailed(context.Background(), opts, cfg, nil))
+
+	counts := rerunFailsCounts(exec, 0, opts.flakiness)
+	assert.Equal(t, len(counts), 2)
+	assert.Equal(t, *counts[0].FirstPassAttempt, 3)
+	assert.Equal(t, *counts[1].FirstPassAttempt, 1)
+
+	assert.NilError(t, writeRerunFailsReport(opts, exec))
+	raw, err := ioutil.ReadFile(reportFile.Path())
+	assert.NilError(t, err)
+	expected := `pkg.TestOne: 4 runs, 3 failures (passed on attempt 3)
+pkg.TestTwo: 2 runs, 1 failures (passed on attempt 1)
+`
+	assert.Equal(t, string(raw), expected)
+}
+
+func TestWriteRerunIDsFile(t *testing.T) {
+	fn := func(args []string) *proc {
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsWriteIDsFile:       dir.Join("ids.txt"),
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	assert.NilError(t, rerunFailed(context.Background(), opts, cfg, nil))
+	assert.NilError(t, writeRerunIDsFile(opts))
+
+	raw, err := ioutil.ReadFile(opts.rerunFailsWriteIDsFile)
+	assert.NilError(t, err)
+	assert.Equal(t, string(raw), "pkg/TestOne\npkg/TestTwo\n")
+}
+
+func TestWriteRerunIDsFile_NoReruns(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{rerunFailsWriteIDsFile: dir.Join("ids.txt")}
+	assert.NilError(t, writeRerunIDsFile(opts))
+
+	raw, err := ioutil.ReadFile(opts.rerunFailsWriteIDsFile)
+	assert.NilError(t, err)
+	assert.Equal(t, string(raw), "")
+}
+
+func TestRerunFailed_TestNotRerun(t *testing.T) {
+	// the initial run has a failed subtest, and a failed test with a name
+	// that is not matched by the -run flag of the rerun.
+	initial := `{"Package": "pkg", "Test": "TestParent", "Action": "run"}
+{"Package": "pkg", "Test": "TestParent/case_1", "Action": "run"}
+{"Package": "pkg", "Test": "TestParent/case_1", "Action": "fail"}
+{"Package": "pkg", "Test": "TestParent", "Action": "fail"}
+{"Package": "pkg", "Test": "TestGeneric[int]", "Action": "run"}
+{"Package": "pkg", "Test": "TestGeneric[int]", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`
+	newExec := func(t *testing.T) *testjson.Execution {
+		exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+			Stdout: strings.NewReader(initial),
+			Stderr: strings.NewReader(""),
+		})
+		assert.NilError(t, err)
+		return exec
+	}
+
+	var runFlags []string
+	fn := func(args []string) *proc {
+		runFlags = append(runFlags, args[3])
+		// The subtest no longer exists, so only the parent runs, and no test
+		// matches the -run flag for TestGeneric[int].
+		out := `{"Package": "pkg", "Action": "output", "Output": "testing: warning: no tests to run\n"}
+{"Package": "pkg", "Action": "pass"}
+`
+		if strings.Contains(args[3], "TestParent") {
+			out = `{"Package": "pkg", "Test": "TestParent", "Action": "run"}
+{"Package": "pkg", "Test": "TestParent", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`
+		}
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(out),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	t.Run("tests are still failed", func(t *testing.T) {
+		runFlags = nil
+		opts := &options{
+			rerunFailsMaxInitialFailures: 10,
+			rerunFailsMaxAttempts:        2,
+			stdout:                       new(bytes.Buffer),
+		}
+		cfg := testjson.ScanConfig{Execution: newExec(t), Handler: noopHandler{}}
+		err := rerunFailed(context.Background(), opts, cfg, nil)
+		assert.Error(t, err, "exit code 1")
+		assert.Equal(t, ExitCodeWithDefault(err), 1)
+
+		// both tests are rerun by each attempt
+		expected := []string{
+			"-test.run=^TestParent$/^case_1$",
+			"-test.run=^TestGeneric\\[int\\]$",
+			"-test.run=^TestParent$/^case_1$",
+			"-test.run=^TestGeneric\\[int\\]$",
+		}
+		assert.DeepEqual(t, runFlags, expected)
+	})
+
+	t.Run("with strict-rerun", func(t *testing.T) {
+		runFlags = nil
+		opts := &options{
+			rerunFailsMaxInitialFailures: 10,
+			rerunFailsMaxAttempts:        2,
+			strictRerun:                  true,
+			stdout:                       new(bytes.Buffer),
+		}
+		cfg := testjson.ScanConfig{Execution: newExec(t), Handler: noopHandler{}}
+		err := rerunFailed(context.Background(), opts, cfg, nil)
+		assert.Error(t, err, "the rerun of TestParent/case_1 in pkg did not run the test, "+
+			"-test.run=^TestParent$/^case_1$ did not match any test")
+		var rerunErr *RerunError
+		assert.Assert(t, errors.As(err, &rerunErr))
+		assert.Equal(t, rerunErr.Kind, ErrKindTestNotRerun)
+		assert.Equal(t, len(runFlags), 1)
+	})
+}
+
+func TestRun_RerunFails_OutputFormat(t *testing.T) {
+	var calls int
+	fn := func(args []string) *proc {
+		calls++
+		if calls == 1 {
+			return &proc{
+				cmd: fakeWaiter{result: newExitCode("failed", 1)},
+				stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "output", "Output": "first run output\n"}
+{"Package": "pkg", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`),
+				stderr: bytes.NewReader(nil),
+			}
+		}
+		return &proc{
+			cmd: fakeWaiter{},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "output", "Output": "rerun output\n"}
+{"Package": "pkg", "Test": "TestA", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		format:                       "testname",
+		rerunFailsMaxAttempts:        1,
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsOutputFormat:       "standard-verbose",
+		stdout:                       out,
+		stderr:                       new(bytes.Buffer),
+		hideSummary:                  newHideSummaryValue(),
+	}
+	assert.NilError(t, run(opts))
+	// the testname format only prints the output of failed tests
+	assert.Assert(t, strings.Contains(out.String(), "rerun output"), out.String())
+	assert.Assert(t, !strings.Contains(out.String(), "PASS pkg.TestA"), out.String())
+}
+
+func TestNewEventHandler_UnknownRerunOutputFormat(t *testing.T) {
+	opts := &options{
+		format:                 "testname",
+		rerunFailsOutputFormat: "bogus",
+		stdout:                 new(bytes.Buffer),
+		stderr:                 new(bytes.Buffer),
+	}
+	_, err := newEventHandler(opts)
+	assert.Error(t, err, "unknown format bogus for --rerun-fails-output-format")
+}
@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// rerunGraphEdge connects two packages which had failed tests in the same
+// rerun attempts. count is the number of those attempts.
+type rerunGraphEdge struct {
+	from, to string
+	count    int
+}
+
+// newRerunGraphEdges returns an edge for every pair of packages with failed
+// tests in the same rerun attempt, sorted by package name. The first run is
+// ignored, because every package with a failure in the first run would be
+// connected to every other, and only the failed packages are re-run.
+func newRerunGraphEdges(exec *testjson.Execution) []rerunGraphEdge {
+	// failedByRun maps a RunID to the packages with failed tests in the run.
+	failedByRun := make(map[int]map[string]bool)
+	for _, tc := range exec.Failed() {
+		if tc.RunID == 0 {
+			continue
+		}
+		if failedByRun[tc.RunID] == nil {
+			failedByRun[tc.RunID] = make(map[string]bool)
+		}
+		failedByRun[tc.RunID][tc.Package] = true
+	}
+
+	counts := make(map[[2]string]int)
+	for _, pkgs := range failedByRun {
+		names := make([]string, 0, len(pkgs))
+		for name := range pkgs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for i := range names {
+			for _, other := range names[i+1:] {
+				counts[[2]string{names[i], other}]++
+			}
+		}
+	}
+
+	edges := make([]rerunGraphEdge, 0, len(counts))
+	for key, count := range counts {
+		edges = append(edges, rerunGraphEdge{from: key[0], to: key[1], count: count})
+	}
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].from != edges[j].from {
+			return edges[i].from < edges[j].from
+		}
+		return edges[i].to < edges[j].to
+	})
+	return edges
+}
+
+// writeRerunGraph writes a GraphViz DOT file to --rerun-fails-generate-graph
+// after all the rerun attempts complete.
+func writeRerunGraph(opts *options, exec *testjson.Execution) {
+	if opts.rerunFailsGraphFile == "" {
+		return
+	}
+	buf := new(bytes.Buffer)
+	writeRerunGraphTo(buf, exec)
+	if err := ioutil.WriteFile(opts.rerunFailsGraphFile, buf.Bytes(), 0o644); err != nil {
+		log.Warnf("failed to write --rerun-fails-generate-graph file: %v", err)
+	}
+}
+
+// writeRerunGraphTo writes a node for each package with failed tests, labeled
+// with the number of rerun attempts of the package, and an edge between
+// packages which failed in the same rerun attempts. A package is red when a test was
+// still failing after the last rerun, and orange when every failure passed on
+// a rerun.
+func writeRerunGraphTo(out io.Writer, exec *testjson.Execution) {
+	fmt.Fprintln(out, "graph reruns {")
+	fmt.Fprintln(out, "  node [shape=box];")
+	for _, summary := range newRerunPackageSummaries(exec) {
+		color := "red"
+		if summary.status() == "FLAKY" {
+			color = "orange"
+		}
+		reruns := "reruns"
+		if summary.reruns == 1 {
+			reruns = "rerun"
+		}
+		label := fmt.Sprintf("%s\n%d %s", testjson.RelativePackagePath(summary.pkg), summary.reruns, reruns)
+		fmt.Fprintf(out, "  %s [label=%s, color=%s];\n",
+			dotQuote(summary.pkg), dotQuote(label), color)
+	}
+	for _, edge := range newRerunGraphEdges(exec) {
+		fmt.Fprintf(out, "  %s -- %s [label=%d, penwidth=%d];\n",
+			dotQuote(edge.from), dotQuote(edge.to), edge.count, edge.count)
+	}
+	fmt.Fprintln(out, "}")
+}
+
+var dotEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// dotQuote returns s as a quoted DOT string. Unlike strconv.Quote it only
+// escapes the characters DOT understands: backslash, double quote, and
+// newline, which becomes a centered line break in a label.
+func dotQuote(s string) string {
+	return `"` + dotEscaper.Replace(s) + `"`
+}
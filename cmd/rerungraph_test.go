@@ -0,0 +1,73 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteRerunGraphTo(t *testing.T) {
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg/one", "Action": "fail"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "fail"}
+{"Package": "pkg/two", "Action": "fail"}
+{"Package": "pkg/three", "Test": "TestC", "Action": "run"}
+{"Package": "pkg/three", "Test": "TestC", "Action": "fail"}
+{"Package": "pkg/three", "Action": "fail"}
+`),
+		Handler: noopHandler{},
+	})
+	assert.NilError(t, err)
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg/one", "Action": "fail"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "fail"}
+{"Package": "pkg/two", "Action": "fail"}
+{"Package": "pkg/three", "Test": "TestC", "Action": "run"}
+{"Package": "pkg/three", "Test": "TestC", "Action": "pass"}
+{"Package": "pkg/three", "Action": "pass"}
+`),
+		Handler:   noopHandler{},
+		Execution: exec,
+		RunID:     1,
+	})
+	assert.NilError(t, err)
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg/one", "Action": "fail"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "fail"}
+{"Package": "pkg/two", "Action": "fail"}
+`),
+		Handler:   noopHandler{},
+		Execution: exec,
+		RunID:     2,
+	})
+	assert.NilError(t, err)
+
+	buf := new(bytes.Buffer)
+	writeRerunGraphTo(buf, exec)
+	expected := `graph reruns {
+  node [shape=box];
+  "pkg/one" [label="pkg/one\n2 reruns", color=red];
+  "pkg/three" [label="pkg/three\n1 rerun", color=orange];
+  "pkg/two" [label="pkg/two\n2 reruns", color=red];
+  "pkg/one" -- "pkg/two" [label=2, penwidth=2];
+}
+`
+	assert.Equal(t, buf.String(), expected)
+}
+
+func TestDotQuote(t *testing.T) {
+	assert.Equal(t, dotQuote("pkg/one\n2 reruns"), `"pkg/one\n2 reruns"`)
+	assert.Equal(t, dotQuote(`a "b" \c`+"\td"), `"a \"b\" \\c`+"\td\"")
+}
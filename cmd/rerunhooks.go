@@ -0,0 +1,35 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+
+	"gotest.tools/gotestsum/internal/log"
+)
+
+// runHook runs the shell command cmd for a rerun attempt. The attempt number,
+// starting at 1, is set as GOTESTSUM_ATTEMPT in the environment of the
+// command. Nothing is run when cmd is empty.
+func runHook(ctx context.Context, cmd string, attempt int) error {
+	if cmd == "" {
+		return nil
+	}
+	shell, flag := "sh", "-c"
+	if runtime.GOOS == "windows" {
+		shell, flag = "cmd", "/C"
+	}
+	log.Debugf("exec: %s %s %q (attempt %d)", shell, flag, cmd, attempt)
+
+	c := exec.CommandContext(ctx, shell, flag, cmd)
+	c.Env = append(os.Environ(), "GOTESTSUM_ATTEMPT="+strconv.Itoa(attempt))
+	out, err := c.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%v: %w\n%s", cmd, err, out)
+	}
+	log.Debugf("hook %q: %s", cmd, out)
+	return nil
+}
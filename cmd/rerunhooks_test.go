@@ -0,0 +1,104 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"runtime"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestRunHook(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test require sh")
+	}
+	assert.NilError(t, runHook(context.Background(), "", 1))
+
+	dir := fs.NewDir(t, t.Name())
+	cmd := `echo "attempt=$GOTESTSUM_ATTEMPT" > ` + dir.Join("out")
+	assert.NilError(t, runHook(context.Background(), cmd, 3))
+	raw, err := ioutil.ReadFile(dir.Join("out"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(raw), "attempt=3\n")
+
+	err = runHook(context.Background(), "echo broken; exit 2", 1)
+	assert.ErrorContains(t, err, "exit status 2")
+	assert.ErrorContains(t, err, "broken")
+}
+
+func TestRerunFailed_WithHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test require sh")
+	}
+	var calls int
+	fn := func(args []string) *proc {
+		calls++
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		// the first attempt is skipped because the before hook fails
+		rerunFailsBeforeHook: `test "$GOTESTSUM_ATTEMPT" != 1`,
+		rerunFailsAfterHook:  `echo "after $GOTESTSUM_ATTEMPT" >> ` + dir.Join("hooks"),
+		stdout:               new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	err := rerunFailed(context.Background(), opts, cfg, nil)
+	assert.Error(t, err, "failed")
+	assert.Equal(t, calls, 2)
+
+	raw, err := ioutil.ReadFile(dir.Join("hooks"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(raw), "after 2\n")
+}
+
+func TestRerunFailed_BeforeHookFailsEveryAttempt(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hook commands in this test require sh")
+	}
+	reset := patchStartGoTestFn(func(args []string) *proc {
+		t.Fatalf("unexpected rerun: %v", args)
+		return nil
+	})
+	defer reset()
+
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsBeforeHook:         "exit 1",
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	initialErr := newExitCode("initial run failed", 1)
+	err := rerunFailed(context.Background(), opts, cfg, initialErr)
+	assert.Equal(t, err, initialErr)
+
+	t.Run("without an initial error", func(t *testing.T) {
+		err := rerunFailed(context.Background(), opts, cfg, nil)
+		assert.Equal(t, ExitCodeWithDefault(err), 1)
+	})
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+)
+
+// rerunAttemptSummary is one line of the --rerun-fails-json-summary file.
+// There is a line for every completed rerun attempt, and for an attempt that
+// was aborted.
+type rerunAttemptSummary struct {
+	Attempt int `json:"attempt"`
+	// TestsRerun is the number of failed tests that were rerun by the attempt.
+	TestsRerun int `json:"tests_rerun"`
+	// TestsPassed and TestsFailed are the number of tests, including
+	// subtests, that passed or failed in the attempt.
+	TestsPassed int   `json:"tests_passed"`
+	TestsFailed int   `json:"tests_failed"`
+	ElapsedMS   int64 `json:"elapsed_ms"`
+	// Error is the reason the attempt was aborted, or empty when the attempt
+	// completed.
+	Error string `json:"error,omitempty"`
+}
+
+// writeRerunAttemptJSONSummary appends the summary of a rerun attempt to
+// opts.rerunFailsJSONSummary as soon as the attempt completes, or is aborted
+// by attemptErr. Any failure to write is logged as a warning, so that the
+// summary never changes the result of the test run.
+func writeRerunAttemptJSONSummary(
+	opts *options,
+	attempt int,
+	testsRerun int,
+	rec *failureRecorder,
+	elapsed time.Duration,
+	attemptErr error,
+) {
+	if opts.rerunFailsJSONSummary == "" {
+		return
+	}
+	summary := rerunAttemptSummary{
+		Attempt:     attempt,
+		TestsRerun:  testsRerun,
+		TestsPassed: rec.passed,
+		TestsFailed: rec.count(),
+		ElapsedMS:   int64(elapsed / time.Millisecond),
+	}
+	if attemptErr != nil {
+		summary.Error = attemptErr.Error()
+	}
+	if err := appendRerunAttemptSummary(opts.rerunFailsJSONSummary, summary); err != nil {
+		log.Warnf("failed to write --rerun-fails-json-summary file: %v", err)
+	}
+}
+
+func appendRerunAttemptSummary(path string, summary rerunAttemptSummary) error {
+	_ = os.MkdirAll(filepath.Dir(path), 0o755)
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if err := json.NewEncoder(fh).Encode(summary); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	return fh.Close()
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestRerunFailed_JSONSummary(t *testing.T) {
+	jsonFailed := `{"Package": "pkg", "Test": "TEST", "Action": "run"}
+{"Package": "pkg", "Test": "TEST", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`
+	jsonPassed := `{"Package": "pkg", "Test": "TEST", "Action": "run"}
+{"Package": "pkg", "Test": "TEST", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`
+	outputs := []string{jsonFailed, jsonFailed, jsonFailed, jsonPassed}
+
+	fn := func(args []string) *proc {
+		next := outputs[0]
+		outputs = outputs[1:]
+		var err error
+		if next == jsonFailed {
+			err = newExitCode("run-failed", 1)
+		}
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd:    fakeWaiter{result: err},
+			stdout: strings.NewReader(strings.Replace(next, "TEST", test, -1)),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsJSONSummary:        dir.Join("summary.json"),
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	err := rerunFailed(context.Background(), opts, cfg, nil)
+	assert.Error(t, err, "run-failed")
+
+	expected := []rerunAttemptSummary{
+		{Attempt: 1, TestsRerun: 2, TestsPassed: 0, TestsFailed: 2},
+		{Attempt: 2, TestsRerun: 2, TestsPassed: 1, TestsFailed: 1},
+	}
+	assert.DeepEqual(t, readRerunAttemptSummaries(t, opts.rerunFailsJSONSummary), expected)
+}
+
+func TestRerunFailed_JSONSummaryAbortedAttempt(t *testing.T) {
+	fn := func(args []string) *proc {
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("build-failed", 2)},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "fail"}
+{"Package": "pkg", "Action": "fail"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsJSONSummary:        dir.Join("summary.json"),
+		stdout:                       new(bytes.Buffer),
+	}
+	cfg := testjson.ScanConfig{
+		Execution: newExecutionWithTwoFailures(t),
+		Handler:   noopHandler{},
+	}
+	err := rerunFailed(context.Background(), opts, cfg, nil)
+	assert.Error(t, err, "unexpected go test exit code: build-failed")
+
+	expected := []rerunAttemptSummary{
+		{
+			Attempt:     1,
+			TestsRerun:  2,
+			TestsFailed: 1,
+			Error:       "unexpected go test exit code: build-failed",
+		},
+	}
+	assert.DeepEqual(t, readRerunAttemptSummaries(t, opts.rerunFailsJSONSummary), expected)
+}
+
+func readRerunAttemptSummaries(t *testing.T, path string) []rerunAttemptSummary {
+	t.Helper()
+	fh, err := os.Open(path)
+	assert.NilError(t, err)
+	defer fh.Close() // nolint: errcheck
+
+	var summaries []rerunAttemptSummary
+	scan := bufio.NewScanner(fh)
+	for scan.Scan() {
+		var summary rerunAttemptSummary
+		assert.NilError(t, json.Unmarshal(scan.Bytes(), &summary))
+		assert.Assert(t, summary.ElapsedMS >= 0)
+		summary.ElapsedMS = 0
+		summaries = append(summaries, summary)
+	}
+	assert.NilError(t, scan.Err())
+	return summaries
+}
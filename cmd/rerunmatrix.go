@@ -0,0 +1,222 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// matrixFlagSet is one entry of the --rerun-fails-matrix file. Each failed
+// test is run once with the go test flags from every flag set.
+type matrixFlagSet []matrixFlag
+
+type matrixFlag struct {
+	name  string
+	value interface{}
+}
+
+// String returns the flags of the set as they are passed to go test.
+func (s matrixFlagSet) String() string {
+	args := s.args()
+	if len(args) == 0 {
+		return "(no flags)"
+	}
+	return strings.Join(args, " ")
+}
+
+func (s matrixFlagSet) args() []string {
+	result := make([]string, 0, len(s))
+	for _, flag := range s {
+		switch v := flag.value.(type) {
+		case bool:
+			if v {
+				result = append(result, "-"+flag.name)
+				continue
+			}
+			result = append(result, fmt.Sprintf("-%s=%t", flag.name, v))
+		default:
+			result = append(result, fmt.Sprintf("-%s=%v", flag.name, v))
+		}
+	}
+	return result
+}
+
+// readRerunFailsMatrixJSON reads the flag sets from the --rerun-fails-matrix
+// file. The file is a JSON list of objects which map a go test flag to its
+// value. For example:
+//
+//	[{"-race": true}, {"-count": 3, "-cpu": "1,4"}]
+func readRerunFailsMatrixJSON(path string) ([]matrixFlagSet, error) {
+	if path == "" {
+		return nil, nil
+	}
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rerun fails matrix: %w", err)
+	}
+	var entries []map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&entries); err != nil {
+		return nil, fmt.Errorf("failed to parse rerun fails matrix %v, must be a JSON list of objects: %w", path, err)
+	}
+
+	matrix := make([]matrixFlagSet, 0, len(entries))
+	for i, entry := range entries {
+		var set matrixFlagSet
+		for name, value := range entry {
+			switch value.(type) {
+			case bool, string, json.Number:
+			default:
+				return nil, fmt.Errorf("rerun fails matrix %v: entry %d: value of %v must be a "+
+					"boolean, number, or string", path, i+1, name)
+			}
+			set = append(set, matrixFlag{name: strings.TrimLeft(name, "-"), value: value})
+		}
+		sort.Slice(set, func(i, j int) bool {
+			return set[i].name < set[j].name
+		})
+		matrix = append(matrix, set)
+	}
+	return matrix, nil
+}
+
+// matrixArgs returns the args with the flags from set, in place of any of the
+// same flags already in args.
+func matrixArgs(args []string, set matrixFlagSet) []string {
+	args = append([]string{}, args...)
+	for _, flag := range set {
+		if _, ok := flag.value.(bool); ok {
+			args = removeBoolArg(flag.name, args)
+			continue
+		}
+		start, end := argIndex(flag.name, args)
+		if start >= 0 && end < len(args) {
+			args = append(args[:start], args[end+1:]...)
+		}
+	}
+	return append(set.args(), args...)
+}
+
+// matrixResult is the result of running a test with a matrixFlagSet.
+type matrixResult struct {
+	tc     testjson.TestCase
+	passed int
+	total  int
+	// errors are the errors from go test, for example when the package
+	// failed to build with the flags of the set.
+	errors []string
+}
+
+// buildFailed returns true when the test did not run because go test failed
+// with an error.
+func (r matrixResult) buildFailed() bool {
+	return r.total == 0 && len(r.errors) > 0
+}
+
+func (r matrixResult) status() string {
+	switch {
+	case r.buildFailed():
+		return "BUILD ERROR"
+	case r.total > 0 && r.passed == r.total:
+		return "PASS"
+	case r.passed > 0:
+		return "FLAKY"
+	default:
+		return "FAIL"
+	}
+}
+
+// runRerunFailsMatrix runs each of the failed tests with every flag set from
+// the --rerun-fails-matrix, and prints the results of each flag set. The
+// results do not change the result of the test run, so any error is logged as
+// a warning.
+func runRerunFailsMatrix(ctx context.Context, opts *options, tcs []testjson.TestCase) {
+	if len(opts.rerunFailsMatrix) == 0 || len(tcs) == 0 || ctx.Err() != nil {
+		return
+	}
+	for _, set := range opts.rerunFailsMatrix {
+		var results []matrixResult
+		for _, tc := range tcs {
+			if tc.Test == "" {
+				continue
+			}
+			result, err := runMatrixTestCase(ctx, opts, set, tc)
+			if err != nil {
+				log.Warnf("failed to run %v with --rerun-fails-matrix flags %v: %v", tc.Test, set, err)
+				continue
+			}
+			results = append(results, result)
+		}
+		writeMatrixResults(opts.stdout, set, results)
+	}
+}
+
+func runMatrixTestCase(
+	ctx context.Context,
+	opts *options,
+	set matrixFlagSet,
+	tc testjson.TestCase,
+) (matrixResult, error) {
+	matrixOpts := *opts
+	matrixOpts.args = matrixArgs(opts.args, set)
+	rerun := rerunOpts{runFlag: goTestRunFlagForTestCase(tc.Test), pkg: tc.Package}
+
+	goTestProc, err := startRerunGoTest(ctx, opts, "", goTestCmdArgs(&matrixOpts, rerun))
+	if err != nil {
+		return matrixResult{}, err
+	}
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: goTestProc.stdout,
+		Stderr: goTestProc.stderr,
+	})
+	if err != nil {
+		return matrixResult{}, err
+	}
+	if err := goTestProc.cmd.Wait(); err != nil && !IsExitCoder(err) {
+		return matrixResult{}, err
+	}
+
+	result := matrixResult{tc: tc, errors: exec.Errors()}
+	if pkg := exec.Package(tc.Package); pkg != nil {
+		for _, run := range pkg.Passed {
+			if run.Test == tc.Test {
+				result.passed++
+				result.total++
+			}
+		}
+		for _, run := range pkg.Failed {
+			if run.Test == tc.Test {
+				result.total++
+			}
+		}
+	}
+	return result, nil
+}
+
+func writeMatrixResults(out io.Writer, set matrixFlagSet, results []matrixResult) {
+	fmt.Fprintf(out, "\n=== Rerun matrix: %v\n", set)
+	for _, result := range results {
+		name := testjson.RelativePackagePath(result.tc.Package) + "." + result.tc.Test.Name()
+		if result.buildFailed() {
+			fmt.Fprintf(out, "%s %s\n", result.status(), name)
+			for _, line := range result.errors {
+				fmt.Fprintf(out, "    %s\n", line)
+			}
+			continue
+		}
+		fmt.Fprintf(out, "%s %s (%d of %d runs passed)\n",
+			result.status(),
+			name,
+			result.passed,
+			result.total)
+	}
+}
@@ -0,0 +1,123 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestReadRerunFailsMatrix(t *testing.T) {
+	file := fs.NewFile(t, t.Name(), fs.WithContent(`[
+  {"-race": true},
+  {"count": 3, "-cpu": "1,4", "-short": false},
+  {}
+]`))
+	matrix, err := readRerunFailsMatrixJSON(file.Path())
+	assert.NilError(t, err)
+	assert.Equal(t, len(matrix), 3)
+	assert.Equal(t, matrix[0].String(), "-race")
+	assert.Equal(t, matrix[1].String(), "-count=3 -cpu=1,4 -short=false")
+	assert.Equal(t, matrix[2].String(), "(no flags)")
+
+	t.Run("invalid value", func(t *testing.T) {
+		file := fs.NewFile(t, t.Name(), fs.WithContent(`[{"-race": [true]}]`))
+		_, err := readRerunFailsMatrixJSON(file.Path())
+		assert.ErrorContains(t, err, "entry 1: value of -race must be a boolean, number, or string")
+	})
+
+	t.Run("not a list", func(t *testing.T) {
+		file := fs.NewFile(t, t.Name(), fs.WithContent("race: true\n"))
+		_, err := readRerunFailsMatrixJSON(file.Path())
+		assert.ErrorContains(t, err, "must be a JSON list of objects")
+	})
+}
+
+func TestMatrixArgs(t *testing.T) {
+	file := fs.NewFile(t, t.Name(), fs.WithContent(`[{"-race": true, "-count": 3}]`))
+	matrix, err := readRerunFailsMatrixJSON(file.Path())
+	assert.NilError(t, err)
+
+	args := []string{"-race", "-count", "1", "-tags=integration"}
+	assert.DeepEqual(t, matrixArgs(args, matrix[0]),
+		[]string{"-count=3", "-race", "-tags=integration"})
+	// args is not modified
+	assert.DeepEqual(t, args, []string{"-race", "-count", "1", "-tags=integration"})
+}
+
+func TestRunRerunFailsMatrix(t *testing.T) {
+	var calls [][]string
+	fn := func(args []string) *proc {
+		calls = append(calls, args)
+		action := "pass"
+		if strings.Join(args, " ") == "go test -json -test.run=^TestA$ -count=1 -race pkg" {
+			action = "fail"
+		}
+		return &proc{
+			cmd: fakeWaiter{},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "` + action + `"}
+{"Package": "pkg", "Action": "` + action + `"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	file := fs.NewFile(t, t.Name(), fs.WithContent(`[{"-race": true}, {"-count": 2}]`))
+	matrix, err := readRerunFailsMatrixJSON(file.Path())
+	assert.NilError(t, err)
+
+	out := new(bytes.Buffer)
+	opts := &options{rerunFailsMatrix: matrix, stdout: out}
+	tcs := []testjson.TestCase{{Package: "pkg"}, {Package: "pkg", Test: "TestA"}}
+	runRerunFailsMatrix(context.Background(), opts, tcs)
+
+	expectedCalls := [][]string{
+		{"go", "test", "-json", "-test.run=^TestA$", "-count=1", "-race", "pkg"},
+		{"go", "test", "-json", "-test.run=^TestA$", "-count=2", "pkg"},
+	}
+	assert.DeepEqual(t, calls, expectedCalls)
+	expected := `
+=== Rerun matrix: -race
+FAIL pkg.TestA (0 of 1 runs passed)
+
+=== Rerun matrix: -count=2
+PASS pkg.TestA (1 of 1 runs passed)
+`
+	assert.Equal(t, out.String(), expected)
+}
+
+func TestRunRerunFailsMatrix_BuildError(t *testing.T) {
+	fn := func(args []string) *proc {
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("build failed", 1)},
+			stdout: strings.NewReader(`{"Package": "pkg", "Action": "output", "Output": "FAIL\tpkg [build failed]\n"}
+{"Package": "pkg", "Action": "fail"}
+`),
+			stderr: strings.NewReader("go: -race requires cgo; enable cgo by setting CGO_ENABLED=1\n"),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	file := fs.NewFile(t, t.Name(), fs.WithContent(`[{"-race": true}]`))
+	matrix, err := readRerunFailsMatrixJSON(file.Path())
+	assert.NilError(t, err)
+
+	out := new(bytes.Buffer)
+	opts := &options{rerunFailsMatrix: matrix, stdout: out}
+	runRerunFailsMatrix(context.Background(), opts, []testjson.TestCase{{Package: "pkg", Test: "TestA"}})
+
+	expected := `
+=== Rerun matrix: -race
+BUILD ERROR pkg.TestA
+    go: -race requires cgo; enable cgo by setting CGO_ENABLED=1
+`
+	assert.Equal(t, out.String(), expected)
+}
@@ -0,0 +1,101 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+
+	"gotest.tools/gotestsum/testjson"
+)
+
+// rerunPackageSummary is the result of the reruns of the failed tests in a
+// package, printed by --rerun-fails-group-by-package.
+type rerunPackageSummary struct {
+	pkg string
+	// reruns is the number of rerun attempts that ran tests from the package.
+	reruns int
+	// failing are the tests that failed on their last run.
+	failing []testjson.TestName
+}
+
+// status is FLAKY when all the failed tests passed on a rerun, and FAIL when
+// any test was still failing after the last rerun.
+func (s rerunPackageSummary) status() string {
+	if len(s.failing) == 0 && s.reruns > 0 {
+		return "FLAKY"
+	}
+	return "FAIL"
+}
+
+// newRerunPackageSummaries returns a summary for each package with a failed
+// test, sorted by package name.
+func newRerunPackageSummaries(exec *testjson.Execution) []rerunPackageSummary {
+	var result []rerunPackageSummary
+	for _, name := range exec.Packages() {
+		pkg := exec.Package(name)
+		if len(pkg.Failed) == 0 {
+			continue
+		}
+
+		summary := rerunPackageSummary{pkg: name}
+		// lastRun maps the name of a test to its most recent run.
+		lastRun := make(map[testjson.TestName]testjson.TestCase)
+		var order []testjson.TestName
+		record := func(tc testjson.TestCase) {
+			if tc.RunID > summary.reruns {
+				summary.reruns = tc.RunID
+			}
+			last, ok := lastRun[tc.Test]
+			if !ok {
+				order = append(order, tc.Test)
+			}
+			if !ok || tc.RunID >= last.RunID {
+				lastRun[tc.Test] = tc
+			}
+		}
+		failed := make(map[int]bool)
+		for _, tc := range pkg.Failed {
+			failed[tc.ID] = true
+			record(tc)
+		}
+		for _, tc := range pkg.Passed {
+			if _, ok := lastRun[tc.Test]; ok {
+				record(tc)
+			}
+		}
+		for _, test := range order {
+			if failed[lastRun[test].ID] {
+				summary.failing = append(summary.failing, test)
+			}
+		}
+		result = append(result, summary)
+	}
+	return result
+}
+
+// writeRerunPackageSummary prints a block for each package with failed tests
+// after all the rerun attempts complete, in place of the summary printed
+// before each attempt.
+func writeRerunPackageSummary(opts *options, exec *testjson.Execution) {
+	if !opts.rerunFailsGroupByPackage {
+		return
+	}
+	writeRerunPackageSummaries(opts.stdout, newRerunPackageSummaries(exec))
+}
+
+func writeRerunPackageSummaries(out io.Writer, summaries []rerunPackageSummary) {
+	if len(summaries) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "\n=== Reruns by package")
+	for _, summary := range summaries {
+		reruns := "reruns"
+		if summary.reruns == 1 {
+			reruns = "rerun"
+		}
+		fmt.Fprintf(out, "%-5s %s (%d %s)\n",
+			summary.status(), testjson.RelativePackagePath(summary.pkg), summary.reruns, reruns)
+		for _, test := range summary.failing {
+			fmt.Fprintf(out, "    %s\n", test)
+		}
+	}
+}
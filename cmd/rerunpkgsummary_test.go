@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestRun_RerunFails_GroupByPackage(t *testing.T) {
+	var calls int
+	fn := func(args []string) *proc {
+		calls++
+		if calls == 1 {
+			return &proc{
+				cmd: fakeWaiter{result: newExitCode("failed", 1)},
+				stdout: strings.NewReader(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg/one", "Test": "TestB", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestB", "Action": "fail"}
+{"Package": "pkg/one", "Action": "fail"}
+{"Package": "pkg/two", "Test": "TestC", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestC", "Action": "fail"}
+{"Package": "pkg/two", "Action": "fail"}
+{"Package": "pkg/three", "Test": "TestD", "Action": "run"}
+{"Package": "pkg/three", "Test": "TestD", "Action": "pass"}
+{"Package": "pkg/three", "Action": "pass"}
+`),
+				stderr: bytes.NewReader(nil),
+			}
+		}
+
+		pkg, test, action := "pkg/one", "TestA", "pass"
+		joined := strings.Join(args, " ")
+		switch {
+		case strings.Contains(joined, "TestB"):
+			test, action = "TestB", "fail"
+		case strings.Contains(joined, "TestC"):
+			pkg, test = "pkg/two", "TestC"
+		}
+		var result error
+		if action == "fail" {
+			result = newExitCode("failed", 1)
+		}
+		return &proc{
+			cmd: fakeWaiter{result: result},
+			stdout: strings.NewReader(`{"Package": "` + pkg + `", "Test": "` + test + `", "Action": "run"}
+{"Package": "` + pkg + `", "Test": "` + test + `", "Action": "` + action + `"}
+{"Package": "` + pkg + `", "Action": "` + action + `"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		format:                       "testname",
+		rerunFailsMaxAttempts:        2,
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsGroupByPackage:     true,
+		stdout:                       out,
+		stderr:                       new(bytes.Buffer),
+		hideSummary:                  newHideSummaryValue(),
+	}
+	err := run(opts)
+	assert.Error(t, err, "failed")
+
+	expected := `
+=== Reruns by package
+FAIL  pkg/one (2 reruns)
+    TestB
+FLAKY pkg/two (1 rerun)
+`
+	assert.Assert(t, cmp.Contains(out.String(), expected))
+	// the summary before each rerun attempt is not printed
+	assert.Equal(t, strings.Count(out.String(), " tests, "), 1, out.String())
+}
@@ -0,0 +1,150 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// rerunRecord is one line of the --rerun-fails-record-to file. There is a
+// record for every run of a tracked test. A test is tracked once it has
+// failed, so that the passing runs of a flaky test are recorded as well as the
+// failures. The file is read by 'gotestsum tool flakiness-report'.
+type rerunRecord struct {
+	Timestamp time.Time `json:"timestamp"`
+	Commit    string    `json:"commit"`
+	Test      string    `json:"test"`
+	Package   string    `json:"package"`
+	// Attempt is 0 for the first run, and the number of the rerun attempt
+	// for a rerun.
+	Attempt int  `json:"attempt"`
+	Passed  bool `json:"passed"`
+}
+
+// writeRerunRecords appends a record for every run of the tracked tests to
+// opts.rerunFailsRecordTo, so that the file accumulates the results of many
+// runs. The tracked tests are the tests that failed in this run, and the
+// tests already in the file. Any failure to write is logged as a warning, so
+// that the record never changes the result of the test run.
+func writeRerunRecords(opts *options, exec *testjson.Execution) {
+	if opts.rerunFailsRecordTo == "" {
+		return
+	}
+	tracked, err := readTrackedTests(opts.rerunFailsRecordTo)
+	if err != nil {
+		log.Warnf("failed to read --rerun-fails-record-to file: %v", err)
+	}
+	records := newRerunRecords(exec, tracked, timeNow().UTC(), gitCommit(context.Background()))
+	if len(records) == 0 {
+		return
+	}
+	if err := appendRerunRecords(opts.rerunFailsRecordTo, records); err != nil {
+		log.Warnf("failed to write --rerun-fails-record-to file: %v", err)
+	}
+}
+
+// timeNow is a shim for testing
+var timeNow = time.Now
+
+func trackedTestKey(pkg string, test string) string {
+	return pkg + "." + test
+}
+
+// readTrackedTests returns the set of the tests in the records file at path.
+// A file that does not exist has no tracked tests.
+func readTrackedTests(path string) (map[string]bool, error) {
+	tracked := make(map[string]bool)
+	fh, err := os.Open(path)
+	switch {
+	case os.IsNotExist(err):
+		return tracked, nil
+	case err != nil:
+		return tracked, err
+	}
+	defer fh.Close() // nolint:errcheck
+
+	dec := json.NewDecoder(fh)
+	for {
+		var record rerunRecord
+		switch err := dec.Decode(&record); {
+		case err == io.EOF:
+			return tracked, nil
+		case err != nil:
+			return tracked, err
+		}
+		tracked[trackedTestKey(record.Package, record.Test)] = true
+	}
+}
+
+func newRerunRecords(
+	exec *testjson.Execution,
+	tracked map[string]bool,
+	now time.Time,
+	commit string,
+) []rerunRecord {
+	tests := make(map[string]bool, len(tracked))
+	for key := range tracked {
+		tests[key] = true
+	}
+	for _, failure := range exec.Failed() {
+		if failure.Test != "" {
+			tests[trackedTestKey(failure.Package, failure.Test.Name())] = true
+		}
+	}
+
+	var records []rerunRecord
+	add := func(tcs []testjson.TestCase, passed bool) {
+		for _, tc := range tcs {
+			if tc.Test == "" || !tests[trackedTestKey(tc.Package, tc.Test.Name())] {
+				continue
+			}
+			records = append(records, rerunRecord{
+				Timestamp: now,
+				Commit:    commit,
+				Test:      tc.Test.Name(),
+				Package:   tc.Package,
+				Attempt:   tc.RunID,
+				Passed:    passed,
+			})
+		}
+	}
+	for _, name := range exec.Packages() {
+		pkg := exec.Package(name)
+		add(pkg.Failed, false)
+		add(pkg.Passed, true)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.Package != b.Package {
+			return a.Package < b.Package
+		}
+		if a.Test != b.Test {
+			return a.Test < b.Test
+		}
+		return a.Attempt < b.Attempt
+	})
+	return records
+}
+
+func appendRerunRecords(path string, records []rerunRecord) error {
+	_ = os.MkdirAll(filepath.Dir(path), 0o755)
+	fh, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(fh)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			_ = fh.Close()
+			return err
+		}
+	}
+	return fh.Close()
+}
@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteRerunRecords(t *testing.T) {
+	t.Setenv("GITHUB_SHA", "abc123")
+	defer func(orig func() time.Time) {
+		timeNow = orig
+	}(timeNow)
+	timeNow = func() time.Time {
+		return time.Date(2024, 4, 1, 10, 0, 0, 0, time.UTC)
+	}
+
+	out := `{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "fail"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "run"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "pass"}
+{"Package": "pkg", "Action": "fail"}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+	_, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		RunID:     1,
+		Execution: exec,
+		Stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+
+	path := filepath.Join(t.TempDir(), "records", "flakiness.jsonl")
+	opts := &options{rerunFailsMaxAttempts: 2, rerunFailsRecordTo: path}
+	writeRerunRecords(opts, exec)
+	// the file is appended to by every run
+	writeRerunRecords(opts, exec)
+
+	// a run where the tracked test passes is recorded as well
+	exec, err = testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "pass"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "run"}
+{"Package": "pkg", "Test": "TestTwo", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+	writeRerunRecords(opts, exec)
+
+	raw, err := ioutil.ReadFile(path)
+	assert.NilError(t, err)
+	line1 := `{"timestamp":"2024-04-01T10:00:00Z","commit":"abc123","test":"TestOne","package":"pkg","attempt":0,"passed":false}`
+	line2 := `{"timestamp":"2024-04-01T10:00:00Z","commit":"abc123","test":"TestOne","package":"pkg","attempt":1,"passed":true}`
+	line3 := `{"timestamp":"2024-04-01T10:00:00Z","commit":"abc123","test":"TestOne","package":"pkg","attempt":0,"passed":true}`
+	assert.Equal(t, string(raw), strings.Join([]string{line1, line2, line1, line2, line3}, "\n")+"\n")
+}
@@ -0,0 +1,257 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// streamingReruns starts the first rerun of failed tests as soon as the
+// package with the failures completes, while the first run continues with
+// other packages.
+//
+// The output of the reruns is buffered, and only scanned after the first run
+// completes. Scanning the output in the same order as a regular rerun ensures
+// that every test is counted once, with the same RunID that would have been
+// used without streaming.
+type streamingReruns struct {
+	testjson.EventHandler
+	ctx    context.Context
+	cancel context.CancelFunc
+	opts   *options
+	cov    *rerunCoverage
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	results []*streamedRerun
+	queued  int
+	// started is the time the first rerun was queued.
+	started time.Time
+	// packages that had reruns started.
+	packages map[string]bool
+	// serial is held while the failures of a package are rerun when
+	// --rerun-fails-serial-packages is set.
+	serial sync.Mutex
+}
+
+type streamedRerun struct {
+	tc     testjson.TestCase
+	rerun  rerunOpts
+	stdout bytes.Buffer
+	stderr bytes.Buffer
+	err    error
+	// done is closed when the rerun has completed.
+	done chan struct{}
+}
+
+func newStreamingReruns(ctx context.Context, opts *options, handler testjson.EventHandler) *streamingReruns {
+	ctx, cancel := context.WithCancel(ctx)
+	return &streamingReruns{
+		EventHandler: handler,
+		ctx:          ctx,
+		cancel:       cancel,
+		opts:         opts,
+		cov:          newRerunCoverage(opts),
+		packages:     make(map[string]bool),
+	}
+}
+
+// Event starts reruns for the failures in a package when the package ends.
+func (s *streamingReruns) Event(event testjson.TestEvent, exec *testjson.Execution) error {
+	if event.PackageEvent() && event.Action == testjson.ActionFail {
+		s.queue(exec, event.Package)
+	}
+	return s.EventHandler.Event(event, exec)
+}
+
+func (s *streamingReruns) queue(exec *testjson.Execution, pkgName string) {
+	pkg := exec.Package(pkgName)
+	var failed []testjson.TestCase
+	if pkg.TestMainFailed() {
+		failed = append(failed, testjson.TestCase{Package: pkgName})
+	}
+	failed = append(failed, pkg.Failed...)
+	tcs := rerunFailsFilter(s.opts, exec)(failed)
+
+	// Do not start reruns which would be discarded because the run has too
+	// many failures.
+	s.queued += len(tcs)
+	if s.queued > s.opts.rerunFailsMaxInitialFailures {
+		return
+	}
+	s.packages[pkgName] = true
+	if s.started.IsZero() {
+		s.started = time.Now()
+	}
+
+	var results []*streamedRerun
+	for _, tc := range tcs {
+		result := &streamedRerun{
+			tc:    tc,
+			rerun: newRerunOptsFromTestCase(s.opts, tc, exec, 1),
+			done:  make(chan struct{}),
+		}
+		if result.err = s.cov.prepare(&result.rerun); result.err != nil {
+			close(result.done)
+		}
+		results = append(results, result)
+	}
+	s.mu.Lock()
+	s.results = append(s.results, results...)
+	s.mu.Unlock()
+
+	// Reruns for a package are run one at a time, the same as without
+	// streaming, but reruns for different packages run concurrently, unless
+	// --rerun-fails-serial-packages is set.
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		if s.opts.rerunFailsSerialPackages {
+			s.serial.Lock()
+			defer s.serial.Unlock()
+		}
+		for _, result := range results {
+			if result.err == nil {
+				s.run(result)
+			}
+		}
+	}()
+}
+
+func (s *streamingReruns) run(result *streamedRerun) {
+	defer close(result.done)
+	goTestProc, err := startRerunGoTest(s.ctx, s.opts, "", goTestCmdArgs(s.opts, result.rerun))
+	if err != nil {
+		s.cov.discard(result.rerun)
+		result.rerun.coverprofile = ""
+		result.err = err
+		return
+	}
+
+	var group errgroup.Group
+	group.Go(func() error {
+		_, err := io.Copy(&result.stdout, goTestProc.stdout)
+		return err
+	})
+	group.Go(func() error {
+		_, err := io.Copy(&result.stderr, goTestProc.stderr)
+		return err
+	})
+	if err := group.Wait(); err != nil {
+		result.err = err
+	}
+	if err := goTestProc.cmd.Wait(); err != nil && result.err == nil {
+		result.err = err
+	}
+}
+
+// stop any reruns that are still running, and wait for them to exit. The
+// coverprofiles of reruns which were not collected by finish, because the run
+// was aborted, are removed.
+func (s *streamingReruns) stop() {
+	s.cancel()
+	s.wg.Wait()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, result := range s.results {
+		s.cov.discard(result.rerun)
+		result.rerun.coverprofile = ""
+	}
+}
+
+// finish scans the output of the streamed reruns as the first rerun attempt,
+// and then continues with the remaining attempts.
+func (s *streamingReruns) finish(ctx context.Context, scanConfig testjson.ScanConfig) error {
+	s.wg.Wait()
+	s.mu.Lock()
+	results := s.results
+	s.mu.Unlock()
+
+	// Failures may be missing a package end event if the test binary exited
+	// early. Those are rerun now, the same way as without streaming.
+	var remaining []testjson.TestCase
+	for _, tc := range rerunFailsFilter(s.opts, scanConfig.Execution)(scanConfig.Execution.Failed()) {
+		if !s.packages[tc.Package] {
+			remaining = append(remaining, tc)
+		}
+	}
+	if len(results)+len(remaining) == 0 {
+		return nil
+	}
+
+	writeRerunAttemptSummary(s.opts, scanConfig.Execution)
+
+	s.opts.flakiness = newFlakinessTracker()
+	rec := newFailureRecorder(scanConfig.Handler, s.opts.flakiness)
+	restoreFormatter := useRerunFormatter(scanConfig.Handler)
+	defer restoreFormatter()
+	err := s.rerunFirstAttempt(ctx, scanConfig, results, remaining, rec)
+	if s.started.IsZero() {
+		s.started = time.Now()
+	}
+	writeRerunAttemptJSONSummary(s.opts, 1, len(results)+len(remaining), rec, time.Since(s.started), err)
+	if err != nil {
+		return err
+	}
+	return rerunFailedFrom(ctx, s.opts, scanConfig, rec, 1, s.cov)
+}
+
+// rerunFirstAttempt scans the output of the reruns started while the first
+// run was still running, and reruns the remaining failures.
+func (s *streamingReruns) rerunFirstAttempt(
+	ctx context.Context,
+	scanConfig testjson.ScanConfig,
+	results []*streamedRerun,
+	remaining []testjson.TestCase,
+	rec *failureRecorder,
+) error {
+	for i, result := range results {
+		s.opts.flakiness.queued(result.tc)
+		if err := writeRerunHeader(s.opts, result.tc, 1, i+1); err != nil {
+			return err
+		}
+		<-result.done
+		exitErr := result.err
+		if exitErr != nil && !IsExitCoder(exitErr) {
+			return &RerunError{Kind: ErrKindRerunFailed, Underlying: exitErr}
+		}
+
+		cfg := testjson.ScanConfig{
+			RunID:     1,
+			Stdout:    &result.stdout,
+			Stderr:    &result.stderr,
+			Handler:   rec,
+			Execution: scanConfig.Execution,
+		}
+		if _, err := testjson.ScanTestOutput(cfg); err != nil {
+			return &RerunError{Kind: ErrKindRerunFailed, Underlying: err}
+		}
+		if exitErr != nil {
+			rec.lastErr = exitErr
+		}
+		s.cov.collect(result.rerun)
+		result.rerun.coverprofile = ""
+		if err := verifyRerun(s.opts, scanConfig.Execution, result.tc, result.rerun.runFlag, 1, rec); err != nil {
+			return err
+		}
+		if err := hasErrors(exitErr, scanConfig.Execution, s.opts, result.tc.Package); err != nil {
+			return err
+		}
+	}
+	for i, tc := range remaining {
+		s.opts.flakiness.queued(tc)
+		if err := writeRerunHeader(s.opts, tc, 1, len(results)+i+1); err != nil {
+			return err
+		}
+		if err := rerunTestCase(ctx, s.opts, scanConfig.Execution, tc, 1, rec, s.cov); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,214 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestRun_RerunFails_Streaming(t *testing.T) {
+	firstRun, writeFirstRun := io.Pipe()
+	chRerunStarted := make(chan []string, 1)
+
+	var mu sync.Mutex
+	var calls int
+	fn := func(args []string) *proc {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			return &proc{
+				cmd:    fakeWaiter{result: newExitCode("failed", 1)},
+				stdout: firstRun,
+				stderr: bytes.NewReader(nil),
+			}
+		}
+		chRerunStarted <- args
+		return &proc{
+			cmd: fakeWaiter{},
+			stdout: strings.NewReader(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "pass"}
+{"Package": "pkg/one", "Action": "pass"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	go func() {
+		_, err := writeFirstRun.Write([]byte(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg/one", "Action": "fail"}
+`))
+		assert.Check(t, err)
+
+		// the rerun starts before the first run has completed
+		args := <-chRerunStarted
+		assert.Check(t, cmp.Contains(args, "-test.run=^TestA$"))
+
+		_, err = writeFirstRun.Write([]byte(`{"Package": "pkg/two", "Test": "TestB", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "pass"}
+{"Package": "pkg/two", "Action": "pass"}
+`))
+		assert.Check(t, err)
+		assert.Check(t, writeFirstRun.Close())
+	}()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		format:                       "testname",
+		rerunFailsMaxAttempts:        2,
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsStreaming:          true,
+		stdout:                       out,
+		stderr:                       os.Stderr,
+		hideSummary:                  newHideSummaryValue(),
+	}
+	assert.NilError(t, run(opts))
+	assert.Equal(t, calls, 2)
+	assert.Assert(t, cmp.Contains(out.String(), "DONE 2 runs, 3 tests, 1 failure"))
+}
+
+func TestRun_RerunFails_StreamingSerialPackages(t *testing.T) {
+	var mu sync.Mutex
+	var calls, running, maxRunning int
+	fn := func(args []string) *proc {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			return &proc{
+				cmd: fakeWaiter{result: newExitCode("failed", 1)},
+				stdout: strings.NewReader(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg/one", "Action": "fail"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "fail"}
+{"Package": "pkg/two", "Action": "fail"}
+`),
+				stderr: bytes.NewReader(nil),
+			}
+		}
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		pkg, test := "pkg/one", "TestA"
+		if strings.Contains(strings.Join(args, " "), "TestB") {
+			pkg, test = "pkg/two", "TestB"
+		}
+		stdout := fmt.Sprintf(`{"Package": %[1]q, "Test": %[2]q, "Action": "run"}
+{"Package": %[1]q, "Test": %[2]q, "Action": "pass"}
+{"Package": %[1]q, "Action": "pass"}
+`, pkg, test)
+		return &proc{
+			cmd: fakeWaiter{},
+			stdout: &slowReader{Reader: strings.NewReader(stdout), done: func() {
+				mu.Lock()
+				defer mu.Unlock()
+				running--
+			}},
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		format:                       "testname",
+		rerunFailsMaxAttempts:        2,
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsStreaming:          true,
+		rerunFailsSerialPackages:     true,
+		stdout:                       out,
+		stderr:                       os.Stderr,
+		hideSummary:                  newHideSummaryValue(),
+	}
+	assert.NilError(t, run(opts))
+	assert.Equal(t, calls, 3)
+	assert.Equal(t, maxRunning, 1)
+	assert.Assert(t, cmp.Contains(out.String(), "DONE 2 runs, 4 tests, 2 failures"))
+}
+
+// slowReader delays the end of the output, so that concurrent reruns would
+// overlap, and calls done when the output has been read.
+type slowReader struct {
+	io.Reader
+	done func()
+}
+
+func (r *slowReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	if err == io.EOF {
+		time.Sleep(20 * time.Millisecond)
+		r.done()
+	}
+	return n, err
+}
+
+func TestRun_RerunFails_StreamingAbortRemovesCoverprofiles(t *testing.T) {
+	var mu sync.Mutex
+	var calls int
+	var coverprofiles []string
+	fn := func(args []string) *proc {
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			return &proc{
+				cmd: fakeWaiter{result: newExitCode("failed", 1)},
+				stdout: strings.NewReader(`{"Package": "pkg/one", "Test": "TestA", "Action": "run"}
+{"Package": "pkg/one", "Test": "TestA", "Action": "fail"}
+{"Package": "pkg/one", "Action": "fail"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestB", "Action": "fail"}
+{"Package": "pkg/two", "Test": "TestC", "Action": "run"}
+{"Package": "pkg/two", "Test": "TestC", "Action": "fail"}
+{"Package": "pkg/two", "Action": "fail"}
+`),
+				stderr: bytes.NewReader(nil),
+			}
+		}
+		for _, arg := range args {
+			if strings.HasPrefix(arg, "-coverprofile=") {
+				coverprofiles = append(coverprofiles, strings.TrimPrefix(arg, "-coverprofile="))
+			}
+		}
+		return &proc{
+			cmd:    fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(""),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	opts := &options{
+		args:                         []string{"-coverprofile=c.out"},
+		packages:                     []string{"./..."},
+		format:                       "testname",
+		rerunFailsMaxAttempts:        2,
+		rerunFailsMaxInitialFailures: 1,
+		rerunFailsStreaming:          true,
+		stdout:                       new(bytes.Buffer),
+		stderr:                       new(bytes.Buffer),
+		hideSummary:                  newHideSummaryValue(),
+	}
+	err := run(opts)
+	assert.ErrorContains(t, err, "exceeds maximum (1) set by --rerun-fails-max-failures")
+
+	// the rerun of pkg/one started before the run was aborted
+	assert.Equal(t, len(coverprofiles), 1)
+	_, err = os.Stat(coverprofiles[0])
+	assert.Assert(t, os.IsNotExist(err), "coverprofile %v was not removed", coverprofiles[0])
+}
@@ -0,0 +1,92 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// rerunFailsUpload is the JSON body sent to the URL set by
+// --rerun-fails-upload.
+type rerunFailsUpload struct {
+	Commit     string            `json:"commit"`
+	Repository string            `json:"repository"`
+	Tests      []rerunTestCounts `json:"tests"`
+}
+
+// uploadRerunFailsReport sends the counts of all the tests that were rerun to
+// opts.rerunFailsUploadURL. Any failure to upload is logged as a warning, so
+// that the upload never changes the result of the test run.
+func uploadRerunFailsReport(opts *options, exec *testjson.Execution) {
+	if opts.rerunFailsMaxAttempts == 0 || opts.rerunFailsUploadURL == "" {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.rerunFailsUploadTimeout)
+	defer cancel()
+
+	body := rerunFailsUpload{
+		Commit:     gitCommit(ctx),
+		Repository: os.Getenv("GITHUB_REPOSITORY"),
+		Tests:      rerunFailsCounts(exec, opts.rerunFailsFlakinessThreshold, opts.flakiness),
+	}
+	if err := postJSON(ctx, opts.rerunFailsUploadURL, nil, body); err != nil {
+		log.Warnf("failed to upload rerun-fails report: %v", err)
+	}
+}
+
+func postJSON(ctx context.Context, url string, headers map[string]string, body interface{}) error {
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	return post(ctx, url, "application/json", headers, raw)
+}
+
+func post(ctx context.Context, url string, contentType string, headers map[string]string, body []byte) error {
+	req, err := http.NewRequest(http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close() // nolint: errcheck
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("unexpected response %v: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// gitCommit returns the SHA of the commit being tested, from $GITHUB_SHA or
+// from git.
+func gitCommit(ctx context.Context) string {
+	if sha := os.Getenv("GITHUB_SHA"); sha != "" {
+		return sha
+	}
+	log.Debugf("exec: git rev-parse HEAD")
+	out, err := exec.CommandContext(ctx, "git", "rev-parse", "HEAD").Output()
+	if err != nil {
+		log.Debugf("failed to lookup git commit: %v", err)
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/env"
+	"gotest.tools/v3/golden"
+)
+
+func TestUploadRerunFailsReport(t *testing.T) {
+	env.Patch(t, "GITHUB_SHA", "abcd1234")
+	env.Patch(t, "GITHUB_REPOSITORY", "example/repo")
+
+	var received rerunFailsUpload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Check(t, r.Method == http.MethodPost)
+		assert.Check(t, r.Header.Get("Content-Type") == "application/json")
+		assert.Check(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	exec := scanRerunOutput(t, golden.Get(t, "go-test-json-flaky-rerun.out"))
+
+	opts := &options{
+		rerunFailsMaxAttempts:   4,
+		rerunFailsUploadURL:     server.URL,
+		rerunFailsUploadTimeout: time.Second,
+	}
+	uploadRerunFailsReport(opts, exec)
+
+	assert.Equal(t, received.Commit, "abcd1234")
+	assert.Equal(t, received.Repository, "example/repo")
+	assert.DeepEqual(t, received.Tests, rerunFailsCounts(exec, 0, nil))
+	assert.Assert(t, len(received.Tests) > 0)
+}
+
+func TestPostJSON_ErrorResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "nope", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := postJSON(context.Background(), server.URL, nil, map[string]string{})
+	assert.ErrorContains(t, err, "unexpected response 403 Forbidden: nope")
+}
@@ -0,0 +1,81 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+)
+
+// runTimeoutError is returned when the test run was stopped because it
+// exceeded --timeout.
+type runTimeoutError struct {
+	timeout time.Duration
+}
+
+func (e runTimeoutError) Error() string {
+	return fmt.Sprintf("the test run was stopped because it exceeded --timeout=%v", e.timeout)
+}
+
+func isRunTimeout(err error) bool {
+	var timeoutErr runTimeoutError
+	return errors.As(err, &timeoutErr)
+}
+
+// withRunTimeout returns a context which is cancelled when the run exceeds
+// --timeout. Cancelling the context stops 'go test', see terminateOnCancel.
+func withRunTimeout(ctx context.Context, opts *options) (context.Context, context.CancelFunc) {
+	if opts.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, opts.timeout)
+}
+
+// runTimeoutErr returns a runTimeoutError when ctx exceeded --timeout,
+// otherwise it returns err.
+func runTimeoutErr(ctx context.Context, opts *options, err error) error {
+	if opts.timeout > 0 && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return runTimeoutError{timeout: opts.timeout}
+	}
+	return err
+}
+
+// closeOutputOnTimeout closes the stdout and stderr of p when they are still
+// open some time after ctx exceeded --timeout and the 'go test' process group
+// was stopped. The output stays open when it was inherited by a process
+// outside of the process group, and reading it would otherwise never end.
+// The returned function must be called once the output has been read.
+func closeOutputOnTimeout(ctx context.Context, opts *options, p *proc) func() {
+	done := make(chan struct{})
+	// wait for terminateOnCancel to kill the process group
+	wait := 2 * interruptGracePeriod
+	go func() {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+		}
+		if runTimeoutErr(ctx, opts, nil) == nil {
+			return
+		}
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-done:
+		case <-timer.C:
+			log.Warnf("the output of 'go test' is still open after --timeout=%v, closing it",
+				opts.timeout)
+			for _, out := range []io.Reader{p.stdout, p.stderr} {
+				if closer, ok := out.(io.Closer); ok {
+					_ = closer.Close()
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}
+}
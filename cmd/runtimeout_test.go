@@ -0,0 +1,72 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestRun_Timeout(t *testing.T) {
+	orig := interruptGracePeriod
+	interruptGracePeriod = 10 * time.Millisecond
+	t.Cleanup(func() { interruptGracePeriod = orig })
+
+	// the output is never closed, like when it is inherited by a process
+	// which does not exit
+	stdout, stdoutWriter := io.Pipe()
+	t.Cleanup(func() { _ = stdoutWriter.Close() })
+	go func() {
+		_, _ = io.WriteString(stdoutWriter, `{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "run"}
+{"Package": "pkg", "Test": "TestOne", "Action": "pass"}
+{"Package": "pkg", "Test": "TestHang", "Action": "run"}
+`)
+	}()
+
+	reset := patchStartGoTestFn(func(args []string) *proc {
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: stdout,
+			stderr: strings.NewReader(""),
+		}
+	})
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		args:             []string{"./..."},
+		format:           "testname",
+		timeout:          50 * time.Millisecond,
+		reportIncomplete: true,
+		stdout:           out,
+		stderr:           os.Stderr,
+		hideSummary:      newHideSummaryValue(),
+	}
+	err := run(opts)
+	assert.Assert(t, isRunTimeout(err), "expected a timeout error, got %v", err)
+	assert.Error(t, err, "the test run was stopped because it exceeded --timeout=50ms")
+	assert.Assert(t, strings.Contains(out.String(),
+		"=== Run stopped by gotestsum --timeout=50ms, the results are incomplete"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "PASS pkg.TestOne"), out.String())
+	assert.Assert(t, strings.Contains(out.String(), "TestHang"), out.String())
+}
+
+func TestRunTimeoutErr(t *testing.T) {
+	opts := &options{timeout: time.Millisecond}
+	ctx, cancel := withRunTimeout(context.Background(), opts)
+	defer cancel()
+	assert.NilError(t, runTimeoutErr(ctx, opts, nil))
+
+	<-ctx.Done()
+	assert.Assert(t, isRunTimeout(runTimeoutErr(ctx, opts, io.EOF)))
+
+	ctx, cancel = withRunTimeout(context.Background(), &options{})
+	cancel()
+	assert.Equal(t, runTimeoutErr(ctx, &options{}, io.EOF), io.EOF)
+}
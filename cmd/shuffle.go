@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+
+	"github.com/fatih/color"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// runShuffleIterations runs the tests opts.shuffleIterations times, each time
+// with -shuffle=on so that the order of tests is different for each run. The
+// seeds used by any failed tests are printed after all the runs complete.
+func runShuffleIterations(ctx context.Context, opts *options) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	handler, err := newEventHandler(opts)
+	if err != nil {
+		return err
+	}
+	defer handler.Close() // nolint: errcheck
+
+	var exec *testjson.Execution
+	var lastErr error
+	failures := newShuffleFailures()
+	for i := 0; i < opts.shuffleIterations; i++ {
+		goTestProc, err := startGoTestFn(ctx, "", nil, goTestCmdArgs(opts, rerunOpts{shuffle: "on"}))
+		if err != nil {
+			return err
+		}
+		outputRead := closeOutputOnTimeout(ctx, opts, goTestProc)
+
+		cfg := testjson.ScanConfig{
+			RunID:                    i,
+			Stdout:                   goTestProc.stdout,
+			Stderr:                   goTestProc.stderr,
+			Handler:                  handler,
+			Execution:                exec,
+			Stop:                     cancel,
+			IgnoreNonJSONOutputLines: opts.ignoreNonJSONOutputLines,
+		}
+		exec, err = testjson.ScanTestOutput(cfg)
+		outputRead()
+		handler.Flush()
+		if err != nil {
+			return finishRun(opts, exec, runTimeoutErr(ctx, opts, err))
+		}
+
+		exitErr := goTestProc.cmd.Wait()
+		if err := runTimeoutErr(ctx, opts, nil); err != nil {
+			return finishRun(opts, exec, err)
+		}
+		if signum := atomic.LoadInt32(&goTestProc.signal); signum != 0 {
+			return finishRun(opts, exec, interruptedError(signum))
+		}
+		if exitErr != nil {
+			lastErr = exitErr
+		}
+		failures.record(exec, i)
+	}
+
+	failures.write(opts.stdout)
+	return finishRun(opts, exec, lastErr)
+}
+
+// shuffleFailures records the shuffle seeds that were used when each test
+// failed.
+type shuffleFailures struct {
+	names []string
+	seeds map[string][]string
+}
+
+func newShuffleFailures() *shuffleFailures {
+	return &shuffleFailures{seeds: make(map[string][]string)}
+}
+
+func (f *shuffleFailures) record(exec *testjson.Execution, runID int) {
+	for _, tc := range exec.Failed() {
+		if tc.RunID != runID {
+			continue
+		}
+		name := testjson.RelativePackagePath(tc.Package)
+		if tc.Test != "" {
+			name += "." + tc.Test.Name()
+		}
+		if _, ok := f.seeds[name]; !ok {
+			f.names = append(f.names, name)
+		}
+		f.seeds[name] = append(f.seeds[name], exec.Package(tc.Package).ShuffleSeed())
+	}
+}
+
+func (f *shuffleFailures) write(out io.Writer) {
+	if len(f.names) == 0 {
+		return
+	}
+	fmt.Fprintln(out, color.RedString("\n=== Shuffle iterations"))
+	for _, name := range f.names {
+		fmt.Fprintf(out, "FAIL %s (seeds: %s)\n", name, strings.Join(f.seeds[name], ", "))
+	}
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"math/rand"
+	"strconv"
+	"time"
+
+	"gotest.tools/gotestsum/internal/log"
+)
+
+// parseShufflePackagesSeed returns the seed used to shuffle the packages. The
+// value of --shuffle-packages is either "on", to use a seed based on the
+// current time, or an integer seed.
+func parseShufflePackagesSeed(value string) (int64, error) {
+	if value == "on" {
+		return time.Now().UnixNano(), nil
+	}
+	seed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("--shuffle-packages must be \"on\" or an integer seed, not %q", value)
+	}
+	return seed, nil
+}
+
+// shufflePackages replaces opts.packages with the expanded list of packages in
+// a random order. The seed is printed so that the order can be reproduced with
+// --shuffle-packages=seed.
+func shufflePackages(opts *options) error {
+	if opts.shufflePackages == "" || opts.rawCommand {
+		return nil
+	}
+	seed, err := parseShufflePackagesSeed(opts.shufflePackages)
+	if err != nil {
+		return err
+	}
+
+	pkgs := opts.packages
+	// The package list was already expanded by --changed-since or
+	// --skip-unchanged.
+	if opts.changedSinceState == nil && opts.skipUnchanged == nil {
+		if pkgs, err = expandPackages(opts); err != nil {
+			return err
+		}
+	}
+
+	shuffled := make([]string, len(pkgs))
+	copy(shuffled, pkgs)
+	rnd := rand.New(rand.NewSource(seed))
+	rnd.Shuffle(len(shuffled), func(i, j int) {
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	})
+	log.Debugf("shuffle-packages: %d packages shuffled with seed %d", len(shuffled), seed)
+
+	fmt.Fprintf(opts.stdout, "=== Shuffled packages with --shuffle-packages=%d\n", seed)
+	opts.packages = shuffled
+	return nil
+}
+
+// expandPackages returns the import paths of the packages matched by the
+// package patterns.
+func expandPackages(opts *options) ([]string, error) {
+	raw, err := goListFn(cmdArgPackageList(opts, rerunOpts{}, "./..."))
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+	listed, err := decodeGoListPackages(raw)
+	if err != nil {
+		return nil, err
+	}
+	selected, _ := selectedPackageDeps(listed)
+	pkgs := make([]string, 0, len(selected))
+	for _, pkg := range selected {
+		pkgs = append(pkgs, pkg.ImportPath)
+	}
+	return pkgs, nil
+}
@@ -0,0 +1,99 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+)
+
+func TestRun_ShufflePackages(t *testing.T) {
+	listed := []goListPackage{
+		{ImportPath: "fmt", Standard: true, DepOnly: true},
+		{ImportPath: "example.com/one"},
+		{ImportPath: "example.com/two"},
+		{ImportPath: "example.com/three"},
+		{ImportPath: "example.com/four"},
+	}
+	origGoList := goListFn
+	goListFn = func(pkgs []string) ([]byte, error) {
+		assert.DeepEqual(t, pkgs, []string{"./..."})
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		for _, pkg := range listed {
+			assert.NilError(t, enc.Encode(pkg))
+		}
+		return buf.Bytes(), nil
+	}
+	t.Cleanup(func() { goListFn = origGoList })
+
+	var calls [][]string
+	fn := func(args []string) *proc {
+		calls = append(calls, args)
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(""),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	runOnce := func(seed string) ([]string, string) {
+		calls = nil
+		out := new(bytes.Buffer)
+		opts := &options{
+			format:          "none",
+			shufflePackages: seed,
+			stdout:          out,
+			stderr:          os.Stderr,
+			hideSummary:     &hideSummaryValue{value: testjson.SummarizeNone},
+		}
+		assert.NilError(t, run(opts))
+		assert.Equal(t, len(calls), 1)
+		return calls[0][3:], out.String()
+	}
+
+	first, out := runOnce("42")
+	assert.Assert(t, cmp.Contains(out, "=== Shuffled packages with --shuffle-packages=42\n"))
+	assert.Equal(t, len(first), 4)
+
+	second, _ := runOnce("42")
+	assert.DeepEqual(t, first, second)
+
+	_, out = runOnce("on")
+	assert.Assert(t, cmp.Contains(out, "=== Shuffled packages with --shuffle-packages="))
+}
+
+func TestRun_ShufflePackages_RawCommand(t *testing.T) {
+	var calls [][]string
+	fn := func(args []string) *proc {
+		calls = append(calls, args)
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(""),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		rawCommand:      true,
+		args:            []string{"./script", "./..."},
+		format:          "none",
+		shufflePackages: "on",
+		stdout:          out,
+		stderr:          os.Stderr,
+		hideSummary:     &hideSummaryValue{value: testjson.SummarizeNone},
+	}
+	assert.NilError(t, run(opts))
+	assert.DeepEqual(t, calls, [][]string{{"./script", "./..."}})
+	assert.Assert(t, !strings.Contains(out.String(), "=== Shuffled packages"))
+}
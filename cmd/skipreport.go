@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"gotest.tools/gotestsum/testjson"
+)
+
+// skipReport is a group of tests in the --skip-report-file which were skipped
+// with the same reason.
+type skipReport struct {
+	// Reason is empty when the tests did not log a message.
+	Reason string `json:"reason"`
+	// Tests are the names of the tests, prefixed by the package import path.
+	Tests []string `json:"tests"`
+}
+
+// writeSkipReportFile writes the skipped tests, grouped by their skip reason,
+// to opts.skipReportFile.
+func writeSkipReportFile(opts *options, exec *testjson.Execution) error {
+	if opts.skipReportFile == "" || exec == nil {
+		return nil
+	}
+	report := []skipReport{}
+	for _, reason := range exec.SkipReasons() {
+		r := skipReport{Reason: reason.Reason}
+		for _, tc := range reason.Tests {
+			r.Tests = append(r.Tests, tc.Package+"."+tc.Test.Name())
+		}
+		report = append(report, r)
+	}
+
+	raw, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(opts.skipReportFile), 0o755)
+	return ioutil.WriteFile(opts.skipReportFile, append(raw, '\n'), 0o644)
+}
@@ -0,0 +1,58 @@
+package cmd
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestWriteSkipReportFile(t *testing.T) {
+	out := `{"Package": "example.com/one", "Test": "TestA", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "output", "Output": "    a_test.go:1: short mode\n"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "output", "Output": "--- SKIP: TestA (0.00s)\n"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "skip"}
+{"Package": "example.com/one", "Test": "TestB", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestB", "Action": "output", "Output": "--- SKIP: TestB (0.00s)\n"}
+{"Package": "example.com/one", "Test": "TestB", "Action": "skip"}
+{"Package": "example.com/one", "Action": "pass"}
+{"Package": "example.com/two", "Test": "TestC", "Action": "run"}
+{"Package": "example.com/two", "Test": "TestC", "Action": "output", "Output": "    c_test.go:1: short mode\n"}
+{"Package": "example.com/two", "Test": "TestC", "Action": "output", "Output": "--- SKIP: TestC (0.00s)\n"}
+{"Package": "example.com/two", "Test": "TestC", "Action": "skip"}
+{"Package": "example.com/two", "Action": "pass"}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{skipReportFile: dir.Join("out", "skipped.json")}
+	assert.NilError(t, writeSkipReportFile(opts, exec))
+
+	raw, err := ioutil.ReadFile(opts.skipReportFile)
+	assert.NilError(t, err)
+	var report []skipReport
+	assert.NilError(t, json.Unmarshal(raw, &report))
+	expected := []skipReport{
+		{Reason: "short mode", Tests: []string{"example.com/one.TestA", "example.com/two.TestC"}},
+		{Reason: "", Tests: []string{"example.com/one.TestB"}},
+	}
+	assert.DeepEqual(t, report, expected)
+}
+
+func TestWriteSkipReportFile_NoSkippedTests(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	opts := &options{skipReportFile: dir.Join("skipped.json")}
+	assert.NilError(t, writeSkipReportFile(opts, newExecutionWithTwoFailures(t)))
+
+	raw, err := ioutil.ReadFile(opts.skipReportFile)
+	assert.NilError(t, err)
+	assert.Equal(t, string(raw), "[]\n")
+}
@@ -0,0 +1,328 @@
+package cmd
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gotest.tools/gotestsum/internal/log"
+	"gotest.tools/gotestsum/testjson"
+)
+
+// unchangedState is the file used by --skip-unchanged to store the hash of
+// every package that passed.
+type unchangedState struct {
+	Packages map[string]unchangedEntry `json:"packages"`
+
+	// hashes of the source files of all packages selected to test, including
+	// the source files of all their dependencies.
+	hashes map[string]string
+	// cached is the list of packages which were not tested because their hash
+	// matched a previous passing run.
+	cached []string
+}
+
+type unchangedEntry struct {
+	Hash   string `json:"hash"`
+	Result string `json:"result"`
+}
+
+// resultCachedPass is the only result stored in the state file. Failures are
+// never stored.
+const resultCachedPass = "pass"
+
+// skipUnchangedPackages removes any package from opts.packages which has not
+// changed since a previous run where it passed.
+func skipUnchangedPackages(opts *options) (*unchangedState, error) {
+	if opts.skipUnchangedFile == "" {
+		return nil, nil
+	}
+	state, err := readUnchangedState(opts.skipUnchangedFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pkgs := cmdArgPackageList(opts, rerunOpts{}, "./...")
+	raw, err := goListFn(pkgs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list packages: %w", err)
+	}
+	listed, err := decodeGoListPackages(raw)
+	if err != nil {
+		return nil, err
+	}
+	state.hashes = hashPackages(listed, opts.skipUnchangedIgnore)
+
+	var remaining []string
+	for _, name := range sortedStringKeys(state.hashes) {
+		entry, ok := state.Packages[name]
+		if ok && entry.Result == resultCachedPass && entry.Hash == state.hashes[name] {
+			state.cached = append(state.cached, name)
+			continue
+		}
+		remaining = append(remaining, name)
+	}
+	log.Debugf("skip-unchanged: %d packages cached, %d to test", len(state.cached), len(remaining))
+	opts.packages = remaining
+	return state, nil
+}
+
+func readUnchangedState(path string) (*unchangedState, error) {
+	state := &unchangedState{Packages: make(map[string]unchangedEntry)}
+	raw, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return state, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read skip-unchanged file: %w", err)
+	}
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, fmt.Errorf("failed to parse skip-unchanged file %v: %w", path, err)
+	}
+	if state.Packages == nil {
+		state.Packages = make(map[string]unchangedEntry)
+	}
+	return state, nil
+}
+
+// update the state with the result of every package that was tested. Packages
+// with any failures are removed from the state.
+func (s *unchangedState) update(exec *testjson.Execution) {
+	if exec == nil {
+		return
+	}
+	for _, name := range exec.Packages() {
+		hash, ok := s.hashes[name]
+		if !ok {
+			continue
+		}
+		pkg := exec.Package(name)
+		if pkg.Result() == testjson.ActionFail || len(pkg.Failed) > 0 {
+			delete(s.Packages, name)
+			continue
+		}
+		s.Packages[name] = unchangedEntry{Hash: hash, Result: resultCachedPass}
+	}
+}
+
+func (s *unchangedState) write(path string) error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	_ = os.MkdirAll(filepath.Dir(path), 0o755)
+	return ioutil.WriteFile(path, append(raw, '\n'), 0o644)
+}
+
+func writeUnchangedState(opts *options, exec *testjson.Execution) error {
+	if opts.skipUnchanged == nil {
+		return nil
+	}
+	opts.skipUnchanged.update(exec)
+	return opts.skipUnchanged.write(opts.skipUnchangedFile)
+}
+
+func writeCachedPassSummary(out io.Writer, state *unchangedState) {
+	if state == nil || len(state.cached) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n=== Cached pass (%d packages)\n", len(state.cached))
+	for _, name := range state.cached {
+		fmt.Fprintf(out, "=== CACHED PASS: %s\n", testjson.RelativePackagePath(name))
+	}
+}
+
+// goListFn is a shim for testing
+var goListFn = goList
+
+func goList(pkgs []string) ([]byte, error) {
+	args := append([]string{"list", "-deps", "-test", "-json"}, pkgs...)
+	log.Debugf("exec: go %s", args)
+	cmd := exec.Command("go", args...)
+	cmd.Stderr = os.Stderr
+	return cmd.Output()
+}
+
+type goListPackage struct {
+	ImportPath      string
+	Dir             string
+	Standard        bool
+	DepOnly         bool
+	ForTest         string
+	Deps            []string
+	GoFiles         []string
+	CgoFiles        []string
+	TestGoFiles     []string
+	XTestGoFiles    []string
+	EmbedFiles      []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+}
+
+func decodeGoListPackages(raw []byte) ([]goListPackage, error) {
+	var result []goListPackage
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	for {
+		var pkg goListPackage
+		switch err := dec.Decode(&pkg); {
+		case err == io.EOF:
+			return result, nil
+		case err != nil:
+			return nil, fmt.Errorf("failed to decode go list output: %w", err)
+		}
+		result = append(result, pkg)
+	}
+}
+
+// hashPackages returns a hash for every package that was selected by the
+// go list patterns. The hash includes the source files of the package and
+// the source files of all of its dependencies, including the dependencies of
+// its tests.
+func hashPackages(listed []goListPackage, ignore []string) map[string]string {
+	own := make(map[string]string)
+	for _, pkg := range listed {
+		if isTestPackage(pkg) {
+			continue
+		}
+		own[pkg.ImportPath] = hashPackageFiles(pkg, ignore)
+	}
+
+	selected, deps := selectedPackageDeps(listed)
+	result := make(map[string]string, len(selected))
+	for _, pkg := range selected {
+		h := sha256.New()
+		for _, name := range deps[pkg.ImportPath] {
+			fmt.Fprintf(h, "%s %s\n", name, own[name])
+		}
+		result[pkg.ImportPath] = hex.EncodeToString(h.Sum(nil))
+	}
+	return result
+}
+
+// selectedPackageDeps returns the packages that were selected by the go list
+// patterns, and a sorted list of the dependencies of each selected package.
+// The dependencies include the package itself, and the dependencies of its
+// tests.
+func selectedPackageDeps(listed []goListPackage) ([]goListPackage, map[string][]string) {
+	testDeps := make(map[string][]string)
+	var selected []goListPackage
+	for _, pkg := range listed {
+		switch {
+		case strings.HasSuffix(pkg.ImportPath, ".test"):
+			// the generated main package of the test binary depends on all
+			// the packages used by the tests.
+			name := strings.TrimSuffix(pkg.ImportPath, ".test")
+			testDeps[name] = pkg.Deps
+		case isTestPackage(pkg):
+		case !pkg.DepOnly && !pkg.Standard && pkg.ForTest == "":
+			selected = append(selected, pkg)
+		}
+	}
+
+	result := make(map[string][]string, len(selected))
+	for _, pkg := range selected {
+		deps := testDeps[pkg.ImportPath]
+		if deps == nil {
+			deps = pkg.Deps
+		}
+		names := map[string]bool{pkg.ImportPath: true}
+		for _, dep := range deps {
+			dep = strings.TrimSuffix(stripTestVariant(dep), "_test")
+			if strings.HasSuffix(dep, ".test") {
+				continue
+			}
+			names[dep] = true
+		}
+		result[pkg.ImportPath] = sortedBoolKeys(names)
+	}
+	return selected, result
+}
+
+// isTestPackage returns true if pkg is a variant of a package compiled for
+// tests, or the generated main package of a test binary. Test variants are
+// identified by their base package.
+func isTestPackage(pkg goListPackage) bool {
+	return strings.HasSuffix(pkg.ImportPath, ".test") ||
+		stripTestVariant(pkg.ImportPath) != pkg.ImportPath
+}
+
+// stripTestVariant removes the " [pkg.test]" suffix that go list adds to
+// packages that are compiled for tests.
+func stripTestVariant(importPath string) string {
+	if i := strings.Index(importPath, " ["); i >= 0 {
+		return importPath[:i]
+	}
+	return importPath
+}
+
+func hashPackageFiles(pkg goListPackage, ignore []string) string {
+	if pkg.Standard {
+		return "std"
+	}
+	var files []string
+	for _, group := range [][]string{
+		pkg.GoFiles, pkg.CgoFiles, pkg.TestGoFiles, pkg.XTestGoFiles,
+		pkg.EmbedFiles, pkg.TestEmbedFiles, pkg.XTestEmbedFiles,
+	} {
+		files = append(files, group...)
+	}
+	sort.Strings(files)
+
+	h := sha256.New()
+	for _, file := range files {
+		path := filepath.Join(pkg.Dir, file)
+		if isIgnoredFile(path, ignore) {
+			continue
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			log.Warnf("skip-unchanged: failed to read %v: %v", path, err)
+			// use a value that will never match a previous hash
+			raw = []byte(err.Error())
+		}
+		fmt.Fprintf(h, "%s %d\n", file, len(raw))
+		h.Write(raw) // nolint: errcheck
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// isIgnoredFile returns true if the base name of path, or the full path,
+// matches any of the glob patterns.
+func isIgnoredFile(path string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := filepath.Match(pattern, filepath.Base(path)); ok {
+			return true
+		}
+		if ok, _ := filepath.Match(pattern, path); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedStringKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func sortedBoolKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,128 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+	"gotest.tools/v3/fs"
+)
+
+func TestRun_SkipUnchanged(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithDir("one",
+			fs.WithFile("one.go", "package one\n"),
+			fs.WithFile("one_test.go", "package one\n"),
+			fs.WithFile("version.go", "package one\n// v1\n")),
+		fs.WithDir("two",
+			fs.WithFile("two.go", "package two\n")))
+	stateFile := dir.Join("state.json")
+
+	listed := []goListPackage{
+		{ImportPath: "fmt", Standard: true, DepOnly: true},
+		{
+			ImportPath:  "example.com/one",
+			Dir:         dir.Join("one"),
+			Deps:        []string{"fmt"},
+			GoFiles:     []string{"one.go", "version.go"},
+			TestGoFiles: []string{"one_test.go"},
+		},
+		{
+			ImportPath: "example.com/two",
+			Dir:        dir.Join("two"),
+			Deps:       []string{"example.com/one", "fmt"},
+			GoFiles:    []string{"two.go"},
+		},
+	}
+	origGoList := goListFn
+	goListFn = func(pkgs []string) ([]byte, error) {
+		buf := new(bytes.Buffer)
+		enc := json.NewEncoder(buf)
+		for _, pkg := range listed {
+			assert.NilError(t, enc.Encode(pkg))
+		}
+		return buf.Bytes(), nil
+	}
+	t.Cleanup(func() { goListFn = origGoList })
+
+	var calls [][]string
+	fn := func(args []string) *proc {
+		calls = append(calls, args)
+		var out strings.Builder
+		for _, pkg := range args[3:] {
+			action := "pass"
+			if pkg == "example.com/two" {
+				action = "fail"
+			}
+			out.WriteString(`{"Package": "` + pkg + `", "Test": "TestA", "Action": "run"}
+{"Package": "` + pkg + `", "Test": "TestA", "Action": "` + action + `"}
+{"Package": "` + pkg + `", "Action": "` + action + `"}
+`)
+		}
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(out.String()),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	runOnce := func() string {
+		out := new(bytes.Buffer)
+		opts := &options{
+			format:              "none",
+			skipUnchangedFile:   stateFile,
+			skipUnchangedIgnore: []string{"version.go"},
+			stdout:              out,
+			stderr:              os.Stderr,
+			hideSummary:         &hideSummaryValue{value: testjson.SummarizeNone},
+		}
+		assert.NilError(t, run(opts))
+		return out.String()
+	}
+
+	runOnce()
+	assert.DeepEqual(t, calls[0],
+		[]string{"go", "test", "-json", "example.com/one", "example.com/two"})
+
+	out := runOnce()
+	assert.DeepEqual(t, calls[1], []string{"go", "test", "-json", "example.com/two"})
+	assert.Assert(t, cmp.Contains(out, "=== Cached pass (1 packages)"))
+
+	t.Run("ignored files do not change the hash", func(t *testing.T) {
+		assert.NilError(t, os.WriteFile(dir.Join("one", "version.go"), []byte("package one\n// v2\n"), 0o644))
+		runOnce()
+		assert.DeepEqual(t, calls[2], []string{"go", "test", "-json", "example.com/two"})
+	})
+
+	t.Run("changed files are tested", func(t *testing.T) {
+		assert.NilError(t, os.WriteFile(dir.Join("one", "one_test.go"), []byte("package one\n\n"), 0o644))
+		runOnce()
+		assert.DeepEqual(t, calls[3],
+			[]string{"go", "test", "-json", "example.com/one", "example.com/two"})
+	})
+}
+
+func TestHashPackages_IncludesTestDependencies(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithDir("one", fs.WithFile("one.go", "package one\n")),
+		fs.WithDir("helper", fs.WithFile("helper.go", "package helper\n")))
+
+	listed := []goListPackage{
+		{ImportPath: "example.com/helper", Dir: dir.Join("helper"), GoFiles: []string{"helper.go"}, DepOnly: true},
+		{ImportPath: "example.com/one", Dir: dir.Join("one"), GoFiles: []string{"one.go"}},
+		{ImportPath: "example.com/one.test", Deps: []string{"example.com/helper", "example.com/one [example.com/one.test]"}},
+	}
+	before := hashPackages(listed, nil)
+	assert.Equal(t, len(before), 1)
+
+	assert.NilError(t, os.WriteFile(dir.Join("helper", "helper.go"), []byte("package helper\n\n"), 0o644))
+	after := hashPackages(listed, nil)
+	assert.Assert(t, before["example.com/one"] != after["example.com/one"])
+}
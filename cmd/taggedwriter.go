@@ -0,0 +1,91 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+)
+
+// taggedWriter prepends a tag to every line written to out. Partial lines are
+// buffered until the line is complete, or Flush is called.
+type taggedWriter struct {
+	out     io.Writer
+	tag     []byte
+	partial []byte
+}
+
+func newTaggedWriter(w io.Writer, tag string) io.Writer {
+	return &taggedWriter{out: w, tag: []byte(tag)}
+}
+
+func (w *taggedWriter) Write(p []byte) (int, error) {
+	w.partial = append(w.partial, p...)
+	var buf bytes.Buffer
+	for {
+		i := bytes.IndexByte(w.partial, '\n')
+		if i < 0 {
+			break
+		}
+		buf.Write(w.tag)
+		buf.Write(w.partial[:i+1])
+		w.partial = w.partial[i+1:]
+	}
+	if buf.Len() > 0 {
+		if _, err := w.out.Write(buf.Bytes()); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// Flush writes the buffered partial line, if there is one.
+func (w *taggedWriter) Flush() error {
+	if len(w.partial) == 0 {
+		return nil
+	}
+	line := append(append([]byte{}, w.tag...), w.partial...)
+	w.partial = nil
+	_, err := w.out.Write(line)
+	return err
+}
+
+// rerunTagOutput is the output of the formatter when --rerun-fails-tag-output
+// is set. Lines written for the events of a rerun are prefixed with
+// [rerun-N], where N is the rerun attempt.
+type rerunTagOutput struct {
+	out     io.Writer
+	runID   int
+	current io.Writer
+}
+
+func newRerunTagOutput(out io.Writer) *rerunTagOutput {
+	return &rerunTagOutput{out: out, current: out}
+}
+
+func (o *rerunTagOutput) Write(p []byte) (int, error) {
+	return o.current.Write(p)
+}
+
+// setRunID changes the tag used for the following writes to the tag for the
+// attempt runID.
+func (o *rerunTagOutput) setRunID(runID int) {
+	if o == nil || runID == o.runID {
+		return
+	}
+	o.Flush()
+	o.runID = runID
+	o.current = o.out
+	if runID > 0 {
+		o.current = newTaggedWriter(o.out, fmt.Sprintf("[rerun-%d] ", runID))
+	}
+}
+
+// Flush writes any partial line from the current attempt.
+func (o *rerunTagOutput) Flush() {
+	if o == nil {
+		return
+	}
+	if f, ok := o.current.(*taggedWriter); ok {
+		_ = f.Flush()
+	}
+}
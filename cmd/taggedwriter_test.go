@@ -0,0 +1,70 @@
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestTaggedWriter(t *testing.T) {
+	buf := new(bytes.Buffer)
+	w := newTaggedWriter(buf, "[tag] ")
+
+	_, err := w.Write([]byte("one\ntw"))
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), "[tag] one\n")
+
+	_, err = w.Write([]byte("o\nthree\nfour"))
+	assert.NilError(t, err)
+	assert.Equal(t, buf.String(), "[tag] one\n[tag] two\n[tag] three\n")
+
+	assert.NilError(t, w.(*taggedWriter).Flush())
+	assert.Equal(t, buf.String(), "[tag] one\n[tag] two\n[tag] three\n[tag] four")
+}
+
+func TestRerunFailed_TagOutput(t *testing.T) {
+	fn := func(args []string) *proc {
+		test := strings.TrimSuffix(strings.TrimPrefix(args[3], "-test.run=^"), "$")
+		return &proc{
+			cmd: fakeWaiter{},
+			stdout: strings.NewReader(`{"Package": "pkg", "Test": "` + test + `", "Action": "run"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "output", "Output": "rerun output\n"}
+{"Package": "pkg", "Test": "` + test + `", "Action": "pass"}
+{"Package": "pkg", "Action": "pass"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	out := new(bytes.Buffer)
+	opts := &options{
+		rerunFailsMaxInitialFailures: 10,
+		rerunFailsMaxAttempts:        2,
+		rerunFailsTagOutput:          true,
+		format:                       "standard-verbose",
+		stdout:                       out,
+		stderr:                       new(bytes.Buffer),
+	}
+	handler, err := newEventHandler(opts)
+	assert.NilError(t, err)
+
+	exec := newExecutionWithTwoFailures(t)
+	out.Reset()
+	cfg := testjson.ScanConfig{Execution: exec, Handler: handler}
+	assert.NilError(t, rerunFailed(context.Background(), opts, cfg, nil))
+	handler.Flush()
+
+	expected := `
+DONE 2 tests, 2 failures in 0.000s
+
+[rerun-1] rerun output
+[rerun-1] rerun output
+`
+	assert.Equal(t, out.String(), expected)
+}
@@ -0,0 +1,191 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gotest.tools/gotestsum/testjson"
+)
+
+// testCountState is the file used by --test-count-file to store the number of
+// tests run by each package in the last successful run.
+type testCountState struct {
+	Packages map[string]int `json:"packages"`
+}
+
+// testCountReport is the result of comparing the number of tests run by each
+// package to the counts in the --test-count-file.
+type testCountReport struct {
+	state *testCountState
+	// current is the number of tests run by each package that passed.
+	current map[string]int
+	// dropped is the list of packages which ran fewer tests than the
+	// previous successful run.
+	dropped []testCountDrop
+}
+
+type testCountDrop struct {
+	pkg      string
+	previous int
+	current  int
+}
+
+// fraction returns the size of the drop as a fraction of the previous count.
+func (d testCountDrop) fraction() float64 {
+	return float64(d.previous-d.current) / float64(d.previous)
+}
+
+// compareTestCounts compares the number of tests run by each package to the
+// counts stored in opts.testCountFile. Packages with any failures are not
+// compared, the failures are already reported.
+func compareTestCounts(opts *options, exec *testjson.Execution) (*testCountReport, error) {
+	if opts.testCountFile == "" || exec == nil {
+		return nil, nil
+	}
+	state, err := readTestCountState(opts.testCountFile)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &testCountReport{state: state, current: make(map[string]int)}
+	for _, name := range exec.Packages() {
+		pkg := exec.Package(name)
+		if pkg.Result() == testjson.ActionFail || len(pkg.Failed) > 0 {
+			continue
+		}
+		count := countTests(pkg)
+		report.current[name] = count
+
+		previous, ok := state.Packages[name]
+		if ok && count < previous && !opts.updateTestCounts {
+			report.dropped = append(report.dropped,
+				testCountDrop{pkg: name, previous: previous, current: count})
+		}
+	}
+	return report, nil
+}
+
+// countTests returns the number of tests that ran in the package. A test that
+// was run more than once (ex: by --rerun-fails) is only counted once.
+func countTests(pkg *testjson.Package) int {
+	names := make(map[testjson.TestName]bool)
+	for _, tc := range pkg.Passed {
+		names[tc.Test] = true
+	}
+	for _, tc := range pkg.Failed {
+		names[tc.Test] = true
+	}
+	return len(names)
+}
+
+func readTestCountState(path string) (*testCountState, error) {
+	state := &testCountState{Packages: make(map[string]int)}
+	raw, err := ioutil.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		return state, nil
+	case err != nil:
+		return nil, fmt.Errorf("failed to read test count file: %w", err)
+	}
+	if err := json.Unmarshal(raw, state); err != nil {
+		return nil, fmt.Errorf("failed to parse test count file %v: %w", path, err)
+	}
+	if state.Packages == nil {
+		state.Packages = make(map[string]int)
+	}
+	return state, nil
+}
+
+// update the state with the counts from the current run. The count of a
+// package that dropped is not changed, so that the drop is reported again by
+// the next run. With --update-test-counts the state is replaced by the counts
+// from the current run.
+func (r *testCountReport) update(replace bool) {
+	if replace {
+		r.state.Packages = r.current
+		return
+	}
+	dropped := make(map[string]bool, len(r.dropped))
+	for _, d := range r.dropped {
+		dropped[d.pkg] = true
+	}
+	for name, count := range r.current {
+		if !dropped[name] {
+			r.state.Packages[name] = count
+		}
+	}
+}
+
+// write the state to path. The state is written to a temporary file which
+// is renamed to path, so that an interrupted write does not leave a partial
+// file.
+func (s *testCountState) write(path string) error {
+	raw, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(path)
+	_ = os.MkdirAll(dir, 0o755)
+	fh, err := ioutil.TempFile(dir, filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(fh.Name()) // nolint: errcheck
+	if _, err := fh.Write(append(raw, '\n')); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	if err := fh.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(fh.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(fh.Name(), path)
+}
+
+// writeTestCounts updates the test count file after a successful run.
+func writeTestCounts(opts *options, exec *testjson.Execution, report *testCountReport, exitErr error) error {
+	if report == nil || exitErr != nil || len(exec.Failed()) > 0 {
+		return nil
+	}
+	report.update(opts.updateTestCounts)
+	return report.state.write(opts.testCountFile)
+}
+
+func writeTestCountSummary(out io.Writer, report *testCountReport) {
+	if report == nil || len(report.dropped) == 0 {
+		return
+	}
+	fmt.Fprintf(out, "\n=== Test count dropped (%d packages)\n", len(report.dropped))
+	for _, d := range report.dropped {
+		fmt.Fprintf(out, "=== DROPPED: %s %d -> %d tests (-%.1f%%)\n",
+			testjson.RelativePackagePath(d.pkg), d.previous, d.current, d.fraction()*100)
+	}
+}
+
+// failOnTestCountDrop returns an error if the test count of any package
+// dropped by more than the threshold set by --fail-on-test-count-drop.
+func failOnTestCountDrop(opts *options, report *testCountReport) error {
+	threshold, ok := opts.failOnTestCountDrop.Value()
+	if report == nil || !ok {
+		return nil
+	}
+	var pkgs []string
+	for _, d := range report.dropped {
+		if d.fraction() > threshold {
+			pkgs = append(pkgs, testjson.RelativePackagePath(d.pkg))
+		}
+	}
+	if len(pkgs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("test count dropped by more than %v in %d packages: %s "+
+		"(use --update-test-counts to accept the new counts)",
+		opts.failOnTestCountDrop, len(pkgs), strings.Join(pkgs, ", "))
+}
@@ -0,0 +1,118 @@
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/assert/cmp"
+	"gotest.tools/v3/fs"
+)
+
+// testCountOutput returns go test -json output for packages that pass, with
+// the number of tests in each package.
+func testCountOutput(counts map[string]int) string {
+	out := new(strings.Builder)
+	pkgs := make([]string, 0, len(counts))
+	for pkg := range counts {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		fmt.Fprintf(out, `{"Package": %q, "Action": "run"}`+"\n", pkg)
+		for i := 0; i < counts[pkg]; i++ {
+			fmt.Fprintf(out, `{"Package": %q, "Test": "Test%d", "Action": "run"}`+"\n", pkg, i)
+			fmt.Fprintf(out, `{"Package": %q, "Test": "Test%d", "Action": "pass"}`+"\n", pkg, i)
+		}
+		fmt.Fprintf(out, `{"Package": %q, "Action": "pass"}`+"\n", pkg)
+	}
+	return out.String()
+}
+
+func TestRun_TestCountFile(t *testing.T) {
+	dir := fs.NewDir(t, t.Name())
+	countFile := dir.Join("counts.json")
+
+	var output string
+	fn := func(args []string) *proc {
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(output),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	runOnce := func(counts map[string]int, flags ...string) (string, error) {
+		output = testCountOutput(counts)
+		flagSet, opts := setupFlags("gotestsum")
+		args := append([]string{"--format=none", "--test-count-file=" + countFile}, flags...)
+		assert.NilError(t, flagSet.Parse(args))
+		out := new(bytes.Buffer)
+		opts.stdout = out
+		opts.stderr = os.Stderr
+		opts.hideSummary = &hideSummaryValue{value: testjson.SummarizeNone}
+		err := run(opts)
+		return out.String(), err
+	}
+	readCounts := func() string {
+		raw, err := ioutil.ReadFile(countFile)
+		assert.NilError(t, err)
+		return string(raw)
+	}
+
+	_, err := runOnce(map[string]int{"example.com/one": 10, "example.com/two": 4})
+	assert.NilError(t, err)
+	expected := `{
+  "packages": {
+    "example.com/one": 10,
+    "example.com/two": 4
+  }
+}
+`
+	assert.Equal(t, readCounts(), expected)
+
+	t.Run("drop is reported", func(t *testing.T) {
+		out, err := runOnce(map[string]int{"example.com/one": 8, "example.com/two": 5})
+		assert.NilError(t, err)
+		assert.Assert(t, cmp.Contains(out, "=== Test count dropped (1 packages)\n"+
+			"=== DROPPED: example.com/one 10 -> 8 tests (-20.0%)\n"))
+		// the count of the package that dropped is not changed
+		assert.Assert(t, cmp.Contains(readCounts(), `"example.com/one": 10,`))
+		assert.Assert(t, cmp.Contains(readCounts(), `"example.com/two": 5`))
+	})
+
+	t.Run("drop above threshold fails", func(t *testing.T) {
+		_, err := runOnce(map[string]int{"example.com/one": 8, "example.com/two": 5},
+			"--fail-on-test-count-drop=10%")
+		assert.Error(t, err, "test count dropped by more than 10% in 1 packages: "+
+			"example.com/one (use --update-test-counts to accept the new counts)")
+	})
+
+	t.Run("drop below threshold passes", func(t *testing.T) {
+		_, err := runOnce(map[string]int{"example.com/one": 8, "example.com/two": 5},
+			"--fail-on-test-count-drop=25%")
+		assert.NilError(t, err)
+	})
+
+	t.Run("update test counts", func(t *testing.T) {
+		out, err := runOnce(map[string]int{"example.com/one": 8},
+			"--update-test-counts", "--fail-on-test-count-drop=10%")
+		assert.NilError(t, err)
+		assert.Assert(t, !strings.Contains(out, "=== Test count dropped"))
+		expected := `{
+  "packages": {
+    "example.com/one": 8
+  }
+}
+`
+		assert.Equal(t, readCounts(), expected)
+	})
+}
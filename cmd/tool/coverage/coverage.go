@@ -0,0 +1,68 @@
+package coverage
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dnephin/pflag"
+	"gotest.tools/gotestsum/internal/coverprofile"
+)
+
+// Run the command to combine coverage profiles.
+func Run(name string, args []string) error {
+	flags, opts := setupFlags(name)
+	switch err := flags.Parse(args); {
+	case err == pflag.ErrHelp:
+		return nil
+	case err != nil:
+		usage(os.Stderr, name, flags)
+		return err
+	}
+	opts.profiles = flags.Args()
+	return run(*opts)
+}
+
+type options struct {
+	output   string
+	profiles []string
+}
+
+func setupFlags(name string) (*pflag.FlagSet, *options) {
+	opts := &options{}
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.SetInterspersed(false)
+	flags.Usage = func() {
+		usage(os.Stdout, name, flags)
+	}
+	flags.StringVarP(&opts.output, "output", "o", "",
+		"path of the combined coverage profile")
+	return flags, opts
+}
+
+func usage(out io.Writer, name string, flags *pflag.FlagSet) {
+	fmt.Fprintf(out, `Usage:
+    %[1]s [flags] PROFILE...
+
+Combine the coverage profiles written by 'go test -coverprofile' into a single
+profile. The counts of blocks that appear in more than one profile are added
+together, or for the set mode, the block is covered if it was covered in any
+profile. All the profiles must use the same covermode.
+
+    %[1]s --output coverage.out shard1.out shard2.out
+
+Flags:
+`, name)
+	flags.SetOutput(out)
+	flags.PrintDefaults()
+}
+
+func run(opts options) error {
+	if opts.output == "" {
+		return fmt.Errorf("--output is required")
+	}
+	if len(opts.profiles) == 0 {
+		return fmt.Errorf("at least one coverage profile is required")
+	}
+	return coverprofile.CombineFiles(opts.output, opts.profiles)
+}
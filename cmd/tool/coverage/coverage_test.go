@@ -0,0 +1,71 @@
+package coverage
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestRun(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("shard1.out", `mode: count
+example.com/pkg/a.go:3.10,5.2 1 2
+`),
+		fs.WithFile("shard2.out", `mode: count
+example.com/pkg/a.go:3.10,5.2 1 3
+example.com/pkg/b.go:1.1,2.2 1 0
+`))
+
+	out := dir.Join("coverage.out")
+	err := Run("combine-coverage", []string{
+		"--output", out, dir.Join("shard1.out"), dir.Join("shard2.out"),
+	})
+	assert.NilError(t, err)
+
+	raw, err := ioutil.ReadFile(out)
+	assert.NilError(t, err)
+	expected := `mode: count
+example.com/pkg/a.go:3.10,5.2 1 5
+example.com/pkg/b.go:1.1,2.2 1 0
+`
+	assert.Equal(t, string(raw), expected)
+}
+
+func TestRun_Errors(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("count.out", "mode: count\n"),
+		fs.WithFile("set.out", "mode: set\n"))
+
+	type testCase struct {
+		name     string
+		opts     options
+		expected string
+	}
+	testCases := []testCase{
+		{
+			name:     "missing output",
+			opts:     options{profiles: []string{dir.Join("count.out")}},
+			expected: "--output is required",
+		},
+		{
+			name:     "missing profiles",
+			opts:     options{output: dir.Join("out")},
+			expected: "at least one coverage profile is required",
+		},
+		{
+			name: "mismatched modes",
+			opts: options{
+				output:   dir.Join("out"),
+				profiles: []string{dir.Join("count.out"), dir.Join("set.out")},
+			},
+			expected: "with mode count and ",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.ErrorContains(t, run(tc.opts), tc.expected)
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package flakiness
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/dnephin/pflag"
+)
+
+// Run the command to print a summary of the flakiness of tests.
+func Run(name string, args []string) error {
+	flags, opts := setupFlags(name)
+	switch err := flags.Parse(args); {
+	case err == pflag.ErrHelp:
+		return nil
+	case err != nil:
+		usage(os.Stderr, name, flags)
+		return err
+	}
+	opts.stdout = os.Stdout
+	opts.now = time.Now
+	return run(*opts)
+}
+
+type options struct {
+	from string
+
+	// shims for testing
+	stdout io.Writer
+	now    func() time.Time
+}
+
+func setupFlags(name string) (*pflag.FlagSet, *options) {
+	opts := &options{}
+	flags := pflag.NewFlagSet(name, pflag.ContinueOnError)
+	flags.SetInterspersed(false)
+	flags.Usage = func() {
+		usage(os.Stdout, name, flags)
+	}
+	flags.StringVar(&opts.from, "from", "",
+		"path of the file written by 'gotestsum --rerun-fails-record-to'")
+	return flags, opts
+}
+
+func usage(out io.Writer, name string, flags *pflag.FlagSet) {
+	fmt.Fprintf(out, `Usage:
+    %[1]s [flags]
+
+Read the results recorded by 'gotestsum --rerun-fails-record-to' and print the
+flakiness of each test over the last 7 and 30 days. The flakiness is the
+percentage of the recorded runs of a test which failed.
+
+    %[1]s --from flakiness.jsonl
+
+Flags:
+`, name)
+	flags.SetOutput(out)
+	flags.PrintDefaults()
+}
+
+// record is one line of the file written by --rerun-fails-record-to.
+type record struct {
+	Timestamp time.Time `json:"timestamp"`
+	Commit    string    `json:"commit"`
+	Test      string    `json:"test"`
+	Package   string    `json:"package"`
+	Attempt   int       `json:"attempt"`
+	Passed    bool      `json:"passed"`
+}
+
+func run(opts options) error {
+	if opts.from == "" {
+		return fmt.Errorf("--from is required")
+	}
+	fh, err := os.Open(opts.from)
+	if err != nil {
+		return err
+	}
+	defer fh.Close() // nolint: errcheck
+
+	records, err := readRecords(fh)
+	if err != nil {
+		return fmt.Errorf("failed to read %v: %w", opts.from, err)
+	}
+	writeReport(opts.stdout, summarize(records, opts.now()))
+	return nil
+}
+
+func readRecords(in io.Reader) ([]record, error) {
+	var records []record
+	scan := bufio.NewScanner(in)
+	for line := 1; scan.Scan(); line++ {
+		if len(scan.Bytes()) == 0 {
+			continue
+		}
+		var r record
+		if err := json.Unmarshal(scan.Bytes(), &r); err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		records = append(records, r)
+	}
+	return records, scan.Err()
+}
+
+// counts are the number of runs, and failed runs, of a test in a period.
+type counts struct {
+	runs     int
+	failures int
+}
+
+func (c counts) rate() float64 {
+	return float64(c.failures) / float64(c.runs)
+}
+
+func (c counts) String() string {
+	if c.runs == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%% (%d/%d)", c.rate()*100, c.failures, c.runs)
+}
+
+func (c *counts) add(r record) {
+	c.runs++
+	if !r.Passed {
+		c.failures++
+	}
+}
+
+type testSummary struct {
+	name  string
+	week  counts
+	month counts
+}
+
+const day = 24 * time.Hour
+
+// summarize returns the counts of every test with a record from the 30 days
+// before now, sorted by the 30 day flakiness.
+func summarize(records []record, now time.Time) []testSummary {
+	byName := make(map[string]*testSummary)
+	for _, r := range records {
+		age := now.Sub(r.Timestamp)
+		if age > 30*day {
+			continue
+		}
+		name := r.Package + "." + r.Test
+		s, ok := byName[name]
+		if !ok {
+			s = &testSummary{name: name}
+			byName[name] = s
+		}
+		s.month.add(r)
+		if age <= 7*day {
+			s.week.add(r)
+		}
+	}
+
+	result := make([]testSummary, 0, len(byName))
+	for _, s := range byName {
+		result = append(result, *s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		a, b := result[i], result[j]
+		if a.month.rate() != b.month.rate() {
+			return a.month.rate() > b.month.rate()
+		}
+		return a.name < b.name
+	})
+	return result
+}
+
+func writeReport(out io.Writer, summaries []testSummary) {
+	if len(summaries) == 0 {
+		fmt.Fprintln(out, "No test results in the last 30 days")
+		return
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "TEST\t7 DAYS\t30 DAYS")
+	for _, s := range summaries {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", s.name, s.week, s.month)
+	}
+	_ = w.Flush()
+}
@@ -0,0 +1,53 @@
+package flakiness
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestRun(t *testing.T) {
+	file := fs.NewFile(t, t.Name(), fs.WithContent(`{"timestamp":"2024-03-30T10:00:00Z","commit":"a","test":"TestOne","package":"example.com/pkg","attempt":0,"passed":false}
+{"timestamp":"2024-03-30T10:00:00Z","commit":"a","test":"TestOne","package":"example.com/pkg","attempt":1,"passed":true}
+{"timestamp":"2024-03-10T10:00:00Z","commit":"b","test":"TestOne","package":"example.com/pkg","attempt":0,"passed":false}
+{"timestamp":"2024-03-10T10:00:00Z","commit":"b","test":"TestOne","package":"example.com/pkg","attempt":1,"passed":false}
+{"timestamp":"2024-03-10T10:00:00Z","commit":"b","test":"TestTwo","package":"example.com/pkg","attempt":0,"passed":false}
+{"timestamp":"2024-03-10T10:00:00Z","commit":"b","test":"TestTwo","package":"example.com/pkg","attempt":1,"passed":true}
+{"timestamp":"2024-01-01T10:00:00Z","commit":"c","test":"TestOld","package":"example.com/pkg","attempt":0,"passed":false}
+`))
+
+	out := new(bytes.Buffer)
+	err := run(options{
+		from:   file.Path(),
+		stdout: out,
+		now: func() time.Time {
+			return time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC)
+		},
+	})
+	assert.NilError(t, err)
+	expected := `TEST                     7 DAYS       30 DAYS
+example.com/pkg.TestOne  50.0% (1/2)  75.0% (3/4)
+example.com/pkg.TestTwo  -            50.0% (1/2)
+`
+	assert.Equal(t, out.String(), expected)
+}
+
+func TestRun_NoRecentResults(t *testing.T) {
+	file := fs.NewFile(t, t.Name(), fs.WithContent(""))
+	out := new(bytes.Buffer)
+	err := run(options{from: file.Path(), stdout: out, now: time.Now})
+	assert.NilError(t, err)
+	assert.Equal(t, out.String(), "No test results in the last 30 days\n")
+}
+
+func TestRun_Errors(t *testing.T) {
+	err := run(options{})
+	assert.Error(t, err, "--from is required")
+
+	file := fs.NewFile(t, t.Name(), fs.WithContent("{}\nnot json\n"))
+	err = run(options{from: file.Path(), stdout: new(bytes.Buffer), now: time.Now})
+	assert.ErrorContains(t, err, "line 2:")
+}
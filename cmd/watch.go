@@ -3,12 +3,15 @@ package cmd
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"os/exec"
+	"sync/atomic"
 
 	"gotest.tools/gotestsum/internal/filewatcher"
+	"gotest.tools/gotestsum/internal/log"
 	"gotest.tools/gotestsum/testjson"
 )
 
@@ -16,15 +19,21 @@ func runWatcher(opts *options) error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	w := &watchRuns{opts: *opts}
-	return filewatcher.Watch(ctx, opts.packages, w.run)
+	w := &watchRuns{opts: *opts, quit: cancel}
+	return filewatcher.Watch(ctx, opts.packages, opts.watchDebounce, w.run)
 }
 
 type watchRuns struct {
 	opts     options
 	prevExec *testjson.Execution
+	// quit stops watching for changes.
+	quit func()
 }
 
+// errQuitWatch is returned by runSingle when the run was interrupted more than
+// once, to stop watching for changes.
+var errQuitWatch = errors.New("quit watching")
+
 func (w *watchRuns) run(event filewatcher.Event) error {
 	if event.Debug {
 		path, cleanup, err := delveInitFile(w.prevExec)
@@ -50,19 +59,42 @@ func (w *watchRuns) run(event filewatcher.Event) error {
 
 	opts := w.opts // shallow copy opts
 	opts.packages = append([]string{}, opts.packages...)
-	opts.packages = append(opts.packages, event.PkgPath)
+	switch {
+	case dir != "" || len(event.PkgPaths) == 0:
+		opts.packages = append(opts.packages, event.PkgPath)
+	default:
+		opts.packages = append(opts.packages, event.PkgPaths...)
+	}
 	opts.packages = append(opts.packages, event.Args...)
 
+	// Rerun the failures when the previous run had failures, because the
+	// change may have been made to fix a flaky test. Reruns are not enabled
+	// when the go test args can not be used with --rerun-fails.
+	if opts.rerunFailsMaxAttempts == 0 && w.prevExec != nil && len(w.prevExec.Failed()) > 0 {
+		rerunOpts := opts
+		rerunOpts.rerunFailsMaxAttempts = defaultRerunFailsMaxAttempts
+		if err := rerunOpts.Validate(); err != nil {
+			log.Debugf("not re-running failures: %v", err)
+		} else {
+			opts = rerunOpts
+		}
+	}
+
 	var err error
-	if w.prevExec, err = runSingle(&opts, dir); !IsExitCoder(err) {
+	w.prevExec, err = runSingle(&opts, dir)
+	switch {
+	case err == errQuitWatch:
+		w.quit()
+		return nil
+	case !IsExitCoder(err):
 		return err
 	}
 	return nil
 }
 
-// runSingle is similar to run. It doesn't support rerun-fails. It may be
-// possible to share runSingle with run, but the defer close on the handler
-// would require at least 3 return values, so for now it is a copy.
+// runSingle is similar to run. It doesn't support --rerun-fails-report. It may be possible to share runSingle with run, but
+// the defer close on the handler would require at least 3 return values, so
+// for now it is a copy.
 func runSingle(opts *options, dir string) (*testjson.Execution, error) {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -71,7 +103,7 @@ func runSingle(opts *options, dir string) (*testjson.Execution, error) {
 		return nil, err
 	}
 
-	goTestProc, err := startGoTestFn(ctx, dir, goTestCmdArgs(opts, rerunOpts{}))
+	goTestProc, err := startGoTestFn(ctx, dir, nil, goTestCmdArgs(opts, rerunOpts{}))
 	if err != nil {
 		return nil, err
 	}
@@ -93,6 +125,36 @@ func runSingle(opts *options, dir string) (*testjson.Execution, error) {
 		return exec, finishRun(opts, exec, err)
 	}
 	err = goTestProc.cmd.Wait()
+	// The first interrupt stops the current run, and a second interrupt
+	// stops watching.
+	if signum := atomic.LoadInt32(&goTestProc.signal); signum != 0 {
+		err := finishRun(opts, exec, interruptedError(signum))
+		if atomic.LoadInt32(&goTestProc.interrupts) > 1 {
+			return exec, errQuitWatch
+		}
+		return exec, err
+	}
+	if err == nil || opts.rerunFailsMaxAttempts == 0 {
+		return exec, finishRun(opts, exec, err)
+	}
+	if err := hasErrors(err, exec, opts, ""); err != nil {
+		return exec, finishRun(opts, exec, err)
+	}
+
+	if failed := len(rerunFailsFilter(opts, exec)(exec.Failed())); failed > opts.rerunFailsMaxInitialFailures {
+		// Not an error, which would stop watching for changes.
+		log.Warnf("not re-running failures, number of test failures (%d) exceeds maximum (%d) "+
+			"set by --rerun-fails-max-failures", failed, opts.rerunFailsMaxInitialFailures)
+		return exec, finishRun(opts, exec, err)
+	}
+
+	initialErr := err
+	cfg = testjson.ScanConfig{Execution: exec, Handler: handler}
+	err = rerunFailed(ctx, opts, cfg, initialErr)
+	if err == nil && rerunSkippedFailures(opts, exec) {
+		err = initialErr
+	}
+	handler.Flush()
 	return exec, finishRun(opts, exec, err)
 }
 
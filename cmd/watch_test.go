@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/gotestsum/internal/filewatcher"
+	"gotest.tools/gotestsum/testjson"
+	"gotest.tools/v3/assert"
+)
+
+func TestWatchRuns_RerunFailsAfterFailedRun(t *testing.T) {
+	var calls [][]string
+	fn := func(args []string) *proc {
+		calls = append(calls, args)
+		stdout := `{"Package": "./one", "Test": "TestA", "Action": "run"}
+{"Package": "./one", "Test": "TestA", "Action": "fail"}
+{"Package": "./one", "Action": "fail"}
+`
+		if len(calls) > 2 {
+			stdout = strings.Replace(stdout, "fail", "pass", -1)
+		}
+		return &proc{
+			cmd:    fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(stdout),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	w := &watchRuns{opts: options{
+		format:                       "none",
+		rerunFailsMaxInitialFailures: 10,
+		stdout:                       new(bytes.Buffer),
+		stderr:                       new(bytes.Buffer),
+		hideSummary:                  &hideSummaryValue{value: testjson.SummarizeNone},
+	}}
+
+	event := filewatcher.Event{PkgPath: "./one", PkgPaths: []string{"./one", "./two"}}
+	assert.NilError(t, w.run(event))
+	assert.Equal(t, len(calls), 1)
+	assert.DeepEqual(t, calls[0], []string{"go", "test", "-json", "./one", "./two"})
+
+	// the previous run failed, so the failures are rerun
+	assert.NilError(t, w.run(filewatcher.Event{PkgPath: "./one"}))
+	assert.Equal(t, len(calls), 3)
+	assert.DeepEqual(t, calls[2], []string{"go", "test", "-json", "-test.run=^TestA$", "-count=1", "./one"})
+}
+
+// failingRuns returns a startGoTestFn which fails the tests in every run, and
+// records the args of each run in calls.
+func failingRuns(calls *[][]string) func(args []string) *proc {
+	return func(args []string) *proc {
+		*calls = append(*calls, args)
+		return &proc{
+			cmd: fakeWaiter{result: newExitCode("failed", 1)},
+			stdout: strings.NewReader(`{"Package": "./one", "Test": "TestA", "Action": "run"}
+{"Package": "./one", "Test": "TestA", "Action": "fail"}
+{"Package": "./one", "Test": "TestB", "Action": "run"}
+{"Package": "./one", "Test": "TestB", "Action": "fail"}
+{"Package": "./one", "Action": "fail"}
+`),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+}
+
+func TestWatchRuns_NoRerunFailsWithIncompatibleArgs(t *testing.T) {
+	var calls [][]string
+	reset := patchStartGoTestFn(failingRuns(&calls))
+	defer reset()
+
+	w := &watchRuns{opts: options{
+		args:                         []string{"-failfast"},
+		format:                       "none",
+		rerunFailsMaxInitialFailures: 10,
+		stdout:                       new(bytes.Buffer),
+		stderr:                       new(bytes.Buffer),
+		hideSummary:                  &hideSummaryValue{value: testjson.SummarizeNone},
+	}}
+	for i := 0; i < 2; i++ {
+		assert.NilError(t, w.run(filewatcher.Event{PkgPath: "./one"}))
+	}
+	expected := []string{"go", "test", "-json", "-failfast", "./one"}
+	assert.DeepEqual(t, calls, [][]string{expected, expected})
+}
+
+func TestWatchRuns_RerunFailsMaxFailures(t *testing.T) {
+	var calls [][]string
+	reset := patchStartGoTestFn(failingRuns(&calls))
+	defer reset()
+
+	w := &watchRuns{opts: options{
+		format:                       "none",
+		rerunFailsMaxInitialFailures: 1,
+		stdout:                       new(bytes.Buffer),
+		stderr:                       new(bytes.Buffer),
+		hideSummary:                  &hideSummaryValue{value: testjson.SummarizeNone},
+	}}
+	for i := 0; i < 2; i++ {
+		assert.NilError(t, w.run(filewatcher.Event{PkgPath: "./one"}))
+	}
+	// the second run had 2 failures, more than --rerun-fails-max-failures
+	expected := []string{"go", "test", "-json", "./one"}
+	assert.DeepEqual(t, calls, [][]string{expected, expected})
+}
+
+func TestWatchRuns_ForwardsGoTestArgs(t *testing.T) {
+	var calls [][]string
+	fn := func(args []string) *proc {
+		calls = append(calls, args)
+		return &proc{
+			cmd:    fakeWaiter{},
+			stdout: strings.NewReader(`{"Package": "./one", "Action": "pass"}` + "\n"),
+			stderr: bytes.NewReader(nil),
+		}
+	}
+	reset := patchStartGoTestFn(fn)
+	defer reset()
+
+	w := &watchRuns{opts: options{
+		args:        []string{"-p", "2"},
+		format:      "none",
+		stdout:      new(bytes.Buffer),
+		stderr:      new(bytes.Buffer),
+		hideSummary: &hideSummaryValue{value: testjson.SummarizeNone},
+	}}
+	for i := 0; i < 2; i++ {
+		assert.NilError(t, w.run(filewatcher.Event{PkgPath: "./one"}))
+	}
+	expected := []string{"go", "test", "-json", "-p", "2", "./one"}
+	assert.DeepEqual(t, calls, [][]string{expected, expected})
+}
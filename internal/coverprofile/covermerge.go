@@ -0,0 +1,245 @@
+// Package coverprofile merges the coverage profiles written by
+// 'go test -coverprofile'.
+package coverprofile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"golang.org/x/tools/cover"
+)
+
+// ParseCoverProfile returns true and the path to the coverage profile if the
+// -coverprofile flag is one of the args. coverpkg is the value of the
+// -coverpkg flag, or an empty string if the flag is not one of the args.
+func ParseCoverProfile(args []string) (hasCoverProfile bool, profilePath string, coverpkg string) {
+	hasCoverProfile, profilePath = flagValue(args, "coverprofile")
+	_, coverpkg = flagValue(args, "coverpkg")
+	return hasCoverProfile, profilePath, coverpkg
+}
+
+// flagValue returns true and the value of the flag name if it is one of the
+// args, in either the -name value or the -name=value form.
+func flagValue(args []string, name string) (bool, string) {
+	for i, arg := range args {
+		for _, flag := range []string{"-" + name, "--" + name} {
+			switch {
+			case arg == flag && i+1 < len(args):
+				return true, args[i+1]
+			case strings.HasPrefix(arg, flag+"="):
+				return true, strings.TrimPrefix(arg, flag+"=")
+			}
+		}
+	}
+	return false, ""
+}
+
+// ProfileMode returns the cover mode (set, count, or atomic) from the header
+// of the coverage profile at path.
+func ProfileMode(path string) (string, error) {
+	fh, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer fh.Close() // nolint: errcheck // fh is opened read-only
+
+	line, err := bufio.NewReader(fh).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if !strings.HasPrefix(line, "mode: ") {
+		return "", fmt.Errorf("%v is missing the mode header", path)
+	}
+	return strings.TrimSpace(strings.TrimPrefix(line, "mode: ")), nil
+}
+
+// Combine merges profiles into the coverage profile at mainPath. The mode
+// of the profile at mainPath is preserved.
+func Combine(mainPath string, profiles []*cover.Profile) error {
+	mode, err := ProfileMode(mainPath)
+	if err != nil {
+		return err
+	}
+	return CombineWithMode(mainPath, profiles, mode)
+}
+
+// CombineWithMode merges profiles into the coverage profile at mainPath, and
+// writes mode as the header of the combined profile. All the profiles must
+// have been created with the same mode. Use ModeUpgrade to combine profiles
+// with different modes.
+func CombineWithMode(mainPath string, profiles []*cover.Profile, mode string) error {
+	main, err := cover.ParseProfiles(mainPath)
+	if err != nil {
+		return err
+	}
+	return WriteProfiles(mainPath, mode, append(main, profiles...))
+}
+
+// CombineFiles merges the coverage profiles at paths, and writes the combined
+// profile to out. All the profiles must have been created with the same mode.
+func CombineFiles(out string, paths []string) error {
+	var mode string
+	var profiles []*cover.Profile
+	for i, path := range paths {
+		pathMode, err := ProfileMode(path)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			mode = pathMode
+		} else if pathMode != mode {
+			return fmt.Errorf("can not combine %v with mode %v and %v with mode %v",
+				paths[0], mode, path, pathMode)
+		}
+		parsed, err := cover.ParseProfiles(path)
+		if err != nil {
+			return err
+		}
+		profiles = append(profiles, parsed...)
+	}
+	return WriteProfiles(out, mode, profiles)
+}
+
+// WriteProfiles merges the blocks of profiles for the same file, and writes
+// the result to path. All the profiles must use mode, see ModeUpgrade.
+func WriteProfiles(path string, mode string, profiles []*cover.Profile) error {
+	merged := make(map[string]*cover.Profile)
+	for _, p := range profiles {
+		if p.Mode != mode {
+			return fmt.Errorf("can not combine profile for %v with mode %v into a profile with mode %v",
+				p.FileName, p.Mode, mode)
+		}
+		existing, ok := merged[p.FileName]
+		if !ok {
+			merged[p.FileName] = copyProfile(p)
+			continue
+		}
+		if err := mergeBlocks(existing, p); err != nil {
+			return err
+		}
+	}
+
+	fh, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := write(fh, mode, merged); err != nil {
+		_ = fh.Close()
+		return err
+	}
+	return fh.Close()
+}
+
+func copyProfile(p *cover.Profile) *cover.Profile {
+	c := *p
+	c.Blocks = append([]cover.ProfileBlock{}, p.Blocks...)
+	return &c
+}
+
+// modeRank orders the cover modes from the least to the most strict.
+var modeRank = map[string]int{"set": 1, "count": 2, "atomic": 3}
+
+// ModeUpgrade returns copies of profiles which all use the strictest mode
+// (atomic > count > set) found in profiles, so that profiles created with
+// different modes can be combined. Blocks from a set profile are converted by
+// using a count of 1 for covered blocks, and 0 for blocks that were not
+// covered. The counts from a count profile are used as is in an atomic profile.
+func ModeUpgrade(profiles []*cover.Profile) ([]*cover.Profile, error) {
+	var mode string
+	for _, p := range profiles {
+		if _, ok := modeRank[p.Mode]; !ok {
+			return nil, fmt.Errorf("unknown cover mode %q in profile for %v", p.Mode, p.FileName)
+		}
+		if modeRank[p.Mode] > modeRank[mode] {
+			mode = p.Mode
+		}
+	}
+
+	result := make([]*cover.Profile, 0, len(profiles))
+	for _, p := range profiles {
+		c := copyProfile(p)
+		if c.Mode == "set" {
+			for i := range c.Blocks {
+				if c.Blocks[i].Count > 0 {
+					c.Blocks[i].Count = 1
+				}
+			}
+		}
+		c.Mode = mode
+		result = append(result, c)
+	}
+	return result, nil
+}
+
+type blockPosition struct {
+	StartLine, StartCol, EndLine, EndCol int
+}
+
+func mergeBlocks(into *cover.Profile, from *cover.Profile) error {
+	index := make(map[blockPosition]int, len(into.Blocks))
+	for i, b := range into.Blocks {
+		index[positionOf(b)] = i
+	}
+
+	for _, b := range from.Blocks {
+		i, ok := index[positionOf(b)]
+		if !ok {
+			into.Blocks = append(into.Blocks, b)
+			index[positionOf(b)] = len(into.Blocks) - 1
+			continue
+		}
+		if into.Blocks[i].NumStmt != b.NumStmt {
+			return fmt.Errorf("inconsistent number of statements in %v:%d.%d",
+				into.FileName, b.StartLine, b.StartCol)
+		}
+		switch into.Mode {
+		case "set":
+			if b.Count > 0 {
+				into.Blocks[i].Count = 1
+			}
+		default: // count, atomic
+			into.Blocks[i].Count += b.Count
+		}
+	}
+	return nil
+}
+
+func positionOf(b cover.ProfileBlock) blockPosition {
+	return blockPosition{
+		StartLine: b.StartLine,
+		StartCol:  b.StartCol,
+		EndLine:   b.EndLine,
+		EndCol:    b.EndCol,
+	}
+}
+
+func write(out io.Writer, mode string, profiles map[string]*cover.Profile) error {
+	buf := bufio.NewWriter(out)
+	fmt.Fprintf(buf, "mode: %s\n", mode)
+
+	names := make([]string, 0, len(profiles))
+	for name := range profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		blocks := profiles[name].Blocks
+		sort.SliceStable(blocks, func(i, j int) bool {
+			a, b := blocks[i], blocks[j]
+			if a.StartLine != b.StartLine {
+				return a.StartLine < b.StartLine
+			}
+			return a.StartCol < b.StartCol
+		})
+		for _, b := range blocks {
+			fmt.Fprintf(buf, "%s:%d.%d,%d.%d %d %d\n",
+				name, b.StartLine, b.StartCol, b.EndLine, b.EndCol, b.NumStmt, b.Count)
+		}
+	}
+	return buf.Flush()
+}
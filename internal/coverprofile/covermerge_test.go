@@ -0,0 +1,197 @@
+package coverprofile
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"golang.org/x/tools/cover"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestParseCoverProfile(t *testing.T) {
+	type testCase struct {
+		args             []string
+		expected         string
+		expectedCoverpkg string
+	}
+	testCases := map[string]testCase{
+		"no flag":       {args: []string{"-count=1", "./..."}},
+		"with equals":   {args: []string{"-coverprofile=c.out"}, expected: "c.out"},
+		"separate":      {args: []string{"-v", "-coverprofile", "c.out", "./..."}, expected: "c.out"},
+		"double dash":   {args: []string{"--coverprofile=c.out"}, expected: "c.out"},
+		"missing value": {args: []string{"-coverprofile"}},
+		"with coverpkg": {
+			args:             []string{"-coverpkg=./pkg/...", "-coverprofile", "c.out"},
+			expected:         "c.out",
+			expectedCoverpkg: "./pkg/...",
+		},
+		"coverpkg separate": {
+			args:             []string{"--coverpkg", "example.com/a,example.com/b", "./..."},
+			expectedCoverpkg: "example.com/a,example.com/b",
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ok, path, coverpkg := ParseCoverProfile(tc.args)
+			assert.Equal(t, ok, tc.expected != "")
+			assert.Equal(t, path, tc.expected)
+			assert.Equal(t, coverpkg, tc.expectedCoverpkg)
+		})
+	}
+}
+
+func TestCombine_AtomicMode(t *testing.T) {
+	main := fs.NewFile(t, t.Name(), fs.WithContent(`mode: atomic
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 0
+`))
+	rerun := parseProfiles(t, `mode: atomic
+example.com/pkg/a.go:7.10,9.2 2 3
+example.com/pkg/b.go:1.1,2.2 1 1
+`)
+
+	assert.NilError(t, Combine(main.Path(), rerun))
+
+	raw, err := ioutil.ReadFile(main.Path())
+	assert.NilError(t, err)
+	expected := `mode: atomic
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 3
+example.com/pkg/b.go:1.1,2.2 1 1
+`
+	assert.Equal(t, string(raw), expected)
+}
+
+func TestCombineWithMode_SetMode(t *testing.T) {
+	main := fs.NewFile(t, t.Name(), fs.WithContent(`mode: set
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 0
+`))
+	rerun := parseProfiles(t, `mode: set
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 1
+`)
+
+	assert.NilError(t, CombineWithMode(main.Path(), rerun, "set"))
+
+	raw, err := ioutil.ReadFile(main.Path())
+	assert.NilError(t, err)
+	expected := `mode: set
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 1
+`
+	assert.Equal(t, string(raw), expected)
+}
+
+func TestCombineWithMode_MismatchedMode(t *testing.T) {
+	main := fs.NewFile(t, t.Name(), fs.WithContent(`mode: atomic
+example.com/pkg/a.go:3.10,5.2 1 1
+`))
+	rerun := parseProfiles(t, `mode: count
+example.com/pkg/a.go:3.10,5.2 1 1
+`)
+
+	err := CombineWithMode(main.Path(), rerun, "atomic")
+	assert.ErrorContains(t, err, "with mode count into a profile with mode atomic")
+}
+
+func TestModeUpgrade(t *testing.T) {
+	profiles := parseProfiles(t, `mode: set
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 0
+`)
+	profiles = append(profiles, parseProfiles(t, `mode: count
+example.com/pkg/a.go:7.10,9.2 2 3
+example.com/pkg/b.go:1.1,2.2 1 4
+`)...)
+
+	upgraded, err := ModeUpgrade(profiles)
+	assert.NilError(t, err)
+	for _, p := range upgraded {
+		assert.Equal(t, p.Mode, "count")
+	}
+	// the original profiles are not modified
+	assert.Equal(t, profiles[0].Mode, "set")
+
+	out := fs.NewFile(t, t.Name())
+	assert.NilError(t, CombineWithMode(out.Path(), upgraded, "count"))
+
+	raw, err := ioutil.ReadFile(out.Path())
+	assert.NilError(t, err)
+	expected := `mode: count
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 3
+example.com/pkg/b.go:1.1,2.2 1 4
+`
+	assert.Equal(t, string(raw), expected)
+}
+
+func TestModeUpgrade_Atomic(t *testing.T) {
+	profiles := parseProfiles(t, `mode: count
+example.com/pkg/a.go:3.10,5.2 1 2
+`)
+	profiles = append(profiles, parseProfiles(t, `mode: atomic
+example.com/pkg/b.go:1.1,2.2 1 1
+`)...)
+	profiles = append(profiles, parseProfiles(t, `mode: set
+example.com/pkg/c.go:1.1,2.2 1 1
+`)...)
+
+	upgraded, err := ModeUpgrade(profiles)
+	assert.NilError(t, err)
+	assert.Equal(t, len(upgraded), 3)
+	for _, p := range upgraded {
+		assert.Equal(t, p.Mode, "atomic")
+	}
+	assert.Equal(t, upgraded[0].Blocks[0].Count, 2)
+}
+
+func TestModeUpgrade_UnknownMode(t *testing.T) {
+	profiles := []*cover.Profile{{FileName: "example.com/pkg/a.go", Mode: "bogus"}}
+	_, err := ModeUpgrade(profiles)
+	assert.ErrorContains(t, err, `unknown cover mode "bogus"`)
+}
+
+func parseProfiles(t *testing.T, raw string) []*cover.Profile {
+	t.Helper()
+	profiles, err := cover.ParseProfilesFromReader(strings.NewReader(raw))
+	assert.NilError(t, err)
+	return profiles
+}
+
+func TestCombineFiles(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("shard1.out", `mode: atomic
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 0
+`),
+		fs.WithFile("shard2.out", `mode: atomic
+example.com/pkg/a.go:7.10,9.2 2 3
+example.com/pkg/b.go:1.1,2.2 1 1
+`))
+
+	out := dir.Join("combined.out")
+	assert.NilError(t, CombineFiles(out, []string{dir.Join("shard1.out"), dir.Join("shard2.out")}))
+
+	raw, err := ioutil.ReadFile(out)
+	assert.NilError(t, err)
+	expected := `mode: atomic
+example.com/pkg/a.go:3.10,5.2 1 1
+example.com/pkg/a.go:7.10,9.2 2 3
+example.com/pkg/b.go:1.1,2.2 1 1
+`
+	assert.Equal(t, string(raw), expected)
+}
+
+func TestCombineFiles_MismatchedMode(t *testing.T) {
+	dir := fs.NewDir(t, t.Name(),
+		fs.WithFile("shard1.out", "mode: atomic\n"),
+		fs.WithFile("shard2.out", "mode: set\n"))
+
+	err := CombineFiles(dir.Join("combined.out"),
+		[]string{dir.Join("shard1.out"), dir.Join("shard2.out")})
+	assert.ErrorContains(t, err, "shard1.out with mode atomic and ")
+	assert.ErrorContains(t, err, "shard2.out with mode set")
+}
@@ -21,6 +21,10 @@ const maxDepth = 7
 type Event struct {
 	// PkgPath of the package that triggered the event.
 	PkgPath string
+	// PkgPaths of all the packages that triggered the event. It is set when
+	// files in more than one package changed within the debounce interval, and
+	// PkgPath is the first item.
+	PkgPaths []string
 	// Args will be appended to the command line args for 'go test'.
 	Args []string
 	// Debug runs the tests with delve.
@@ -36,8 +40,10 @@ type Event struct {
 }
 
 // Watch dirs for filesystem events, and run tests when .go files are saved.
+// Tests are run after no more files have changed for the debounce interval,
+// so that saving many files at once only runs the tests once.
 // nolint: gocyclo
-func Watch(ctx context.Context, dirs []string, run func(Event) error) error {
+func Watch(ctx context.Context, dirs []string, debounce time.Duration, run func(Event) error) error {
 	watcher, err := fsnotify.NewWatcher()
 	if err != nil {
 		return fmt.Errorf("failed to create file watcher: %w", err)
@@ -55,7 +61,8 @@ func Watch(ctx context.Context, dirs []string, run func(Event) error) error {
 	defer term.Reset()
 	go term.Monitor(ctx)
 
-	h := &fsEventHandler{last: time.Now(), fn: run}
+	h := &fsEventHandler{last: time.Now(), fn: run, debounce: debounce}
+	defer h.stopDebounce()
 	for {
 		select {
 		case <-ctx.Done():
@@ -93,6 +100,12 @@ func Watch(ctx context.Context, dirs []string, run func(Event) error) error {
 				return fmt.Errorf("failed to run tests for %v: %v", event.Name, err)
 			}
 
+		case <-h.debounced():
+			resetTimer(timer)
+			if err := h.runPending(); err != nil {
+				return fmt.Errorf("failed to run tests for %v: %v", h.lastPath, err)
+			}
+
 		case err := <-watcher.Errors:
 			return fmt.Errorf("failed while watching files: %v", err)
 		}
@@ -228,39 +241,120 @@ func handleDirCreated(watcher *fsnotify.Watcher, event fsnotify.Event) (handled
 }
 
 type fsEventHandler struct {
-	last     time.Time
-	lastPath string
-	fn       func(opts Event) error
+	last      time.Time
+	lastPath  string
+	lastPaths []string
+	fn        func(opts Event) error
+
+	// debounce is the time to wait after the last file change before running
+	// tests. Tests are run immediately when debounce is 0.
+	debounce time.Duration
+	timer    *time.Timer
+	// pending is the list of package paths with changes that have not been
+	// tested yet.
+	pending []string
 }
 
 var floodThreshold = 250 * time.Millisecond
 
 func (h *fsEventHandler) handleEvent(event fsnotify.Event) error {
 	if event.Op&(fsnotify.Write|fsnotify.Create|fsnotify.Rename) == 0 {
+		log.Debugf("ignoring event %v, operation is not write, create, or rename", event)
 		return nil
 	}
 
 	if !strings.HasSuffix(event.Name, ".go") {
+		log.Debugf("ignoring event %v, not a .go file", event)
 		return nil
 	}
 
-	if time.Since(h.last) < floodThreshold {
-		log.Debugf("skipping event received less than %v after the previous", floodThreshold)
+	pkgPath := "./" + filepath.Dir(event.Name)
+	if h.debounce <= 0 {
+		if time.Since(h.last) < floodThreshold {
+			log.Debugf("skipping event received less than %v after the previous", floodThreshold)
+			return nil
+		}
+		log.Debugf("running tests for event %v", event)
+		return h.runTests(Event{PkgPath: pkgPath})
+	}
+
+	// Changes made while the tests are running are received once the run
+	// ends. They are added to pending, so that all of them are tested by
+	// a single run after the debounce interval.
+	log.Debugf("debouncing event %v for %v", event, h.debounce)
+	if !containsString(h.pending, pkgPath) {
+		h.pending = append(h.pending, pkgPath)
+	}
+	h.resetDebounce()
+	return nil
+}
+
+// debounced returns a channel that receives when the debounce interval has
+// elapsed since the last file change.
+func (h *fsEventHandler) debounced() <-chan time.Time {
+	if h.timer == nil {
+		return nil
+	}
+	return h.timer.C
+}
+
+func (h *fsEventHandler) resetDebounce() {
+	if h.timer == nil {
+		h.timer = time.NewTimer(h.debounce)
+		return
+	}
+	h.stopDebounce()
+	h.timer.Reset(h.debounce)
+}
+
+func (h *fsEventHandler) stopDebounce() {
+	if h.timer != nil && !h.timer.Stop() {
+		select {
+		case <-h.timer.C:
+		default:
+		}
+	}
+}
+
+// runPending runs the tests for all the packages that changed since the last
+// run.
+func (h *fsEventHandler) runPending() error {
+	if len(h.pending) == 0 {
 		return nil
 	}
-	return h.runTests(Event{PkgPath: "./" + filepath.Dir(event.Name)})
+	event := Event{PkgPath: h.pending[0]}
+	if len(h.pending) > 1 {
+		event.PkgPaths = h.pending
+	}
+	h.pending = nil
+	return h.runTests(event)
+}
+
+func containsString(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+	return false
 }
 
 func (h *fsEventHandler) runTests(opts Event) error {
 	if opts.useLastPath {
 		opts.PkgPath = h.lastPath
+		opts.PkgPaths = h.lastPaths
+	}
+	if len(opts.PkgPaths) > 0 {
+		fmt.Printf("\nRunning tests in %v\n", strings.Join(opts.PkgPaths, " "))
+	} else {
+		fmt.Printf("\nRunning tests in %v\n", opts.PkgPath)
 	}
-	fmt.Printf("\nRunning tests in %v\n", opts.PkgPath)
 
 	if err := h.fn(opts); err != nil {
 		return err
 	}
 	h.last = time.Now()
 	h.lastPath = opts.PkgPath
+	h.lastPaths = opts.PkgPaths
 	return nil
 }
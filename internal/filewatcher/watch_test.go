@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/fsnotify/fsnotify"
+	"github.com/google/go-cmp/cmp"
 	"gotest.tools/v3/assert"
 	"gotest.tools/v3/env"
 	"gotest.tools/v3/fs"
@@ -82,6 +83,61 @@ func TestFSEventHandler_HandleEvent(t *testing.T) {
 	}
 }
 
+func TestFSEventHandler_HandleEvent_WithDebounce(t *testing.T) {
+	var events []Event
+	run := func(opts Event) error {
+		events = append(events, opts)
+		return nil
+	}
+
+	h := fsEventHandler{fn: run, debounce: time.Millisecond}
+	defer h.stopDebounce()
+	for _, name := range []string{"one/a.go", "two/b.go", "one/c.go"} {
+		err := h.handleEvent(fsnotify.Event{Op: fsnotify.Write, Name: name})
+		assert.NilError(t, err)
+	}
+	assert.Equal(t, len(events), 0)
+
+	<-h.debounced()
+	assert.NilError(t, h.runPending())
+	expected := []Event{{PkgPath: "./one", PkgPaths: []string{"./one", "./two"}}}
+	assert.DeepEqual(t, events, expected, cmpEventFields)
+	assert.Equal(t, len(h.pending), 0)
+}
+
+func TestFSEventHandler_HandleEvent_ChangesDuringRun(t *testing.T) {
+	var events []Event
+	run := func(opts Event) error {
+		events = append(events, opts)
+		return nil
+	}
+	h := fsEventHandler{fn: run, debounce: time.Millisecond}
+	defer h.stopDebounce()
+
+	assert.NilError(t, h.handleEvent(fsnotify.Event{Op: fsnotify.Write, Name: "one/a.go"}))
+	<-h.debounced()
+	assert.NilError(t, h.runPending())
+	assert.Equal(t, len(events), 1)
+
+	// The events for files saved while the tests were running are received
+	// right after the run ends.
+	for _, name := range []string{"one/a.go", "two/b.go", "one/a.go"} {
+		assert.NilError(t, h.handleEvent(fsnotify.Event{Op: fsnotify.Write, Name: name}))
+	}
+	<-h.debounced()
+	assert.NilError(t, h.runPending())
+	assert.NilError(t, h.runPending())
+
+	// the changes are tested by exactly one run
+	expected := []Event{
+		{PkgPath: "./one"},
+		{PkgPath: "./one", PkgPaths: []string{"./one", "./two"}},
+	}
+	assert.DeepEqual(t, events, expected, cmpEventFields)
+}
+
+var cmpEventFields = cmp.AllowUnexported(Event{})
+
 func TestHasGoFiles(t *testing.T) {
 	t.Run("none", func(t *testing.T) {
 		tmpDir := fs.NewDir(t, t.Name(), fs.WithFile("readme.md", ""))
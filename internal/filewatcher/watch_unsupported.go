@@ -4,15 +4,19 @@
 package filewatcher
 
 import (
+	"context"
 	"fmt"
 	"runtime"
+	"time"
 )
 
 type Event struct {
-	PkgPath string
-	Debug   bool
+	PkgPath  string
+	PkgPaths []string
+	Args     []string
+	Debug    bool
 }
 
-func Watch(dirs []string, run func(Event) error) error {
+func Watch(ctx context.Context, dirs []string, debounce time.Duration, run func(Event) error) error {
 	return fmt.Errorf("file watching is not supported on %v/%v", runtime.GOOS, runtime.GOARCH)
 }
@@ -0,0 +1,39 @@
+package junitxml
+
+import (
+	"os"
+	"strconv"
+)
+
+// defaultBazelName is the name of the testsuites element when the TEST_TARGET
+// environment variable is not set by Bazel, and there is no project name.
+const defaultBazelName = "gotestsum"
+
+// withBazelSchema changes suites to match the schema of the XML_OUTPUT_FILE
+// that is read by Bazel. Bazel requires a name for the testsuites element,
+// and an errors attribute on every testsuite. The status attribute of each
+// testcase is "run", or "notrun" for a skipped test.
+func withBazelSchema(suites *JUnitTestSuites) {
+	if suites.Name == "" {
+		suites.Name = os.Getenv("TEST_TARGET")
+	}
+	if suites.Name == "" {
+		suites.Name = defaultBazelName
+	}
+	for i := range suites.Suites {
+		suite := &suites.Suites[i]
+		var errors int
+		for j := range suite.TestCases {
+			tc := &suite.TestCases[j]
+			tc.Status = "run"
+			if tc.SkipMessage != nil {
+				tc.Status = "notrun"
+			}
+			// A TestMain failure is reported as an error, not a test failure.
+			if tc.Name == "TestMain" && tc.Failure != nil {
+				errors++
+			}
+		}
+		suite.Errors = strconv.Itoa(errors)
+	}
+}
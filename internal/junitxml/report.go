@@ -11,6 +11,7 @@ import (
 	"os/exec"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"gotest.tools/gotestsum/internal/log"
 	"gotest.tools/gotestsum/testjson"
@@ -18,13 +19,20 @@ import (
 
 // JUnitTestSuites is a collection of JUnit test suites.
 type JUnitTestSuites struct {
-	XMLName  xml.Name `xml:"testsuites"`
-	Name     string   `xml:"name,attr,omitempty"`
-	Tests    int      `xml:"tests,attr"`
-	Failures int      `xml:"failures,attr"`
-	Errors   int      `xml:"errors,attr"`
-	Time     string   `xml:"time,attr"`
-	Suites   []JUnitTestSuite
+	XMLName    xml.Name         `xml:"testsuites"`
+	Name       string           `xml:"name,attr,omitempty"`
+	Tests      int              `xml:"tests,attr"`
+	Failures   int              `xml:"failures,attr"`
+	Errors     int              `xml:"errors,attr"`
+	Time       string           `xml:"time,attr"`
+	Properties *JUnitProperties `xml:"properties,omitempty"`
+	Suites     []JUnitTestSuite
+}
+
+// JUnitProperties is a list of properties. It is a separate type so that the
+// properties element is omitted when there are no properties.
+type JUnitProperties struct {
+	Property []JUnitProperty `xml:"property"`
 }
 
 // JUnitTestSuite is a single JUnit test suite which may contain many
@@ -33,6 +41,7 @@ type JUnitTestSuite struct {
 	XMLName    xml.Name        `xml:"testsuite"`
 	Tests      int             `xml:"tests,attr"`
 	Failures   int             `xml:"failures,attr"`
+	Errors     string          `xml:"errors,attr,omitempty"`
 	Time       string          `xml:"time,attr"`
 	Name       string          `xml:"name,attr"`
 	Properties []JUnitProperty `xml:"properties>property,omitempty"`
@@ -46,6 +55,7 @@ type JUnitTestCase struct {
 	Classname   string            `xml:"classname,attr"`
 	Name        string            `xml:"name,attr"`
 	Time        string            `xml:"time,attr"`
+	Status      string            `xml:"status,attr,omitempty"`
 	SkipMessage *JUnitSkipMessage `xml:"skipped,omitempty"`
 	Failure     *JUnitFailure     `xml:"failure,omitempty"`
 }
@@ -74,6 +84,29 @@ type Config struct {
 	FormatTestSuiteName     FormatFunc
 	FormatTestCaseClassname FormatFunc
 	HideEmptyPackages       bool
+	// CachedPackages is a list of packages which were not tested because
+	// they passed in a previous run, and have not changed since. Each package
+	// is written as an empty testsuite with a gotestsum.result property.
+	CachedPackages []string
+	// TestCaseTime selects the elapsed time used for the time attribute of a
+	// testcase that was run more than once. The default uses the elapsed time
+	// of each individual run.
+	TestCaseTime TestCaseTime
+	// Properties are written to the testsuites element. They are used to
+	// record metadata about the run, like the git commit or branch.
+	Properties []JUnitProperty
+	// MaxOutputBytes limits the size of the output written for each testcase.
+	// Output longer than the limit is truncated by removing the middle of the
+	// output, so that both the start and the end are preserved. A value of 0
+	// means no limit.
+	MaxOutputBytes int
+	// MaxFailuresOutput limits the number of failed testcases that include
+	// the test output. Any other failed testcases are written without output.
+	// A value of 0 means no limit.
+	MaxFailuresOutput int
+	// Bazel writes the document with the changes to the schema required by
+	// Bazel for the XML_OUTPUT_FILE. See withBazelSchema.
+	Bazel bool
 	// This is used for tests to have a consistent timestamp
 	customTimestamp string
 	customElapsed   string
@@ -82,6 +115,21 @@ type Config struct {
 // FormatFunc converts a string from one format into another.
 type FormatFunc func(string) string
 
+// TestCaseTime enumerates the ways the time of a testcase can be calculated
+// when the test was run more than once (ex: by --rerun-fails).
+type TestCaseTime string
+
+const (
+	// TestCaseTimeEachRun uses the elapsed time of each run.
+	TestCaseTimeEachRun TestCaseTime = ""
+	// TestCaseTimeFirst uses the elapsed time of the first run.
+	TestCaseTimeFirst TestCaseTime = "first"
+	// TestCaseTimeLast uses the elapsed time of the last run.
+	TestCaseTimeLast TestCaseTime = "last"
+	// TestCaseTimeSum uses the sum of the elapsed time of all runs.
+	TestCaseTimeSum TestCaseTime = "sum"
+)
+
 // Write creates an XML document and writes it to out.
 func Write(out io.Writer, exec *testjson.Execution, cfg Config) error {
 	if err := write(out, generate(exec, cfg)); err != nil {
@@ -100,22 +148,27 @@ func generate(exec *testjson.Execution, cfg Config) JUnitTestSuites {
 		Errors:   len(exec.Errors()),
 		Time:     formatDurationAsSeconds(time.Since(exec.Started())),
 	}
+	if len(cfg.Properties) > 0 {
+		suites.Properties = &JUnitProperties{Property: cfg.Properties}
+	}
 
 	if cfg.customElapsed != "" {
 		suites.Time = cfg.customElapsed
 	}
+	limit := &failureOutputLimit{max: cfg.MaxFailuresOutput}
 	for _, pkgname := range exec.Packages() {
 		pkg := exec.Package(pkgname)
 		if cfg.HideEmptyPackages && pkg.IsEmpty() {
 			continue
 		}
+		metrics := pkg.Metrics()
 		junitpkg := JUnitTestSuite{
 			Name:       cfg.FormatTestSuiteName(pkgname),
-			Tests:      pkg.Total,
-			Time:       formatDurationAsSeconds(pkg.Elapsed()),
-			Properties: packageProperties(version),
-			TestCases:  packageTestCases(pkg, cfg.FormatTestCaseClassname),
-			Failures:   len(pkg.Failed),
+			Tests:      metrics.TotalTests,
+			Time:       formatDurationAsSeconds(metrics.Elapsed),
+			Properties: packageProperties(version, pkg),
+			TestCases:  packageTestCases(pkg, cfg, limit),
+			Failures:   metrics.Failed,
 			Timestamp:  cfg.customTimestamp,
 		}
 		if cfg.customTimestamp == "" {
@@ -123,6 +176,25 @@ func generate(exec *testjson.Execution, cfg Config) JUnitTestSuites {
 		}
 		suites.Suites = append(suites.Suites, junitpkg)
 	}
+	for _, pkgname := range cfg.CachedPackages {
+		junitpkg := JUnitTestSuite{
+			Name: cfg.FormatTestSuiteName(pkgname),
+			Time: formatDurationAsSeconds(0),
+			Properties: []JUnitProperty{
+				{Name: "go.version", Value: version},
+				{Name: "gotestsum.result", Value: "cached pass"},
+			},
+			TestCases: []JUnitTestCase{},
+			Timestamp: cfg.customTimestamp,
+		}
+		if cfg.customTimestamp == "" {
+			junitpkg.Timestamp = exec.Started().Format(time.RFC3339)
+		}
+		suites.Suites = append(suites.Suites, junitpkg)
+	}
+	if cfg.Bazel {
+		withBazelSchema(&suites)
+	}
 	return suites
 }
 
@@ -143,10 +215,14 @@ func formatDurationAsSeconds(d time.Duration) string {
 	return fmt.Sprintf("%f", d.Seconds())
 }
 
-func packageProperties(goVersion string) []JUnitProperty {
-	return []JUnitProperty{
+func packageProperties(goVersion string, pkg *testjson.Package) []JUnitProperty {
+	properties := []JUnitProperty{
 		{Name: "go.version", Value: goVersion},
 	}
+	if seed := pkg.ShuffleSeed(); seed != "" {
+		properties = append(properties, JUnitProperty{Name: "go.test.shuffle", Value: seed})
+	}
+	return properties
 }
 
 // goVersion returns the version as reported by the go binary in PATH. This
@@ -169,50 +245,154 @@ func goVersion() string {
 	return strings.TrimPrefix(strings.TrimSpace(string(out)), "go version ")
 }
 
-func packageTestCases(pkg *testjson.Package, formatClassname FormatFunc) []JUnitTestCase {
+// failureOutputLimit counts the failed testcases written with output, to
+// apply Config.MaxFailuresOutput across all packages.
+type failureOutputLimit struct {
+	max   int
+	count int
+}
+
+// contents returns the output of a failure, or an empty string if the limit
+// was reached.
+func (l *failureOutputLimit) contents(output string) string {
+	if l.max <= 0 {
+		return output
+	}
+	l.count++
+	if l.count > l.max {
+		return ""
+	}
+	return output
+}
+
+func packageTestCases(pkg *testjson.Package, cfg Config, limit *failureOutputLimit) []JUnitTestCase {
 	cases := []JUnitTestCase{}
+	formatClassname := cfg.FormatTestCaseClassname
+	elapsed := testCaseElapsed(pkg, cfg.TestCaseTime)
 
 	if pkg.TestMainFailed() {
 		var buf bytes.Buffer
 		pkg.WriteOutputTo(&buf, 0) //nolint:errcheck
-		jtc := newJUnitTestCase(testjson.TestCase{Test: "TestMain"}, formatClassname)
+		jtc := newJUnitTestCase(testjson.TestCase{Test: "TestMain"}, formatClassname, nil)
 		jtc.Failure = &JUnitFailure{
 			Message:  "Failed",
-			Contents: buf.String(),
+			Contents: truncateOutput(limit.contents(buf.String()), cfg.MaxOutputBytes),
 		}
 		cases = append(cases, jtc)
 	}
 
 	for _, tc := range pkg.Failed {
-		jtc := newJUnitTestCase(tc, formatClassname)
+		jtc := newJUnitTestCase(tc, formatClassname, elapsed)
 		jtc.Failure = &JUnitFailure{
 			Message:  "Failed",
-			Contents: strings.Join(pkg.OutputLines(tc), ""),
+			Contents: truncateOutput(limit.contents(strings.Join(pkg.OutputLines(tc), "")), cfg.MaxOutputBytes),
 		}
 		cases = append(cases, jtc)
 	}
 
 	for _, tc := range pkg.Skipped {
-		jtc := newJUnitTestCase(tc, formatClassname)
+		jtc := newJUnitTestCase(tc, formatClassname, elapsed)
 		jtc.SkipMessage = &JUnitSkipMessage{
-			Message: strings.Join(pkg.OutputLines(tc), ""),
+			Message: truncateOutput(strings.Join(pkg.OutputLines(tc), ""), cfg.MaxOutputBytes),
 		}
 		cases = append(cases, jtc)
 	}
 
 	for _, tc := range pkg.Passed {
-		jtc := newJUnitTestCase(tc, formatClassname)
+		jtc := newJUnitTestCase(tc, formatClassname, elapsed)
 		cases = append(cases, jtc)
 	}
 	return cases
 }
 
-func newJUnitTestCase(tc testjson.TestCase, formatClassname FormatFunc) JUnitTestCase {
+const truncatedMarker = "\n... [truncated]\n"
+
+// truncateOutput returns output unchanged if it is at most max bytes.
+// Otherwise the middle of the output is replaced by a marker, keeping max
+// bytes from the head and tail of the output.
+func truncateOutput(output string, max int) string {
+	if max <= 0 || len(output) <= max {
+		return output
+	}
+	head := max / 2
+	tail := len(output) - (max - head)
+	// avoid splitting a multi-byte character
+	for head > 0 && !utf8.RuneStart(output[head]) {
+		head--
+	}
+	for tail < len(output) && !utf8.RuneStart(output[tail]) {
+		tail++
+	}
+	return output[:head] + truncatedMarker + output[tail:]
+}
+
+func newJUnitTestCase(
+	tc testjson.TestCase,
+	formatClassname FormatFunc,
+	elapsed map[testjson.TestName]time.Duration,
+) JUnitTestCase {
+	d, ok := elapsed[tc.Test]
+	if !ok {
+		d = tc.Elapsed
+	}
 	return JUnitTestCase{
 		Classname: formatClassname(tc.Package),
 		Name:      tc.Test.Name(),
-		Time:      formatDurationAsSeconds(tc.Elapsed),
+		Time:      formatDurationAsSeconds(d),
+	}
+}
+
+// testCaseElapsed returns the elapsed time to use for every test in the
+// package, calculated from all the runs of the test. Returns nil when
+// each run should use its own elapsed time.
+func testCaseElapsed(pkg *testjson.Package, mode TestCaseTime) map[testjson.TestName]time.Duration {
+	if mode == TestCaseTimeEachRun {
+		return nil
+	}
+
+	type run struct {
+		first, last testjson.TestCase
+		sum         time.Duration
+	}
+	runs := make(map[testjson.TestName]*run)
+	for _, tc := range pkg.TestCases() {
+		elapsed := tc.Elapsed
+		if elapsed < 0 { // the test never finished
+			elapsed = 0
+		}
+		r, ok := runs[tc.Test]
+		if !ok {
+			runs[tc.Test] = &run{first: tc, last: tc, sum: elapsed}
+			continue
+		}
+		if isEarlierRun(tc, r.first) {
+			r.first = tc
+		}
+		if isEarlierRun(r.last, tc) {
+			r.last = tc
+		}
+		r.sum += elapsed
+	}
+
+	result := make(map[testjson.TestName]time.Duration, len(runs))
+	for name, r := range runs {
+		switch mode {
+		case TestCaseTimeFirst:
+			result[name] = r.first.Elapsed
+		case TestCaseTimeLast:
+			result[name] = r.last.Elapsed
+		case TestCaseTimeSum:
+			result[name] = r.sum
+		}
+	}
+	return result
+}
+
+func isEarlierRun(a, b testjson.TestCase) bool {
+	if a.RunID != b.RunID {
+		return a.RunID < b.RunID
 	}
+	return a.ID < b.ID
 }
 
 func write(out io.Writer, suites JUnitTestSuites) error {
@@ -6,6 +6,7 @@ import (
 	"io"
 	"io/ioutil"
 	"runtime"
+	"strings"
 	"testing"
 	"time"
 
@@ -29,6 +30,21 @@ func TestWrite(t *testing.T) {
 	golden.Assert(t, out.String(), "junitxml-report.golden")
 }
 
+func TestWrite_Bazel(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec := createExecution(t)
+
+	env.Patch(t, "GOVERSION", "go7.7.7")
+	env.Patch(t, "TEST_TARGET", "//pkg:go_test")
+	err := Write(out, exec, Config{
+		Bazel:           true,
+		customTimestamp: new(time.Time).Format(time.RFC3339),
+		customElapsed:   "2.1",
+	})
+	assert.NilError(t, err)
+	golden.Assert(t, out.String(), "junitxml-report-bazel.golden")
+}
+
 func TestWrite_HideEmptyPackages(t *testing.T) {
 	out := new(bytes.Buffer)
 	exec := createExecution(t)
@@ -44,17 +60,205 @@ func TestWrite_HideEmptyPackages(t *testing.T) {
 	golden.Assert(t, out.String(), "junitxml-report-skip-empty.golden")
 }
 
+func TestWrite_WithShuffle(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
+		Stdout: readTestData(t, "go-test-json-with-shuffle", "out"),
+		Stderr: readTestData(t, "go-test-json-with-shuffle", "err"),
+	})
+	assert.NilError(t, err)
+
+	env.Patch(t, "GOVERSION", "go7.7.7")
+	err = Write(out, exec, Config{
+		ProjectName:     "test",
+		customTimestamp: new(time.Time).Format(time.RFC3339),
+		customElapsed:   "2.1",
+	})
+	assert.NilError(t, err)
+	golden.Assert(t, out.String(), "junitxml-report-shuffle.golden")
+}
+
+func TestWrite_CachedPackages(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec := createExecution(t)
+
+	env.Patch(t, "GOVERSION", "go7.7.7")
+	err := Write(out, exec, Config{
+		ProjectName:       "test",
+		HideEmptyPackages: true,
+		CachedPackages:    []string{"example.com/cached"},
+		customTimestamp:   new(time.Time).Format(time.RFC3339),
+		customElapsed:     "2.1",
+	})
+	assert.NilError(t, err)
+	golden.Assert(t, out.String(), "junitxml-report-cached-packages.golden")
+}
+
+func TestWrite_WithProperties(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec := createExecution(t)
+
+	env.Patch(t, "GOVERSION", "go7.7.7")
+	err := Write(out, exec, Config{
+		ProjectName:       "test",
+		HideEmptyPackages: true,
+		Properties: []JUnitProperty{
+			{Name: "git.sha", Value: "abc123"},
+			{Name: "git.branch", Value: "main"},
+		},
+		customTimestamp: new(time.Time).Format(time.RFC3339),
+		customElapsed:   "2.1",
+	})
+	assert.NilError(t, err)
+	golden.Assert(t, out.String(), "junitxml-report-properties.golden")
+}
+
+func TestGenerate_MaxFailuresOutput(t *testing.T) {
+	exec := createExecution(t)
+	env.Patch(t, "GOVERSION", "go7.7.7")
+
+	suites := generate(exec, Config{MaxFailuresOutput: 2})
+	var failures, withOutput int
+	for _, suite := range suites.Suites {
+		for _, tc := range suite.TestCases {
+			if tc.Failure == nil {
+				continue
+			}
+			failures++
+			if tc.Failure.Contents != "" {
+				withOutput++
+			}
+		}
+	}
+	assert.Assert(t, failures > 2, "expected more than 2 failures, got %d", failures)
+	assert.Equal(t, withOutput, 2)
+}
+
+func TestTruncateOutput(t *testing.T) {
+	type testCase struct {
+		name     string
+		output   string
+		max      int
+		expected string
+	}
+	run := func(t *testing.T, tc testCase) {
+		assert.Equal(t, truncateOutput(tc.output, tc.max), tc.expected)
+	}
+	testCases := []testCase{
+		{
+			name:     "no limit",
+			output:   "first line\nlast line\n",
+			expected: "first line\nlast line\n",
+		},
+		{
+			name:     "shorter than limit",
+			output:   "first line\nlast line\n",
+			max:      100,
+			expected: "first line\nlast line\n",
+		},
+		{
+			name:     "keeps head and tail",
+			output:   "first line\nmiddle\nlast line\n",
+			max:      20,
+			expected: "first line" + truncatedMarker + "last line\n",
+		},
+		{
+			name:     "does not split multi-byte characters",
+			output:   "ab\u00e9cdefgh\u00e9ij",
+			max:      6,
+			expected: "ab" + truncatedMarker + "ij",
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestWrite_TestCaseTime(t *testing.T) {
+	exec := createExecutionWithReruns(t)
+	env.Patch(t, "GOVERSION", "go7.7.7")
+
+	for _, mode := range []TestCaseTime{TestCaseTimeFirst, TestCaseTimeLast, TestCaseTimeSum} {
+		t.Run(string(mode), func(t *testing.T) {
+			out := new(bytes.Buffer)
+			err := Write(out, exec, Config{
+				ProjectName:     "test",
+				TestCaseTime:    mode,
+				customTimestamp: new(time.Time).Format(time.RFC3339),
+				customElapsed:   "2.1",
+			})
+			assert.NilError(t, err)
+			golden.Assert(t, out.String(), "junitxml-report-time-"+string(mode)+".golden")
+		})
+	}
+}
+
+func TestWrite_NormalizesPackagePath(t *testing.T) {
+	in := `{"Package": "example.com\\pkg\\sub", "Test": "TestOne", "Action": "run"}
+{"Package": "example.com\\pkg\\sub", "Test": "TestOne", "Action": "fail"}
+{"Package": "example.com\\pkg\\sub", "Action": "fail"}
+`
+	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{Stdout: strings.NewReader(in)})
+	assert.NilError(t, err)
+
+	out := new(bytes.Buffer)
+	env.Patch(t, "GOVERSION", "go7.7.7")
+	err = Write(out, exec, Config{
+		FormatTestCaseClassname: testjson.RelativePackagePath,
+		FormatTestSuiteName:     testjson.RelativePackagePath,
+	})
+	assert.NilError(t, err)
+	assert.Assert(t, !strings.Contains(out.String(), `\`), out.String())
+	assert.Assert(t, strings.Contains(out.String(), `classname="example.com/pkg/sub"`), out.String())
+}
+
+func createExecutionWithReruns(t *testing.T) *testjson.Execution {
+	t.Helper()
+	runs := []string{
+		`{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestFlaky", "Action": "run"}
+{"Package": "pkg", "Test": "TestFlaky", "Action": "fail", "Elapsed": 1.5}
+{"Package": "pkg", "Test": "TestStable", "Action": "run"}
+{"Package": "pkg", "Test": "TestStable", "Action": "pass", "Elapsed": 0.2}
+{"Package": "pkg", "Action": "fail", "Elapsed": 2}
+`,
+		`{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestFlaky", "Action": "run"}
+{"Package": "pkg", "Test": "TestFlaky", "Action": "fail", "Elapsed": 2.25}
+{"Package": "pkg", "Action": "fail", "Elapsed": 3}
+`,
+		`{"Package": "pkg", "Action": "run"}
+{"Package": "pkg", "Test": "TestFlaky", "Action": "run"}
+{"Package": "pkg", "Test": "TestFlaky", "Action": "pass", "Elapsed": 0.5}
+{"Package": "pkg", "Action": "pass", "Elapsed": 1}
+`,
+	}
+	var exec *testjson.Execution
+	for i, run := range runs {
+		var err error
+		exec, err = testjson.ScanTestOutput(testjson.ScanConfig{
+			RunID:     i,
+			Stdout:    strings.NewReader(run),
+			Execution: exec,
+		})
+		assert.NilError(t, err)
+	}
+	return exec
+}
+
 func createExecution(t *testing.T) *testjson.Execution {
 	exec, err := testjson.ScanTestOutput(testjson.ScanConfig{
-		Stdout: readTestData(t, "out"),
-		Stderr: readTestData(t, "err"),
+		Stdout: readTestData(t, "go-test-json", "out"),
+		Stderr: readTestData(t, "go-test-json", "err"),
 	})
 	assert.NilError(t, err)
 	return exec
 }
 
-func readTestData(t *testing.T, stream string) io.Reader {
-	raw, err := ioutil.ReadFile("../../testjson/testdata/input/go-test-json." + stream)
+func readTestData(t *testing.T, name string, stream string) io.Reader {
+	raw, err := ioutil.ReadFile("../../testjson/testdata/input/" + name + "." + stream)
 	assert.NilError(t, err)
 	return bytes.NewReader(raw)
 }
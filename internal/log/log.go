@@ -1,7 +1,11 @@
 package log
 
 import (
+	"encoding/json"
 	"fmt"
+	"io"
+	"strings"
+	"time"
 
 	"github.com/fatih/color"
 )
@@ -15,9 +19,43 @@ const (
 	DebugLevel
 )
 
+var levelNames = map[Level]string{
+	ErrorLevel: "error",
+	WarnLevel:  "warn",
+	InfoLevel:  "info",
+	DebugLevel: "debug",
+}
+
+func (l Level) String() string {
+	return levelNames[l]
+}
+
+// ParseLevel returns the Level with the name s.
+func ParseLevel(s string) (Level, error) {
+	for l, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid log level %q, must be one of: debug, info, warn, error", s)
+}
+
+// Format of the log messages.
+type Format string
+
+const (
+	// TextFormat prints each message on a line, with a prefix for warnings and
+	// errors.
+	TextFormat Format = "text"
+	// JSONFormat prints each message as a JSON object on a line.
+	JSONFormat Format = "json"
+)
+
 var (
-	level = WarnLevel
-	out   = color.Error
+	level  = WarnLevel
+	format = TextFormat
+	out    = color.Error
+	now    = time.Now
 )
 
 // SetLevel for the global logger.
@@ -25,49 +63,70 @@ func SetLevel(l Level) {
 	level = l
 }
 
+// SetFormat for the global logger.
+func SetFormat(f Format) {
+	format = f
+}
+
+// SetOutput sets the writer used by the global logger. The default is stderr.
+func SetOutput(w io.Writer) {
+	out = w
+}
+
 // Warnf prints the message to stderr, with a yellow WARN prefix.
 func Warnf(format string, args ...interface{}) {
-	if level < WarnLevel {
-		return
-	}
-	fmt.Fprint(out, color.YellowString("WARN "))
-	fmt.Fprintf(out, format, args...)
-	fmt.Fprint(out, "\n")
+	logf(WarnLevel, color.YellowString("WARN "), format, args...)
 }
 
 // Debugf prints the message to stderr, with no prefix.
 func Debugf(format string, args ...interface{}) {
-	if level < DebugLevel {
-		return
-	}
-	fmt.Fprintf(out, format, args...)
-	fmt.Fprint(out, "\n")
+	logf(DebugLevel, "", format, args...)
 }
 
 // Infof prints the message to stderr, with no prefix.
 func Infof(format string, args ...interface{}) {
-	if level < InfoLevel {
-		return
-	}
-	fmt.Fprintf(out, format, args...)
-	fmt.Fprint(out, "\n")
+	logf(InfoLevel, "", format, args...)
 }
 
 // Errorf prints the message to stderr, with a red ERROR prefix.
 func Errorf(format string, args ...interface{}) {
-	if level < ErrorLevel {
+	logf(ErrorLevel, color.RedString("ERROR "), format, args...)
+}
+
+// Error prints the message to stderr, with a red ERROR prefix.
+func Error(msg string) {
+	logf(ErrorLevel, color.RedString("ERROR "), "%s", msg)
+}
+
+func logf(l Level, prefix string, msgFormat string, args ...interface{}) {
+	if level < l {
+		return
+	}
+	msg := fmt.Sprintf(msgFormat, args...)
+	if format == JSONFormat {
+		writeJSON(l, msg)
 		return
 	}
-	fmt.Fprint(out, color.RedString("ERROR "))
-	fmt.Fprintf(out, format, args...)
+	fmt.Fprint(out, prefix)
+	fmt.Fprint(out, msg)
 	fmt.Fprint(out, "\n")
 }
 
-// Error prints the message to stderr, with a red ERROR prefix.
-func Error(msg string) {
-	if level < ErrorLevel {
+type jsonMessage struct {
+	Time  string `json:"time"`
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+func writeJSON(l Level, msg string) {
+	raw, err := json.Marshal(jsonMessage{
+		Time:  now().Format(time.RFC3339Nano),
+		Level: l.String(),
+		Msg:   strings.TrimRight(msg, "\n"),
+	})
+	if err != nil {
+		fmt.Fprintln(out, msg)
 		return
 	}
-	fmt.Fprint(out, color.RedString("ERROR "))
-	fmt.Fprintln(out, msg)
+	fmt.Fprintf(out, "%s\n", raw)
 }
@@ -0,0 +1,61 @@
+package log
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/fatih/color"
+	"gotest.tools/v3/assert"
+)
+
+func patchLogger(t *testing.T, l Level, f Format) *bytes.Buffer {
+	t.Helper()
+	origLevel, origFormat, origOut, origNow, origNoColor := level, format, out, now, color.NoColor
+	t.Cleanup(func() {
+		level, format, out, now, color.NoColor = origLevel, origFormat, origOut, origNow, origNoColor
+	})
+
+	buf := new(bytes.Buffer)
+	SetLevel(l)
+	SetFormat(f)
+	SetOutput(buf)
+	now = func() time.Time {
+		return time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+	}
+	color.NoColor = true
+	return buf
+}
+
+func TestLogf_TextFormat(t *testing.T) {
+	buf := patchLogger(t, InfoLevel, TextFormat)
+
+	Debugf("not %v", "printed")
+	Infof("info %v", 1)
+	Warnf("warn %v", 2)
+	Error("error 3")
+
+	expected := "info 1\nWARN warn 2\nERROR error 3\n"
+	assert.Equal(t, buf.String(), expected)
+}
+
+func TestLogf_JSONFormat(t *testing.T) {
+	buf := patchLogger(t, DebugLevel, JSONFormat)
+
+	Debugf("exec: %v", []string{"go", "test"})
+	Warnf("warn %v", 2)
+
+	expected := `{"time":"2022-01-02T03:04:05Z","level":"debug","msg":"exec: [go test]"}
+{"time":"2022-01-02T03:04:05Z","level":"warn","msg":"warn 2"}
+`
+	assert.Equal(t, buf.String(), expected)
+}
+
+func TestParseLevel(t *testing.T) {
+	l, err := ParseLevel("DEBUG")
+	assert.NilError(t, err)
+	assert.Equal(t, l, DebugLevel)
+
+	_, err = ParseLevel("verbose")
+	assert.ErrorContains(t, err, `invalid log level "verbose"`)
+}
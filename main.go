@@ -5,6 +5,8 @@ import (
 	"os"
 
 	"gotest.tools/gotestsum/cmd"
+	"gotest.tools/gotestsum/cmd/tool/coverage"
+	"gotest.tools/gotestsum/cmd/tool/flakiness"
 	"gotest.tools/gotestsum/cmd/tool/matrix"
 	"gotest.tools/gotestsum/cmd/tool/slowest"
 	"gotest.tools/gotestsum/internal/log"
@@ -55,8 +57,10 @@ func toolRun(name string, args []string) error {
 		return fmt.Sprintf(`Usage: %[1]s COMMAND [flags]
 
 Commands:
-    %[1]s slowest      find or skip the slowest tests
-    %[1]s ci-matrix    use previous test runtime to place packages into optimal buckets
+    %[1]s slowest             find or skip the slowest tests
+    %[1]s ci-matrix           use previous test runtime to place packages into optimal buckets
+    %[1]s combine-coverage    combine coverage profiles into a single profile
+    %[1]s flakiness-report    summarize the results recorded by --rerun-fails-record-to
 
 Use '%[1]s COMMAND --help' for command specific help.
 `, name)
@@ -71,6 +75,10 @@ Use '%[1]s COMMAND --help' for command specific help.
 		return slowest.Run(name+" "+next, rest)
 	case "ci-matrix":
 		return matrix.Run(name+" "+next, rest)
+	case "combine-coverage":
+		return coverage.Run(name+" "+next, rest)
+	case "flakiness-report":
+		return flakiness.Run(name+" "+next, rest)
 	default:
 		fmt.Fprintln(os.Stderr, usage(name))
 		return fmt.Errorf("invalid command: %v %v", name, next)
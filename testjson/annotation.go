@@ -0,0 +1,100 @@
+package testjson
+
+import (
+	"sort"
+	"strings"
+)
+
+// addAnnotations records the tag from the output of a test, if the output is
+// an annotation.
+func (e *Execution) addAnnotations(pkg *Package, event TestEvent) {
+	tag, ok := tagFromOutput(e.annotationPrefix, event.Output)
+	if !ok {
+		return
+	}
+	id := pkg.running[event.Test].ID
+	for _, existing := range pkg.tags[id] {
+		if existing == tag {
+			return
+		}
+	}
+	if pkg.tags == nil {
+		pkg.tags = make(map[int][]string)
+	}
+	pkg.tags[id] = append(pkg.tags[id], tag)
+}
+
+// tagFromOutput returns the name of the tag from a line of output that
+// contains prefix followed by "tag <name>". The prefix may appear anywhere in
+// the line, because t.Log adds the file and line number before the message.
+func tagFromOutput(prefix string, output string) (string, bool) {
+	if prefix == "" {
+		return "", false
+	}
+	idx := strings.Index(output, prefix)
+	if idx < 0 {
+		return "", false
+	}
+	fields := strings.Fields(output[idx+len(prefix):])
+	if len(fields) != 2 || fields[0] != "tag" {
+		return "", false
+	}
+	return fields[1], true
+}
+
+// TaggedWith returns the test cases, from all packages, which were annotated
+// with tag. Every run of a tagged test is included, whether it passed,
+// failed, or was skipped. See ScanConfig.AnnotationPrefix.
+func (e *Execution) TaggedWith(tag string) []TestCase {
+	if e == nil {
+		return nil
+	}
+	var result []TestCase
+	for _, name := range sortedKeys(e.packages) {
+		pkg := e.packages[name]
+		var tagged []TestCase
+		for _, tcs := range [][]TestCase{pkg.Failed, pkg.Skipped, pkg.Passed} {
+			for _, tc := range tcs {
+				if hasTag(pkg.tags[tc.ID], tag) {
+					tagged = append(tagged, tc)
+				}
+			}
+		}
+		sort.Slice(tagged, func(i, j int) bool {
+			return tagged[i].ID < tagged[j].ID
+		})
+		result = append(result, tagged...)
+	}
+	return result
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Tags returns the sorted list of unique tags from the annotations of all the
+// tests in the execution. See ScanConfig.AnnotationPrefix.
+func (e *Execution) Tags() []string {
+	if e == nil {
+		return nil
+	}
+	seen := make(map[string]bool)
+	var result []string
+	for _, pkg := range e.packages {
+		for _, tags := range pkg.tags {
+			for _, tag := range tags {
+				if !seen[tag] {
+					seen[tag] = true
+					result = append(result, tag)
+				}
+			}
+		}
+	}
+	sort.Strings(result)
+	return result
+}
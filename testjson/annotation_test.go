@@ -0,0 +1,59 @@
+package testjson
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func newExecutionWithAnnotations() *Execution {
+	exec := newExecution()
+	exec.annotationPrefix = "# gotestsum:"
+	for _, event := range []TestEvent{
+		{Package: "two", Test: "TestD", Action: ActionRun},
+		{Package: "two", Test: "TestD", Action: ActionOutput, Output: "    two_test.go:5: # gotestsum:tag slow\n"},
+		{Package: "two", Test: "TestD", Action: ActionPass},
+		{Package: "two", Action: ActionPass},
+		{Package: "one", Test: "TestA", Action: ActionRun},
+		{Package: "one", Test: "TestA", Action: ActionOutput, Output: "# gotestsum:tag slow\n"},
+		{Package: "one", Test: "TestA", Action: ActionOutput, Output: "# gotestsum:tag network\n"},
+		{Package: "one", Test: "TestA", Action: ActionOutput, Output: "# gotestsum:tag slow\n"},
+		{Package: "one", Test: "TestA", Action: ActionFail},
+		{Package: "one", Test: "TestB", Action: ActionRun},
+		{Package: "one", Test: "TestB", Action: ActionOutput, Output: "# gotestsum:other slow\n"},
+		{Package: "one", Test: "TestB", Action: ActionPass},
+		{Package: "one", Test: "TestC", Action: ActionRun},
+		{Package: "one", Test: "TestC", Action: ActionOutput, Output: "# gotestsum:tag slow\n"},
+		{Package: "one", Test: "TestC", Action: ActionSkip},
+		{Package: "one", Action: ActionFail},
+	} {
+		exec.add(event)
+	}
+	return exec
+}
+
+func TestExecution_TaggedWith(t *testing.T) {
+	exec := newExecutionWithAnnotations()
+
+	var names []string
+	for _, tc := range exec.TaggedWith("slow") {
+		names = append(names, tc.Package+"."+tc.Test.Name())
+	}
+	assert.DeepEqual(t, names, []string{"one.TestA", "one.TestC", "two.TestD"})
+	assert.Equal(t, len(exec.TaggedWith("network")), 1)
+	assert.Equal(t, len(exec.TaggedWith("other")), 0)
+}
+
+func TestExecution_Tags(t *testing.T) {
+	exec := newExecutionWithAnnotations()
+	assert.DeepEqual(t, exec.Tags(), []string{"network", "slow"})
+}
+
+func TestExecution_Tags_NoAnnotationPrefix(t *testing.T) {
+	exec := newExecutionWithAnnotations()
+	exec.annotationPrefix = ""
+	exec.add(TestEvent{Package: "three", Test: "TestE", Action: ActionRun})
+	exec.add(TestEvent{Package: "three", Test: "TestE", Action: ActionOutput, Output: "# gotestsum:tag fast\n"})
+	exec.add(TestEvent{Package: "three", Test: "TestE", Action: ActionPass})
+	assert.DeepEqual(t, exec.Tags(), []string{"network", "slow"})
+}
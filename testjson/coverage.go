@@ -0,0 +1,65 @@
+package testjson
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// packageCoverage is the coverage percentage of a package.
+type packageCoverage struct {
+	name    string
+	percent float64
+}
+
+// CoverageReport returns a text report with the coverage percentage of each
+// package, sorted with the lowest coverage first, followed by a mean line.
+// The coverage output of 'go test' does not include the number of
+// statements, so the last line is the unweighted mean of the packages in the
+// report, not the coverage of all the statements.
+// Packages without coverage output are not included. CoverageReport returns
+// an empty string when no package has coverage.
+func (e *Execution) CoverageReport() string {
+	var pkgs []packageCoverage
+	for _, name := range sortedKeys(e.packages) {
+		percent, ok := parseCoveragePercent(e.packages[name].coverage)
+		if !ok {
+			continue
+		}
+		pkgs = append(pkgs, packageCoverage{name: name, percent: percent})
+	}
+	if len(pkgs) == 0 {
+		return ""
+	}
+	sort.SliceStable(pkgs, func(i, j int) bool {
+		return pkgs[i].percent < pkgs[j].percent
+	})
+
+	buf := new(strings.Builder)
+	w := tabwriter.NewWriter(buf, 0, 0, 2, ' ', 0)
+	var sum float64
+	for _, pkg := range pkgs {
+		sum += pkg.percent
+		fmt.Fprintf(w, "%s\t%5.1f%%\n", pkg.name, pkg.percent)
+	}
+	fmt.Fprintf(w, "mean of packages\t%5.1f%%\n", sum/float64(len(pkgs)))
+	_ = w.Flush()
+	return buf.String()
+}
+
+// parseCoveragePercent returns the percentage from the coverage output of a
+// package (ex: coverage: 91.1% of statements).
+func parseCoveragePercent(coverage string) (float64, bool) {
+	value := strings.TrimPrefix(coverage, "coverage: ")
+	end := strings.Index(value, "%")
+	if end < 0 {
+		return 0, false
+	}
+	percent, err := strconv.ParseFloat(value[:end], 64)
+	if err != nil {
+		return 0, false
+	}
+	return percent, true
+}
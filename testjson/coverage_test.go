@@ -0,0 +1,61 @@
+package testjson
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"gotest.tools/v3/assert"
+)
+
+func TestExecution_CoverageReport(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "example.com/one", Action: ActionOutput, Output: "coverage: 80.5% of statements\n"},
+		{Package: "example.com/one", Action: ActionPass},
+		{Package: "example.com/two/long", Action: ActionOutput, Output: "ok  \texample.com/two/long\t0.01s\tcoverage: 7.0% of statements\n"},
+		{Package: "example.com/two/long", Action: ActionPass},
+		{Package: "example.com/three", Action: ActionOutput, Output: "coverage: 100.0% of statements in ./...\n"},
+		{Package: "example.com/three", Action: ActionPass},
+		{Package: "example.com/nocover", Action: ActionPass},
+	} {
+		exec.add(event)
+	}
+
+	expected := `example.com/two/long    7.0%
+example.com/one        80.5%
+example.com/three     100.0%
+mean of packages       62.5%
+`
+	assert.Equal(t, exec.CoverageReport(), expected)
+}
+
+func TestExecution_CoverageReport_NoCoverage(t *testing.T) {
+	exec := newExecution()
+	exec.add(TestEvent{Package: "example.com/one", Action: ActionPass})
+	assert.Equal(t, exec.CoverageReport(), "")
+}
+
+func TestScanTestOutput_CoverageHandler(t *testing.T) {
+	type call struct {
+		pkg     string
+		percent float64
+	}
+	var calls []call
+	cfg := ScanConfig{
+		Stdout: strings.NewReader(`{"Package": "example.com/one", "Action": "output", "Output": "coverage: 80.5% of statements\n"}
+{"Package": "example.com/one", "Action": "pass"}
+{"Package": "example.com/two", "Test": "TestA", "Action": "output", "Output": "coverage: 1.0% of statements\n"}
+{"Package": "example.com/two", "Action": "output", "Output": "ok  \texample.com/two\t0.01s\tcoverage: 7.0% of statements\n"}
+{"Package": "example.com/two", "Action": "pass"}
+{"Package": "example.com/nocover", "Action": "pass"}
+`),
+		CoverageHandler: func(pkg string, percent float64) {
+			calls = append(calls, call{pkg: pkg, percent: percent})
+		},
+	}
+	_, err := ScanTestOutput(cfg)
+	assert.NilError(t, err)
+	expected := []call{{pkg: "example.com/one", percent: 80.5}, {pkg: "example.com/two", percent: 7}}
+	assert.DeepEqual(t, calls, expected, cmp.AllowUnexported(call{}))
+}
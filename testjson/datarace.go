@@ -0,0 +1,74 @@
+package testjson
+
+import (
+	"io"
+
+	"github.com/fatih/color"
+)
+
+// Raced returns the failed tests in the package which had output from the
+// race detector.
+func (p *Package) Raced() []TestCase {
+	var raced []TestCase
+	for _, tc := range p.Failed {
+		if p.racedIDs[tc.ID] {
+			raced = append(raced, tc)
+		}
+	}
+	return raced
+}
+
+// Raced returns the failed tests, from all packages, which had output from
+// the race detector.
+func (e *Execution) Raced() []TestCase {
+	if e == nil {
+		return nil
+	}
+	var raced []TestCase
+	for _, name := range sortedKeys(e.packages) {
+		raced = append(raced, e.packages[name].Raced()...)
+	}
+	return raced
+}
+
+// splitRaced returns the failures which did not report a data race, and the
+// failures which did.
+func splitRaced(execution *Execution, failures []TestCase) ([]TestCase, []TestCase) {
+	var failed, raced []TestCase
+	for _, tc := range failures {
+		pkg := execution.Package(tc.Package)
+		if tc.Test != "" && pkg != nil && pkg.racedIDs[tc.ID] {
+			raced = append(raced, tc)
+			continue
+		}
+		failed = append(failed, tc)
+	}
+	return failed, raced
+}
+
+// writeRacedSummary prints the tests which reported a data race, with their
+// output, in the same format as the failed section.
+func writeRacedSummary(
+	out io.Writer,
+	execSummary executionSummary,
+	raced []TestCase,
+	cfg SummaryConfig,
+	runCounts map[testRunCountKey]int,
+) {
+	if len(raced) == 0 {
+		return
+	}
+	withColor := color.RedString
+	conf := testCaseFormatConfig{
+		header:          withColor("Data races"),
+		prefix:          withColor("DATA RACE"),
+		runCounts:       runCounts,
+		source:          cfg.FailureSource,
+		maxOutput:       cfg.MaxFailuresOutput,
+		collapseRepeats: cfg.CollapseRepeats,
+		getter: func(executionSummary) []TestCase {
+			return raced
+		},
+	}
+	writeTestCaseSummary(out, execSummary, conf)
+}
@@ -0,0 +1,64 @@
+package testjson
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func newExecutionWithDataRace() *Execution {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "one", Test: "TestA", Action: ActionRun},
+		{Package: "one", Test: "TestA", Action: ActionOutput, Output: "==================\n"},
+		{Package: "one", Test: "TestA", Action: ActionOutput, Output: "WARNING: DATA RACE\n"},
+		{Package: "one", Test: "TestA", Action: ActionOutput, Output: "    testing.go:1465: race detected during execution of test\n"},
+		{Package: "one", Test: "TestA", Action: ActionFail},
+		{Package: "one", Test: "TestB", Action: ActionRun},
+		{Package: "one", Test: "TestB", Action: ActionOutput, Output: "    one_test.go:10: broken\n"},
+		{Package: "one", Test: "TestB", Action: ActionFail},
+		{Package: "one", Test: "TestC", Action: ActionRun},
+		{Package: "one", Test: "TestC", Action: ActionPass},
+		{Package: "one", Action: ActionFail},
+	} {
+		exec.add(event)
+	}
+	return exec
+}
+
+func TestExecution_Raced(t *testing.T) {
+	exec := newExecutionWithDataRace()
+	raced := exec.Raced()
+	assert.Equal(t, len(raced), 1)
+	assert.Equal(t, raced[0].Test, TestName("TestA"))
+	assert.Equal(t, len(exec.Package("one").Raced()), 1)
+}
+
+func TestPrintSummaryWithConfig_DataRaces(t *testing.T) {
+	exec := newExecutionWithDataRace()
+
+	buf := new(bytes.Buffer)
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{
+		Summary:   SummarizeFailed | SummarizeOutput,
+		DataRaces: true,
+	})
+	expected := `
+=== Failed
+=== FAIL: one TestB (0.00s)
+    one_test.go:10: broken
+
+=== Data races
+=== DATA RACE: one TestA (0.00s)
+==================
+WARNING: DATA RACE
+    testing.go:1465: race detected during execution of test
+
+ 3 tests, 1 failure, 1 data race in 0.000s
+`
+	assert.Equal(t, buf.String(), expected)
+
+	buf.Reset()
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{Summary: SummarizeNone})
+	assert.Equal(t, buf.String(), "\n 3 tests, 2 failures in 0.000s\n")
+}
@@ -0,0 +1,82 @@
+package testjson
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// durationBuckets are the upper bounds of the buckets used by the duration
+// histogram. A test is counted in the first bucket with a bound greater than
+// its elapsed time, so tests with an elapsed time of 0 are counted in the
+// first bucket. Tests with an elapsed time of at least the last bound are
+// counted in an extra bucket.
+var durationBuckets = []time.Duration{
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// maxHistogramBarWidth is the width of the bar for the largest bucket.
+const maxHistogramBarWidth = 40
+
+// DurationHistogram returns the number of tests in each duration bucket. The
+// buckets are <10ms, <100ms, <1s, <10s, and >=10s. Passed and failed tests
+// are counted, including the tests from every re-run. Skipped tests, and
+// tests which never finished, are not counted.
+func (e *Execution) DurationHistogram() []int {
+	counts := make([]int, len(durationBuckets)+1)
+	for _, name := range sortedKeys(e.packages) {
+		pkg := e.packages[name]
+		for _, tcs := range [][]TestCase{pkg.Passed, pkg.Failed} {
+			for _, tc := range tcs {
+				if tc.Elapsed == neverFinished {
+					continue
+				}
+				counts[durationBucket(tc.Elapsed)]++
+			}
+		}
+	}
+	return counts
+}
+
+func durationBucket(elapsed time.Duration) int {
+	for i, bound := range durationBuckets {
+		if elapsed < bound {
+			return i
+		}
+	}
+	return len(durationBuckets)
+}
+
+func durationBucketLabel(i int) string {
+	if i == len(durationBuckets) {
+		return ">=" + durationBuckets[i-1].String()
+	}
+	return "<" + durationBuckets[i].String()
+}
+
+func writeDurationHistogram(out io.Writer, counts []int) {
+	var largest int
+	for _, count := range counts {
+		if count > largest {
+			largest = count
+		}
+	}
+	if largest == 0 {
+		return
+	}
+	countWidth := len(fmt.Sprint(largest))
+
+	fmt.Fprintln(out, "\n=== Test durations")
+	for i, count := range counts {
+		width := count * maxHistogramBarWidth / largest
+		if width == 0 && count > 0 {
+			width = 1
+		}
+		line := fmt.Sprintf("%6s %*d %s", durationBucketLabel(i), countWidth, count, strings.Repeat("#", width))
+		fmt.Fprintln(out, strings.TrimRight(line, " "))
+	}
+}
@@ -0,0 +1,59 @@
+package testjson
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestDurationBucket(t *testing.T) {
+	for _, tc := range []struct {
+		elapsed  time.Duration
+		expected string
+	}{
+		{elapsed: 0, expected: "<10ms"},
+		{elapsed: 9 * time.Millisecond, expected: "<10ms"},
+		{elapsed: 10 * time.Millisecond, expected: "<100ms"},
+		{elapsed: 999 * time.Millisecond, expected: "<1s"},
+		{elapsed: time.Second, expected: "<10s"},
+		{elapsed: 10 * time.Second, expected: ">=10s"},
+		{elapsed: time.Hour, expected: ">=10s"},
+	} {
+		assert.Equal(t, durationBucketLabel(durationBucket(tc.elapsed)), tc.expected, tc.elapsed)
+	}
+}
+
+func TestExecution_DurationHistogram(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "one", Test: "TestA", Action: ActionRun},
+		{Package: "one", Test: "TestA", Action: ActionPass},
+		{Package: "one", Test: "TestB", Action: ActionRun},
+		{Package: "one", Test: "TestB", Action: ActionPass, Elapsed: 0.05},
+		{Package: "one", Test: "TestC", Action: ActionRun},
+		{Package: "one", Test: "TestC", Action: ActionFail, Elapsed: 12},
+		{Package: "one", Test: "TestD", Action: ActionRun},
+		{Package: "one", Test: "TestD", Action: ActionSkip},
+		{Package: "two", Test: "TestE", Action: ActionRun},
+		{Package: "two", Test: "TestE", Action: ActionPass, Elapsed: 0.001},
+	} {
+		exec.add(event)
+	}
+	assert.DeepEqual(t, exec.DurationHistogram(), []int{2, 1, 0, 0, 1})
+}
+
+func TestPrintSummaryWithConfig_DurationHistogram(t *testing.T) {
+	patchTimeNow(t)
+	exec, err := ScanTestOutput(scanConfigFromGolden("input/go-test-json.out")(t))
+	assert.NilError(t, err)
+
+	buf := new(bytes.Buffer)
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{
+		Summary:           SummarizeNone,
+		DurationHistogram: true,
+	})
+	golden.Assert(t, buf.String(), "summary/duration-histogram")
+}
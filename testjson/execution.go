@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"sort"
 	"strings"
 	"sync"
@@ -101,6 +102,17 @@ type Package struct {
 	// github.com/golang/go/issues/45508. This field may be removed in the future
 	// if the issue is fixed in Go.
 	panicked bool
+	// dataRace is true if the package, or one of the tests in the package,
+	// contained output from the race detector.
+	dataRace bool
+	// racedIDs are the IDs of the tests with output from the race detector.
+	racedIDs map[int]bool
+	// tags maps the ID of a test to the tags from its annotations.
+	tags map[int][]string
+	// metadata stores the values set by SetMetadata.
+	metadata map[string]string
+	// buildFailed is true if the package failed to build.
+	buildFailed bool
 	// shuffleSeed is the seed used to shuffle the tests. The value is set when
 	// tests are run with -shuffle
 	shuffleSeed string
@@ -109,6 +121,35 @@ type Package struct {
 	// output caused by a test timeout. This is necessary to work around a race
 	// condition in test2json. See https://github.com/golang/go/issues/57305.
 	testTimeoutPanicInTest string
+
+	// runIndex is the index used by TestCaseForRun. A TestCase is added to the
+	// index when it is added to Failed, Passed, or Skipped.
+	runIndex map[testRunKey]TestCase
+}
+
+type testRunKey struct {
+	test  TestName
+	runID int
+}
+
+// TestCaseForRun returns the TestCase for the test that ended with runID. If
+// the test ran more than once with the same runID, for example with -count,
+// the TestCase that started last is returned. Returns false if the test did
+// not end in that run.
+func (p *Package) TestCaseForRun(test TestName, runID int) (TestCase, bool) {
+	tc, ok := p.runIndex[testRunKey{test: test, runID: runID}]
+	return tc, ok
+}
+
+// addToRunIndex adds tc to the index used by TestCaseForRun.
+func (p *Package) addToRunIndex(tc TestCase) {
+	if p.runIndex == nil {
+		p.runIndex = make(map[testRunKey]TestCase)
+	}
+	key := testRunKey{test: tc.Test, runID: tc.RunID}
+	if current, ok := p.runIndex[key]; !ok || tc.ID > current.ID {
+		p.runIndex[key] = tc
+	}
 }
 
 // Result returns if the package passed, failed, or was skipped because there
@@ -131,6 +172,34 @@ func (p *Package) TestCases() []TestCase {
 	return tc
 }
 
+// PercentileElapsed returns the percentile pct (0 to 100) of the elapsed time
+// of the test cases in the package, using the nearest-rank method. Test cases
+// that never finished are ignored. Returns 0 if the package has no test cases.
+func (p *Package) PercentileElapsed(pct float64) time.Duration {
+	var times []time.Duration // nolint: prealloc
+	for _, tc := range p.TestCases() {
+		if tc.Elapsed == neverFinished {
+			continue
+		}
+		times = append(times, tc.Elapsed)
+	}
+	if len(times) == 0 {
+		return 0
+	}
+	sort.Slice(times, func(i, j int) bool {
+		return times[i] < times[j]
+	})
+
+	rank := int(math.Ceil(pct / 100 * float64(len(times))))
+	switch {
+	case rank < 1:
+		rank = 1
+	case rank > len(times):
+		rank = len(times)
+	}
+	return times[rank-1]
+}
+
 // LastFailedByName returns the most recent test with name in the list of Failed
 // tests. If no TestCase is found with that name, an empty TestCase is returned.
 //
@@ -194,6 +263,13 @@ func (p *Package) addOutput(id int, output string) {
 	if strings.HasPrefix(output, "panic: ") {
 		p.panicked = true
 	}
+	if strings.HasPrefix(output, "WARNING: DATA RACE") {
+		p.dataRace = true
+		if p.racedIDs == nil {
+			p.racedIDs = make(map[int]bool)
+		}
+		p.racedIDs[id] = true
+	}
 	p.output[id] = append(p.output[id], output)
 }
 
@@ -225,6 +301,25 @@ func (n TestName) Parent() string {
 	return string(n)[:idx]
 }
 
+// WithSuffix returns the name of the subtest suffix of the test n.
+func (n TestName) WithSuffix(suffix string) TestName {
+	if n == "" {
+		return TestName(suffix)
+	}
+	return n + "/" + TestName(suffix)
+}
+
+// WithPrefix returns the name of the test n as a subtest of prefix.
+func (n TestName) WithPrefix(prefix string) TestName {
+	return TestName(prefix).WithSuffix(string(n))
+}
+
+// Sibling returns the name of the test with the same parent as n, and the
+// last part of the name replaced with name.
+func (n TestName) Sibling(name string) TestName {
+	return TestName(n.Parent()).WithSuffix(name)
+}
+
 func (p *Package) removeOutput(id int) {
 	delete(p.output, id)
 
@@ -244,6 +339,49 @@ func tcIDSet(skipped []TestCase) map[int]struct{} {
 	return result
 }
 
+// ShuffleSeed returns the seed used by -test.shuffle to randomize the order of
+// tests in the package. Returns an empty string if the tests were not shuffled.
+func (p *Package) ShuffleSeed() string {
+	return strings.TrimPrefix(p.shuffleSeed, "-test.shuffle ")
+}
+
+// PackageMetrics is a summary of the results of a package.
+type PackageMetrics struct {
+	// TotalTests is the number of tests run, including subtests and reruns.
+	TotalTests int
+	Passed     int
+	Failed     int
+	Skipped    int
+	// Elapsed time reported by the pass or fail event for the package.
+	Elapsed time.Duration
+	// Coverage is the code coverage output for the package
+	// (ex: coverage: 91.1% of statements), or an empty string if coverage was
+	// not enabled.
+	Coverage string
+	// HasPanic is true if the output of the package, or one of its tests,
+	// looked like a panic.
+	HasPanic bool
+	// HasDataRace is true if the race detector reported a data race.
+	HasDataRace bool
+	// BuildError is true if the package failed to build.
+	BuildError bool
+}
+
+// Metrics returns a summary of the results of the package.
+func (p *Package) Metrics() PackageMetrics {
+	return PackageMetrics{
+		TotalTests:  p.Total,
+		Passed:      len(p.Passed),
+		Failed:      len(p.Failed),
+		Skipped:     len(p.Skipped),
+		Elapsed:     p.elapsed,
+		Coverage:    p.coverage,
+		HasPanic:    p.panicked,
+		HasDataRace: p.dataRace,
+		BuildError:  p.buildFailed,
+	}
+}
+
 // TestMainFailed returns true if the package has output related to a failure. This
 // may happen if a TestMain or init function panic, or if test timeout
 // is reached and output is associated with the package instead of the running
@@ -276,8 +414,10 @@ func (p *Package) end() []TestEvent {
 			continue
 		}
 
+		log.Debugf("missing end event for %v in %v, marking it as failed", tc.Test, tc.Package)
 		tc.Elapsed = neverFinished
 		p.Failed = append(p.Failed, tc)
+		p.addToRunIndex(tc)
 
 		result = append(result, TestEvent{
 			Action:  ActionFail,
@@ -345,12 +485,20 @@ func newPackage() *Package {
 
 // Execution of one or more test packages
 type Execution struct {
-	started    time.Time
-	packages   map[string]*Package
+	started  time.Time
+	packages map[string]*Package
+	// errorsLock is used for both errors and warnings.
 	errorsLock sync.RWMutex
 	errors     []string
+	warnings   []Warning
 	done       bool
 	lastRunID  int
+	// firstFailure is used to call ScanConfig.OnFirstFailure at most once.
+	firstFailure sync.Once
+	// wg is used by an EventHandler to register goroutines.
+	wg sync.WaitGroup
+	// annotationPrefix is set from ScanConfig.AnnotationPrefix.
+	annotationPrefix string
 }
 
 func (e *Execution) add(event TestEvent) {
@@ -359,11 +507,17 @@ func (e *Execution) add(event TestEvent) {
 		pkg = newPackage()
 		e.packages[event.Package] = pkg
 	}
+	if w, ok := warningFromEvent(event); ok {
+		e.addWarning(w)
+	}
 	if event.PackageEvent() {
 		pkg.addEvent(event)
 		return
 	}
 	pkg.addTestEvent(event)
+	if event.Action == ActionOutput {
+		e.addAnnotations(pkg, event)
+	}
 }
 
 func (p *Package) addEvent(event TestEvent) {
@@ -378,6 +532,9 @@ func (p *Package) addEvent(event TestEvent) {
 		if strings.Contains(event.Output, "\t(cached)") {
 			p.cached = true
 		}
+		if strings.HasSuffix(strings.TrimRight(event.Output, "\n"), "[build failed]") {
+			p.buildFailed = true
+		}
 		if isShuffleSeedOutput(event.Output) {
 			p.shuffleSeed = strings.TrimRight(event.Output, "\n")
 		}
@@ -415,6 +572,7 @@ func (p *Package) addTestEvent(event TestEvent) {
 	// This appears to be a bug in 'go test' or test2json. This test is missing
 	// an Action=run event. Create one on the first event received from the test.
 	if tc.ID == 0 {
+		log.Debugf("missing run event for %v in %v: %s", event.Test, event.Package, event.raw)
 		tc = p.newTestCaseFromEvent(event)
 		p.running[event.Test] = tc
 	}
@@ -439,6 +597,7 @@ func (p *Package) addTestEvent(event TestEvent) {
 	// the event.Action must be one of the three "test end" events
 	delete(p.running, event.Test)
 	tc.Elapsed = elapsedDuration(event.Elapsed)
+	p.addToRunIndex(tc)
 
 	switch event.Action {
 	case ActionFail:
@@ -513,7 +672,8 @@ func (e *Execution) Package(name string) *Package {
 	return e.packages[name]
 }
 
-// Packages returns a sorted list of all package names.
+// Packages returns a sorted list of the names of all the packages in the
+// execution, including packages which failed to build or had no tests.
 func (e *Execution) Packages() []string {
 	return sortedKeys(e.packages)
 }
@@ -545,6 +705,125 @@ func (e *Execution) Failed() []TestCase {
 	return failed
 }
 
+// Incomplete returns the test cases that started, but never had a pass, fail,
+// or skip event. This happens when a test panics, or when the test run is
+// stopped before all the tests complete. The test cases are also included in
+// Failed.
+func (e *Execution) Incomplete() []TestCase {
+	if e == nil {
+		return nil
+	}
+	var result []TestCase
+	for _, name := range sortedKeys(e.packages) {
+		var incomplete []TestCase
+		for _, tc := range e.packages[name].Failed {
+			if tc.Elapsed == neverFinished {
+				incomplete = append(incomplete, tc)
+			}
+		}
+		// The missing end events are created in random order.
+		sort.SliceStable(incomplete, func(i, j int) bool {
+			return incomplete[i].Test < incomplete[j].Test
+		})
+		result = append(result, incomplete...)
+	}
+	return result
+}
+
+// NewestFailure returns the TestCase which failed most recently, from all
+// packages and runs. A test fails when it ends, so the Time and Elapsed of
+// each test are compared. Returns false if no tests failed.
+func (e *Execution) NewestFailure() (TestCase, bool) {
+	return e.findFailure(func(tc, current TestCase) bool {
+		return failedAt(tc).After(failedAt(current))
+	})
+}
+
+// OldestFailure returns the TestCase which failed first, from all packages
+// and runs. Returns false if no tests failed.
+func (e *Execution) OldestFailure() (TestCase, bool) {
+	return e.findFailure(func(tc, current TestCase) bool {
+		return failedAt(tc).Before(failedAt(current))
+	})
+}
+
+// failedAt returns the time when tc ended. Tests which never finished are
+// treated as ending when they started.
+func failedAt(tc TestCase) time.Time {
+	if tc.Elapsed == neverFinished {
+		return tc.Time
+	}
+	return tc.Time.Add(tc.Elapsed)
+}
+
+// findFailure returns the failed TestCase which is preferred over every other
+// failed TestCase by replace.
+func (e *Execution) findFailure(replace func(tc, current TestCase) bool) (TestCase, bool) {
+	var result TestCase
+	var found bool
+	for _, name := range sortedKeys(e.packages) {
+		for _, tc := range e.packages[name].Failed {
+			if !found || replace(tc, result) {
+				result, found = tc, true
+			}
+		}
+	}
+	return result, found
+}
+
+// TestDurationMap returns the elapsed time of every test that passed in the
+// initial run, keyed by "package/TestName". Tests from a re-run are ignored,
+// so that the map can be stored and compared against the durations from a
+// later run. When a test passed more than once, for example because -count
+// was used, the longest elapsed time is used.
+func (e *Execution) TestDurationMap() map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for _, name := range sortedKeys(e.packages) {
+		for _, tc := range e.packages[name].Passed {
+			if tc.RunID != 0 {
+				continue
+			}
+			key := name + "/" + tc.Test.Name()
+			if current, ok := result[key]; !ok || tc.Elapsed > current {
+				result[key] = tc.Elapsed
+			}
+		}
+	}
+	return result
+}
+
+// PackageMedianDuration returns the median elapsed time of the tests in each
+// package. Passed and failed tests from every re-run attempt are included.
+// Skipped tests, and tests which never finished, are ignored. A package
+// without any of those tests is not in the map.
+func (e *Execution) PackageMedianDuration() map[string]time.Duration {
+	result := make(map[string]time.Duration)
+	for _, name := range sortedKeys(e.packages) {
+		pkg := e.packages[name]
+		var durations []time.Duration
+		for _, tcs := range [][]TestCase{pkg.Passed, pkg.Failed} {
+			for _, tc := range tcs {
+				if tc.Elapsed != neverFinished {
+					durations = append(durations, tc.Elapsed)
+				}
+			}
+		}
+		if len(durations) == 0 {
+			continue
+		}
+		sort.Slice(durations, func(i, j int) bool {
+			return durations[i] < durations[j]
+		})
+		mid := len(durations) / 2
+		if len(durations)%2 == 1 {
+			result[name] = durations[mid]
+			continue
+		}
+		result[name] = (durations[mid-1] + durations[mid]) / 2
+	}
+	return result
+}
+
 // FilterFailedUnique filters a slice of failed TestCases to remove any parent
 // tests that have failed subtests. The parent test will always be run when
 // running any of its subtests.
@@ -584,6 +863,24 @@ func FilterFailedUnique(tcs []TestCase) []TestCase {
 	return result
 }
 
+// SortByDuration sorts a slice of TestCases by elapsed time, so that the
+// fastest tests are first. Tests with the same elapsed time keep their order.
+// Tests that never finished are sorted last, because their elapsed time is
+// not known.
+func SortByDuration(tcs []TestCase) []TestCase {
+	sort.SliceStable(tcs, func(i, j int) bool {
+		a, b := tcs[i].Elapsed, tcs[j].Elapsed
+		switch {
+		case a == neverFinished:
+			return false
+		case b == neverFinished:
+			return true
+		}
+		return a < b
+	})
+	return tcs
+}
+
 func sortedKeys(pkgs map[string]*Package) []string {
 	keys := make([]string, 0, len(pkgs))
 	for key := range pkgs {
@@ -621,6 +918,13 @@ func (e *Execution) addError(err string) {
 	e.errorsLock.Unlock()
 }
 
+// WaitGroup returns a sync.WaitGroup that an EventHandler can use to register
+// any goroutines it starts. ScanTestOutput waits for all of the registered
+// goroutines to complete before it returns.
+func (e *Execution) WaitGroup() *sync.WaitGroup {
+	return &e.wg
+}
+
 // Errors returns a list of all the errors.
 func (e *Execution) Errors() []string {
 	e.errorsLock.RLock()
@@ -681,12 +985,40 @@ type ScanConfig struct {
 	// IgnoreNonJSONOutputLines causes ScanTestOutput to ignore non-JSON lines received from
 	// the Stdout reader. Instead of causing an error, the lines will be sent to Handler.Err.
 	IgnoreNonJSONOutputLines bool
+	// OnFirstFailure is called with the first test that fails in the
+	// Execution. It is called at most once, even when the Execution is used by
+	// multiple calls to ScanTestOutput, and it is called before the event is
+	// sent to Handler.
+	OnFirstFailure func(tc TestCase)
+	// PostRunHook is called with the Execution after the scan completes, and
+	// after all the goroutines registered with Execution.WaitGroup are done.
+	// It is not called when the scan fails. An error returned by PostRunHook
+	// is returned by ScanTestOutput.
+	PostRunHook func(exec *Execution) error
+	// AnnotationPrefix enables annotations in the output of tests. A line of
+	// test output that contains AnnotationPrefix followed by "tag <name>" adds
+	// the tag name to the test (ex: with a prefix of "# gotestsum:", the line
+	// "# gotestsum:tag slow" tags the test as slow). Annotations are ignored
+	// when AnnotationPrefix is empty. See Execution.TaggedWith.
+	AnnotationPrefix string
+	// CoverageHandler is called with the name of a package and its coverage
+	// percentage when the coverage output of the package is scanned (ex:
+	// coverage: 91.1% of statements). It is called from the scan goroutine,
+	// before the event is sent to Handler. ScanMultiple scans streams from
+	// separate goroutines, so CoverageHandler must be safe to call
+	// concurrently.
+	CoverageHandler func(pkg string, percent float64)
+
+	// lock is held while an event is added to the Execution and sent to
+	// the Handler. It is set by ScanMultiple to scan streams concurrently.
+	lock sync.Locker
 }
 
 // EventHandler is called by ScanTestOutput for each event and write to stderr.
 type EventHandler interface {
 	// Event is called for every TestEvent, with the current value of Execution.
-	// It may return an error to stop scanning.
+	// It may return an error to stop scanning. Any goroutines started by Event
+	// should be registered with execution.WaitGroup.
 	Event(event TestEvent, execution *Execution) error
 	// Err is called for every line from the Stderr reader and may return an
 	// error to stop scanning.
@@ -697,18 +1029,17 @@ type EventHandler interface {
 // Execution, calls the Handler for each event, and returns the Execution.
 //
 // If config.Handler is nil, a default no-op handler will be used.
+//
+// ScanTestOutput reads Stdout and Stderr in two goroutines, and does not
+// return until both readers reach EOF, and all the goroutines registered with
+// Execution.WaitGroup are done. When reading either stream fails, config.Stop
+// is called so that the process writing to the streams can be stopped, which
+// closes the other stream. No goroutines started by ScanTestOutput are left
+// running after it returns.
 func ScanTestOutput(config ScanConfig) (*Execution, error) {
-	if config.Stdout == nil {
-		return nil, fmt.Errorf("stdout reader must be non-nil")
-	}
-	if config.Handler == nil {
-		config.Handler = noopHandler{}
-	}
-	if config.Stderr == nil {
-		config.Stderr = new(bytes.Reader)
-	}
-	if config.Stop == nil {
-		config.Stop = func() {}
+	config, err := withDefaults(config)
+	if err != nil {
+		return nil, err
 	}
 	execution := config.Execution
 	if execution == nil {
@@ -716,6 +1047,9 @@ func ScanTestOutput(config ScanConfig) (*Execution, error) {
 	}
 	execution.done = false
 	execution.lastRunID = config.RunID
+	if config.AnnotationPrefix != "" {
+		execution.annotationPrefix = config.AnnotationPrefix
+	}
 
 	var group errgroup.Group
 	group.Go(func() error {
@@ -725,13 +1059,53 @@ func ScanTestOutput(config ScanConfig) (*Execution, error) {
 		return stopOnError(config.Stop, readStderr(config, execution))
 	})
 
-	err := group.Wait()
+	err = group.Wait()
+	handlerFor := func(string) EventHandler {
+		return config.Handler
+	}
+	if endErr := handleEndEvents(execution, handlerFor); endErr != nil {
+		return execution, endErr
+	}
+	if err != nil || config.PostRunHook == nil {
+		return execution, err
+	}
+	if err := config.PostRunHook(execution); err != nil {
+		return execution, fmt.Errorf("post run hook failed: %w", err)
+	}
+	return execution, nil
+}
+
+// withDefaults returns config with default values for the optional fields.
+func withDefaults(config ScanConfig) (ScanConfig, error) {
+	if config.Stdout == nil {
+		return config, fmt.Errorf("stdout reader must be non-nil")
+	}
+	if config.Handler == nil {
+		config.Handler = noopHandler{}
+	}
+	if config.Stderr == nil {
+		config.Stderr = new(bytes.Reader)
+	}
+	if config.Stop == nil {
+		config.Stop = func() {}
+	}
+	if config.lock == nil {
+		config.lock = noopLocker{}
+	}
+	return config, nil
+}
+
+// handleEndEvents sends the end events to the handler returned by handlerFor
+// for the package of the event, then waits for the goroutines started by the
+// handlers.
+func handleEndEvents(execution *Execution, handlerFor func(pkg string) EventHandler) error {
+	defer execution.wg.Wait()
 	for _, event := range execution.end() {
-		if err := config.Handler.Event(event, execution); err != nil {
-			return execution, err
+		if err := handlerFor(event.Package).Event(event, execution); err != nil {
+			return err
 		}
 	}
-	return execution, err
+	return nil
 }
 
 func stopOnError(stop func(), err error) error {
@@ -743,17 +1117,34 @@ func stopOnError(stop func(), err error) error {
 }
 
 func readStdout(config ScanConfig, execution *Execution) error {
+	var malformed int
+	defer func() {
+		if malformed > 0 {
+			log.Debugf("ignored %d malformed lines from test2json output", malformed)
+		}
+	}()
+
+	var split lineSplitter
 	scanner := bufio.NewScanner(config.Stdout)
+	scanner.Split(split.scanLines)
 	for scanner.Scan() {
 		raw := scanner.Bytes()
 		event, err := parseEvent(raw)
 		switch {
+		case err != nil && split.unterminated && bytes.HasPrefix(raw, []byte("{")):
+			// The last event is incomplete when the process was killed while
+			// it was writing the event. The events before it are still valid.
+			log.Debugf("ignoring incomplete event at the end of test output: %s", raw)
+			continue
 		case err == errBadEvent:
+			malformed++
 			// nolint: errcheck
 			config.Handler.Err(errBadEvent.Error() + ": " + scanner.Text())
 			continue
 		case err != nil:
 			if config.IgnoreNonJSONOutputLines {
+				malformed++
+				log.Debugf("ignoring non-JSON line: %s", raw)
 				// nolint: errcheck
 				config.Handler.Err(string(raw))
 				continue
@@ -762,8 +1153,7 @@ func readStdout(config ScanConfig, execution *Execution) error {
 		}
 
 		event.RunID = config.RunID
-		execution.add(event)
-		if err := config.Handler.Event(event, execution); err != nil {
+		if err := addEvent(config, execution, event); err != nil {
 			return err
 		}
 	}
@@ -773,18 +1163,64 @@ func readStdout(config ScanConfig, execution *Execution) error {
 	return nil
 }
 
+func addEvent(config ScanConfig, execution *Execution, event TestEvent) error {
+	config.lock.Lock()
+	defer config.lock.Unlock()
+
+	execution.add(event)
+	if config.OnFirstFailure != nil && event.Action == ActionFail && !event.PackageEvent() {
+		tc := execution.Package(event.Package).LastFailedByName(event.Test)
+		execution.firstFailure.Do(func() {
+			config.OnFirstFailure(tc)
+		})
+	}
+	if config.CoverageHandler != nil && event.PackageEvent() && event.Action == ActionOutput {
+		if coverage, ok := isCoverageOutput(event.Output); ok {
+			if percent, ok := parseCoveragePercent(coverage); ok {
+				config.CoverageHandler(event.Package, percent)
+			}
+		}
+	}
+	return config.Handler.Event(event, execution)
+}
+
+type noopLocker struct{}
+
+func (noopLocker) Lock()   {}
+func (noopLocker) Unlock() {}
+
+// lineSplitter is a bufio.SplitFunc that splits lines the same as
+// bufio.ScanLines, and records if the last line was missing a newline.
+type lineSplitter struct {
+	unterminated bool
+}
+
+func (s *lineSplitter) scanLines(data []byte, atEOF bool) (int, []byte, error) {
+	advance, token, err := bufio.ScanLines(data, atEOF)
+	s.unterminated = atEOF && token != nil && bytes.IndexByte(data, '\n') < 0
+	return advance, token, err
+}
+
 func readStderr(config ScanConfig, execution *Execution) error {
+	var warnings stderrWarnings
 	scanner := bufio.NewScanner(config.Stderr)
 	for scanner.Scan() {
 		line := scanner.Text()
-		if err := config.Handler.Err(line); err != nil {
+		config.lock.Lock()
+		err := config.Handler.Err(line)
+		config.lock.Unlock()
+		if err != nil {
 			return fmt.Errorf("failed to handle stderr: %v", err)
 		}
 		if isGoModuleOutput(line) || isGoDebugOutput(line) {
 			continue
 		}
-		if strings.HasPrefix(line, "warning:") {
-			continue
+		if w, ok := warnings.parse(line); ok {
+			execution.addWarning(w)
+			// vet findings fail the run, so they are also errors
+			if w.Kind != WarningVet {
+				continue
+			}
 		}
 		execution.addError(line)
 	}
@@ -835,10 +1271,18 @@ func parseEvent(raw []byte) (TestEvent, error) {
 
 	event := TestEvent{}
 	err := json.Unmarshal(raw, &event)
+	event.Package = normalizePackagePath(event.Package)
 	event.raw = raw
 	return event, err
 }
 
+// normalizePackagePath replaces any backslash path separators in the package
+// name with forward slashes. The package name of some events on Windows uses
+// the path separator, but import paths always use forward slashes.
+func normalizePackagePath(pkg string) string {
+	return strings.ReplaceAll(pkg, `\`, "/")
+}
+
 var errBadEvent = errors.New("bad output from test2json")
 
 type noopHandler struct{}
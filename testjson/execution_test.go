@@ -3,13 +3,18 @@ package testjson
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/fatih/color"
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
+	"gotest.tools/gotestsum/internal/log"
 	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
 	"gotest.tools/v3/golden"
 )
 
@@ -32,6 +37,37 @@ func TestExecution_Add_PackageCoverage(t *testing.T) {
 	assert.DeepEqual(t, pkg, expected, cmpPackage)
 }
 
+func TestPackage_Metrics(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "one", Test: "TestA", Action: ActionRun},
+		{Package: "one", Test: "TestA", Action: ActionOutput, Output: "WARNING: DATA RACE\n"},
+		{Package: "one", Test: "TestA", Action: ActionFail},
+		{Package: "one", Test: "TestB", Action: ActionRun},
+		{Package: "one", Test: "TestB", Action: ActionPass},
+		{Package: "one", Test: "TestC", Action: ActionRun},
+		{Package: "one", Test: "TestC", Action: ActionSkip},
+		{Package: "one", Action: ActionOutput, Output: "coverage: 50.0% of statements\n"},
+		{Package: "one", Action: ActionFail, Elapsed: 1.5},
+		{Package: "two", Action: ActionOutput, Output: "FAIL\ttwo [build failed]\n"},
+		{Package: "two", Action: ActionFail},
+	} {
+		exec.add(event)
+	}
+
+	expected := PackageMetrics{
+		TotalTests:  3,
+		Passed:      1,
+		Failed:      1,
+		Skipped:     1,
+		Elapsed:     1500 * time.Millisecond,
+		Coverage:    "coverage: 50.0% of statements",
+		HasDataRace: true,
+	}
+	assert.DeepEqual(t, exec.Package("one").Metrics(), expected)
+	assert.DeepEqual(t, exec.Package("two").Metrics(), PackageMetrics{BuildError: true})
+}
+
 var cmpPackage = cmp.Options{
 	cmp.AllowUnexported(Package{}),
 	cmpopts.EquateEmpty(),
@@ -45,6 +81,129 @@ func TestScanTestOutput_MinimalConfig(t *testing.T) {
 	assert.Equal(t, exec.Total(), 59)
 }
 
+func TestScanTestOutput_OnFirstFailure(t *testing.T) {
+	var calls []TestCase
+	cfg := ScanConfig{
+		Stdout: bytes.NewReader(golden.Get(t, "input/go-test-json.out")),
+		OnFirstFailure: func(tc TestCase) {
+			calls = append(calls, tc)
+		},
+	}
+	exec, err := ScanTestOutput(cfg)
+	assert.NilError(t, err)
+	assert.Assert(t, len(exec.Failed()) > 1)
+	assert.Equal(t, len(calls), 1)
+	first := calls[0]
+
+	t.Run("not called again by a rerun", func(t *testing.T) {
+		cfg.Stdout = strings.NewReader(`{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "fail"}
+`)
+		cfg.Execution = exec
+		cfg.RunID = 1
+		_, err := ScanTestOutput(cfg)
+		assert.NilError(t, err)
+		assert.Equal(t, len(calls), 1)
+		assert.Equal(t, calls[0].Test, first.Test)
+	})
+}
+
+func TestScanTestOutput_LogsEventSequenceAnomalies(t *testing.T) {
+	buf := new(bytes.Buffer)
+	log.SetOutput(buf)
+	log.SetLevel(log.DebugLevel)
+	t.Cleanup(func() {
+		log.SetOutput(color.Error)
+		log.SetLevel(log.WarnLevel)
+	})
+
+	in := `{"Package": "pkg", "Test": "TestA", "Action": "pass"}
+not json
+{"Package": "pkg", "Test": "TestB", "Action": "run"}
+`
+	_, err := ScanTestOutput(ScanConfig{
+		Stdout:                   strings.NewReader(in),
+		IgnoreNonJSONOutputLines: true,
+	})
+	assert.NilError(t, err)
+
+	out := buf.String()
+	assert.Assert(t, is.Contains(out,
+		`missing run event for TestA in pkg: {"Package": "pkg", "Test": "TestA", "Action": "pass"}`))
+	assert.Assert(t, is.Contains(out, "ignoring non-JSON line: not json"))
+	assert.Assert(t, is.Contains(out, "ignored 1 malformed lines from test2json output"))
+	assert.Assert(t, is.Contains(out, "missing end event for TestB in pkg, marking it as failed"))
+}
+
+func TestScanTestOutput_IncompleteLastLine(t *testing.T) {
+	in := `{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "pass"}
+{"Package": "pkg", "Test": "TestB", "Action": "run"}
+{"Package": "pkg", "Test": "TestB", "Act`
+	exec, err := ScanTestOutput(ScanConfig{Stdout: strings.NewReader(in)})
+	assert.NilError(t, err)
+	assert.Equal(t, len(exec.Package("pkg").Passed), 1)
+	assert.Equal(t, len(exec.Failed()), 1)
+	assert.Equal(t, exec.Failed()[0].Test, TestName("TestB"))
+
+	t.Run("incomplete line before the end", func(t *testing.T) {
+		in := `{"Package": "pkg", "Test": "TestB", "Act
+{"Package": "pkg", "Test": "TestA", "Action": "run"}
+`
+		_, err := ScanTestOutput(ScanConfig{Stdout: strings.NewReader(in)})
+		assert.ErrorContains(t, err, "failed to parse test output")
+	})
+
+	t.Run("non-JSON last line", func(t *testing.T) {
+		in := `{"Package": "pkg", "Test": "TestA", "Action": "run"}
+{"Package": "pkg", "Test": "TestA", "Action": "pass"}
+panic: test timed out`
+		handler := &captureHandler{}
+		_, err := ScanTestOutput(ScanConfig{
+			Stdout:                   strings.NewReader(in),
+			Handler:                  handler,
+			IgnoreNonJSONOutputLines: true,
+		})
+		assert.NilError(t, err)
+		assert.DeepEqual(t, handler.errs, []string{"panic: test timed out"})
+
+		_, err = ScanTestOutput(ScanConfig{Stdout: strings.NewReader(in)})
+		assert.ErrorContains(t, err, "failed to parse test output: panic: test timed out")
+	})
+}
+
+// windowsPackageEvents are events with backslash separators in the package
+// name.
+const windowsPackageEvents = `{"Package": "example.com\\pkg\\sub", "Action": "start"}
+{"Package": "example.com\\pkg\\sub", "Test": "TestOne", "Action": "run"}
+{"Package": "example.com\\pkg\\sub", "Test": "TestOne", "Action": "output", "Output": "failed\n"}
+{"Package": "example.com\\pkg\\sub", "Test": "TestOne", "Action": "fail"}
+{"Package": "example.com\\pkg\\sub", "Test": "TestTwo", "Action": "run"}
+{"Package": "example.com\\pkg\\sub", "Test": "TestTwo", "Action": "pass"}
+{"Package": "example.com\\pkg\\sub", "Action": "fail"}
+`
+
+func TestScanTestOutput_NormalizesPackagePath(t *testing.T) {
+	patchPkgPathPrefix(t, "example.com")
+
+	for _, format := range []string{"testname", "pkgname", "github-actions", "tap", "testdox"} {
+		t.Run(format, func(t *testing.T) {
+			out := new(bytes.Buffer)
+			exec, err := ScanTestOutput(ScanConfig{
+				Stdout:  strings.NewReader(windowsPackageEvents),
+				Handler: newFakeHandler(NewEventFormatter(out, format, FormatOptions{}), ""),
+			})
+			assert.NilError(t, err)
+			assert.DeepEqual(t, exec.Packages(), []string{"example.com/pkg/sub"})
+			assert.Equal(t, exec.Failed()[0].Package, "example.com/pkg/sub")
+
+			PrintSummary(out, exec, SummarizeAll)
+			assert.Assert(t, !strings.Contains(out.String(), `\`), out.String())
+			assert.Assert(t, is.Contains(out.String(), "pkg/sub"))
+		})
+	}
+}
+
 func TestScanTestOutput_CallsStopOnError(t *testing.T) {
 	var called bool
 	stop := func() {
@@ -60,6 +219,115 @@ func TestScanTestOutput_CallsStopOnError(t *testing.T) {
 	assert.Assert(t, called)
 }
 
+func TestScanTestOutput_StopClosesStderrOnError(t *testing.T) {
+	// stderr stays open until Stop is called, like the stderr of a 'go test'
+	// process which is still running.
+	stderr, stderrWriter := io.Pipe()
+	cfg := ScanConfig{
+		Stdout:  bytes.NewReader(golden.Get(t, "input/go-test-json.out")),
+		Stderr:  stderr,
+		Handler: &handlerFails{},
+		Stop: func() {
+			_ = stderrWriter.Close()
+		},
+	}
+	_, err := ScanTestOutput(cfg)
+	assert.Error(t, err, "something failed")
+}
+
+func TestScanTestOutput_PostRunHook(t *testing.T) {
+	handler := &handlerWithGoroutines{}
+	var total, handled int
+	cfg := ScanConfig{
+		Stdout:  bytes.NewReader(golden.Get(t, "input/go-test-json.out")),
+		Handler: handler,
+		PostRunHook: func(exec *Execution) error {
+			total = exec.Total()
+			handler.mu.Lock()
+			handled = handler.count
+			handler.mu.Unlock()
+			return nil
+		},
+	}
+	_, err := ScanTestOutput(cfg)
+	assert.NilError(t, err)
+	assert.Equal(t, total, 59)
+	// the goroutines started by the handler were done before the hook
+	assert.Equal(t, handled, handler.started)
+
+	t.Run("error is returned", func(t *testing.T) {
+		cfg := ScanConfig{
+			Stdout: bytes.NewReader(golden.Get(t, "input/go-test-json.out")),
+			PostRunHook: func(*Execution) error {
+				return fmt.Errorf("upload failed")
+			},
+		}
+		exec, err := ScanTestOutput(cfg)
+		assert.Error(t, err, "post run hook failed: upload failed")
+		assert.Equal(t, exec.Total(), 59)
+	})
+
+	t.Run("not called when the scan fails", func(t *testing.T) {
+		var called bool
+		cfg := ScanConfig{
+			Stdout:  bytes.NewReader(golden.Get(t, "input/go-test-json.out")),
+			Handler: &handlerFails{},
+			PostRunHook: func(*Execution) error {
+				called = true
+				return nil
+			},
+		}
+		_, err := ScanTestOutput(cfg)
+		assert.Error(t, err, "something failed")
+		assert.Assert(t, !called)
+	})
+}
+
+func TestScanTestOutput_WaitsForHandlerGoroutines(t *testing.T) {
+	handler := &handlerWithGoroutines{}
+	cfg := ScanConfig{
+		Stdout:  bytes.NewReader(golden.Get(t, "input/go-test-json.out")),
+		Handler: handler,
+	}
+	exec, err := ScanTestOutput(cfg)
+	assert.NilError(t, err)
+
+	handler.mu.Lock()
+	defer handler.mu.Unlock()
+	assert.Assert(t, handler.count > 0)
+	// every event, including the end events, was handled by a goroutine
+	// which completed before ScanTestOutput returned.
+	assert.Equal(t, handler.count, handler.started)
+	assert.Equal(t, exec.Total(), 59)
+}
+
+type handlerWithGoroutines struct {
+	mu      sync.Mutex
+	started int
+	count   int
+}
+
+func (h *handlerWithGoroutines) Event(_ TestEvent, exec *Execution) error {
+	h.mu.Lock()
+	h.started++
+	h.mu.Unlock()
+
+	wg := exec.WaitGroup()
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		time.Sleep(time.Millisecond)
+		h.mu.Lock()
+		h.count++
+		h.mu.Unlock()
+	}()
+	return nil
+}
+
+func (h *handlerWithGoroutines) Err(_ string) error {
+	return nil
+}
+
 type handlerFails struct {
 	count int
 }
@@ -315,3 +583,234 @@ func TestFilterFailedUnique_NestedWithGaps(t *testing.T) {
 	cmpTestCase := cmp.AllowUnexported(TestCase{})
 	assert.DeepEqual(t, expected, actual, cmpTestCase)
 }
+
+func TestPackage_PercentileElapsed(t *testing.T) {
+	pkg := &Package{
+		Passed: []TestCase{
+			{Elapsed: 4 * time.Millisecond},
+			{Elapsed: time.Millisecond},
+			{Elapsed: 3 * time.Millisecond},
+		},
+		Failed: []TestCase{
+			{Elapsed: 2 * time.Millisecond},
+			{Elapsed: neverFinished},
+		},
+		Skipped: []TestCase{
+			{Elapsed: 5 * time.Millisecond},
+		},
+	}
+	assert.Equal(t, pkg.PercentileElapsed(0), time.Millisecond)
+	assert.Equal(t, pkg.PercentileElapsed(50), 3*time.Millisecond)
+	assert.Equal(t, pkg.PercentileElapsed(80), 4*time.Millisecond)
+	assert.Equal(t, pkg.PercentileElapsed(99), 5*time.Millisecond)
+	assert.Equal(t, pkg.PercentileElapsed(100), 5*time.Millisecond)
+
+	assert.Equal(t, (&Package{}).PercentileElapsed(99), time.Duration(0))
+}
+
+func TestSortByDuration(t *testing.T) {
+	input := []TestCase{
+		{ID: 1, Test: "TestSlow", Elapsed: 3 * time.Second},
+		{ID: 2, Test: "TestPanic", Elapsed: neverFinished},
+		{ID: 3, Test: "TestFast", Elapsed: time.Millisecond},
+		{ID: 4, Test: "TestSame1", Elapsed: time.Second},
+		{ID: 5, Test: "TestSame2", Elapsed: time.Second},
+	}
+	actual := SortByDuration(input)
+
+	var ids []int
+	for _, tc := range actual {
+		ids = append(ids, tc.ID)
+	}
+	assert.DeepEqual(t, ids, []int{3, 4, 5, 1, 2})
+}
+
+func TestExecution_NewestAndOldestFailure(t *testing.T) {
+	t.Run("no failures", func(t *testing.T) {
+		exec := newExecution()
+		_, ok := exec.NewestFailure()
+		assert.Assert(t, !ok)
+		_, ok = exec.OldestFailure()
+		assert.Assert(t, !ok)
+	})
+
+	t.Run("with failures", func(t *testing.T) {
+		start := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+		exec := newExecution()
+		for _, event := range []TestEvent{
+			{Package: "one", Test: "TestA", Action: ActionRun, Time: start.Add(2 * time.Second)},
+			{Package: "one", Test: "TestA", Action: ActionFail},
+			{Package: "one", Test: "TestB", Action: ActionRun, Time: start.Add(3 * time.Second)},
+			{Package: "one", Test: "TestB", Action: ActionPass},
+			{Package: "two", Test: "TestC", Action: ActionRun, Time: start.Add(time.Second)},
+			{Package: "two", Test: "TestC", Action: ActionFail},
+			{Package: "two", Test: "TestC", Action: ActionRun, Time: start.Add(5 * time.Second), RunID: 1},
+			{Package: "two", Test: "TestC", Action: ActionFail, RunID: 1},
+		} {
+			exec.add(event)
+		}
+
+		newest, ok := exec.NewestFailure()
+		assert.Assert(t, ok)
+		assert.Equal(t, newest.Test, TestName("TestC"))
+		assert.Equal(t, newest.RunID, 1)
+
+		oldest, ok := exec.OldestFailure()
+		assert.Assert(t, ok)
+		assert.Equal(t, oldest.Package, "two")
+		assert.Equal(t, oldest.RunID, 0)
+	})
+
+	t.Run("long test that started first and failed last", func(t *testing.T) {
+		start := time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)
+		exec := newExecution()
+		for _, event := range []TestEvent{
+			{Package: "one", Test: "TestLong", Action: ActionRun, Time: start},
+			{Package: "one", Test: "TestShort", Action: ActionRun, Time: start.Add(time.Second)},
+			{Package: "one", Test: "TestShort", Action: ActionFail, Elapsed: 1},
+			{Package: "one", Test: "TestLong", Action: ActionFail, Elapsed: 10},
+		} {
+			exec.add(event)
+		}
+
+		newest, ok := exec.NewestFailure()
+		assert.Assert(t, ok)
+		assert.Equal(t, newest.Test, TestName("TestLong"))
+
+		oldest, ok := exec.OldestFailure()
+		assert.Assert(t, ok)
+		assert.Equal(t, oldest.Test, TestName("TestShort"))
+	})
+}
+
+func TestExecution_TestDurationMap(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "example.com/one", Test: "TestA", Action: ActionRun},
+		{Package: "example.com/one", Test: "TestA", Action: ActionPass, Elapsed: 0.2},
+		{Package: "example.com/one", Test: "TestA", Action: ActionRun},
+		{Package: "example.com/one", Test: "TestA", Action: ActionPass, Elapsed: 0.5},
+		{Package: "example.com/one", Test: "TestA/sub", Action: ActionRun},
+		{Package: "example.com/one", Test: "TestA/sub", Action: ActionPass, Elapsed: 0.1},
+		{Package: "example.com/one", Test: "TestB", Action: ActionRun},
+		{Package: "example.com/one", Test: "TestB", Action: ActionFail, Elapsed: 1},
+		{Package: "example.com/one", Test: "TestB", Action: ActionRun, RunID: 1},
+		{Package: "example.com/one", Test: "TestB", Action: ActionPass, Elapsed: 1.5, RunID: 1},
+		{Package: "example.com/two", Test: "TestC", Action: ActionRun},
+		{Package: "example.com/two", Test: "TestC", Action: ActionSkip},
+		{Package: "example.com/two", Test: "TestD", Action: ActionRun},
+		{Package: "example.com/two", Test: "TestD", Action: ActionPass, Elapsed: 3},
+	} {
+		exec.add(event)
+	}
+
+	expected := map[string]time.Duration{
+		"example.com/one/TestA":     500 * time.Millisecond,
+		"example.com/one/TestA/sub": 100 * time.Millisecond,
+		"example.com/two/TestD":     3 * time.Second,
+	}
+	assert.DeepEqual(t, exec.TestDurationMap(), expected)
+}
+
+func TestExecution_PackageMedianDuration(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "example.com/one", Test: "TestA", Action: ActionRun},
+		{Package: "example.com/one", Test: "TestA", Action: ActionPass, Elapsed: 0.2},
+		{Package: "example.com/one", Test: "TestB", Action: ActionRun},
+		{Package: "example.com/one", Test: "TestB", Action: ActionFail, Elapsed: 1},
+		{Package: "example.com/one", Test: "TestB", Action: ActionRun, RunID: 1},
+		{Package: "example.com/one", Test: "TestB", Action: ActionPass, Elapsed: 3, RunID: 1},
+		{Package: "example.com/two", Test: "TestC", Action: ActionRun},
+		{Package: "example.com/two", Test: "TestC", Action: ActionSkip},
+		{Package: "example.com/two", Test: "TestD", Action: ActionRun},
+		{Package: "example.com/two", Test: "TestD", Action: ActionPass, Elapsed: 2},
+		{Package: "example.com/two", Test: "TestE", Action: ActionRun},
+		{Package: "example.com/two", Test: "TestE", Action: ActionPass, Elapsed: 1},
+		{Package: "example.com/three", Test: "TestF", Action: ActionRun},
+		{Package: "example.com/three", Test: "TestF", Action: ActionSkip},
+	} {
+		exec.add(event)
+	}
+
+	expected := map[string]time.Duration{
+		// the re-run of TestB is included
+		"example.com/one": time.Second,
+		// the skipped test is ignored, and the median of an even number of
+		// tests is the mean of the middle two
+		"example.com/two": 1500 * time.Millisecond,
+	}
+	assert.DeepEqual(t, exec.PackageMedianDuration(), expected)
+}
+
+func TestExecution_Packages(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "example.com/one", Test: "TestA", Action: ActionRun},
+		{Package: "example.com/one", Test: "TestA", Action: ActionPass},
+		{Package: "example.com/one", Action: ActionPass},
+		{Package: "example.com/broken", Action: ActionOutput, Output: "FAIL\texample.com/broken [build failed]\n"},
+		{Package: "example.com/broken", Action: ActionFail},
+		{Package: "example.com/empty", Action: ActionOutput, Output: "?   \texample.com/empty\t[no test files]\n"},
+		{Package: "example.com/empty", Action: ActionSkip},
+	} {
+		exec.add(event)
+	}
+	expected := []string{"example.com/broken", "example.com/empty", "example.com/one"}
+	assert.DeepEqual(t, exec.Packages(), expected)
+}
+
+func TestPackage_TestCaseForRun(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "one", Test: "TestA", Action: ActionRun},
+		{Package: "one", Test: "TestA", Action: ActionFail},
+		{Package: "one", Test: "TestB", Action: ActionRun},
+		{Package: "one", Test: "TestB", Action: ActionSkip},
+		{Package: "one", Test: "TestA", Action: ActionRun, RunID: 1},
+		{Package: "one", Test: "TestA", Action: ActionPass, RunID: 1},
+	} {
+		exec.add(event)
+	}
+	pkg := exec.Package("one")
+
+	tc, ok := pkg.TestCaseForRun("TestA", 0)
+	assert.Assert(t, ok)
+	assert.Equal(t, tc.ID, 1)
+	tc, ok = pkg.TestCaseForRun("TestA", 1)
+	assert.Assert(t, ok)
+	assert.Equal(t, tc.ID, 3)
+	tc, ok = pkg.TestCaseForRun("TestB", 0)
+	assert.Assert(t, ok)
+	assert.Equal(t, tc.ID, 2)
+	_, ok = pkg.TestCaseForRun("TestB", 1)
+	assert.Assert(t, !ok)
+
+	t.Run("index is updated by new events", func(t *testing.T) {
+		for _, event := range []TestEvent{
+			{Package: "one", Test: "TestB", Action: ActionRun, RunID: 2},
+			{Package: "one", Test: "TestB", Action: ActionFail, RunID: 2},
+			{Package: "one", Test: "TestB", Action: ActionRun, RunID: 2},
+			{Package: "one", Test: "TestB", Action: ActionPass, RunID: 2},
+		} {
+			exec.add(event)
+		}
+		tc, ok := pkg.TestCaseForRun("TestB", 2)
+		assert.Assert(t, ok)
+		assert.Equal(t, tc.ID, 5, "the last run with the same runID is returned")
+	})
+}
+
+func TestTestName_Constructors(t *testing.T) {
+	assert.Equal(t, TestName("TestA").WithSuffix("sub"), TestName("TestA/sub"))
+	assert.Equal(t, TestName("TestA/sub").WithSuffix("case"), TestName("TestA/sub/case"))
+	assert.Equal(t, TestName("").WithSuffix("TestA"), TestName("TestA"))
+
+	assert.Equal(t, TestName("sub").WithPrefix("TestA"), TestName("TestA/sub"))
+	assert.Equal(t, TestName("sub/case").WithPrefix("TestA"), TestName("TestA/sub/case"))
+	assert.Equal(t, TestName("TestA").WithPrefix(""), TestName("TestA"))
+
+	assert.Equal(t, TestName("TestA/one").Sibling("two"), TestName("TestA/two"))
+	assert.Equal(t, TestName("TestA/sub/one").Sibling("two"), TestName("TestA/sub/two"))
+	assert.Equal(t, TestName("TestA").Sibling("TestB"), TestName("TestB"))
+}
@@ -0,0 +1,161 @@
+package testjson
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/fatih/color"
+)
+
+// FailureSource prints the lines of source code around the location of a
+// test failure.
+type FailureSource struct {
+	// Context is the number of lines to print before and after the failing
+	// line.
+	Context int
+	// PackageDir returns the directory of the package with the import path
+	// pkg. An empty string is returned when the directory is not known.
+	PackageDir func(pkg string) string
+
+	mu sync.Mutex
+	// files caches the lines of each source file. Files which could not be
+	// read are stored as nil, so that they are not read again.
+	files map[string][]string
+}
+
+// sourceRefPattern matches a file:line reference like the ones printed by
+// t.Error and t.Fatal (ex: "    file_test.go:42: message"), and the absolute
+// paths printed by testify (ex: "Error Trace:	/path/to/file_test.go:42").
+var sourceRefPattern = regexp.MustCompile(`(?:^|\s)((?:[A-Za-z]:)?[^\s:]*\.go):(\d+)(?::\s|:$|\s|$)`)
+
+// sourceRef is a reference to a line in a source file.
+type sourceRef struct {
+	file string
+	line int
+}
+
+// parseSourceRef returns the first file:line reference in lines.
+func parseSourceRef(lines []string) (sourceRef, bool) {
+	ref, _, ok := parseSourceRefWithMessage(lines)
+	return ref, ok
+}
+
+// parseSourceRefWithMessage returns the first file:line reference in lines,
+// and the rest of the line after the reference.
+func parseSourceRefWithMessage(lines []string) (sourceRef, string, bool) {
+	for _, line := range lines {
+		match := sourceRefPattern.FindStringSubmatchIndex(line)
+		if match == nil {
+			continue
+		}
+		n, err := strconv.Atoi(line[match[4]:match[5]])
+		if err != nil || n < 1 {
+			continue
+		}
+		msg := strings.TrimSpace(line[match[1]:])
+		return sourceRef{file: line[match[2]:match[3]], line: n}, msg, true
+	}
+	return sourceRef{}, "", false
+}
+
+// FailureLocation is the location of a test failure in a source file.
+type FailureLocation struct {
+	// File is the path to the source file. The path is relative to the
+	// package directory when the directory is not known.
+	File string
+	Line int
+	// Message is the rest of the output line after the file:line reference.
+	Message string
+}
+
+// Location returns the first file:line reference in the output of tc. The
+// output of a subtest is used instead of the output of its parent, so the
+// location of a subtest failure is the line in the subtest. Returns false if
+// the output has no reference.
+func (s *FailureSource) Location(exec *Execution, tc TestCase) (FailureLocation, bool) {
+	ref, msg, ok := parseSourceRefWithMessage(exec.OutputLines(tc))
+	if !ok {
+		return FailureLocation{}, false
+	}
+	loc := FailureLocation{File: ref.file, Line: ref.line, Message: msg}
+	if path := s.resolve(tc.Package, ref); path != "" {
+		loc.File = path
+	}
+	return loc, true
+}
+
+// resolve returns the path to the file referenced by ref. Relative paths are
+// relative to the package directory.
+func (s *FailureSource) resolve(pkg string, ref sourceRef) string {
+	if filepath.IsAbs(ref.file) {
+		return ref.file
+	}
+	if s.PackageDir == nil {
+		return ""
+	}
+	dir := s.PackageDir(pkg)
+	if dir == "" {
+		return ""
+	}
+	return filepath.Join(dir, ref.file)
+}
+
+func (s *FailureSource) readLines(path string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if lines, ok := s.files[path]; ok {
+		return lines
+	}
+	if s.files == nil {
+		s.files = make(map[string][]string)
+	}
+	var lines []string
+	if raw, err := ioutil.ReadFile(path); err == nil {
+		lines = strings.Split(strings.TrimSuffix(string(raw), "\n"), "\n")
+	}
+	s.files[path] = lines
+	return lines
+}
+
+// write the source around the first file:line reference in the output of tc.
+// Nothing is written if the output has no reference, or the file can not be
+// read.
+func (s *FailureSource) write(out io.Writer, tc TestCase, output []string) {
+	ref, ok := parseSourceRef(output)
+	if !ok {
+		return
+	}
+	path := s.resolve(tc.Package, ref)
+	if path == "" {
+		return
+	}
+	lines := s.readLines(path)
+	if ref.line > len(lines) {
+		return
+	}
+
+	first, last := ref.line-s.Context, ref.line+s.Context
+	if first < 1 {
+		first = 1
+	}
+	if last > len(lines) {
+		last = len(lines)
+	}
+	width := len(strconv.Itoa(last))
+
+	fmt.Fprintf(out, "\n%s:%d\n", ref.file, ref.line)
+	for n := first; n <= last; n++ {
+		line := fmt.Sprintf("%*d | %s", width, n, lines[n-1])
+		if n == ref.line {
+			fmt.Fprintln(out, color.RedString("> "+line))
+			continue
+		}
+		fmt.Fprintln(out, "  "+line)
+	}
+}
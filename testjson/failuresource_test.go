@@ -0,0 +1,185 @@
+package testjson
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/fatih/color"
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/fs"
+)
+
+func TestParseSourceRef(t *testing.T) {
+	type testCase struct {
+		name     string
+		lines    []string
+		expected sourceRef
+		noMatch  bool
+	}
+	run := func(t *testing.T, tc testCase) {
+		ref, ok := parseSourceRef(tc.lines)
+		if tc.noMatch {
+			assert.Assert(t, !ok, "got %v", ref)
+			return
+		}
+		assert.Assert(t, ok)
+		assert.Equal(t, ref, tc.expected)
+	}
+	testCases := []testCase{
+		{
+			name:     "testing package",
+			lines:    []string{"=== RUN   TestOne\n", "    one_test.go:42: assertion failed\n"},
+			expected: sourceRef{file: "one_test.go", line: 42},
+		},
+		{
+			name:     "testing package without message",
+			lines:    []string{"\tone_test.go:7\n"},
+			expected: sourceRef{file: "one_test.go", line: 7},
+		},
+		{
+			name: "testify",
+			lines: []string{
+				"    one_test.go:12: \n",
+				"        \tError Trace:\t/home/user/project/one_test.go:12\n",
+			},
+			expected: sourceRef{file: "one_test.go", line: 12},
+		},
+		{
+			name:     "testify absolute path",
+			lines:    []string{"        \tError Trace:\t/home/user/project/one_test.go:12\n"},
+			expected: sourceRef{file: "/home/user/project/one_test.go", line: 12},
+		},
+		{
+			name:     "first reference is used",
+			lines:    []string{"    one_test.go:3: first\n", "    two_test.go:4: second\n"},
+			expected: sourceRef{file: "one_test.go", line: 3},
+		},
+		{
+			name:    "no reference",
+			lines:   []string{"=== RUN   TestOne\n", "--- FAIL: TestOne (0.00s)\n"},
+			noMatch: true,
+		},
+		{
+			name:    "not a go file",
+			lines:   []string{"    config.yaml:3: bad value\n"},
+			noMatch: true,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestPrintSummaryWithConfig_FailureSource(t *testing.T) {
+	patchPkgPathPrefix(t, "example.com")
+	patchTimeNow(t)
+	defer func(orig bool) {
+		color.NoColor = orig
+	}(color.NoColor)
+	color.NoColor = true
+
+	dir := fs.NewDir(t, "failure-source",
+		fs.WithFile("one_test.go", `package one
+
+func TestOne(t *testing.T) {
+	value := 1
+	assert.Equal(t, value, 2)
+}
+`))
+
+	exec := &Execution{
+		started: timeNow(),
+		done:    true,
+		packages: map[string]*Package{
+			"example.com/one": {
+				Total: 2,
+				Failed: []TestCase{
+					{Package: "example.com/one", Test: "TestOne", ID: 1},
+					{Package: "example.com/one", Test: "TestMissing", ID: 2},
+				},
+				output: map[int][]string{
+					1: multiLine("=== RUN   TestOne\n    one_test.go:5: assertion failed\n--- FAIL: TestOne (0.00s)\n"),
+					2: multiLine("=== RUN   TestMissing\n    missing_test.go:5: assertion failed\n--- FAIL: TestMissing (0.00s)\n"),
+				},
+				action: ActionFail,
+			},
+		},
+	}
+
+	var lookups int
+	source := &FailureSource{
+		Context: 1,
+		PackageDir: func(pkg string) string {
+			lookups++
+			assert.Equal(t, pkg, "example.com/one")
+			return dir.Path()
+		},
+	}
+	out := new(bytes.Buffer)
+	PrintSummaryWithConfig(out, exec, SummaryConfig{
+		Summary:       SummarizeFailed | SummarizeOutput,
+		FailureSource: source,
+	})
+
+	expected := `
+=== Failed
+=== FAIL: one TestOne (0.00s)
+    one_test.go:5: assertion failed
+
+one_test.go:5
+  4 | 	value := 1
+> 5 | 	assert.Equal(t, value, 2)
+  6 | }
+
+=== FAIL: one TestMissing (0.00s)
+    missing_test.go:5: assertion failed
+
+DONE 2 tests, 2 failures in 0.000s
+`
+	assert.Equal(t, out.String(), expected)
+	assert.Equal(t, lookups, 2)
+}
+
+func TestFailureSource_Location(t *testing.T) {
+	pkg := &Package{
+		Failed: []TestCase{
+			{Package: "example.com/one", Test: "TestOne/sub", ID: 2},
+			{Package: "example.com/one", Test: "TestOne", ID: 1, hasSubTestFailed: true},
+			{Package: "example.com/one", Test: "TestTwo", ID: 3},
+		},
+		output: map[int][]string{
+			1: multiLine("=== RUN   TestOne\n"),
+			2: multiLine("=== RUN   TestOne/sub\n    one_test.go:9: got 1, want 2\n    one_test.go:10: second\n"),
+			3: multiLine("=== RUN   TestTwo\n    --- FAIL: TestTwo (0.00s)\n"),
+		},
+		subTests: map[int][]int{1: {2}},
+	}
+	exec := &Execution{packages: map[string]*Package{"example.com/one": pkg}}
+	source := &FailureSource{
+		PackageDir: func(string) string { return "/src/one" },
+	}
+
+	loc, ok := source.Location(exec, pkg.Failed[0])
+	assert.Assert(t, ok)
+	expected := FailureLocation{
+		File:    filepath.Join("/src/one", "one_test.go"),
+		Line:    9,
+		Message: "got 1, want 2",
+	}
+	assert.Equal(t, loc, expected)
+
+	_, ok = source.Location(exec, pkg.Failed[1])
+	assert.Assert(t, !ok, "root test has no reference in its own output")
+	_, ok = source.Location(exec, pkg.Failed[2])
+	assert.Assert(t, !ok)
+
+	t.Run("unknown package dir", func(t *testing.T) {
+		source := &FailureSource{}
+		loc, ok := source.Location(exec, pkg.Failed[0])
+		assert.Assert(t, ok)
+		assert.Equal(t, loc.File, "one_test.go")
+	})
+}
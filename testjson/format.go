@@ -37,6 +37,138 @@ func standardVerboseFormat(out io.Writer) EventFormatter {
 	})
 }
 
+// go test -v, with the result lines highlighted in color. The color is
+// always enabled, even when the output is not a terminal.
+func standardVerboseColorFormat(out io.Writer, opts FormatOptions) EventFormatter {
+	formatter := standardVerboseFormat(out)
+	if opts.QuietPassing {
+		formatter = standardVerboseQuietPassingFormat(out)
+	}
+	return eventFormatterFunc(func(event TestEvent, exec *Execution) error {
+		if event.Action == ActionOutput {
+			event.Output = colorVerboseLine(event.Output)
+		}
+		return formatter.Format(event, exec)
+	})
+}
+
+var (
+	forcedGreen  = forceColor(color.New(color.FgGreen))
+	forcedRed    = forceColor(color.New(color.FgRed))
+	forcedYellow = forceColor(color.New(color.FgYellow))
+)
+
+func forceColor(c *color.Color) func(a ...interface{}) string {
+	c.EnableColor()
+	return c.SprintFunc()
+}
+
+// colorVerboseLine colors the line if it is the result of a test or package.
+// The trailing newline is left uncolored.
+func colorVerboseLine(line string) string {
+	text := strings.TrimRight(line, "\n")
+	trimmed := strings.TrimLeft(text, " ")
+
+	var colorize func(a ...interface{}) string
+	switch {
+	case strings.HasPrefix(trimmed, "--- PASS"),
+		trimmed == "PASS",
+		strings.HasPrefix(text, "ok  "):
+		colorize = forcedGreen
+	case strings.HasPrefix(trimmed, "--- FAIL"),
+		trimmed == "FAIL",
+		strings.HasPrefix(text, "FAIL\t"):
+		colorize = forcedRed
+	case strings.HasPrefix(trimmed, "--- SKIP"):
+		colorize = forcedYellow
+	default:
+		return line
+	}
+	return colorize(text) + line[len(text):]
+}
+
+// go test -v, with the output of passing tests removed
+func standardVerboseQuietPassingFormat(out io.Writer) EventFormatter {
+	buf := bufio.NewWriter(out)
+
+	type name struct {
+		Package string
+		Test    string
+	}
+	type testOutput struct {
+		lines []string
+		// keep is true when the root test, or any of its subtests, did not pass.
+		keep bool
+	}
+	pending := map[name]*testOutput{}
+	var order []name
+
+	// flushPackage writes the output of any tests in pkg that have not yet
+	// completed. This preserves the order of output when a test never
+	// receives an end event (ex: a panic), or when package output arrives
+	// while tests are still running.
+	flushPackage := func(pkg string) {
+		remaining := order[:0]
+		for _, key := range order {
+			if key.Package != pkg {
+				remaining = append(remaining, key)
+				continue
+			}
+			for _, line := range pending[key].lines {
+				_, _ = buf.WriteString(line)
+			}
+			delete(pending, key)
+		}
+		order = remaining
+	}
+
+	return eventFormatterFunc(func(event TestEvent, _ *Execution) error {
+		if event.PackageEvent() {
+			flushPackage(event.Package)
+			if event.Action == ActionOutput {
+				_, _ = buf.WriteString(event.Output)
+			}
+			return buf.Flush()
+		}
+
+		root, _ := TestName(event.Test).Split()
+		key := name{Package: event.Package, Test: root}
+		output, ok := pending[key]
+		if !ok {
+			output = &testOutput{}
+			pending[key] = output
+			order = append(order, key)
+		}
+
+		switch {
+		case event.Action == ActionOutput:
+			output.lines = append(output.lines, event.Output)
+			return nil
+		case !event.Action.IsTerminal():
+			return nil
+		case event.Action != ActionPass:
+			output.keep = true
+		}
+
+		if event.Test != root {
+			return nil
+		}
+		if output.keep {
+			for _, line := range output.lines {
+				_, _ = buf.WriteString(line)
+			}
+		}
+		delete(pending, key)
+		for i, k := range order {
+			if k == key {
+				order = append(order[:i], order[i+1:]...)
+				break
+			}
+		}
+		return buf.Flush()
+	})
+}
+
 // go test
 func standardQuietFormat(out io.Writer) EventFormatter {
 	buf := bufio.NewWriter(out)
@@ -361,8 +493,8 @@ func packageLine(event TestEvent, pkg *Package) string {
 		buf.WriteString(fmt.Sprintf(" (%s)", d))
 	}
 
-	if pkg.coverage != "" {
-		buf.WriteString(" (" + pkg.coverage + ")")
+	if coverage := pkg.Metrics().Coverage; coverage != "" {
+		buf.WriteString(" (" + coverage + ")")
 	}
 
 	if event.Action == ActionFail && pkg.shuffleSeed != "" {
@@ -374,9 +506,14 @@ func packageLine(event TestEvent, pkg *Package) string {
 
 func pkgNameWithFailuresFormat(out io.Writer, opts FormatOptions) eventFormatterFunc {
 	buf := bufio.NewWriter(out)
+	var failures int
 	return func(event TestEvent, exec *Execution) error {
 		if !event.PackageEvent() {
 			if event.Action == ActionFail {
+				failures++
+				if opts.MaxFailures > 0 && failures > opts.MaxFailures {
+					return nil
+				}
 				pkg := exec.Package(event.Package)
 				tc := pkg.LastFailedByName(event.Test)
 				pkg.WriteOutputTo(buf, tc.ID) // nolint:errcheck
@@ -417,10 +554,28 @@ type FormatOptions struct {
 	HideEmptyPackages    bool
 	UseHiVisibilityIcons bool // Deprecated
 	Icons                string
+	// QuietPassing removes the output of passing tests from the
+	// standard-verbose format.
+	QuietPassing bool
+	// WideNameWidth is the maximum width of the test name column in the wide
+	// format. Longer names are truncated. A value less than 0 disables
+	// truncation, and 0 uses DefaultWideNameWidth.
+	WideNameWidth int
+	// ShowPassed prints the output of passing tests in the
+	// plain-verbose-package format.
+	ShowPassed bool
+	// MaxFailures is the maximum number of failed tests with output printed
+	// by the pkgname-and-test-fails format. A value of 0 prints all of them.
+	MaxFailures int
+	// Options are key=value settings for the format. Each format supports a
+	// different set of keys, see ValidateFormatOptions.
+	Options map[string]string
 }
 
-// NewEventFormatter returns a formatter for printing events.
+// NewEventFormatter returns a formatter for printing events. Invalid
+// formatOpts.Options are ignored, use ValidateFormatOptions to check them.
 func NewEventFormatter(out io.Writer, format string, formatOpts FormatOptions) EventFormatter {
+	formatOpts, _ = applyFormatOptions(format, formatOpts)
 	switch format {
 	case "none":
 		return eventFormatterFunc(func(TestEvent, *Execution) error { return nil })
@@ -429,7 +584,12 @@ func NewEventFormatter(out io.Writer, format string, formatOpts FormatOptions) E
 	case "standard-json":
 		return standardJSONFormat(out)
 	case "standard-verbose":
+		if formatOpts.QuietPassing {
+			return standardVerboseQuietPassingFormat(out)
+		}
 		return standardVerboseFormat(out)
+	case "standard-verbose-color":
+		return standardVerboseColorFormat(out, formatOpts)
 	case "standard-quiet":
 		return standardQuietFormat(out)
 	case "dots", "dots-v1":
@@ -449,6 +609,12 @@ func NewEventFormatter(out io.Writer, format string, formatOpts FormatOptions) E
 		return pkgNameWithFailuresFormat(out, formatOpts)
 	case "github-actions", "github-action":
 		return githubActionsFormat(out)
+	case "tap":
+		return tapFormat(out)
+	case "wide":
+		return newWideFormatter(out, formatOpts)
+	case "plain-verbose-package":
+		return plainVerbosePackageFormat(out, formatOpts)
 	default:
 		return nil
 	}
@@ -73,9 +73,13 @@ func TestFormats_DefaultGoTestJson(t *testing.T) {
 
 	run := func(t *testing.T, tc testCase) {
 		out := new(bytes.Buffer)
-		shim := newFakeHandler(tc.format(out), "input/go-test-json")
+		formatter := tc.format(out)
+		shim := newFakeHandler(formatter, "input/go-test-json")
 		exec, err := ScanTestOutput(shim.Config(t))
 		assert.NilError(t, err)
+		if closer, ok := formatter.(io.Closer); ok {
+			assert.NilError(t, closer.Close())
+		}
 
 		golden.Assert(t, out.String(), tc.expectedOut)
 		golden.Assert(t, shim.err.String(), "input/go-test-json.err")
@@ -157,6 +161,18 @@ func TestFormats_DefaultGoTestJson(t *testing.T) {
 			format:      standardVerboseFormat,
 			expectedOut: "format/standard-verbose.out",
 		},
+		{
+			name:        "standard-verbose with quiet-passing",
+			format:      standardVerboseQuietPassingFormat,
+			expectedOut: "format/standard-verbose-quiet-passing.out",
+		},
+		{
+			name: "standard-verbose-color",
+			format: func(out io.Writer) EventFormatter {
+				return standardVerboseColorFormat(out, FormatOptions{})
+			},
+			expectedOut: "format/standard-verbose-color.out",
+		},
 		{
 			name:        "standard-quiet",
 			format:      standardQuietFormat,
@@ -172,6 +188,39 @@ func TestFormats_DefaultGoTestJson(t *testing.T) {
 			format:      githubActionsFormat,
 			expectedOut: "format/github-actions.out",
 		},
+		{
+			name:        "tap",
+			format:      tapFormat,
+			expectedOut: "format/tap.out",
+		},
+		{
+			name: "plain-verbose-package",
+			format: func(out io.Writer) EventFormatter {
+				return plainVerbosePackageFormat(out, FormatOptions{})
+			},
+			expectedOut: "format/plain-verbose-package.out",
+		},
+		{
+			name: "plain-verbose-package with show_passed",
+			format: func(out io.Writer) EventFormatter {
+				return plainVerbosePackageFormat(out, FormatOptions{ShowPassed: true})
+			},
+			expectedOut: "format/plain-verbose-package-show-passed.out",
+		},
+		{
+			name: "wide",
+			format: func(out io.Writer) EventFormatter {
+				return wideFormatAligned(out, FormatOptions{WideNameWidth: 24})
+			},
+			expectedOut: "format/wide.out",
+		},
+		{
+			name: "wide not a terminal",
+			format: func(out io.Writer) EventFormatter {
+				return wideFormatUnaligned(out, FormatOptions{WideNameWidth: 30})
+			},
+			expectedOut: "format/wide-unaligned.out",
+		},
 	}
 
 	for _, tc := range testCases {
@@ -323,3 +372,9 @@ func TestFormats_Shuffle(t *testing.T) {
 		})
 	}
 }
+
+func TestNewWideFormatter_NotATerminal(t *testing.T) {
+	out := new(bytes.Buffer)
+	_, ok := newWideFormatter(out, FormatOptions{}).(*wideFormatter)
+	assert.Assert(t, !ok, "expected the unaligned formatter for a buffer")
+}
@@ -0,0 +1,100 @@
+package testjson
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// formatOption sets the field of opts for the value of a key in
+// FormatOptions.Options.
+type formatOption func(opts *FormatOptions, value string) error
+
+func showPassedOption(opts *FormatOptions, value string) error {
+	return parseBoolOption(value, &opts.ShowPassed)
+}
+
+func maxFailuresOption(opts *FormatOptions, value string) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return fmt.Errorf("must be an integer greater than or equal to 0")
+	}
+	opts.MaxFailures = n
+	return nil
+}
+
+// formatOptionKeys are the keys of FormatOptions.Options supported by each
+// format:
+//
+//	pkgname-and-test-fails:
+//	    max_failures=int        print the output of at most this many failed tests, 0 for no limit
+//	plain-verbose-package:
+//	    show_passed=bool        print the output of passing tests
+var formatOptionKeys = map[string]map[string]formatOption{
+	"pkgname-and-test-fails": {"max_failures": maxFailuresOption},
+	"plain-verbose-package":  {"show_passed": showPassedOption},
+}
+
+// formatAliases maps the other names of a format to the name used by
+// formatOptionKeys.
+var formatAliases = map[string]string{
+	"short-with-failures": "pkgname-and-test-fails",
+}
+
+func parseBoolOption(value string, target *bool) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return fmt.Errorf("must be true or false")
+	}
+	*target = b
+	return nil
+}
+
+func formatOptionsFor(format string) map[string]formatOption {
+	if name, ok := formatAliases[format]; ok {
+		format = name
+	}
+	return formatOptionKeys[format]
+}
+
+// ValidateFormatOptions returns an error if any of the keys in options is not
+// supported by format, or has an invalid value.
+func ValidateFormatOptions(format string, options map[string]string) error {
+	_, err := applyFormatOptions(format, FormatOptions{Options: options})
+	return err
+}
+
+// applyFormatOptions returns opts with the fields set from the values in
+// opts.Options.
+func applyFormatOptions(format string, opts FormatOptions) (FormatOptions, error) {
+	supported := formatOptionsFor(format)
+	for _, key := range sortedStrings(opts.Options) {
+		apply, ok := supported[key]
+		if !ok {
+			if len(supported) == 0 {
+				return opts, fmt.Errorf("format %v does not support any format options, got %v", format, key)
+			}
+			var keys []string
+			for k := range supported {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			return opts, fmt.Errorf("format %v does not support the format option %v, supported options: %v",
+				format, key, strings.Join(keys, ", "))
+		}
+		if err := apply(&opts, opts.Options[key]); err != nil {
+			return opts, fmt.Errorf("invalid value %q for format option %v: %w", opts.Options[key], key, err)
+		}
+	}
+	return opts, nil
+}
+
+func sortedStrings(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
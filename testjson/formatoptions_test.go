@@ -0,0 +1,93 @@
+package testjson
+
+import (
+	"bytes"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestApplyFormatOptions(t *testing.T) {
+	opts := FormatOptions{Options: map[string]string{"max_failures": "3"}}
+	actual, err := applyFormatOptions("short-with-failures", opts)
+	assert.NilError(t, err)
+	assert.Equal(t, actual.MaxFailures, 3)
+
+	opts = FormatOptions{Options: map[string]string{"show_passed": "true"}}
+	actual, err = applyFormatOptions("plain-verbose-package", opts)
+	assert.NilError(t, err)
+	assert.Equal(t, actual.ShowPassed, true)
+}
+
+func TestPkgNameWithFailuresFormat_MaxFailures(t *testing.T) {
+	out := new(bytes.Buffer)
+	formatter := pkgNameWithFailuresFormat(out, FormatOptions{MaxFailures: 1})
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "example.com/a", Test: "TestOne", Action: ActionRun},
+		{Package: "example.com/a", Test: "TestOne", Action: ActionOutput, Output: "first failure\n"},
+		{Package: "example.com/a", Test: "TestOne", Action: ActionFail},
+		{Package: "example.com/a", Test: "TestTwo", Action: ActionRun},
+		{Package: "example.com/a", Test: "TestTwo", Action: ActionOutput, Output: "second failure\n"},
+		{Package: "example.com/a", Test: "TestTwo", Action: ActionFail},
+	} {
+		exec.add(event)
+		assert.NilError(t, formatter.Format(event, exec))
+	}
+	assert.Equal(t, out.String(), "first failure\n")
+}
+
+func TestValidateFormatOptions(t *testing.T) {
+	type testCase struct {
+		name     string
+		format   string
+		options  map[string]string
+		expected string
+	}
+	testCases := []testCase{
+		{
+			name:    "no options",
+			format:  "dots",
+			options: nil,
+		},
+		{
+			name:    "valid",
+			format:  "pkgname-and-test-fails",
+			options: map[string]string{"max_failures": "5"},
+		},
+		{
+			name:     "unsupported key",
+			format:   "plain-verbose-package",
+			options:  map[string]string{"max_failures": "10"},
+			expected: "format plain-verbose-package does not support the format option max_failures, supported options: show_passed",
+		},
+		{
+			name:     "format without options",
+			format:   "tap",
+			options:  map[string]string{"show_passed": "true"},
+			expected: "format tap does not support any format options, got show_passed",
+		},
+		{
+			name:     "invalid bool",
+			format:   "plain-verbose-package",
+			options:  map[string]string{"show_passed": "yes please"},
+			expected: `invalid value "yes please" for format option show_passed: must be true or false`,
+		},
+		{
+			name:     "invalid int",
+			format:   "short-with-failures",
+			options:  map[string]string{"max_failures": "-1"},
+			expected: `invalid value "-1" for format option max_failures: must be an integer greater than or equal to 0`,
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := ValidateFormatOptions(tc.format, tc.options)
+			if tc.expected == "" {
+				assert.NilError(t, err)
+				return
+			}
+			assert.Error(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package testjson
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	code := m.Run()
+	if code == 0 {
+		if leaked := leakedGoroutines(time.Second); len(leaked) > 0 {
+			fmt.Fprintf(os.Stderr, "found %d leaked goroutines:\n\n%s\n",
+				len(leaked), strings.Join(leaked, "\n\n"))
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// leakedGoroutines returns the stack of every goroutine that is still running,
+// other than the current goroutine. Goroutines may take a moment to exit after
+// the test that started them, so it retries until timeout.
+func leakedGoroutines(timeout time.Duration) []string {
+	deadline := time.Now().Add(timeout)
+	for {
+		leaked := otherGoroutines()
+		if len(leaked) == 0 || time.Now().After(deadline) {
+			return leaked
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func otherGoroutines() []string {
+	buf := make([]byte, 1<<20)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	// The first stack is always the current goroutine.
+	stacks := strings.Split(strings.TrimSpace(string(buf)), "\n\n")[1:]
+	var result []string
+	for _, stack := range stacks {
+		// Started by the runtime the first time a signal is received.
+		if strings.Contains(stack, "os/signal.signal_recv") {
+			continue
+		}
+		result = append(result, stack)
+	}
+	return result
+}
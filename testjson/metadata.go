@@ -0,0 +1,24 @@
+package testjson
+
+// SetMetadata stores value with key on the package, replacing any previous
+// value for key. The metadata is not used by gotestsum. It allows an
+// EventHandler to attach information to a package, like an ID from an
+// external system or the owner of the package, and read it later with
+// GetMetadata.
+//
+// Like the rest of the Package, the metadata is not safe for concurrent use.
+// EventHandler.Event is never called concurrently for one Execution, so the
+// metadata can be used from an EventHandler.
+func (p *Package) SetMetadata(key, value string) {
+	if p.metadata == nil {
+		p.metadata = make(map[string]string)
+	}
+	p.metadata[key] = value
+}
+
+// GetMetadata returns the value stored with key by SetMetadata. Returns false
+// if no value was stored with key.
+func (p *Package) GetMetadata(key string) (string, bool) {
+	value, ok := p.metadata[key]
+	return value, ok
+}
@@ -0,0 +1,27 @@
+package testjson
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPackage_Metadata(t *testing.T) {
+	exec := newExecution()
+	exec.add(TestEvent{Package: "one", Action: ActionPass})
+	pkg := exec.Package("one")
+
+	_, ok := pkg.GetMetadata("owner")
+	assert.Assert(t, !ok)
+
+	pkg.SetMetadata("owner", "team-a")
+	pkg.SetMetadata("owner", "team-b")
+	value, ok := pkg.GetMetadata("owner")
+	assert.Assert(t, ok)
+	assert.Equal(t, value, "team-b")
+
+	pkg.SetMetadata("empty", "")
+	value, ok = pkg.GetMetadata("empty")
+	assert.Assert(t, ok)
+	assert.Equal(t, value, "")
+}
@@ -0,0 +1,99 @@
+package testjson
+
+import (
+	"fmt"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ScanMultiple reads the test2json streams from the Stdout and Stderr of each
+// config concurrently, and populates a single Execution with the events from
+// all the streams. The events from each stream are handled in the order they
+// are read from that stream, but there is no order between the events from
+// different streams. Only one event is added to the Execution and sent to a
+// Handler at a time, so the Handlers do not need to be safe for concurrent use.
+//
+// The Execution of the first config is populated, or a new Execution is created
+// when it is nil. The Execution field of the other configs is ignored. The end
+// events of a package are sent to the Handler of the stream which included the
+// package. The PostRunHook of each config is called after all the streams are
+// scanned.
+//
+// ScanMultiple is used when the tests of a run are split across many
+// processes, each writing its own stream of events, like the test targets
+// of bazel.
+func ScanMultiple(configs []ScanConfig) (*Execution, error) {
+	if len(configs) == 0 {
+		return nil, fmt.Errorf("at least one ScanConfig is required")
+	}
+	execution := configs[0].Execution
+	if execution == nil {
+		execution = newExecution()
+	}
+	execution.done = false
+	execution.lastRunID = configs[0].RunID
+
+	var lock sync.Mutex
+	// handlers maps each package to the Handler of the stream which included
+	// the package. It is only accessed while lock is held.
+	handlers := make(map[string]EventHandler)
+	streams := make([]ScanConfig, 0, len(configs))
+	for _, config := range configs {
+		config, err := withDefaults(config)
+		if err != nil {
+			return nil, err
+		}
+		config.lock = &lock
+		config.Handler = &streamHandler{EventHandler: config.Handler, handlers: handlers}
+		streams = append(streams, config)
+	}
+
+	var group errgroup.Group
+	for i := range streams {
+		config := streams[i]
+		group.Go(func() error {
+			return stopOnError(config.Stop, readStdout(config, execution))
+		})
+		group.Go(func() error {
+			return stopOnError(config.Stop, readStderr(config, execution))
+		})
+	}
+
+	err := group.Wait()
+	handlerFor := func(pkg string) EventHandler {
+		if handler, ok := handlers[pkg]; ok {
+			return handler
+		}
+		return streams[0].Handler
+	}
+	if endErr := handleEndEvents(execution, handlerFor); endErr != nil {
+		return execution, endErr
+	}
+	if err != nil {
+		return execution, err
+	}
+	for _, config := range streams {
+		if config.PostRunHook == nil {
+			continue
+		}
+		if err := config.PostRunHook(execution); err != nil {
+			return execution, fmt.Errorf("post run hook failed: %w", err)
+		}
+	}
+	return execution, nil
+}
+
+// streamHandler records the packages included in a stream, so that the end
+// events of those packages can be sent to the Handler of the stream.
+type streamHandler struct {
+	EventHandler
+	handlers map[string]EventHandler
+}
+
+func (h *streamHandler) Event(event TestEvent, execution *Execution) error {
+	if _, ok := h.handlers[event.Package]; !ok {
+		h.handlers[event.Package] = h.EventHandler
+	}
+	return h.EventHandler.Event(event, execution)
+}
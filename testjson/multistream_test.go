@@ -0,0 +1,96 @@
+package testjson
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestScanMultiple(t *testing.T) {
+	streamEvents := func(pkg string, n int) string {
+		var out strings.Builder
+		for i := 0; i < n; i++ {
+			fmt.Fprintf(&out, `{"Package": %q, "Test": "Test%d", "Action": "run"}`+"\n", pkg, i)
+			fmt.Fprintf(&out, `{"Package": %q, "Test": "Test%d", "Action": "pass"}`+"\n", pkg, i)
+		}
+		fmt.Fprintf(&out, `{"Package": %q, "Test": "TestFails", "Action": "run"}`+"\n", pkg)
+		fmt.Fprintf(&out, `{"Package": %q, "Test": "TestFails", "Action": "fail"}`+"\n", pkg)
+		// a test with no end event, the end event is created by ScanMultiple
+		fmt.Fprintf(&out, `{"Package": %q, "Test": "TestNeverEnds", "Action": "run"}`+"\n", pkg)
+		return out.String()
+	}
+
+	// The streams are written concurrently, so that the events are
+	// interleaved while they are scanned.
+	var configs []ScanConfig
+	var handlers []*countingHandler
+	for _, pkg := range []string{"example.com/one", "example.com/two", "example.com/three"} {
+		reader, writer := io.Pipe()
+		go func(pkg string) {
+			_, err := io.Copy(writer, strings.NewReader(streamEvents(pkg, 100)))
+			_ = writer.CloseWithError(err)
+		}(pkg)
+
+		handler := &countingHandler{packages: map[string]int{}}
+		handlers = append(handlers, handler)
+		configs = append(configs, ScanConfig{Stdout: reader, Handler: handler})
+	}
+
+	var hookCalls int
+	configs[0].PostRunHook = func(*Execution) error {
+		hookCalls++
+		return nil
+	}
+	exec, err := ScanMultiple(configs)
+	assert.NilError(t, err)
+
+	assert.DeepEqual(t, exec.Packages(),
+		[]string{"example.com/one", "example.com/three", "example.com/two"})
+	assert.Equal(t, exec.Total(), 3*102)
+	assert.Equal(t, len(exec.Failed()), 3*2)
+	assert.Equal(t, hookCalls, 1)
+
+	for i, pkg := range []string{"example.com/one", "example.com/two", "example.com/three"} {
+		// every event, including the end event for TestNeverEnds, was sent to
+		// the handler of the stream.
+		assert.DeepEqual(t, handlers[i].packages, map[string]int{pkg: 100*2 + 2 + 2})
+	}
+}
+
+func TestScanMultiple_NoConfigs(t *testing.T) {
+	_, err := ScanMultiple(nil)
+	assert.Error(t, err, "at least one ScanConfig is required")
+}
+
+func TestScanMultiple_CallsStopOnError(t *testing.T) {
+	var stopped []int
+	configs := []ScanConfig{
+		{
+			Stdout: strings.NewReader(`{"Package": "one", "Action": "pass"}` + "\n"),
+			Stop:   func() { stopped = append(stopped, 0) },
+		},
+		{
+			Stdout: strings.NewReader("not json\n"),
+			Stop:   func() { stopped = append(stopped, 1) },
+		},
+	}
+	_, err := ScanMultiple(configs)
+	assert.ErrorContains(t, err, "failed to parse test output: not json")
+	assert.DeepEqual(t, stopped, []int{1})
+}
+
+type countingHandler struct {
+	packages map[string]int
+}
+
+func (h *countingHandler) Event(event TestEvent, _ *Execution) error {
+	h.packages[event.Package]++
+	return nil
+}
+
+func (h *countingHandler) Err(string) error {
+	return nil
+}
@@ -18,6 +18,7 @@ import (
 // unmodified.
 // If the pkgpath matches the common prefix exactly then '.' will be returned.
 func RelativePackagePath(pkgpath string) string {
+	pkgpath = normalizePackagePath(pkgpath)
 	if pkgpath == pkgPathPrefix {
 		return "."
 	}
@@ -46,13 +47,12 @@ func isGoModuleEnabled() bool {
 	return os.Getenv("GO111MODULE") != "off"
 }
 
-// TODO: might not work on windows
 func getPkgPathPrefixGoPath(cwd string) string {
 	gopaths := strings.Split(build.Default.GOPATH, string(filepath.ListSeparator))
 	for _, gopath := range gopaths {
-		gosrcpath := gopath + "/src/"
+		gosrcpath := filepath.Join(gopath, "src") + string(filepath.Separator)
 		if strings.HasPrefix(cwd, gosrcpath) {
-			return strings.TrimPrefix(cwd, gosrcpath)
+			return filepath.ToSlash(strings.TrimPrefix(cwd, gosrcpath))
 		}
 	}
 	return ""
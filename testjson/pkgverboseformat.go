@@ -0,0 +1,106 @@
+package testjson
+
+import (
+	"bufio"
+	"io"
+	"sort"
+	"strings"
+)
+
+// packageSeparator is printed between the output of each package by the
+// plain-verbose-package format.
+var packageSeparator = strings.Repeat("-", 72) + "\n"
+
+// plainVerbosePackageFormatter prints the go test -v output of each package
+// as one group when the package ends, so that the output of packages which
+// run in parallel is not interleaved. The output of passing tests is removed
+// unless FormatOptions.ShowPassed is set. The output of packages which never
+// end, for example because the run was interrupted, is printed by Flush.
+type plainVerbosePackageFormatter struct {
+	buf  *bufio.Writer
+	opts FormatOptions
+	// pkgs are the events of each package which has not ended.
+	pkgs map[string][]TestEvent
+	// printed is true once the output of any package was printed.
+	printed bool
+}
+
+func plainVerbosePackageFormat(out io.Writer, opts FormatOptions) EventFormatter {
+	return &plainVerbosePackageFormatter{
+		buf:  bufio.NewWriter(out),
+		opts: opts,
+		pkgs: make(map[string][]TestEvent),
+	}
+}
+
+func (f *plainVerbosePackageFormatter) Format(event TestEvent, _ *Execution) error {
+	f.pkgs[event.Package] = append(f.pkgs[event.Package], event)
+	if !event.PackageEvent() || !event.Action.IsTerminal() {
+		return nil
+	}
+	f.writePackage(event.Package)
+	return f.buf.Flush()
+}
+
+// Flush prints the output of the packages which have not ended.
+func (f *plainVerbosePackageFormatter) Flush() error {
+	pkgs := make([]string, 0, len(f.pkgs))
+	for pkg := range f.pkgs {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		f.writePackage(pkg)
+	}
+	return f.buf.Flush()
+}
+
+// Close prints the output of the packages which have not ended.
+func (f *plainVerbosePackageFormatter) Close() error {
+	return f.Flush()
+}
+
+func (f *plainVerbosePackageFormatter) writePackage(pkg string) {
+	events := f.pkgs[pkg]
+	delete(f.pkgs, pkg)
+
+	if f.printed {
+		_, _ = f.buf.WriteString(packageSeparator)
+	}
+	f.printed = true
+	keep := testsWithFailedOutput(events)
+	for _, event := range events {
+		if event.Action != ActionOutput {
+			continue
+		}
+		if root, _ := TestName(event.Test).Split(); event.Test == "" || f.opts.ShowPassed || keep[root] {
+			_, _ = f.buf.WriteString(event.Output)
+		}
+	}
+}
+
+// testsWithFailedOutput returns the root tests in events which, or any of
+// their subtests, did not pass, or which never ended.
+func testsWithFailedOutput(events []TestEvent) map[string]bool {
+	keep := make(map[string]bool)
+	ended := make(map[string]bool)
+	for _, event := range events {
+		if event.Test == "" {
+			continue
+		}
+		root, _ := TestName(event.Test).Split()
+		switch {
+		case !event.Action.IsTerminal():
+		case event.Action != ActionPass:
+			keep[root] = true
+		case event.Test == root:
+			ended[root] = true
+		}
+	}
+	for _, event := range events {
+		if root, _ := TestName(event.Test).Split(); event.Test != "" && !ended[root] {
+			keep[root] = true
+		}
+	}
+	return keep
+}
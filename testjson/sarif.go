@@ -0,0 +1,163 @@
+package testjson
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+)
+
+// sarifLog is the root of a SARIF 2.1.0 document. Only the properties used by
+// ToSARIF are included.
+type sarifLog struct {
+	Version string     `json:"version"`
+	Schema  string     `json:"$schema"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules,omitempty"`
+}
+
+type sarifRule struct {
+	ID string `json:"id"`
+}
+
+type sarifResult struct {
+	RuleID    string          `json:"ruleId"`
+	Level     string          `json:"level"`
+	Message   sarifMessage    `json:"message"`
+	Locations []sarifLocation `json:"locations,omitempty"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine int `json:"startLine"`
+}
+
+// ToSARIF returns a SARIF (Static Analysis Results Interchange Format) 2.1.0
+// document with a result for each test failure, each package that failed
+// outside of a test (ex: from TestMain, or a timeout), and each error from
+// go test (ex: a build error).
+//
+// The ruleId of a test result is the name of the test, and the location is the
+// first file:line reference in the output of the test. Relative file paths are
+// joined with the directory of the package relative to the module root.
+// Failures with no file:line reference in their output have no location.
+// Tests that failed and then passed when they were re-run have a level of
+// warning instead of error.
+func (e *Execution) ToSARIF() ([]byte, error) {
+	run := sarifRun{
+		Tool: sarifTool{Driver: sarifDriver{
+			Name:           "gotestsum",
+			InformationURI: "https://github.com/gotestyourself/gotestsum",
+		}},
+		Results: []sarifResult{},
+	}
+	rules := make(map[string]bool)
+	addResult := func(result sarifResult) {
+		if !rules[result.RuleID] {
+			rules[result.RuleID] = true
+			run.Tool.Driver.Rules = append(run.Tool.Driver.Rules, sarifRule{ID: result.RuleID})
+		}
+		run.Results = append(run.Results, result)
+	}
+
+	for _, tc := range e.Failed() {
+		result := sarifResult{RuleID: tc.Test.Name(), Level: "error"}
+		switch {
+		case tc.Test == "":
+			result.RuleID = sarifRulePackageFailed
+			result.Message.Text = fmt.Sprintf("package %s failed", tc.Package)
+		case e.passedOnRerun(tc):
+			result.Level = "warning"
+			result.Message.Text = fmt.Sprintf("%s failed in %s (passed when re-run)", tc.Test, tc.Package)
+		default:
+			result.Message.Text = fmt.Sprintf("%s failed in %s", tc.Test, tc.Package)
+		}
+
+		ref, msg, ok := parseSourceRefWithMessage(e.OutputLines(tc))
+		if ok {
+			if msg != "" {
+				result.Message.Text += ": " + msg
+			}
+			result.Locations = []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: sarifURI(tc.Package, ref.file)},
+					Region:           sarifRegion{StartLine: ref.line},
+				},
+			}}
+		}
+		addResult(result)
+	}
+	for _, msg := range e.Errors() {
+		addResult(sarifResult{
+			RuleID:  sarifRuleGoTestError,
+			Level:   "error",
+			Message: sarifMessage{Text: msg},
+		})
+	}
+	return json.MarshalIndent(sarifLog{
+		Version: "2.1.0",
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Runs:    []sarifRun{run},
+	}, "", "  ")
+}
+
+const (
+	sarifRulePackageFailed = "package-failed"
+	sarifRuleGoTestError   = "go-test-error"
+)
+
+// passedOnRerun returns true if the test passed in a run after the run where
+// tc failed.
+func (e *Execution) passedOnRerun(tc TestCase) bool {
+	pkg := e.Package(tc.Package)
+	if pkg == nil {
+		return false
+	}
+	for _, passed := range pkg.Passed {
+		if passed.Test == tc.Test && passed.RunID > tc.RunID {
+			return true
+		}
+	}
+	return false
+}
+
+// sarifURI returns the path to file, relative to the module root. Test output
+// usually includes only the base name of the file, so relative paths are
+// joined with the directory of the package.
+func sarifURI(pkgpath string, file string) string {
+	file = filepath.ToSlash(file)
+	if path.IsAbs(file) || filepath.IsAbs(file) {
+		return file
+	}
+	return path.Join(RelativePackagePath(pkgpath), file)
+}
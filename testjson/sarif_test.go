@@ -0,0 +1,39 @@
+package testjson
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+	"gotest.tools/v3/golden"
+)
+
+func TestExecution_ToSARIF(t *testing.T) {
+	patchPkgPathPrefix(t, "example.com/mod")
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "example.com/mod/one", Test: "TestA", Action: ActionRun},
+		{Package: "example.com/mod/one", Test: "TestA", Action: ActionOutput, Output: "    one_test.go:12: expected 1, got 2\n"},
+		{Package: "example.com/mod/one", Test: "TestA", Action: ActionFail},
+		{Package: "example.com/mod/one", Test: "TestB", Action: ActionRun},
+		{Package: "example.com/mod/one", Test: "TestB", Action: ActionPass},
+		{Package: "example.com/mod/one", Test: "TestC", Action: ActionRun},
+		{Package: "example.com/mod/one", Test: "TestC", Action: ActionOutput, Output: "panic: boom\n"},
+		{Package: "example.com/mod/one", Test: "TestC", Action: ActionFail},
+		{Package: "example.com/mod/one", Test: "TestD", Action: ActionRun},
+		{Package: "example.com/mod/one", Test: "TestD", Action: ActionOutput, Output: "    one_test.go:40: flaky\n"},
+		{Package: "example.com/mod/one", Test: "TestD", Action: ActionFail},
+		{Package: "example.com/mod/one", Action: ActionFail},
+		{Package: "example.com/mod", Action: ActionOutput, Output: "FAIL\tTestMain exited early\n"},
+		{Package: "example.com/mod", Action: ActionFail},
+		{Package: "example.com/mod/one", Test: "TestD", Action: ActionRun, RunID: 1},
+		{Package: "example.com/mod/one", Test: "TestD", Action: ActionPass, RunID: 1},
+		{Package: "example.com/mod/one", Action: ActionPass, RunID: 1},
+	} {
+		exec.add(event)
+	}
+	exec.addError("two/two.go:3:1: syntax error: unexpected newline")
+
+	out, err := exec.ToSARIF()
+	assert.NilError(t, err)
+	golden.Assert(t, string(out), "sarif.golden")
+}
@@ -0,0 +1,125 @@
+package testjson
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/fatih/color"
+)
+
+// SkipReason is a group of skipped tests which were skipped with the same
+// message.
+type SkipReason struct {
+	// Reason is the message logged by the test when it was skipped. It is
+	// empty when the test did not log a message.
+	Reason string
+	Tests  []TestCase
+}
+
+// SkipReasons groups the skipped tests by the message they logged when they
+// were skipped. The groups are sorted by the number of tests, from most to
+// least.
+func (e *Execution) SkipReasons() []SkipReason {
+	groups := make(map[string]*SkipReason)
+	var reasons []*SkipReason
+	for _, tc := range e.Skipped() {
+		reason := skipReason(e.packages[tc.Package].output[tc.ID], tc.Test.Name())
+		group, ok := groups[reason]
+		if !ok {
+			group = &SkipReason{Reason: reason}
+			groups[reason] = group
+			reasons = append(reasons, group)
+		}
+		group.Tests = append(group.Tests, tc)
+	}
+
+	sort.SliceStable(reasons, func(i, j int) bool {
+		if len(reasons[i].Tests) != len(reasons[j].Tests) {
+			return len(reasons[i].Tests) > len(reasons[j].Tests)
+		}
+		return reasons[i].Reason < reasons[j].Reason
+	})
+	result := make([]SkipReason, 0, len(reasons))
+	for _, r := range reasons {
+		result = append(result, *r)
+	}
+	return result
+}
+
+// logLinePrefix matches the file:line prefix of a message logged by a test.
+// Before go1.14 the prefix also included the name of the test.
+var logLinePrefix = regexp.MustCompile(`^\s+(?:\S+: )?[^\s:]+\.go:\d+: ?`)
+
+// skipReason returns the message passed to t.Skip, which is the message
+// logged next to the --- SKIP line of the test. Since go1.14 the message is
+// printed before the --- SKIP line, and before go1.14 it is the last message
+// printed after it. The indented continuation lines of a multi-line message
+// are joined with a space. Any other output, like the output of a
+// fmt.Println, is not a reason.
+func skipReason(output []string, testName string) string {
+	var message []string
+	var indent int
+	var afterSkip bool
+	for _, line := range output {
+		line = strings.TrimRight(line, "\n")
+		trimmed := strings.TrimLeft(line, " \t")
+		// The framing lines of subtests are indented.
+		if isFramingLine(trimmed, testName) {
+			if strings.HasPrefix(trimmed, "--- SKIP") {
+				if len(message) > 0 {
+					return strings.Join(message, " ")
+				}
+				afterSkip = true
+			}
+			message = nil
+			continue
+		}
+		if loc := logLinePrefix.FindStringIndex(line); loc != nil {
+			message = []string{strings.TrimSpace(line[loc[1]:])}
+			indent = len(line) - len(trimmed)
+			continue
+		}
+		if len(message) > 0 && trimmed != "" && len(line)-len(trimmed) > indent {
+			message = append(message, trimmed)
+			continue
+		}
+		message = nil
+	}
+	if afterSkip {
+		return strings.Join(message, " ")
+	}
+	return ""
+}
+
+// noSkipReason is printed in place of the reason for tests which were skipped
+// without a message.
+const noSkipReason = "(no reason given)"
+
+func writeSkipReasonsSummary(out io.Writer, reasons []SkipReason) {
+	if len(reasons) == 0 {
+		return
+	}
+	fmt.Fprintln(out, color.YellowString("\n=== Skipped reasons"))
+	for _, r := range reasons {
+		reason := r.Reason
+		if reason == "" {
+			reason = color.RedString(noSkipReason)
+		}
+		names := make([]string, 0, len(r.Tests))
+		for _, tc := range r.Tests {
+			names = append(names, RelativePackagePath(tc.Package)+"."+tc.Test.Name())
+		}
+		fmt.Fprintf(out, "%s (%d %s): %s\n",
+			reason, len(r.Tests), pluralTests(len(r.Tests)), strings.Join(names, ", "))
+	}
+}
+
+func pluralTests(n int) string {
+	if n == 1 {
+		return "test"
+	}
+	return "tests"
+}
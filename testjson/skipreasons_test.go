@@ -0,0 +1,172 @@
+package testjson
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSkipReason(t *testing.T) {
+	type testCase struct {
+		name     string
+		testName string
+		output   []string
+		expected string
+	}
+	run := func(t *testing.T, tc testCase) {
+		assert.Equal(t, skipReason(tc.output, tc.testName), tc.expected)
+	}
+
+	testCases := []testCase{
+		{
+			name:     "message",
+			testName: "TestOne",
+			output: []string{
+				"=== RUN   TestOne\n",
+				"    one_test.go:12: not on this platform\n",
+				"--- SKIP: TestOne (0.00s)\n",
+			},
+			expected: "not on this platform",
+		},
+		{
+			name:     "no message",
+			testName: "TestOne",
+			output: []string{
+				"=== RUN   TestOne\n",
+				"--- SKIP: TestOne (0.00s)\n",
+			},
+		},
+		{
+			name:     "last message is the reason",
+			testName: "TestOne",
+			output: []string{
+				"=== RUN   TestOne\n",
+				"    one_test.go:10: checking the platform\n",
+				"    one_test.go:12: not on this platform\n",
+				"--- SKIP: TestOne (0.00s)\n",
+			},
+			expected: "not on this platform",
+		},
+		{
+			name:     "multi-line message",
+			testName: "TestOne",
+			output: []string{
+				"=== RUN   TestOne\n",
+				"    one_test.go:12: requires a database\n",
+				"        set DATABASE_URL to run\n",
+				"--- SKIP: TestOne (0.00s)\n",
+			},
+			expected: "requires a database set DATABASE_URL to run",
+		},
+		{
+			name:     "subtest",
+			testName: "TestOne/sub",
+			output: []string{
+				"=== RUN   TestOne/sub\n",
+				"        one_test.go:12: slow\n",
+				"    --- SKIP: TestOne/sub (0.00s)\n",
+			},
+			expected: "slow",
+		},
+		{
+			name:     "output after the message",
+			testName: "TestOne",
+			output: []string{
+				"=== RUN   TestOne\n",
+				"    one_test.go:10: checking the platform\n",
+				"unrelated output\n",
+				"--- SKIP: TestOne (0.00s)\n",
+			},
+		},
+		{
+			name:     "output after the skip line",
+			testName: "TestOne",
+			output: []string{
+				"=== RUN   TestOne\n",
+				"--- SKIP: TestOne (0.00s)\n",
+				"unrelated output\n",
+			},
+		},
+		{
+			name:     "prefix from go1.13",
+			testName: "TestOne",
+			output: []string{
+				"=== RUN   TestOne\n",
+				"--- SKIP: TestOne (0.00s)\n",
+				"    TestOne: one_test.go:12: not on this platform\n",
+			},
+			expected: "not on this platform",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestExecution_SkipReasons(t *testing.T) {
+	out := `{"Package": "example.com/one", "Test": "TestA", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "output", "Output": "    a_test.go:1: short mode\n"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "output", "Output": "--- SKIP: TestA (0.00s)\n"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "skip"}
+{"Package": "example.com/one", "Test": "TestB", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestB", "Action": "output", "Output": "--- SKIP: TestB (0.00s)\n"}
+{"Package": "example.com/one", "Test": "TestB", "Action": "skip"}
+{"Package": "example.com/one", "Test": "TestC", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestC", "Action": "output", "Output": "    c_test.go:1: short mode\n"}
+{"Package": "example.com/one", "Test": "TestC", "Action": "output", "Output": "--- SKIP: TestC (0.00s)\n"}
+{"Package": "example.com/one", "Test": "TestC", "Action": "skip"}
+{"Package": "example.com/one", "Action": "pass"}
+`
+	exec, err := ScanTestOutput(ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+
+	reasons := exec.SkipReasons()
+	assert.Equal(t, len(reasons), 2)
+	assert.Equal(t, reasons[0].Reason, "short mode")
+	assert.Equal(t, len(reasons[0].Tests), 2)
+	assert.Equal(t, reasons[1].Reason, "")
+	assert.Equal(t, reasons[1].Tests[0].Test.Name(), "TestB")
+
+	buf := new(bytes.Buffer)
+	writeSkipReasonsSummary(buf, reasons)
+	expected := `
+=== Skipped reasons
+short mode (2 tests): example.com/one.TestA, example.com/one.TestC
+(no reason given) (1 test): example.com/one.TestB
+`
+	assert.Equal(t, buf.String(), expected)
+}
+
+func TestPrintSummary_SkippedReasonsHiddenWithSkipped(t *testing.T) {
+	out := `{"Package": "example.com/one", "Test": "TestA", "Action": "run"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "output", "Output": "    a_test.go:1: short mode\n"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "output", "Output": "--- SKIP: TestA (0.00s)\n"}
+{"Package": "example.com/one", "Test": "TestA", "Action": "skip"}
+{"Package": "example.com/one", "Action": "pass"}
+`
+	exec, err := ScanTestOutput(ScanConfig{
+		Stdout: strings.NewReader(out),
+		Stderr: strings.NewReader(""),
+	})
+	assert.NilError(t, err)
+
+	buf := new(bytes.Buffer)
+	PrintSummary(buf, exec, SummarizeAll|SummarizeSkippedReasons)
+	assert.Assert(t, strings.Contains(buf.String(), "=== Skipped reasons"), buf.String())
+
+	buf.Reset()
+	PrintSummary(buf, exec, SummarizeAll)
+	assert.Assert(t, !strings.Contains(buf.String(), "=== Skipped reasons"), buf.String())
+
+	buf.Reset()
+	PrintSummary(buf, exec, (SummarizeAll|SummarizeSkippedReasons)&^SummarizeSkipped)
+	assert.Assert(t, !strings.Contains(buf.String(), "=== Skipped reasons"), buf.String())
+}
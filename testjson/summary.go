@@ -3,6 +3,7 @@ package testjson
 import (
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
 	"time"
 	"unicode"
@@ -21,23 +22,30 @@ const (
 	SummarizeFailed
 	SummarizeErrors
 	SummarizeOutput
+	SummarizeWarnings
+	SummarizeSkippedReasons
 	SummarizeAll = SummarizeSkipped | SummarizeFailed | SummarizeErrors | SummarizeOutput
 )
 
 var summaryValues = map[Summary]string{
-	SummarizeSkipped: "skipped",
-	SummarizeFailed:  "failed",
-	SummarizeErrors:  "errors",
-	SummarizeOutput:  "output",
+	SummarizeSkipped:        "skipped",
+	SummarizeFailed:         "failed",
+	SummarizeErrors:         "errors",
+	SummarizeOutput:         "output",
+	SummarizeWarnings:       "warnings",
+	SummarizeSkippedReasons: "skipped-reasons",
 }
 
 var summaryFromValue = map[string]Summary{
-	"none":    SummarizeNone,
-	"skipped": SummarizeSkipped,
-	"failed":  SummarizeFailed,
-	"errors":  SummarizeErrors,
-	"output":  SummarizeOutput,
-	"all":     SummarizeAll,
+	"none":     SummarizeNone,
+	"skipped":  SummarizeSkipped,
+	"failed":   SummarizeFailed,
+	"errors":   SummarizeErrors,
+	"output":   SummarizeOutput,
+	"warnings": SummarizeWarnings,
+	"all":      SummarizeAll,
+
+	"skipped-reasons": SummarizeSkippedReasons,
 }
 
 func (s Summary) String() string {
@@ -68,12 +76,94 @@ func NewSummary(value string) (Summary, bool) {
 // PrintSummary of a test Execution. Prints a section for each summary type
 // followed by a DONE line to out.
 func PrintSummary(out io.Writer, execution *Execution, opts Summary) {
+	PrintSummaryWithConfig(out, execution, SummaryConfig{Summary: opts})
+}
+
+// SummaryConfig is used to customize the output of PrintSummaryWithConfig.
+type SummaryConfig struct {
+	// Summary selects the sections to print.
+	Summary Summary
+	// FailureSource is used to print the source code around the location of
+	// each failure in the failed section. If nil, no source is printed.
+	FailureSource *FailureSource
+	// MaxFailuresOutput is the maximum number of failures printed with their
+	// output in the failed section. Any other failures are listed by name.
+	// A value of 0 means no limit.
+	MaxFailuresOutput int
+	// Incomplete prints a section with the tests that never finished.
+	Incomplete bool
+	// DurationHistogram prints a section with the number of tests in each
+	// duration bucket. See Execution.DurationHistogram for the buckets.
+	DurationHistogram bool
+	// ExpectedFailure returns true if the failed test was expected to fail.
+	// Expected failures are listed by name in a separate section, instead of
+	// the failed section, and are not counted as failures. If nil, all
+	// failures are unexpected.
+	ExpectedFailure func(tc TestCase) bool
+	// CollapseRepeats replaces each run of at least this number of identical
+	// consecutive lines, in the output of failed tests, with a single line
+	// followed by the number of times it was repeated. A value of 0 means the
+	// output is printed unchanged.
+	CollapseRepeats int
+	// PassRate prints the percentage of test runs which passed after the
+	// DONE line. Skipped tests are not counted, unless PassRateIncludeSkipped
+	// is true.
+	PassRate               bool
+	PassRateIncludeSkipped bool
+	// DataRaces lists the failed tests which reported a data race in a
+	// separate section, instead of the failed section, and counts them as
+	// data races instead of failures.
+	DataRaces bool
+	// RunCount adds the number of times a failed test was run to the name of
+	// each failed test which ran more than once (ex: with reruns).
+	RunCount bool
+}
+
+// PrintSummaryWithConfig is the same as PrintSummary, with additional options
+// from cfg.
+func PrintSummaryWithConfig(out io.Writer, execution *Execution, cfg SummaryConfig) {
+	opts := cfg.Summary
+	failed, expected := splitExpectedFailures(execution.Failed(), cfg.ExpectedFailure)
+	var raced []TestCase
+	if cfg.DataRaces {
+		failed, raced = splitRaced(execution, failed)
+	}
 	execSummary := newExecSummary(execution, opts)
 	if opts.Includes(SummarizeSkipped) {
 		writeTestCaseSummary(out, execSummary, formatSkipped())
 	}
+	// The skipped reasons are part of the skipped section, so they are hidden
+	// along with it.
+	if opts.Includes(SummarizeSkipped | SummarizeSkippedReasons) {
+		writeSkipReasonsSummary(out, execution.SkipReasons())
+	}
 	if opts.Includes(SummarizeFailed) {
-		writeTestCaseSummary(out, execSummary, formatFailed())
+		var runCounts map[testRunCountKey]int
+		if cfg.RunCount {
+			runCounts = newRunCounts(execution)
+		}
+		conf := formatFailed()
+		conf.runCounts = runCounts
+		conf.source = cfg.FailureSource
+		conf.maxOutput = cfg.MaxFailuresOutput
+		conf.collapseRepeats = cfg.CollapseRepeats
+		conf.getter = func(executionSummary) []TestCase {
+			return failed
+		}
+		writeTestCaseSummary(out, execSummary, conf)
+		writeRacedSummary(out, execSummary, raced, cfg, runCounts)
+		writeShuffleSummary(out, execution)
+		writeExpectedFailuresSummary(out, expected)
+	}
+	if cfg.Incomplete {
+		writeIncompleteSummary(out, execution.Incomplete())
+	}
+	if cfg.DurationHistogram {
+		writeDurationHistogram(out, execution.DurationHistogram())
+	}
+
+	if opts.Includes(SummarizeWarnings) {
+		writeWarningSummary(out, execution.Warnings())
 	}
 
 	errors := execution.Errors()
@@ -81,13 +171,37 @@ func PrintSummary(out io.Writer, execution *Execution, opts Summary) {
 		writeErrorSummary(out, errors)
 	}
 
-	fmt.Fprintf(out, "\n%s %d tests%s%s%s in %s\n",
+	fmt.Fprintf(out, "\n%s %d tests%s%s%s%s%s in %s\n",
 		formatExecStatus(execution),
 		execution.Total(),
 		formatTestCount(len(execution.Skipped()), "skipped", ""),
-		formatTestCount(len(execution.Failed()), "failure", "s"),
+		formatTestCount(len(failed), "failure", "s"),
+		formatTestCount(len(expected), "expected failure", "s"),
+		formatTestCount(len(raced), "data race", "s"),
 		formatTestCount(countErrors(errors), "error", "s"),
 		FormatDurationAsSeconds(execution.Elapsed(), 3))
+	if cfg.PassRate {
+		fmt.Fprintln(out, formatPassRate(execution, cfg.PassRateIncludeSkipped))
+	}
+}
+
+// formatPassRate returns the percentage of the test runs in execution which
+// passed. Each run of a test is counted, including re-runs. Skipped tests are
+// counted as not passed when includeSkipped is true, and are otherwise
+// ignored.
+func formatPassRate(execution *Execution, includeSkipped bool) string {
+	var passed, total int
+	for _, pkg := range execution.packages {
+		passed += len(pkg.Passed)
+		total += len(pkg.Passed) + len(pkg.Failed)
+		if includeSkipped {
+			total += len(pkg.Skipped)
+		}
+	}
+	if total == 0 {
+		return "pass rate: n/a"
+	}
+	return fmt.Sprintf("pass rate: %.1f%% (%d/%d)", float64(passed)*100/float64(total), passed, total)
 }
 
 func formatTestCount(count int, category string, pluralize string) string {
@@ -120,6 +234,15 @@ func FormatDurationAsSeconds(d time.Duration, precision int) string {
 	return fmt.Sprintf("%.[2]*[1]fs", d.Seconds(), precision)
 }
 
+func writeWarningSummary(out io.Writer, warnings []Warning) {
+	if len(warnings) > 0 {
+		fmt.Fprintln(out, color.YellowString("\n=== Warnings"))
+	}
+	for _, w := range warnings {
+		fmt.Fprintln(out, w)
+	}
+}
+
 func writeErrorSummary(out io.Writer, errors []string) {
 	if len(errors) > 0 {
 		fmt.Fprintln(out, color.MagentaString("\n=== Errors"))
@@ -129,6 +252,95 @@ func writeErrorSummary(out io.Writer, errors []string) {
 	}
 }
 
+// splitExpectedFailures returns the failures which were not expected, and the
+// failures which were expected by isExpected.
+func splitExpectedFailures(failures []TestCase, isExpected func(TestCase) bool) ([]TestCase, []TestCase) {
+	if isExpected == nil {
+		return failures, nil
+	}
+	var failed, expected []TestCase
+	for _, tc := range failures {
+		if isExpected(tc) {
+			expected = append(expected, tc)
+			continue
+		}
+		failed = append(failed, tc)
+	}
+	return failed, expected
+}
+
+// writeExpectedFailuresSummary prints the names of the failed tests which
+// were expected to fail.
+func writeExpectedFailuresSummary(out io.Writer, expected []TestCase) {
+	if len(expected) == 0 {
+		return
+	}
+	fmt.Fprintln(out, color.YellowString("\n=== Expected failures"))
+	for _, tc := range expected {
+		fmt.Fprintf(out, "=== %s: %s %s%s (%s)\n",
+			color.YellowString("EXPECTED FAIL"),
+			RelativePackagePath(tc.Package),
+			tc.Test,
+			formatRunID(tc.RunID),
+			FormatDurationAsSeconds(tc.Elapsed, 2))
+	}
+}
+
+// writeIncompleteSummary prints the tests that started but never finished.
+func writeIncompleteSummary(out io.Writer, incomplete []TestCase) {
+	if len(incomplete) == 0 {
+		return
+	}
+	fmt.Fprintln(out, "\n=== Incomplete")
+	for _, tc := range incomplete {
+		fmt.Fprintf(out, "=== INCOMPLETE: %s %s%s\n",
+			RelativePackagePath(tc.Package), tc.Test, formatRunID(tc.RunID))
+	}
+}
+
+// writeShuffleSummary prints a command to reproduce the failures of each
+// package that was run with -shuffle, using the same seed.
+func writeShuffleSummary(out io.Writer, execution *Execution) {
+	var lines []string
+	for _, name := range execution.Packages() {
+		pkg := execution.Package(name)
+		seed := pkg.ShuffleSeed()
+		if seed == "" || (pkg.Metrics().Failed == 0 && !pkg.TestMainFailed()) {
+			continue
+		}
+
+		var runFlag string
+		if names := failedRootTestNames(pkg); len(names) > 0 {
+			runFlag = fmt.Sprintf("-run '^(%s)$' ", strings.Join(names, "|"))
+		}
+		lines = append(lines, fmt.Sprintf(
+			"reproduce with: go test %s-shuffle=%s %s", runFlag, seed, name))
+	}
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Fprintln(out, color.RedString("\n=== Shuffle"))
+	for _, line := range lines {
+		fmt.Fprintln(out, line)
+	}
+}
+
+// failedRootTestNames returns the unique names of the root tests of all the
+// failed tests in pkg.
+func failedRootTestNames(pkg *Package) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, tc := range pkg.Failed {
+		root, _ := tc.Test.Split()
+		if seen[root] {
+			continue
+		}
+		seen[root] = true
+		names = append(names, regexp.QuoteMeta(root))
+	}
+	return names
+}
+
 // countErrors in stderr lines. Build errors may include multiple lines where
 // subsequent lines are indented.
 // FIXME: Panics will include multiple lines, and are still overcounted.
@@ -147,6 +359,7 @@ type executionSummary interface {
 	Failed() []TestCase
 	Skipped() []TestCase
 	OutputLines(TestCase) []string
+	Package(name string) *Package
 }
 
 type noOutputSummary struct {
@@ -170,20 +383,41 @@ func writeTestCaseSummary(out io.Writer, execution executionSummary, conf testCa
 		return
 	}
 	fmt.Fprintln(out, "\n=== "+conf.header)
+	_, isNoOutput := execution.(*noOutputSummary)
+	maxOutput := conf.maxOutput
+	if isNoOutput {
+		maxOutput = 0
+	}
 	for idx, tc := range testCases {
+		omitOutput := maxOutput > 0 && idx >= maxOutput
+		if maxOutput > 0 && idx == maxOutput {
+			fmt.Fprintf(out, "=== and %d more failures, output omitted\n", len(testCases)-idx)
+		}
+
 		fmt.Fprintf(out, "=== %s: %s %s%s (%s)\n",
 			conf.prefix,
 			RelativePackagePath(tc.Package),
 			tc.Test,
-			formatRunID(tc.RunID),
+			formatRunAnnotation(tc, conf.runCounts),
 			FormatDurationAsSeconds(tc.Elapsed, 2))
-		for _, line := range execution.OutputLines(tc) {
+		if omitOutput {
+			continue
+		}
+		output := execution.OutputLines(tc)
+		var lines []string
+		for _, line := range output {
 			if isFramingLine(line, tc.Test.Name()) {
 				continue
 			}
+			lines = append(lines, line)
+		}
+		for _, line := range collapseRepeatedLines(lines, conf.collapseRepeats) {
 			fmt.Fprint(out, line)
 		}
-		if _, isNoOutput := execution.(*noOutputSummary); !isNoOutput && idx+1 != len(testCases) {
+		if conf.source != nil {
+			conf.source.write(out, tc, output)
+		}
+		if !isNoOutput && idx+1 != len(testCases) {
 			fmt.Fprintln(out)
 		}
 	}
@@ -193,6 +427,83 @@ type testCaseFormatConfig struct {
 	header string
 	prefix string
 	getter func(executionSummary) []TestCase
+	// source is used to print the source around the location of the failure.
+	source *FailureSource
+	// maxOutput is the maximum number of test cases printed with output. Any
+	// other test cases are printed without output. 0 means no limit.
+	maxOutput int
+	// runCounts is the number of times each test was run, used to print the
+	// number of runs of tests which ran more than once. When nil, the number
+	// of runs is not printed.
+	runCounts map[testRunCountKey]int
+	// collapseRepeats is the minimum number of identical consecutive lines
+	// which are collapsed into one line. 0 means lines are never collapsed.
+	collapseRepeats int
+}
+
+// collapseRepeatedLines returns lines with each run of at least threshold
+// identical consecutive lines replaced by the first line of the run, followed
+// by a line with the number of times it was repeated. The first line is
+// printed unchanged, and the count line has the same indentation.
+func collapseRepeatedLines(lines []string, threshold int) []string {
+	if threshold <= 1 {
+		return lines
+	}
+	result := make([]string, 0, len(lines))
+	for i := 0; i < len(lines); {
+		count := 1
+		for i+count < len(lines) && lines[i+count] == lines[i] {
+			count++
+		}
+		if count < threshold {
+			result = append(result, lines[i:i+count]...)
+			i += count
+			continue
+		}
+		first := lines[i]
+		indent := first[:len(first)-len(strings.TrimLeft(first, " \t"))]
+		repeated := fmt.Sprintf("%v(repeated %d times)\n", indent, count)
+		if !strings.HasSuffix(first, "\n") {
+			repeated = "\n" + repeated
+		}
+		result = append(result, first, repeated)
+		i += count
+	}
+	return result
+}
+
+// testRunCountKey identifies a test by package and name, from all runs.
+type testRunCountKey struct {
+	pkg  string
+	test TestName
+}
+
+// newRunCounts returns the number of times each test in execution was run.
+func newRunCounts(execution *Execution) map[testRunCountKey]int {
+	counts := make(map[testRunCountKey]int)
+	for name, pkg := range execution.packages {
+		for _, group := range [][]TestCase{pkg.Failed, pkg.Passed, pkg.Skipped} {
+			for _, tc := range group {
+				counts[testRunCountKey{pkg: name, test: tc.Test}]++
+			}
+		}
+	}
+	return counts
+}
+
+// formatRunAnnotation returns the rerun annotation of tc from formatRunID,
+// with the number of times the test was run added when runCounts is not nil
+// and the test was run more than once (ex: (re-run 1, ran 3 times)).
+func formatRunAnnotation(tc TestCase, runCounts map[testRunCountKey]int) string {
+	count := runCounts[testRunCountKey{pkg: tc.Package, test: tc.Test}]
+	switch {
+	case count <= 1:
+		return formatRunID(tc.RunID)
+	case tc.RunID <= 0:
+		return fmt.Sprintf(" (ran %d times)", count)
+	default:
+		return fmt.Sprintf(" (re-run %d, ran %d times)", tc.RunID, count)
+	}
 }
 
 func formatFailed() testCaseFormatConfig {
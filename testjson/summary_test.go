@@ -224,10 +224,133 @@ func patchTimeNow(t *testing.T) {
 	})
 }
 
+func TestPrintSummaryWithConfig_MaxFailuresOutput(t *testing.T) {
+	patchTimeNow(t)
+	exec, err := ScanTestOutput(scanConfigFromGolden("input/go-test-json.out")(t))
+	assert.NilError(t, err)
+
+	buf := new(bytes.Buffer)
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{
+		Summary:           SummarizeFailed | SummarizeOutput,
+		MaxFailuresOutput: 3,
+	})
+	golden.Assert(t, buf.String(), "summary/max-failures-output")
+}
+
+func TestPrintSummaryWithConfig_ExpectedFailure(t *testing.T) {
+	patchTimeNow(t)
+	exec, err := ScanTestOutput(scanConfigFromGolden("input/go-test-json.out")(t))
+	assert.NilError(t, err)
+
+	buf := new(bytes.Buffer)
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{
+		Summary: SummarizeFailed,
+		ExpectedFailure: func(tc TestCase) bool {
+			root, _ := tc.Test.Split()
+			return root == "TestNestedWithFailure"
+		},
+	})
+	golden.Assert(t, buf.String(), "summary/expected-failure")
+}
+
+func TestCollapseRepeatedLines(t *testing.T) {
+	type testCase struct {
+		name      string
+		lines     []string
+		threshold int
+		expected  []string
+	}
+	run := func(t *testing.T, tc testCase) {
+		assert.DeepEqual(t, collapseRepeatedLines(tc.lines, tc.threshold), tc.expected)
+	}
+	testCases := []testCase{
+		{
+			name:      "disabled",
+			lines:     multiLine("a\na\na\n"),
+			threshold: 0,
+			expected:  multiLine("a\na\na\n"),
+		},
+		{
+			name:      "fewer than threshold",
+			lines:     []string{"a\n", "a\n", "b\n"},
+			threshold: 3,
+			expected:  []string{"a\n", "a\n", "b\n"},
+		},
+		{
+			name:      "collapsed",
+			lines:     []string{"start\n", "    retrying\n", "    retrying\n", "    retrying\n", "end\n"},
+			threshold: 3,
+			expected:  []string{"start\n", "    retrying\n", "    (repeated 3 times)\n", "end\n"},
+		},
+		{
+			name:      "only consecutive lines",
+			lines:     []string{"a\n", "a\n", "b\n", "a\n", "a\n"},
+			threshold: 2,
+			expected:  []string{"a\n", "(repeated 2 times)\n", "b\n", "a\n", "(repeated 2 times)\n"},
+		},
+		{
+			name:      "without newline",
+			lines:     []string{"a", "a"},
+			threshold: 2,
+			expected:  []string{"a", "\n(repeated 2 times)\n"},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			run(t, tc)
+		})
+	}
+}
+
+func TestFormatPassRate(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "one", Test: "TestA", Action: ActionRun},
+		{Package: "one", Test: "TestA", Action: ActionPass},
+		{Package: "one", Test: "TestB", Action: ActionRun},
+		{Package: "one", Test: "TestB", Action: ActionFail},
+		{Package: "two", Test: "TestC", Action: ActionRun},
+		{Package: "two", Test: "TestC", Action: ActionPass},
+		{Package: "two", Test: "TestD", Action: ActionRun},
+		{Package: "two", Test: "TestD", Action: ActionSkip},
+	} {
+		exec.add(event)
+	}
+	assert.Equal(t, formatPassRate(exec, false), "pass rate: 66.7% (2/3)")
+	assert.Equal(t, formatPassRate(exec, true), "pass rate: 50.0% (2/4)")
+	assert.Equal(t, formatPassRate(newExecution(), false), "pass rate: n/a")
+}
+
+func TestPrintSummaryWithConfig_PassRate(t *testing.T) {
+	patchTimeNow(t)
+	exec, err := ScanTestOutput(scanConfigFromGolden("input/go-test-json.out")(t))
+	assert.NilError(t, err)
+
+	buf := new(bytes.Buffer)
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{
+		Summary:  SummarizeNone,
+		PassRate: true,
+	})
+	golden.Assert(t, buf.String(), "summary/pass-rate")
+}
+
 func multiLine(s string) []string {
 	return strings.SplitAfter(s, "\n")
 }
 
+func TestPrintSummaryWithConfig_Incomplete(t *testing.T) {
+	patchTimeNow(t)
+	exec, err := ScanTestOutput(scanConfigFromGolden("go-test-json-missing-test-events.out")(t))
+	assert.NilError(t, err)
+
+	buf := new(bytes.Buffer)
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{
+		Summary:    SummarizeNone,
+		Incomplete: true,
+	})
+	golden.Assert(t, buf.String(), "summary/incomplete")
+}
+
 func TestPrintSummary(t *testing.T) {
 	patchTimeNow(t)
 
@@ -295,6 +418,11 @@ func TestPrintSummary(t *testing.T) {
 			},
 			expectedOut: "summary/bug-repeated-test-case-output",
 		},
+		{
+			name:        "with shuffle",
+			config:      scanConfigFromGolden("input/go-test-json-with-shuffle.out"),
+			expectedOut: "summary/with-shuffle",
+		},
 		{
 			name: "with rerun id",
 			config: func(t *testing.T) ScanConfig {
@@ -319,3 +447,34 @@ func scanConfigFromGolden(filename string) func(t *testing.T) ScanConfig {
 		return ScanConfig{Stdout: bytes.NewReader(golden.Get(t, filename))}
 	}
 }
+
+func TestPrintSummaryWithConfig_RunCount(t *testing.T) {
+	exec := newExecution()
+	for _, event := range []TestEvent{
+		{Package: "one", Test: "TestA", Action: ActionRun},
+		{Package: "one", Test: "TestA", Action: ActionFail},
+		{Package: "one", Test: "TestB", Action: ActionRun},
+		{Package: "one", Test: "TestB", Action: ActionFail},
+		{Package: "one", Action: ActionFail},
+		{Package: "one", Test: "TestA", Action: ActionRun, RunID: 1},
+		{Package: "one", Test: "TestA", Action: ActionFail, RunID: 1},
+		{Package: "one", Test: "TestA", Action: ActionRun, RunID: 2},
+		{Package: "one", Test: "TestA", Action: ActionPass, RunID: 2},
+	} {
+		exec.add(event)
+	}
+
+	buf := new(bytes.Buffer)
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{Summary: SummarizeFailed, RunCount: true})
+	expected := `
+=== Failed
+=== FAIL: one TestA (ran 3 times) (0.00s)
+=== FAIL: one TestB (0.00s)
+=== FAIL: one TestA (re-run 1, ran 3 times) (0.00s)
+`
+	assert.Assert(t, strings.HasPrefix(buf.String(), expected), buf.String())
+
+	buf.Reset()
+	PrintSummaryWithConfig(buf, exec, SummaryConfig{Summary: SummarizeFailed})
+	assert.Assert(t, strings.Contains(buf.String(), "=== FAIL: one TestA (re-run 1) (0.00s)\n"), buf.String())
+}
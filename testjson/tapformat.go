@@ -0,0 +1,152 @@
+package testjson
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// tapFormatter prints the results of a run as a single TAP version 13
+// document. Each package is a subtest with its own indented plan, followed by
+// a test point for the package. The plan line of a subtest must be printed
+// before its results, so the results are buffered until the package is done.
+// The plan of the document is printed by Close, after the last package.
+type tapFormatter struct {
+	buf  *bufio.Writer
+	pkgs map[string]*tapPackage
+	// count is the number of packages written to the document.
+	count int
+}
+
+type tapPackage struct {
+	results []tapResult
+	// output of each test that is still running, and the package output with
+	// the key "".
+	output map[string][]string
+}
+
+type tapResult struct {
+	name   string
+	action Action
+	output []string
+}
+
+func tapFormat(out io.Writer) EventFormatter {
+	return &tapFormatter{
+		buf:  bufio.NewWriter(out),
+		pkgs: make(map[string]*tapPackage),
+	}
+}
+
+func (f *tapFormatter) Format(event TestEvent, _ *Execution) error {
+	pkg, ok := f.pkgs[event.Package]
+	if !ok {
+		pkg = &tapPackage{output: make(map[string][]string)}
+		f.pkgs[event.Package] = pkg
+	}
+
+	switch {
+	case event.Action == ActionOutput:
+		if !isFramingLine(event.Output, event.Test) {
+			pkg.output[event.Test] = append(pkg.output[event.Test], event.Output)
+		}
+		return nil
+	case !event.Action.IsTerminal():
+		return nil
+	case event.Test != "":
+		pkg.results = append(pkg.results, tapResult{
+			name:   event.Test,
+			action: event.Action,
+			output: pkg.output[event.Test],
+		})
+		delete(pkg.output, event.Test)
+		return nil
+	}
+
+	delete(f.pkgs, event.Package)
+	results := pkg.results
+	// A package can fail without any failed tests, for example when the
+	// package fails to build, or TestMain exits non-zero.
+	if event.Action == ActionFail && !hasTAPFailure(results) {
+		results = append(results, tapResult{
+			name:   RelativePackagePath(event.Package),
+			action: ActionFail,
+			output: pkg.output[""],
+		})
+	}
+	f.writePackage(event.Package, results, event.Action)
+	return f.buf.Flush()
+}
+
+func hasTAPFailure(results []tapResult) bool {
+	for _, r := range results {
+		if r.action == ActionFail {
+			return true
+		}
+	}
+	return false
+}
+
+func (f *tapFormatter) writePackage(name string, results []tapResult, action Action) {
+	f.writeHeader()
+	f.count++
+	pkgName := tapEscape(RelativePackagePath(name))
+	f.buf.WriteString("    # Subtest: " + pkgName + "\n")
+	if len(results) == 0 {
+		f.buf.WriteString("    1..0 # SKIP no tests\n")
+		fmt.Fprintf(f.buf, "ok %d - %s # SKIP no tests\n", f.count, pkgName)
+		return
+	}
+	fmt.Fprintf(f.buf, "    1..%d\n", len(results))
+
+	for i, r := range results {
+		fmt.Fprintf(f.buf, "    %s %d - %s", tapStatus(r.action), i+1, tapEscape(r.name))
+		if r.action == ActionSkip {
+			f.buf.WriteString(" # SKIP")
+		}
+		f.buf.WriteString("\n")
+
+		if r.action == ActionFail && len(r.output) > 0 {
+			writeTAPOutput(f.buf, "    ", r.output)
+		}
+	}
+	fmt.Fprintf(f.buf, "%s %d - %s\n", tapStatus(action), f.count, pkgName)
+}
+
+func (f *tapFormatter) writeHeader() {
+	if f.count == 0 {
+		f.buf.WriteString("TAP version 13\n")
+	}
+}
+
+// Close writes the plan of the document.
+func (f *tapFormatter) Close() error {
+	f.writeHeader()
+	fmt.Fprintf(f.buf, "1..%d\n", f.count)
+	return f.buf.Flush()
+}
+
+func tapStatus(action Action) string {
+	if action == ActionFail {
+		return "not ok"
+	}
+	return "ok"
+}
+
+// writeTAPOutput writes the output of a failed test as a YAML diagnostic
+// block.
+func writeTAPOutput(buf *bufio.Writer, indent string, output []string) {
+	buf.WriteString(indent + "  ---\n")
+	buf.WriteString(indent + "  output: |\n")
+	for _, line := range output {
+		buf.WriteString(indent + "    " + strings.TrimRight(line, "\n") + "\n")
+	}
+	buf.WriteString(indent + "  ...\n")
+}
+
+// tapEscape escapes the characters that have a special meaning in the
+// description of a TAP test point.
+func tapEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "#", `\#`).Replace(s)
+}
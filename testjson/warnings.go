@@ -0,0 +1,115 @@
+package testjson
+
+import (
+	"strings"
+)
+
+// WarningKind identifies the diagnostic that was recognized in a Warning.
+type WarningKind string
+
+const (
+	// WarningNoTestsToRun is reported when a test binary ran, but the -run
+	// pattern did not match any tests.
+	WarningNoTestsToRun WarningKind = "no tests to run"
+	// WarningNoTestFiles is reported for a package with no test files.
+	WarningNoTestFiles WarningKind = "no test files"
+	// WarningVet is reported for each finding from the vet checks run by
+	// go test.
+	WarningVet WarningKind = "vet"
+	// WarningGo is reported for any other warning printed by go test to
+	// stderr.
+	WarningGo WarningKind = "go"
+)
+
+// Warning is a non-fatal diagnostic printed by go test, or by a test binary.
+type Warning struct {
+	// Package is the import path of the package, or an empty string if the
+	// warning is not associated with a package.
+	Package string
+	Kind    WarningKind
+	// Message is the line of output that was recognized as a warning.
+	Message string
+}
+
+func (w Warning) String() string {
+	if w.Package == "" {
+		return w.Message
+	}
+	return RelativePackagePath(w.Package) + ": " + w.Message
+}
+
+// warningFromEvent returns a Warning if the output from the event is a
+// recognized diagnostic.
+func warningFromEvent(event TestEvent) (Warning, bool) {
+	if event.Action != ActionOutput {
+		return Warning{}, false
+	}
+	output := strings.TrimSpace(event.Output)
+	switch {
+	case output == "testing: warning: no tests to run":
+		return Warning{Package: event.Package, Kind: WarningNoTestsToRun, Message: output}, true
+	case strings.HasSuffix(output, "[no test files]"):
+		return Warning{Package: event.Package, Kind: WarningNoTestFiles, Message: "no test files"}, true
+	}
+	return Warning{}, false
+}
+
+// stderrWarnings recognizes warnings in the lines written to stderr by go test.
+// Vet findings are printed after a header with the package name in square
+// brackets (ex: # [example.com/pkg]). A vet finding fails the package, so it
+// is recorded as an error as well as a warning.
+type stderrWarnings struct {
+	vetPkg string
+}
+
+func (s *stderrWarnings) parse(line string) (Warning, bool) {
+	if strings.HasPrefix(line, "# ") {
+		s.vetPkg = ""
+		header := strings.TrimPrefix(line, "# ")
+		if strings.HasPrefix(header, "[") && strings.HasSuffix(header, "]") {
+			s.vetPkg = strings.TrimSuffix(strings.TrimPrefix(header, "["), "]")
+		}
+		return Warning{}, false
+	}
+	switch {
+	case s.vetPkg != "":
+		return Warning{Package: s.vetPkg, Kind: WarningVet, Message: line}, true
+	case strings.HasPrefix(line, "vet: "):
+		return Warning{Kind: WarningVet, Message: line}, true
+	case strings.HasPrefix(line, "warning:"):
+		return Warning{Kind: WarningGo, Message: line}, true
+	}
+	return Warning{}, false
+}
+
+// addWarning adds w to the list of warnings, unless the same warning was
+// already added by a previous run.
+func (e *Execution) addWarning(w Warning) {
+	e.errorsLock.Lock()
+	defer e.errorsLock.Unlock()
+	for _, existing := range e.warnings {
+		if existing == w {
+			return
+		}
+	}
+	e.warnings = append(e.warnings, w)
+}
+
+// Warnings returns a list of all the non-fatal diagnostics that were
+// recognized in the output.
+func (e *Execution) Warnings() []Warning {
+	e.errorsLock.RLock()
+	defer e.errorsLock.RUnlock()
+	return e.warnings
+}
+
+// WarningsOfKind returns the warnings that match kind.
+func (e *Execution) WarningsOfKind(kind WarningKind) []Warning {
+	var result []Warning
+	for _, w := range e.Warnings() {
+		if w.Kind == kind {
+			result = append(result, w)
+		}
+	}
+	return result
+}
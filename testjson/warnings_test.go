@@ -0,0 +1,60 @@
+package testjson
+
+import (
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestScanTestOutput_Warnings(t *testing.T) {
+	stdout := `{"Package": "example.com/one", "Action": "output", "Output": "testing: warning: no tests to run\n"}
+{"Package": "example.com/one", "Action": "pass"}
+{"Package": "example.com/two", "Action": "output", "Output": "?   \texample.com/two\t[no test files]\n"}
+{"Package": "example.com/two", "Action": "skip"}
+`
+	stderr := `warning: no packages being tested depend on matches for pattern ./other
+# example.com/three
+# [example.com/three]
+./three_test.go:10:2: fmt.Printf format %d has arg "x" of wrong type string
+# example.com/four
+./four.go:3:1: syntax error: non-declaration statement outside function body
+`
+	exec, err := ScanTestOutput(ScanConfig{
+		Stdout: strings.NewReader(stdout),
+		Stderr: strings.NewReader(stderr),
+	})
+	assert.NilError(t, err)
+
+	expected := []Warning{
+		{Package: "example.com/one", Kind: WarningNoTestsToRun, Message: "testing: warning: no tests to run"},
+		{Package: "example.com/two", Kind: WarningNoTestFiles, Message: "no test files"},
+		{Kind: WarningGo, Message: "warning: no packages being tested depend on matches for pattern ./other"},
+		{
+			Package: "example.com/three",
+			Kind:    WarningVet,
+			Message: `./three_test.go:10:2: fmt.Printf format %d has arg "x" of wrong type string`,
+		},
+	}
+	assert.DeepEqual(t, sortWarnings(exec.Warnings()), expected)
+	assert.DeepEqual(t, exec.Errors(), []string{
+		`./three_test.go:10:2: fmt.Printf format %d has arg "x" of wrong type string`,
+		"./four.go:3:1: syntax error: non-declaration statement outside function body",
+	})
+	assert.Equal(t, len(exec.WarningsOfKind(WarningVet)), 1)
+}
+
+// sortWarnings puts the warnings from stdout first, because stdout and stderr
+// are scanned concurrently.
+func sortWarnings(warnings []Warning) []Warning {
+	var fromStdout, fromStderr []Warning
+	for _, w := range warnings {
+		switch w.Kind {
+		case WarningNoTestsToRun, WarningNoTestFiles:
+			fromStdout = append(fromStdout, w)
+		default:
+			fromStderr = append(fromStderr, w)
+		}
+	}
+	return append(fromStdout, fromStderr...)
+}
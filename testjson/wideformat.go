@@ -0,0 +1,123 @@
+package testjson
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"golang.org/x/term"
+)
+
+// DefaultWideNameWidth is the default maximum width of the test name column
+// in the wide format.
+const DefaultWideNameWidth = 80
+
+// wideFormatter prints a row for each test with columns for the status,
+// package, test name, and elapsed time. The rows of each package are aligned
+// when the package completes.
+type wideFormatter struct {
+	out       io.Writer
+	nameWidth int
+	rows      map[string][]wideRow
+}
+
+type wideRow struct {
+	event TestEvent
+	name  string
+}
+
+func newWideFormatter(out io.Writer, opts FormatOptions) EventFormatter {
+	if !isTerminal(out) {
+		return wideFormatUnaligned(out, opts)
+	}
+	return wideFormatAligned(out, opts)
+}
+
+// isTerminal returns true if out is a file which is a terminal.
+func isTerminal(out io.Writer) bool {
+	f, ok := out.(interface{ Fd() uintptr })
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+func wideFormatAligned(out io.Writer, opts FormatOptions) EventFormatter {
+	return &wideFormatter{
+		out:       out,
+		nameWidth: wideNameWidth(opts),
+		rows:      make(map[string][]wideRow),
+	}
+}
+
+func wideNameWidth(opts FormatOptions) int {
+	if opts.WideNameWidth == 0 {
+		return DefaultWideNameWidth
+	}
+	return opts.WideNameWidth
+}
+
+func (f *wideFormatter) Format(event TestEvent, _ *Execution) error {
+	if !event.Action.IsTerminal() {
+		return nil
+	}
+	row := wideRow{event: event, name: truncateName(event.Test, f.nameWidth)}
+	f.rows[event.Package] = append(f.rows[event.Package], row)
+	if !event.PackageEvent() {
+		return nil
+	}
+
+	rows := f.rows[event.Package]
+	delete(f.rows, event.Package)
+	w := tabwriter.NewWriter(f.out, 0, 0, 2, ' ', 0)
+	for _, row := range rows {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n",
+			wideStatus(row.event),
+			RelativePackagePath(row.event.Package),
+			row.name,
+			wideElapsed(row.event))
+	}
+	return w.Flush()
+}
+
+// wideFormatUnaligned prints the same columns as the wide format, separated
+// by a single space, as soon as each test completes. It is used when the
+// output is not a terminal.
+func wideFormatUnaligned(out io.Writer, opts FormatOptions) EventFormatter {
+	buf := bufio.NewWriter(out)
+	nameWidth := wideNameWidth(opts)
+	return eventFormatterFunc(func(event TestEvent, _ *Execution) error {
+		if !event.Action.IsTerminal() {
+			return nil
+		}
+		columns := []string{wideStatus(event), RelativePackagePath(event.Package)}
+		if !event.PackageEvent() {
+			columns = append(columns, truncateName(event.Test, nameWidth))
+		}
+		columns = append(columns, wideElapsed(event))
+		buf.WriteString(strings.Join(columns, " ") + "\n")
+		return buf.Flush()
+	})
+}
+
+// wideStatus returns the status column. All the values have the same width,
+// so that the color codes do not change the alignment of the columns.
+func wideStatus(event TestEvent) string {
+	return colorEvent(event)(strings.ToUpper(string(event.Action)))
+}
+
+func wideElapsed(event TestEvent) string {
+	return fmt.Sprintf("%.2fs", event.Elapsed)
+}
+
+// truncateName shortens name to width characters, replacing the end of the
+// name with an ellipsis. A width less than 0 disables truncation.
+func truncateName(name string, width int) string {
+	runes := []rune(name)
+	if width < 0 || len(runes) <= width {
+		return name
+	}
+	if width <= 1 {
+		return "…"
+	}
+	return string(runes[:width-1]) + "…"
+}
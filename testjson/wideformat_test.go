@@ -0,0 +1,15 @@
+package testjson
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestTruncateName(t *testing.T) {
+	assert.Equal(t, truncateName("TestShort", 20), "TestShort")
+	assert.Equal(t, truncateName("TestExactly", 11), "TestExactly")
+	assert.Equal(t, truncateName("TestVeryLongName/with_sub", 10), "TestVeryL…")
+	assert.Equal(t, truncateName("TestÜnicödé", 6), "TestÜ…")
+	assert.Equal(t, truncateName("TestVeryLongName", -1), "TestVeryLongName")
+}